@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/console"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -68,6 +69,10 @@ It expects the genesis file as argument.`,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 			utils.GCModeFlag,
+			utils.AncientFlag,
+			utils.AncientDirFlag,
+			utils.AncientThresholdFlag,
+			utils.AncientCompressFlag,
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
 		},
@@ -86,6 +91,7 @@ processing will proceed even if an individual RLP-file import failure occurs.`,
 		ArgsUsage: "<filename> [<blockNumFirst> <blockNumLast>]",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.AncientDirFlag,
 			utils.CacheFlag,
 			utils.LightModeFlag,
 		},
@@ -125,6 +131,23 @@ The first argument must be the directory containing the blockchain to download f
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
 Remove blockchain and state databases`,
+	}
+	pruneStateCommand = cli.Command{
+		Action:    utils.MigrateFlags(pruneState),
+		Name:      "prune-state",
+		Usage:     "Delete the state not reachable from the recent blocks",
+		ArgsUsage: "[<recentBlocks>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientDirFlag,
+			utils.CacheFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The prune-state command deletes from the chain database every state trie node
+and contract code not reachable from the state of the given number of recent
+blocks (default 128) or of the genesis block. It must be run while the node is
+stopped, and resumes with the same state if interrupted.`,
 	}
 	dumpCommand = cli.Command{
 		Action:    utils.MigrateFlags(dump),
@@ -218,7 +241,7 @@ func importChain(ctx *cli.Context) error {
 	fmt.Printf("Import done in %v.\n\n", time.Since(start))
 
 	// Output pre-compaction stats mostly to see the import trashing
-	db := chainDb.(*ethdb.LDBDatabase)
+	db := ethdb.KeyValueStore(chainDb).(*ethdb.LDBDatabase)
 
 	stats, err := db.LDB().GetProperty("leveldb.stats")
 	if err != nil {
@@ -343,7 +366,7 @@ func copyDb(ctx *cli.Context) error {
 	// Compact the entire database to remove any sync overhead
 	start = time.Now()
 	fmt.Println("Compacting entire database...")
-	if err = chainDb.(*ethdb.LDBDatabase).LDB().CompactRange(util.Range{}); err != nil {
+	if err = ethdb.KeyValueStore(chainDb).(*ethdb.LDBDatabase).LDB().CompactRange(util.Range{}); err != nil {
 		utils.Fatalf("Compaction failed: %v", err)
 	}
 	fmt.Printf("Compaction done in %v.\n\n", time.Since(start))
@@ -380,6 +403,57 @@ func removeDB(ctx *cli.Context) error {
 	return nil
 }
 
+func pruneState(ctx *cli.Context) error {
+	if len(ctx.Args()) > 1 {
+		utils.Fatalf("This command requires at most one argument.")
+	}
+	recent := uint64(128)
+	if len(ctx.Args()) == 1 {
+		n, err := strconv.ParseUint(ctx.Args().First(), 10, 64)
+		if err != nil || n == 0 {
+			utils.Fatalf("Invalid number of recent blocks: %s", ctx.Args().First())
+		}
+		recent = n
+	}
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	db, ok := ethdb.KeyValueStore(chainDb).(*ethdb.LDBDatabase)
+	if !ok {
+		utils.Fatalf("State pruning requires a persistent database")
+	}
+	// Retain the state of the recent blocks found on disk, and of the genesis
+	var roots []common.Hash
+	head := core.GetBlock(chainDb, core.GetHeadBlockHash(chainDb), core.GetBlockNumber(chainDb, core.GetHeadBlockHash(chainDb)))
+	for block := head; block != nil && recent > 0; recent-- {
+		if ok, _ := db.Has(block.Root().Bytes()); ok {
+			roots = append(roots, block.Root())
+		}
+		if block.NumberU64() == 0 {
+			break
+		}
+		block = core.GetBlock(chainDb, block.ParentHash(), block.NumberU64()-1)
+	}
+	if len(roots) == 0 {
+		utils.Fatalf("No recent state found, refusing to prune")
+	}
+	if genesis := core.GetBlock(chainDb, core.GetCanonicalHash(chainDb, 0), 0); genesis != nil {
+		if ok, _ := db.Has(genesis.Root().Bytes()); ok {
+			roots = append(roots, genesis.Root())
+		}
+	}
+	p, err := pruner.NewPruner(db, roots)
+	if err != nil {
+		utils.Fatalf("Failed to create state pruner: %v", err)
+	}
+	log.Info("Pruning state", "head", head.Number(), "roots", len(p.Roots()))
+	if err := p.Prune(); err != nil {
+		utils.Fatalf("State pruning failed: %v", err)
+	}
+	return nil
+}
+
 func dump(ctx *cli.Context) error {
 	stack := makeFullNode(ctx)
 	chain, chainDb := utils.MakeChain(ctx, stack)
@@ -0,0 +1,236 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/console"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/olekukonko/tablewriter"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	dbLimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of entries to iterate (0 = unlimited)",
+		Value: 100,
+	}
+	dbFlags = []cli.Flag{
+		utils.DataDirFlag,
+		utils.AncientFlag,
+		utils.AncientDirFlag,
+		utils.AncientCompressFlag,
+		utils.CacheFlag,
+		utils.LightModeFlag,
+	}
+
+	dbCommand = cli.Command{
+		Name:      "db",
+		Usage:     "Low level database operations",
+		ArgsUsage: "",
+		Category:  "DATABASE COMMANDS",
+		Description: `
+Inspect the chain database, or look up and repair individual entries of it.
+
+Keys are interpreted as hexadecimal if prefixed with 0x, or as raw strings
+otherwise. The database must not be in use by a running node.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "inspect",
+				Usage:     "Report the number and size of the entries of every kind of data",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(inspectDB),
+				Category:  "DATABASE COMMANDS",
+				Flags:     dbFlags,
+				Description: `
+Iterates the whole chain database, and reports the number and size of the
+entries of every kind of data laid out by the database schema.`,
+			},
+			{
+				Name:      "get",
+				Usage:     "Show the value of a database entry",
+				ArgsUsage: "<key>",
+				Action:    utils.MigrateFlags(dbGet),
+				Category:  "DATABASE COMMANDS",
+				Flags:     dbFlags,
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a database entry",
+				ArgsUsage: "<key>",
+				Action:    utils.MigrateFlags(dbDelete),
+				Category:  "DATABASE COMMANDS",
+				Flags:     dbFlags,
+				Description: `
+Deletes a single entry of the chain database after confirmation. Deleting
+entries the node relies on corrupts the database, use with great care.`,
+			},
+			{
+				Name:      "iterate",
+				Usage:     "List the database entries with a key prefix",
+				ArgsUsage: "[<prefix> [<start>]]",
+				Action:    utils.MigrateFlags(dbIterate),
+				Category:  "DATABASE COMMANDS",
+				Flags:     append([]cli.Flag{dbLimitFlag}, dbFlags...),
+				Description: `
+Lists the entries whose key starts with the given prefix (all of them if none
+is given), optionally starting from the given key suffix.`,
+			},
+		},
+	}
+)
+
+// openChainDB opens the chain database of the node configured on the command
+// line, along with its underlying key-value store.
+func openChainDB(ctx *cli.Context) (ethdb.Database, *ethdb.LDBDatabase) {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+
+	db, ok := ethdb.KeyValueStore(chainDb).(*ethdb.LDBDatabase)
+	if !ok {
+		utils.Fatalf("Database operations require a persistent database")
+	}
+	return chainDb, db
+}
+
+// parseDBKey converts a command line argument into a database key.
+func parseDBKey(arg string) []byte {
+	if strings.HasPrefix(arg, "0x") || strings.HasPrefix(arg, "0X") {
+		key, err := hexutil.Decode(arg)
+		if err != nil {
+			utils.Fatalf("Invalid hex key %s: %v", arg, err)
+		}
+		return key
+	}
+	return []byte(arg)
+}
+
+func inspectDB(ctx *cli.Context) error {
+	if len(ctx.Args()) > 0 {
+		utils.Fatalf("This command requires no arguments.")
+	}
+	chainDb, _ := openChainDB(ctx)
+	defer chainDb.Close()
+
+	stats, err := core.InspectDatabase(chainDb)
+	if err != nil {
+		utils.Fatalf("Failed to inspect database: %v", err)
+	}
+	var (
+		total uint64
+		size  common.StorageSize
+	)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Database", "Category", "Items", "Size"})
+	for _, stat := range stats {
+		table.Append([]string{stat.Database, stat.Kind, fmt.Sprintf("%d", stat.Count), stat.Size.String()})
+		total += stat.Count
+		size += stat.Size
+	}
+	table.SetFooter([]string{"", "Total", fmt.Sprintf("%d", total), size.String()})
+	table.Render()
+
+	return nil
+}
+
+func dbGet(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a key argument.")
+	}
+	chainDb, db := openChainDB(ctx)
+	defer chainDb.Close()
+
+	key := parseDBKey(ctx.Args().First())
+	value, err := db.Get(key)
+	if err != nil {
+		utils.Fatalf("Failed to retrieve %#x: %v", key, err)
+	}
+	fmt.Printf("key %#x: %#x\n", key, value)
+	return nil
+}
+
+func dbDelete(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires a key argument.")
+	}
+	chainDb, db := openChainDB(ctx)
+	defer chainDb.Close()
+
+	key := parseDBKey(ctx.Args().First())
+	value, err := db.Get(key)
+	if err != nil {
+		utils.Fatalf("Failed to retrieve %#x: %v", key, err)
+	}
+	fmt.Printf("key %#x: %#x\n", key, value)
+
+	confirm, err := console.Stdin.PromptConfirm("Delete this entry?")
+	switch {
+	case err != nil:
+		utils.Fatalf("%v", err)
+	case !confirm:
+		log.Warn("Entry deletion aborted")
+	default:
+		if err := db.Delete(key); err != nil {
+			utils.Fatalf("Failed to delete %#x: %v", key, err)
+		}
+		log.Info("Entry successfully deleted", "key", hexutil.Encode(key))
+	}
+	return nil
+}
+
+func dbIterate(ctx *cli.Context) error {
+	if len(ctx.Args()) > 2 {
+		utils.Fatalf("This command requires at most two arguments.")
+	}
+	chainDb, db := openChainDB(ctx)
+	defer chainDb.Close()
+
+	var prefix, start []byte
+	if len(ctx.Args()) > 0 {
+		prefix = parseDBKey(ctx.Args().Get(0))
+	}
+	if len(ctx.Args()) > 1 {
+		start = parseDBKey(ctx.Args().Get(1))
+	}
+	rng := util.BytesPrefix(prefix)
+	if len(start) > 0 {
+		rng.Start = append(append([]byte{}, prefix...), start...)
+	}
+	it := db.LDB().NewIterator(rng, nil)
+	defer it.Release()
+
+	limit := ctx.Int(dbLimitFlag.Name)
+	for count := 0; it.Next(); count++ {
+		if limit > 0 && count >= limit {
+			log.Info("Iteration limit reached", "limit", limit, "next", hexutil.Encode(it.Key()))
+			break
+		}
+		fmt.Printf("%#x: %#x\n", it.Key(), it.Value())
+	}
+	return it.Error()
+}
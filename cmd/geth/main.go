@@ -73,6 +73,7 @@ var (
 		utils.EthashDatasetsOnDiskFlag,
 		utils.TxPoolNoLocalsFlag,
 		utils.TxPoolJournalFlag,
+		utils.TxPoolJournalRemotesFlag,
 		utils.TxPoolRejournalFlag,
 		utils.TxPoolPriceLimitFlag,
 		utils.TxPoolPriceBumpFlag,
@@ -85,6 +86,11 @@ var (
 		utils.LightModeFlag,
 		utils.SyncModeFlag,
 		utils.GCModeFlag,
+		utils.TxLookupLimitFlag,
+		utils.AncientFlag,
+		utils.AncientDirFlag,
+		utils.AncientThresholdFlag,
+		utils.AncientCompressFlag,
 		utils.LightServFlag,
 		utils.LightPeersFlag,
 		utils.LightKDFFlag,
@@ -92,6 +98,7 @@ var (
 		utils.CacheDatabaseFlag,
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
+		utils.SnapshotFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -117,6 +124,7 @@ var (
 		utils.RPCVirtualHostsFlag,
 		utils.EthStatsURLFlag,
 		utils.MetricsEnabledFlag,
+		utils.SlowBlockFlag,
 		utils.FakePoWFlag,
 		utils.NoCompactionFlag,
 		utils.GpoBlocksFlag,
@@ -124,6 +132,9 @@ var (
 		utils.ExtraDataFlag,
 		configFileFlag,
 		utils.IstanbulRequestTimeoutFlag,
+		utils.IstanbulCommitTimeoutFlag,
+		utils.IstanbulRoundTimeoutIncrementFlag,
+		utils.IstanbulMaxRoundTimeoutFlag,
 		utils.IstanbulBlockPeriodFlag,
 	}
 
@@ -139,6 +150,8 @@ var (
 		utils.WSAllowedOriginsFlag,
 		utils.IPCDisabledFlag,
 		utils.IPCPathFlag,
+		utils.LogsBlockRangeFlag,
+		utils.LogsLimitFlag,
 	}
 
 	whisperFlags = []cli.Flag{
@@ -160,7 +173,10 @@ func init() {
 		exportCommand,
 		copydbCommand,
 		removedbCommand,
+		pruneStateCommand,
 		dumpCommand,
+		// See dbcmd.go:
+		dbCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
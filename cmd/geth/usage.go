@@ -77,6 +77,11 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.OttomanFlag,
 			utils.SyncModeFlag,
 			utils.GCModeFlag,
+			utils.TxLookupLimitFlag,
+			utils.AncientFlag,
+			utils.AncientDirFlag,
+			utils.AncientThresholdFlag,
+			utils.AncientCompressFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightServFlag,
@@ -116,6 +121,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Flags: []cli.Flag{
 			utils.TxPoolNoLocalsFlag,
 			utils.TxPoolJournalFlag,
+			utils.TxPoolJournalRemotesFlag,
 			utils.TxPoolRejournalFlag,
 			utils.TxPoolPriceLimitFlag,
 			utils.TxPoolPriceBumpFlag,
@@ -133,6 +139,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
 			utils.TrieCacheGenFlag,
+			utils.SnapshotFlag,
 		},
 	},
 	{
@@ -158,6 +165,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.IPCPathFlag,
 			utils.RPCCORSDomainFlag,
 			utils.RPCVirtualHostsFlag,
+			utils.LogsBlockRangeFlag,
+			utils.LogsLimitFlag,
 			utils.JSpathFlag,
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
@@ -208,6 +217,7 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "LOGGING AND DEBUGGING",
 		Flags: append([]cli.Flag{
 			utils.MetricsEnabledFlag,
+			utils.SlowBlockFlag,
 			utils.FakePoWFlag,
 			utils.NoCompactionFlag,
 		}, debug.Flags...),
@@ -230,6 +240,9 @@ var AppHelpFlagGroups = []flagGroup{
 		Name: "ISTANBUL",
 		Flags: []cli.Flag{
 			utils.IstanbulRequestTimeoutFlag,
+			utils.IstanbulCommitTimeoutFlag,
+			utils.IstanbulRoundTimeoutIncrementFlag,
+			utils.IstanbulMaxRoundTimeoutFlag,
 			utils.IstanbulBlockPeriodFlag,
 		},
 	},
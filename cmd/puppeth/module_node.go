@@ -27,6 +27,7 @@ import (
 	"text/template"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -38,11 +39,13 @@ ADD genesis.json /genesis.json
 {{if .Unlock}}
 	ADD signer.json /signer.json
 	ADD signer.pass /signer.pass
+{{end}}{{if .NodeKey}}
+	ADD nodekey /nodekey
 {{end}}
 RUN \
   echo 'geth --cache 512 init /genesis.json' > geth.sh && \{{if .Unlock}}
 	echo 'mkdir -p /root/.ethereum/keystore/ && cp /signer.json /root/.ethereum/keystore/' >> geth.sh && \{{end}}
-	echo $'geth --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --maxpeers {{.Peers}} {{.LightFlag}} --ethstats \'{{.Ethstats}}\' {{if .Bootnodes}}--bootnodes {{.Bootnodes}}{{end}} {{if .Etherbase}}--etherbase {{.Etherbase}} --mine --minerthreads 1{{end}} {{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} --targetgaslimit {{.GasTarget}} --gasprice {{.GasPrice}}' >> geth.sh
+	echo $'geth --networkid {{.NetworkID}} --cache 512 --port {{.Port}} --maxpeers {{.Peers}} {{.LightFlag}} --ethstats \'{{.Ethstats}}\' {{if .Bootnodes}}--bootnodes {{.Bootnodes}}{{end}} {{if .Etherbase}}--etherbase {{.Etherbase}} --mine --minerthreads 1{{end}} {{if .Unlock}}--unlock 0 --password /signer.pass --mine{{end}} {{if .NodeKey}}--nodekey /nodekey --mine --istanbul.blockperiod {{.BlockPeriod}} --istanbul.requesttimeout {{.RequestTimeout}}{{end}} --targetgaslimit {{.GasTarget}} --gasprice {{.GasPrice}}' >> geth.sh
 
 ENTRYPOINT ["/bin/sh", "geth.sh"]
 `
@@ -68,7 +71,9 @@ services:
       - STATS_NAME={{.Ethstats}}
       - MINER_NAME={{.Etherbase}}
       - GAS_TARGET={{.GasTarget}}
-      - GAS_PRICE={{.GasPrice}}
+      - GAS_PRICE={{.GasPrice}}{{if .NodeKey}}
+      - BLOCK_PERIOD={{.BlockPeriod}}
+      - REQUEST_TIMEOUT={{.RequestTimeout}}{{end}}
     logging:
       driver: "json-file"
       options:
@@ -82,7 +87,7 @@ services:
 // already exists there, it will be overwritten!
 func deployNode(client *sshClient, network string, bootnodes []string, config *nodeInfos, nocache bool) ([]byte, error) {
 	kind := "sealnode"
-	if config.keyJSON == "" && config.etherbase == "" {
+	if config.keyJSON == "" && config.etherbase == "" && config.nodeKey == "" {
 		kind = "bootnode"
 		bootnodes = make([]string, 0)
 	}
@@ -106,6 +111,10 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		"GasTarget": uint64(1000000 * config.gasTarget),
 		"GasPrice":  uint64(1000000000 * config.gasPrice),
 		"Unlock":    config.keyJSON != "",
+		"NodeKey":   config.nodeKey != "",
+
+		"BlockPeriod":    config.blockPeriod,
+		"RequestTimeout": config.requestTimeout,
 	})
 	files[filepath.Join(workdir, "Dockerfile")] = dockerfile.Bytes()
 
@@ -123,6 +132,10 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		"Etherbase":  config.etherbase,
 		"GasTarget":  config.gasTarget,
 		"GasPrice":   config.gasPrice,
+		"NodeKey":    config.nodeKey != "",
+
+		"BlockPeriod":    config.blockPeriod,
+		"RequestTimeout": config.requestTimeout,
 	})
 	files[filepath.Join(workdir, "docker-compose.yaml")] = composefile.Bytes()
 
@@ -131,6 +144,9 @@ func deployNode(client *sshClient, network string, bootnodes []string, config *n
 		files[filepath.Join(workdir, "signer.json")] = []byte(config.keyJSON)
 		files[filepath.Join(workdir, "signer.pass")] = []byte(config.keyPass)
 	}
+	if config.nodeKey != "" {
+		files[filepath.Join(workdir, "nodekey")] = []byte(config.nodeKey)
+	}
 	// Upload the deployment files to the remote server (and clean up afterwards)
 	if out, err := client.Upload(files); err != nil {
 		return out, err
@@ -161,6 +177,10 @@ type nodeInfos struct {
 	keyPass    string
 	gasTarget  float64
 	gasPrice   float64
+
+	nodeKey        string // Hex encoded node key of an Istanbul validator
+	blockPeriod    uint64 // Minimum number of seconds between Istanbul blocks
+	requestTimeout uint64 // Istanbul round timeout in milliseconds
 }
 
 // Report converts the typed struct into a plain string->string map, containing
@@ -194,6 +214,16 @@ func (info *nodeInfos) Report() map[string]string {
 				log.Error("Failed to retrieve signer address", "err", err)
 			}
 		}
+		if info.nodeKey != "" {
+			// Istanbul byzantine fault tolerant validator
+			if key, err := crypto.HexToECDSA(info.nodeKey); err == nil {
+				report["Validator account"] = crypto.PubkeyToAddress(key.PublicKey).Hex()
+			} else {
+				log.Error("Failed to retrieve validator address", "err", err)
+			}
+			report["Block period (minimum)"] = fmt.Sprintf("%d s", info.blockPeriod)
+			report["Request timeout (round)"] = fmt.Sprintf("%d ms", info.requestTimeout)
+		}
 	}
 	return report
 }
@@ -218,6 +248,8 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 	lightPeers, _ := strconv.Atoi(infos.envvars["LIGHT_PEERS"])
 	gasTarget, _ := strconv.ParseFloat(infos.envvars["GAS_TARGET"], 64)
 	gasPrice, _ := strconv.ParseFloat(infos.envvars["GAS_PRICE"], 64)
+	blockPeriod, _ := strconv.ParseUint(infos.envvars["BLOCK_PERIOD"], 10, 64)
+	requestTimeout, _ := strconv.ParseUint(infos.envvars["REQUEST_TIMEOUT"], 10, 64)
 
 	// Container available, retrieve its node ID and its genesis json
 	var out []byte
@@ -238,6 +270,10 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 	if out, err = client.Run(fmt.Sprintf("docker exec %s_%s_1 cat /signer.pass", network, kind)); err == nil {
 		keyPass = string(bytes.TrimSpace(out))
 	}
+	nodeKey := ""
+	if out, err = client.Run(fmt.Sprintf("docker exec %s_%s_1 cat /nodekey", network, kind)); err == nil {
+		nodeKey = string(bytes.TrimSpace(out))
+	}
 	// Run a sanity check to see if the devp2p is reachable
 	port := infos.portmap[infos.envvars["PORT"]]
 	if err = checkPort(client.server, port); err != nil {
@@ -257,6 +293,10 @@ func checkNode(client *sshClient, network string, boot bool) (*nodeInfos, error)
 		keyPass:    keyPass,
 		gasTarget:  gasTarget,
 		gasPrice:   gasPrice,
+
+		nodeKey:        nodeKey,
+		blockPeriod:    blockPeriod,
+		requestTimeout: requestTimeout,
 	}
 	stats.enode = fmt.Sprintf("enode://%s@%s:%d", id, client.address, stats.port)
 
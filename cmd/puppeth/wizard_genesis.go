@@ -26,9 +26,12 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // makeGenesis creates a new genesis struct based on some user input.
@@ -52,6 +55,7 @@ func (w *wizard) makeGenesis() {
 	fmt.Println("Which consensus engine to use? (default = clique)")
 	fmt.Println(" 1. Ethash - proof-of-work")
 	fmt.Println(" 2. Clique - proof-of-authority")
+	fmt.Println(" 3. Istanbul - practical byzantine fault tolerance")
 
 	choice := w.read()
 	switch {
@@ -98,6 +102,56 @@ func (w *wizard) makeGenesis() {
 			copy(genesis.ExtraData[32+i*common.AddressLength:], signer[:])
 		}
 
+	case choice == "3":
+		// In the case of istanbul, configure the consensus parameters
+		genesis.Difficulty = big.NewInt(1)
+		genesis.Mixhash = types.IstanbulDigest
+		genesis.Config.Istanbul = &params.IstanbulConfig{
+			Epoch:          30000,
+			ProposerPolicy: uint64(istanbul.RoundRobin),
+		}
+		fmt.Println()
+		fmt.Println("How many blocks should a voting epoch last? (default = 30000)")
+		genesis.Config.Istanbul.Epoch = uint64(w.readDefaultInt(30000))
+
+		fmt.Println()
+		fmt.Println("Which proposer policy to use? (default = round-robin)")
+		fmt.Println(" 1. Round-robin - the proposer changes after every block")
+		fmt.Println(" 2. Sticky - the proposer changes only on round change")
+
+		switch policy := w.read(); {
+		case policy == "" || policy == "1":
+			genesis.Config.Istanbul.ProposerPolicy = uint64(istanbul.RoundRobin)
+		case policy == "2":
+			genesis.Config.Istanbul.ProposerPolicy = uint64(istanbul.Sticky)
+		default:
+			log.Crit("Invalid proposer policy choice", "choice", policy)
+		}
+		// We also need the initial list of validators
+		fmt.Println()
+		fmt.Println("Which accounts are allowed to validate? (mandatory at least one)")
+
+		var validators []common.Address
+		for {
+			if address := w.readAddress(); address != nil {
+				validators = append(validators, *address)
+				continue
+			}
+			if len(validators) > 0 {
+				break
+			}
+		}
+		// Embed the validators into the extra-data section after an empty vanity
+		extra, err := rlp.EncodeToBytes(&types.IstanbulExtra{
+			Validators:    validators,
+			Seal:          []byte{},
+			CommittedSeal: [][]byte{},
+		})
+		if err != nil {
+			log.Crit("Failed to encode istanbul extra-data", "err", err)
+		}
+		genesis.ExtraData = append(make([]byte, types.IstanbulExtraVanity), extra...)
+
 	default:
 		log.Crit("Invalid consensus engine choice", "choice", choice)
 	}
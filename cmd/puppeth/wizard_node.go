@@ -23,6 +23,10 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 )
 
@@ -52,6 +56,10 @@ func (w *wizard) deployNode(boot bool) {
 		} else {
 			infos = &nodeInfos{port: 30303, peersTotal: 50, peersLight: 0, gasTarget: 4.7, gasPrice: 18}
 		}
+		if w.conf.Genesis.Config.Istanbul != nil {
+			infos.blockPeriod = istanbul.DefaultConfig.BlockPeriod
+			infos.requestTimeout = istanbul.DefaultConfig.RequestTimeout
+		}
 	}
 	existed := err == nil
 
@@ -146,6 +154,42 @@ func (w *wizard) deployNode(boot bool) {
 					return
 				}
 			}
+		} else if w.conf.Genesis.Config.Istanbul != nil {
+			// If a previous validator was already set, offer to reuse it
+			if infos.nodeKey != "" {
+				if key, err := crypto.HexToECDSA(infos.nodeKey); err != nil {
+					infos.nodeKey = ""
+				} else {
+					fmt.Println()
+					fmt.Printf("Reuse previous (%s) validator account (y/n)? (default = yes)\n", crypto.PubkeyToAddress(key.PublicKey).Hex())
+					if w.readDefaultString("y") != "y" {
+						infos.nodeKey = ""
+					}
+				}
+			}
+			// Istanbul validators sign with their node key, ask if unavailable
+			if infos.nodeKey == "" {
+				fmt.Println()
+				fmt.Println("Please paste the validator's hex node key: (won't be echoed)")
+				infos.nodeKey = w.readPassword()
+
+				key, err := crypto.HexToECDSA(infos.nodeKey)
+				if err != nil {
+					log.Error("Failed to parse validator node key", "err", err)
+					return
+				}
+				if !isIstanbulValidator(w.conf.Genesis, crypto.PubkeyToAddress(key.PublicKey)) {
+					log.Warn("Node key is not a genesis validator", "address", crypto.PubkeyToAddress(key.PublicKey))
+				}
+			}
+			// Establish the block production pace enforced by the validator
+			fmt.Println()
+			fmt.Printf("How many seconds should blocks take at minimum? (default = %d)\n", infos.blockPeriod)
+			infos.blockPeriod = uint64(w.readDefaultInt(int(infos.blockPeriod)))
+
+			fmt.Println()
+			fmt.Printf("How many milliseconds should a consensus round last? (default = %d)\n", infos.requestTimeout)
+			infos.requestTimeout = uint64(w.readDefaultInt(int(infos.requestTimeout)))
 		}
 		// Establish the gas dynamics to be enforced by the signer
 		fmt.Println()
@@ -176,3 +220,18 @@ func (w *wizard) deployNode(boot bool) {
 
 	w.networkStats()
 }
+
+// isIstanbulValidator checks whether the given address is part of the initial
+// validator set embedded into an Istanbul genesis block.
+func isIstanbulValidator(genesis *core.Genesis, address common.Address) bool {
+	extra, err := types.ExtractIstanbulExtra(&types.Header{Extra: genesis.ExtraData})
+	if err != nil {
+		return false
+	}
+	for _, validator := range extra.Validators {
+		if validator == address {
+			return true
+		}
+	}
+	return false
+}
@@ -42,6 +42,7 @@ import (
 	"github.com/ethereum/go-ethereum/dashboard"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/ethstats"
@@ -179,6 +180,27 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	TxLookupLimitFlag = cli.Uint64Flag{
+		Name:  "txlookuplimit",
+		Usage: "Number of recent blocks to index the transactions of (0 = all blocks)",
+	}
+	AncientFlag = cli.BoolFlag{
+		Name:  "ancient",
+		Usage: "Move the blocks past the ancient threshold into append-only flat files",
+	}
+	AncientDirFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Data directory for the ancient blocks (default = inside chaindata)",
+	}
+	AncientThresholdFlag = cli.Uint64Flag{
+		Name:  "ancient.threshold",
+		Usage: "Number of recent blocks kept in the chain database when moving ancient blocks",
+		Value: eth.DefaultConfig.AncientThreshold,
+	}
+	AncientCompressFlag = cli.BoolFlag{
+		Name:  "ancient.compress",
+		Usage: "Snappy compress the headers, bodies and receipts of new ancient stores",
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -253,6 +275,10 @@ var (
 		Usage: "Disk journal for local transaction to survive node restarts",
 		Value: core.DefaultTxPoolConfig.Journal,
 	}
+	TxPoolJournalRemotesFlag = cli.BoolFlag{
+		Name:  "txpool.journalremotes",
+		Usage: "Journal the remote transactions too, restoring the whole pool on restart",
+	}
 	TxPoolRejournalFlag = cli.DurationFlag{
 		Name:  "txpool.rejournal",
 		Usage: "Time interval to regenerate the local transaction journal",
@@ -314,6 +340,10 @@ var (
 		Usage: "Number of trie node generations to keep in memory",
 		Value: int(state.MaxTrieCacheGen),
 	}
+	SnapshotFlag = cli.BoolFlag{
+		Name:  "snapshot",
+		Usage: "Maintain a flat snapshot of the recent states for faster state reads",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -368,6 +398,10 @@ var (
 		Name:  metrics.MetricsEnabledFlag,
 		Usage: "Enable metrics collection and reporting",
 	}
+	SlowBlockFlag = cli.DurationFlag{
+		Name:  "slowblock",
+		Usage: "Log the import statistics of the blocks taking longer than this to import (0 = disabled)",
+	}
 	FakePoWFlag = cli.BoolFlag{
 		Name:  "fakepow",
 		Usage: "Disables proof-of-work verification",
@@ -414,6 +448,16 @@ var (
 		Name:  "ipcpath",
 		Usage: "Filename for IPC socket/pipe within the datadir (explicit paths escape it)",
 	}
+	LogsBlockRangeFlag = cli.Uint64Flag{
+		Name:  "logs.blockrange",
+		Usage: "Maximum number of blocks searched by a log query, longer ones need paging (0 = unlimited)",
+		Value: eth.DefaultConfig.Filters.BlockRange,
+	}
+	LogsLimitFlag = cli.IntFlag{
+		Name:  "logs.limit",
+		Usage: "Maximum number of logs returned by a log query, more need paging (0 = unlimited)",
+		Value: eth.DefaultConfig.Filters.ResultLimit,
+	}
 	WSEnabledFlag = cli.BoolFlag{
 		Name:  "ws",
 		Usage: "Enable the WS-RPC server",
@@ -543,6 +587,21 @@ var (
 		Usage: "Timeout for each Istanbul round in milliseconds",
 		Value: eth.DefaultConfig.Istanbul.RequestTimeout,
 	}
+	IstanbulCommitTimeoutFlag = cli.Uint64Flag{
+		Name:  "istanbul.committimeout",
+		Usage: "Timeout for committing an accepted proposal in milliseconds (0 = until the round timeout)",
+		Value: eth.DefaultConfig.Istanbul.CommitTimeout,
+	}
+	IstanbulRoundTimeoutIncrementFlag = cli.Uint64Flag{
+		Name:  "istanbul.roundtimeoutincrement",
+		Usage: "Timeout added for every round change in milliseconds (0 = exponential backoff)",
+		Value: eth.DefaultConfig.Istanbul.RoundTimeoutIncrement,
+	}
+	IstanbulMaxRoundTimeoutFlag = cli.Uint64Flag{
+		Name:  "istanbul.maxroundtimeout",
+		Usage: "Maximum timeout of an Istanbul round in milliseconds (0 = unbounded)",
+		Value: eth.DefaultConfig.Istanbul.MaxRoundTimeout,
+	}
 	IstanbulBlockPeriodFlag = cli.Uint64Flag{
 		Name:  "istanbul.blockperiod",
 		Usage: "Default minimum difference between two consecutive block's timestamps in seconds",
@@ -930,6 +989,15 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	}
 }
 
+func setFilters(ctx *cli.Context, cfg *filters.Config) {
+	if ctx.GlobalIsSet(LogsBlockRangeFlag.Name) {
+		cfg.BlockRange = ctx.GlobalUint64(LogsBlockRangeFlag.Name)
+	}
+	if ctx.GlobalIsSet(LogsLimitFlag.Name) {
+		cfg.ResultLimit = ctx.GlobalInt(LogsLimitFlag.Name)
+	}
+}
+
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolNoLocalsFlag.Name) {
 		cfg.NoLocals = ctx.GlobalBool(TxPoolNoLocalsFlag.Name)
@@ -937,6 +1005,9 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolJournalFlag.Name) {
 		cfg.Journal = ctx.GlobalString(TxPoolJournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolJournalRemotesFlag.Name) {
+		cfg.JournalRemotes = ctx.GlobalBool(TxPoolJournalRemotesFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
@@ -988,6 +1059,15 @@ func setIstanbul(ctx *cli.Context, cfg *eth.Config) {
 	if ctx.GlobalIsSet(IstanbulRequestTimeoutFlag.Name) {
 		cfg.Istanbul.RequestTimeout = ctx.GlobalUint64(IstanbulRequestTimeoutFlag.Name)
 	}
+	if ctx.GlobalIsSet(IstanbulCommitTimeoutFlag.Name) {
+		cfg.Istanbul.CommitTimeout = ctx.GlobalUint64(IstanbulCommitTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(IstanbulRoundTimeoutIncrementFlag.Name) {
+		cfg.Istanbul.RoundTimeoutIncrement = ctx.GlobalUint64(IstanbulRoundTimeoutIncrementFlag.Name)
+	}
+	if ctx.GlobalIsSet(IstanbulMaxRoundTimeoutFlag.Name) {
+		cfg.Istanbul.MaxRoundTimeout = ctx.GlobalUint64(IstanbulMaxRoundTimeoutFlag.Name)
+	}
 	if ctx.GlobalIsSet(IstanbulBlockPeriodFlag.Name) {
 		cfg.Istanbul.BlockPeriod = ctx.GlobalUint64(IstanbulBlockPeriodFlag.Name)
 	}
@@ -1052,6 +1132,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
+	setFilters(ctx, &cfg.Filters)
 	setTxPool(ctx, &cfg.TxPool)
 	setEthash(ctx, cfg)
 	setIstanbul(ctx, cfg)
@@ -1083,10 +1164,32 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
 	}
 	cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
+	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
+		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(SlowBlockFlag.Name) {
+		cfg.SlowBlockThreshold = ctx.GlobalDuration(SlowBlockFlag.Name)
+	}
+
+	if ctx.GlobalIsSet(AncientFlag.Name) {
+		cfg.Ancient = ctx.GlobalBool(AncientFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientDirFlag.Name) {
+		cfg.AncientDir = ctx.GlobalString(AncientDirFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientThresholdFlag.Name) {
+		cfg.AncientThreshold = ctx.GlobalUint64(AncientThresholdFlag.Name)
+	}
+	if ctx.GlobalIsSet(AncientCompressFlag.Name) {
+		cfg.AncientCompress = ctx.GlobalBool(AncientCompressFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if ctx.GlobalIsSet(SnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalBool(SnapshotFlag.Name)
+	}
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
@@ -1233,6 +1336,10 @@ func MakeChainDatabase(ctx *cli.Context, stack *node.Node) ethdb.Database {
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
+	dir := stack.ResolvePath(eth.AncientDir(name, ctx.GlobalString(AncientDirFlag.Name)))
+	if chainDb, err = eth.OpenAncients(chainDb, dir, ctx.GlobalBool(AncientFlag.Name), ctx.GlobalBool(AncientCompressFlag.Name)); err != nil {
+		Fatalf("Could not open ancient database: %v", err)
+	}
 	return chainDb
 }
 
@@ -1283,6 +1390,12 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
 		TrieNodeLimit: eth.DefaultConfig.TrieCache,
 		TrieTimeLimit: eth.DefaultConfig.TrieTimeout,
+
+		AncientThreshold: ctx.GlobalUint64(AncientThresholdFlag.Name),
+		Snapshot:         ctx.GlobalBool(SnapshotFlag.Name),
+		TxLookupLimit:    ctx.GlobalUint64(TxLookupLimitFlag.Name),
+
+		SlowBlockThreshold: ctx.GlobalDuration(SlowBlockFlag.Name),
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -0,0 +1,113 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package mclock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Simulated implements a virtual Clock for reproducible time-sensitive tests. It
+// simulates a scheduler on a virtual timescale where actual processing takes zero
+// time. Timers only fire from within Run, on the goroutine calling it, in the
+// order of their deadlines (and of their creation for equal deadlines).
+//
+// The zero value is a usable clock starting at time zero.
+type Simulated struct {
+	now       AbsTime
+	scheduled []*simTimer
+	seq       uint64
+	mu        sync.Mutex
+}
+
+// simTimer implements Timer on the virtual clock.
+type simTimer struct {
+	at  AbsTime
+	seq uint64
+	fn  func()
+	s   *Simulated
+}
+
+// Now returns the current virtual time.
+func (s *Simulated) Now() AbsTime {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.now
+}
+
+// AfterFunc schedules f to run on the goroutine calling Run once the duration
+// has elapsed on the virtual clock.
+func (s *Simulated) AfterFunc(d time.Duration, f func()) Timer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d < 0 {
+		d = 0
+	}
+	t := &simTimer{at: s.now + AbsTime(d), seq: s.seq, fn: f, s: s}
+	s.seq++
+
+	i := sort.Search(len(s.scheduled), func(i int) bool {
+		return s.scheduled[i].at > t.at
+	})
+	s.scheduled = append(s.scheduled, nil)
+	copy(s.scheduled[i+1:], s.scheduled[i:])
+	s.scheduled[i] = t
+	return t
+}
+
+// Run moves the clock by the given duration, executing all timers before that
+// duration, including the ones scheduled by the executed timers themselves.
+func (s *Simulated) Run(d time.Duration) {
+	s.mu.Lock()
+	end := s.now + AbsTime(d)
+	for len(s.scheduled) > 0 && s.scheduled[0].at <= end {
+		t := s.scheduled[0]
+		s.scheduled = s.scheduled[1:]
+		s.now = t.at
+
+		s.mu.Unlock()
+		t.fn()
+		s.mu.Lock()
+	}
+	s.now = end
+	s.mu.Unlock()
+}
+
+// ActiveTimers returns the number of timers that haven't fired.
+func (s *Simulated) ActiveTimers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.scheduled)
+}
+
+// Stop cancels the timer, returning false if it already fired or was stopped.
+func (t *simTimer) Stop() bool {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+
+	for i, st := range t.s.scheduled {
+		if st == t {
+			t.s.scheduled = append(t.s.scheduled[:i], t.s.scheduled[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
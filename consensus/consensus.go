@@ -22,6 +22,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"math/big"
@@ -113,6 +114,14 @@ type Handler interface {
 	SetBroadcaster(Broadcaster)
 }
 
+// Overlay should be implemented if the consensus keeps direct connections
+// between the block producers
+type Overlay interface {
+	// SetPeerManager sets the peer manager to connect to the block producers
+	// of the given chain, starting with the given known nodes
+	SetPeerManager(manager PeerManager, chain ChainReader, nodes []*discover.Node)
+}
+
 // PoW is a consensus engine based on proof-of-work.
 type PoW interface {
 	Engine
@@ -41,9 +41,9 @@ type Backend interface {
 	// Gossip sends a message to all validators (exclude self)
 	Gossip(valSet ValidatorSet, payload []byte) error
 
-	// Commit delivers an approved proposal to backend.
-	// The delivered proposal will be put into blockchain.
-	Commit(proposal Proposal, seals [][]byte) error
+	// Commit delivers an approved proposal to backend, along with the committed
+	// seals of the given signers. The delivered proposal will be put into blockchain.
+	Commit(proposal Proposal, seals [][]byte, signers []common.Address) error
 
 	// Verify verifies the proposal. If a consensus.ErrFutureBlock error is returned,
 	// the time difference of the proposal and current time is also returned.
@@ -56,6 +56,15 @@ type Backend interface {
 	// the given validator
 	CheckSignature(data []byte, addr common.Address, sig []byte) error
 
+	// SignCommittedSeal creates the committed seal of the proposal with the
+	// backend's private key
+	SignCommittedSeal(proposal Proposal) ([]byte, error)
+
+	// VerifyCommittedSeals verifies the committed seals of the proposal made by
+	// the given signers, at once where possible, and returns the signers whose
+	// seals are invalid
+	VerifyCommittedSeals(proposal Proposal, seals [][]byte, signers []common.Address) ([]common.Address, error)
+
 	// LastProposal retrieves latest committed proposal and the address of proposer
 	LastProposal() (Proposal, common.Address)
 
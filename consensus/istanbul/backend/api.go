@@ -17,9 +17,15 @@
 package backend
 
 import (
+	"context"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -106,6 +112,23 @@ func (api *API) Propose(address common.Address, auth bool) {
 	defer api.istanbul.candidatesLock.Unlock()
 
 	api.istanbul.candidates[address] = auth
+	delete(api.istanbul.candidateWeights, address)
+	delete(api.istanbul.candidateKeys, address)
+}
+
+// ProposeWeight injects a new candidate that the validator will attempt to push
+// through with the given voting power, or a new voting power for an existing
+// validator.
+func (api *API) ProposeWeight(address common.Address, weight uint64) error {
+	if weight == 0 || weight > maxVoteWeight {
+		return errInvalidVote
+	}
+	api.istanbul.candidatesLock.Lock()
+	defer api.istanbul.candidatesLock.Unlock()
+
+	api.istanbul.candidates[address] = true
+	api.istanbul.candidateWeights[address] = weight
+	return nil
 }
 
 // Discard drops a currently running candidate, stopping the validator from casting
@@ -115,4 +138,113 @@ func (api *API) Discard(address common.Address) {
 	defer api.istanbul.candidatesLock.Unlock()
 
 	delete(api.istanbul.candidates, address)
+	delete(api.istanbul.candidateWeights, address)
+	delete(api.istanbul.candidateKeys, address)
+}
+
+// BLSKey returns the BLS public key of the validator followed by its proof of
+// possession, for the other validators to register it through ProposeBLSKey.
+func (api *API) BLSKey() (hexutil.Bytes, error) {
+	return api.istanbul.blsKeyRegistration()
+}
+
+// ProposeBLSKey injects a new BLS key registration that the validator will attempt
+// to push through, authorizing the account if it isn't a validator yet. The key is
+// the output of BLSKey on the account's node.
+func (api *API) ProposeBLSKey(address common.Address, key hexutil.Bytes) error {
+	if _, err := decodeBLSKey(key); err != nil {
+		return err
+	}
+	api.istanbul.candidatesLock.Lock()
+	defer api.istanbul.candidatesLock.Unlock()
+
+	api.istanbul.candidates[address] = true
+	api.istanbul.candidateKeys[address] = common.CopyBytes(key)
+	return nil
+}
+
+// GetEvidence retrieves the proofs of equivocation collected by the validator,
+// optionally restricted to a single offending validator.
+func (api *API) GetEvidence(offender *common.Address) []*istanbul.Evidence {
+	evidence := make([]*istanbul.Evidence, 0)
+	for _, e := range api.istanbul.core.Evidence() {
+		if offender == nil || e.Offender == *offender {
+			evidence = append(evidence, e)
+		}
+	}
+	return evidence
+}
+
+// Status retrieves the current state of the local consensus engine, such as the
+// view being agreed on, the collected votes and the queued future messages.
+func (api *API) Status() (*istanbulCore.Status, error) {
+	status := api.istanbul.core.Status()
+	if status == nil {
+		return nil, istanbul.ErrStoppedEngine
+	}
+	return status, nil
+}
+
+// consensusEventQueueSize is the number of consensus events queued for a single
+// subscriber before new ones are dropped.
+const consensusEventQueueSize = 256
+
+// consensusEvent is a notification sent to the consensus event subscribers.
+type consensusEvent struct {
+	Type  string      `json:"type"`
+	Event interface{} `json:"event"`
+}
+
+// ConsensusEvents creates a subscription that streams the state transitions and
+// the round changes of the local consensus engine.
+func (api *API) ConsensusEvents(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	events := api.istanbul.istanbulEventMux.Subscribe(istanbulCore.StateEvent{}, istanbulCore.RoundChangeEvent{})
+	go func() {
+		defer events.Unsubscribe()
+
+		// The consensus engine posts the events synchronously, so never wait for the
+		// client here. Notifications are queued for a separate sender and dropped
+		// once the queue is full.
+		queue := make(chan *consensusEvent, consensusEventQueueSize)
+		defer close(queue)
+
+		go func() {
+			for ev := range queue {
+				notifier.Notify(rpcSub.ID, ev)
+			}
+		}()
+		for {
+			select {
+			case ev, ok := <-events.Chan():
+				if !ok {
+					return
+				}
+				var notification *consensusEvent
+				switch ev.Data.(type) {
+				case istanbulCore.StateEvent:
+					notification = &consensusEvent{Type: "state", Event: ev.Data}
+				case istanbulCore.RoundChangeEvent:
+					notification = &consensusEvent{Type: "roundChange", Event: ev.Data}
+				default:
+					continue
+				}
+				select {
+				case queue <- notification:
+				default:
+					log.Warn("Dropping consensus event for slow subscriber", "id", rpcSub.ID, "type", notification.Type)
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
 }
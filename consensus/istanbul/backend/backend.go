@@ -30,9 +30,11 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/bls"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	lru "github.com/hashicorp/golang-lru"
 )
 
@@ -43,6 +45,12 @@ const (
 
 // New creates an Ethereum backend for Istanbul core engine.
 func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, db ethdb.Database) consensus.Istanbul {
+	return NewWithBLSKey(config, privateKey, nil, db)
+}
+
+// NewWithBLSKey creates an Ethereum backend for Istanbul core engine, signing the
+// committed seals with the given BLS key since the BLS fork.
+func NewWithBLSKey(config *istanbul.Config, privateKey *ecdsa.PrivateKey, blsKey *bls.SecretKey, db ethdb.Database) consensus.Istanbul {
 	// Allocate the snapshot caches and create the engine
 	recents, _ := lru.NewARC(inmemorySnapshots)
 	recentMessages, _ := lru.NewARC(inmemoryPeers)
@@ -51,17 +59,22 @@ func New(config *istanbul.Config, privateKey *ecdsa.PrivateKey, db ethdb.Databas
 		config:           config,
 		istanbulEventMux: new(event.TypeMux),
 		privateKey:       privateKey,
+		blsKey:           blsKey,
 		address:          crypto.PubkeyToAddress(privateKey.PublicKey),
 		logger:           log.New(),
 		db:               db,
 		commitCh:         make(chan *types.Block, 1),
 		recents:          recents,
 		candidates:       make(map[common.Address]bool),
+		candidateWeights: make(map[common.Address]uint64),
+		candidateKeys:    make(map[common.Address][]byte),
 		coreStarted:      false,
 		recentMessages:   recentMessages,
 		knownMessages:    knownMessages,
+		dialed:           make(map[common.Address]*discover.Node),
+		resolving:        make(map[common.Address]bool),
 	}
-	backend.core = istanbulCore.New(backend, backend.config)
+	backend.core = istanbulCore.New(backend, backend.config, db)
 	return backend
 }
 
@@ -71,6 +84,7 @@ type backend struct {
 	config           *istanbul.Config
 	istanbulEventMux *event.TypeMux
 	privateKey       *ecdsa.PrivateKey
+	blsKey           *bls.SecretKey
 	address          common.Address
 	core             istanbulCore.Engine
 	logger           log.Logger
@@ -88,6 +102,10 @@ type backend struct {
 
 	// Current list of candidates we are pushing
 	candidates map[common.Address]bool
+	// Voting power to assign to authorized candidates (missing = default)
+	candidateWeights map[common.Address]uint64
+	// BLS keys to register for authorized candidates, with their proof of possession
+	candidateKeys map[common.Address][]byte
 	// Protects the signer fields
 	candidatesLock sync.RWMutex
 	// Snapshots for recent block to speed up reorgs
@@ -98,6 +116,14 @@ type backend struct {
 
 	recentMessages *lru.ARCCache // the cache of peer's messages
 	knownMessages  *lru.ARCCache // the cache of self messages
+
+	// Direct connections between the validators
+	peerManager  consensus.PeerManager
+	overlayChain consensus.ChainReader             // Chain the validator set is read from
+	enodes       map[common.Address]*discover.Node // Known enodes of the validators
+	dialed       map[common.Address]*discover.Node // Validators we keep a connection to
+	resolving    map[common.Address]bool           // Validators whose enode is being looked up
+	overlayMu    sync.Mutex
 }
 
 // Address implements istanbul.Backend.Address
@@ -137,29 +163,19 @@ func (sb *backend) Gossip(valSet istanbul.ValidatorSet, payload []byte) error {
 	if sb.broadcaster != nil && len(targets) > 0 {
 		ps := sb.broadcaster.FindPeers(targets)
 		for addr, p := range ps {
-			ms, ok := sb.recentMessages.Get(addr)
-			var m *lru.ARCCache
-			if ok {
-				m, _ = ms.(*lru.ARCCache)
-				if _, k := m.Get(hash); k {
-					// This peer had this event, skip it
-					continue
-				}
-			} else {
-				m, _ = lru.NewARC(inmemoryMessages)
-			}
-
-			m.Add(hash, true)
-			sb.recentMessages.Add(addr, m)
-
-			go p.Send(istanbulMsg, payload)
+			sb.sendToPeer(addr, p, hash, payload)
+		}
+		// Fall back to relaying through the other peers if we aren't directly
+		// connected to every validator
+		if len(ps) < len(targets) {
+			sb.relay(hash, payload, targets)
 		}
 	}
 	return nil
 }
 
 // Commit implements istanbul.Backend.Commit
-func (sb *backend) Commit(proposal istanbul.Proposal, seals [][]byte) error {
+func (sb *backend) Commit(proposal istanbul.Proposal, seals [][]byte, signers []common.Address) error {
 	// Check if the proposal is a valid block
 	block := &types.Block{}
 	block, ok := proposal.(*types.Block)
@@ -169,11 +185,18 @@ func (sb *backend) Commit(proposal istanbul.Proposal, seals [][]byte) error {
 	}
 
 	h := block.Header()
-	// Append seals into extra-data
-	err := writeCommittedSeals(h, seals)
+	// Append seals into extra-data, aggregated since the BLS fork
+	snap, err := sb.snapshot(sb.chain, h.Number.Uint64()-1, h.ParentHash, nil)
 	if err != nil {
 		return err
 	}
+	if sb.aggregatesSeals(h.Number, snap) {
+		if err := writeAggregatedSeal(h, seals, signers, snap.validators()); err != nil {
+			return err
+		}
+	} else if err := writeCommittedSeals(h, seals); err != nil {
+		return err
+	}
 	// update block's header
 	block = block.WithSeal(h)
 
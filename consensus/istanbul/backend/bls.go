@@ -0,0 +1,290 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/bls"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// blsKeyLength is the length of a BLS key registration: the public key followed
+// by its proof of possession.
+const blsKeyLength = bls.PublicKeyLength + bls.SignatureLength
+
+var (
+	// errInvalidBLSKey is returned if a header registers a malformed BLS key, one
+	// without a valid proof of possession, or one not attached to an authorize vote.
+	errInvalidBLSKey = errors.New("invalid BLS key")
+	// errMissingBLSKey is returned if a validator without a registered BLS key
+	// seals a block after the BLS fork.
+	errMissingBLSKey = errors.New("missing BLS key")
+	// errNoBLSKey is returned if a BLS signature is needed from a node which has
+	// no BLS key configured.
+	errNoBLSKey = errors.New("no BLS key configured")
+)
+
+// blsKeyRegistration returns the BLS public key of the validator followed by its
+// proof of possession, as registered through the validator votes.
+func (sb *backend) blsKeyRegistration() ([]byte, error) {
+	if sb.blsKey == nil {
+		return nil, errNoBLSKey
+	}
+	return append(sb.blsKey.PublicKey().Marshal(), sb.blsKey.Prove().Marshal()...), nil
+}
+
+// aggregatesSeals returns whether the committed seals of the block with the given
+// number, on top of the given parent snapshot, are aggregated into a single BLS
+// signature. This is the case from the BLS fork on, once every validator has a
+// registered BLS key; until then, the validators keep sealing with their ECDSA
+// keys, so that validators without a BLS key don't halt the chain.
+func (sb *backend) aggregatesSeals(number *big.Int, snap *Snapshot) bool {
+	if !sb.config.IsBLS(number) {
+		return false
+	}
+	for _, validator := range snap.validators() {
+		if _, ok := snap.BLSKeys[validator]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// proposalSnapshot returns the snapshot the committed seals of a proposal are
+// checked against, the one of its parent.
+func (sb *backend) proposalSnapshot(proposal istanbul.Proposal) (*types.Block, *Snapshot, error) {
+	block, ok := proposal.(*types.Block)
+	if !ok {
+		return nil, nil, errInvalidProposal
+	}
+	snap, err := sb.snapshot(sb.chain, block.NumberU64()-1, block.ParentHash(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, snap, nil
+}
+
+// decodeBLSKey checks a BLS key registration and returns the public key in it.
+func decodeBLSKey(registration []byte) ([]byte, error) {
+	if len(registration) != blsKeyLength {
+		return nil, errInvalidBLSKey
+	}
+	key, err := bls.PublicKeyFromBytes(registration[:bls.PublicKeyLength])
+	if err != nil {
+		return nil, errInvalidBLSKey
+	}
+	proof, err := bls.SignatureFromBytes(registration[bls.PublicKeyLength:])
+	if err != nil || !key.VerifyProof(proof) {
+		return nil, errInvalidBLSKey
+	}
+	return registration[:bls.PublicKeyLength], nil
+}
+
+// SignCommittedSeal implements istanbul.Backend.SignCommittedSeal. Once the seals
+// are aggregated, the committed seal is a BLS signature.
+func (sb *backend) SignCommittedSeal(proposal istanbul.Proposal) ([]byte, error) {
+	seal := istanbulCore.PrepareCommittedSeal(proposal.Hash())
+	if !sb.config.IsBLS(proposal.Number()) {
+		return sb.Sign(seal)
+	}
+	block, snap, err := sb.proposalSnapshot(proposal)
+	if err != nil {
+		return nil, err
+	}
+	if !sb.aggregatesSeals(block.Number(), snap) {
+		return sb.Sign(seal)
+	}
+	if sb.blsKey == nil {
+		return nil, errNoBLSKey
+	}
+	return sb.blsKey.Sign(seal).Marshal(), nil
+}
+
+// VerifyCommittedSeals implements istanbul.Backend.VerifyCommittedSeals. BLS seals
+// are checked with a single pairing check on their aggregate, and only checked
+// one by one to find the invalid ones if the aggregate fails.
+func (sb *backend) VerifyCommittedSeals(proposal istanbul.Proposal, seals [][]byte, signers []common.Address) ([]common.Address, error) {
+	hash := istanbulCore.PrepareCommittedSeal(proposal.Hash())
+
+	if sb.config.IsBLS(proposal.Number()) {
+		block, snap, err := sb.proposalSnapshot(proposal)
+		if err != nil {
+			return nil, err
+		}
+		if sb.aggregatesSeals(block.Number(), snap) {
+			return verifyBLSSeals(hash, seals, signers, snap), nil
+		}
+	}
+	var invalid []common.Address
+	for i, seal := range seals {
+		if err := sb.CheckSignature(hash, signers[i], seal); err != nil {
+			invalid = append(invalid, signers[i])
+		}
+	}
+	return invalid, nil
+}
+
+// verifyBLSSeals checks the BLS committed seals of the given signers over a hash,
+// returning the signers whose seals are invalid.
+func verifyBLSSeals(hash []byte, seals [][]byte, signers []common.Address, snap *Snapshot) []common.Address {
+	var (
+		invalid []common.Address
+		valid   []int
+		keys    = make([]*bls.PublicKey, len(seals))
+		sigs    = make([]*bls.Signature, len(seals))
+	)
+	for i, seal := range seals {
+		blob, ok := snap.BLSKeys[signers[i]]
+		if !ok {
+			invalid = append(invalid, signers[i])
+			continue
+		}
+		key, err := bls.PublicKeyFromBytes(blob)
+		if err != nil {
+			invalid = append(invalid, signers[i])
+			continue
+		}
+		sig, err := bls.SignatureFromBytes(seal)
+		if err != nil {
+			invalid = append(invalid, signers[i])
+			continue
+		}
+		keys[i], sigs[i] = key, sig
+		valid = append(valid, i)
+	}
+	if len(valid) == 0 {
+		return invalid
+	}
+	var (
+		aggKeys = make([]*bls.PublicKey, 0, len(valid))
+		aggSigs = make([]*bls.Signature, 0, len(valid))
+	)
+	for _, i := range valid {
+		aggKeys = append(aggKeys, keys[i])
+		aggSigs = append(aggSigs, sigs[i])
+	}
+	if bls.AggregatePublicKeys(aggKeys).Verify(hash, bls.AggregateSignatures(aggSigs)) {
+		return invalid
+	}
+	for _, i := range valid {
+		if !keys[i].Verify(hash, sigs[i]) {
+			invalid = append(invalid, signers[i])
+		}
+	}
+	return invalid
+}
+
+// writeAggregatedSeal writes the extra-data field of a block header with the
+// aggregate of the given BLS committed seals, and the bitmap of their signers
+// among the given validators.
+func writeAggregatedSeal(h *types.Header, seals [][]byte, signers []common.Address, validators []common.Address) error {
+	if len(seals) == 0 || len(seals) != len(signers) {
+		return errInvalidCommittedSeals
+	}
+	index := make(map[common.Address]int)
+	for i, validator := range validators {
+		index[validator] = i
+	}
+	var (
+		bitmap = make([]byte, (len(validators)+7)/8)
+		sigs   = make([]*bls.Signature, len(seals))
+	)
+	for i, seal := range seals {
+		sig, err := bls.SignatureFromBytes(seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		pos, ok := index[signers[i]]
+		if !ok || bitmap[pos/8]&(1<<uint(pos%8)) != 0 {
+			return errInvalidCommittedSeals
+		}
+		bitmap[pos/8] |= 1 << uint(pos%8)
+		sigs[i] = sig
+	}
+
+	istanbulExtra, err := types.ExtractIstanbulExtra(h)
+	if err != nil {
+		return err
+	}
+	istanbulExtra.CommittedSeal = [][]byte{}
+	istanbulExtra.AggregatedSeal = bls.AggregateSignatures(sigs).Marshal()
+	istanbulExtra.SignerBitmap = bitmap
+
+	payload, err := rlp.EncodeToBytes(&istanbulExtra)
+	if err != nil {
+		return err
+	}
+
+	h.Extra = append(h.Extra[:types.IstanbulExtraVanity], payload...)
+	return nil
+}
+
+// verifyAggregatedSeal checks whether the aggregated seal of a header is signed by
+// the parent's validators marked in the signer bitmap, and that they hold enough
+// voting power to commit the block.
+func (sb *backend) verifyAggregatedSeal(header *types.Header, extra *types.IstanbulExtra, snap *Snapshot) error {
+	if len(extra.AggregatedSeal) == 0 {
+		return errEmptyCommittedSeals
+	}
+	validators := snap.validators()
+	if len(extra.CommittedSeal) != 0 || len(extra.SignerBitmap) != (len(validators)+7)/8 {
+		return errInvalidCommittedSeals
+	}
+	var (
+		keys   []*bls.PublicKey
+		weight int
+	)
+	for i := 0; i < len(extra.SignerBitmap)*8; i++ {
+		if extra.SignerBitmap[i/8]&(1<<uint(i%8)) == 0 {
+			continue
+		}
+		// Bits past the last validator must not be set
+		if i >= len(validators) {
+			return errInvalidCommittedSeals
+		}
+		blob, ok := snap.BLSKeys[validators[i]]
+		if !ok {
+			return errMissingBLSKey
+		}
+		key, err := bls.PublicKeyFromBytes(blob)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+
+		_, v := snap.ValSet.GetByAddress(validators[i])
+		weight += int(v.Weight())
+	}
+	// The voting power of the signers should reach a two-thirds quorum
+	if weight < snap.ValSet.QuorumSize() {
+		return errInvalidCommittedSeals
+	}
+	sig, err := bls.SignatureFromBytes(extra.AggregatedSeal)
+	if err != nil {
+		return errInvalidCommittedSeals
+	}
+	if !bls.AggregatePublicKeys(keys).Verify(istanbulCore.PrepareCommittedSeal(header.Hash()), sig) {
+		return errInvalidCommittedSeals
+	}
+	return nil
+}
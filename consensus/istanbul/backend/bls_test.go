@@ -0,0 +1,224 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto/bls"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// newBLSBlockChain creates a single validator chain switching to aggregated BLS
+// committed seals at the given block.
+func newBLSBlockChain(fork uint64) (*core.BlockChain, *backend) {
+	genesis, nodeKeys := getGenesisAndKeys(1)
+	genesis.Config.Istanbul.BLSBlock = new(big.Int).SetUint64(fork)
+
+	config := *istanbul.DefaultConfig
+	config.BLSBlock = genesis.Config.Istanbul.BLSBlock
+
+	memDB, _ := ethdb.NewMemDatabase()
+	blsKey, _ := bls.GenerateKey()
+	b, _ := NewWithBLSKey(&config, nodeKeys[0], blsKey, memDB).(*backend)
+	genesis.MustCommit(memDB)
+	blockchain, err := core.NewBlockChain(memDB, nil, genesis.Config, b, vm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	b.Start(blockchain, blockchain.CurrentBlock, blockchain.HasBadBlock)
+	return blockchain, b
+}
+
+func TestBLSKeyRegistration(t *testing.T) {
+	chain, engine := newBLSBlockChain(100)
+	defer engine.Stop()
+
+	api := &API{chain: chain, istanbul: engine}
+	key, err := api.BLSKey()
+	if err != nil {
+		t.Fatalf("failed to retrieve BLS key: %v", err)
+	}
+
+	// Registrations without a valid proof of possession are refused
+	forged := common.CopyBytes(key)
+	forged[len(forged)-1] ^= 0xff
+	if err := api.ProposeBLSKey(engine.Address(), forged); err != errInvalidBLSKey {
+		t.Errorf("error mismatch: have %v, want %v", err, errInvalidBLSKey)
+	}
+	if err := api.ProposeBLSKey(engine.Address(), key); err != nil {
+		t.Fatalf("failed to propose BLS key: %v", err)
+	}
+	block := makeBlock(chain, engine, chain.Genesis())
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	snap, err := engine.snapshot(chain, 1, block.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if have := snap.BLSKeys[engine.Address()]; !bytes.Equal(have, key[:len(key)-64]) {
+		t.Errorf("registered key mismatch: have %x, want %x", have, key[:len(key)-64])
+	}
+	// Once registered, the key isn't voted on again
+	header := makeHeader(block, engine.config)
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	if header.Coinbase != (common.Address{}) {
+		t.Errorf("registered key voted on again")
+	}
+	// Keys can't be registered along with a drop vote
+	header.Coinbase, header.Time = engine.Address(), block.Time()
+	if err := writeBLSKey(header, key); err != nil {
+		t.Fatalf("failed to write BLS key: %v", err)
+	}
+	if err := engine.VerifyHeader(chain, header, false); err != errInvalidBLSKey {
+		t.Errorf("error mismatch: have %v, want %v", err, errInvalidBLSKey)
+	}
+}
+
+func TestAggregatedSeal(t *testing.T) {
+	chain, engine := newBLSBlockChain(2)
+	defer engine.Stop()
+
+	api := &API{chain: chain, istanbul: engine}
+	key, err := api.BLSKey()
+	if err != nil {
+		t.Fatalf("failed to retrieve BLS key: %v", err)
+	}
+	if err := api.ProposeBLSKey(engine.Address(), key); err != nil {
+		t.Fatalf("failed to propose BLS key: %v", err)
+	}
+	// Before the fork, blocks carry the individual committed seals
+	block := makeBlock(chain, engine, chain.Genesis())
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert block 1: %v", err)
+	}
+	extra, _ := types.ExtractIstanbulExtra(block.Header())
+	if len(extra.CommittedSeal) != 1 || extra.AggregatedSeal != nil {
+		t.Fatalf("unexpected seals before the fork: %d committed, aggregated %x", len(extra.CommittedSeal), extra.AggregatedSeal)
+	}
+	// After the fork, they are aggregated
+	block = makeBlock(chain, engine, block)
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert block 2: %v", err)
+	}
+	extra, _ = types.ExtractIstanbulExtra(block.Header())
+	if len(extra.CommittedSeal) != 0 || len(extra.AggregatedSeal) != 64 || !bytes.Equal(extra.SignerBitmap, []byte{0x01}) {
+		t.Fatalf("unexpected seals after the fork: %d committed, aggregated %x, bitmap %x", len(extra.CommittedSeal), extra.AggregatedSeal, extra.SignerBitmap)
+	}
+	// Tampered seals are rejected
+	tamper := func(modify func(*types.IstanbulExtra)) *types.Header {
+		header := block.Header()
+		extra, _ := types.ExtractIstanbulExtra(header)
+		modify(extra)
+		payload, _ := rlp.EncodeToBytes(&extra)
+		header.Extra = append(header.Extra[:types.IstanbulExtraVanity], payload...)
+		return header
+	}
+	tests := []struct {
+		modify func(*types.IstanbulExtra)
+		err    error
+	}{
+		{func(extra *types.IstanbulExtra) { extra.SignerBitmap = []byte{0x00} }, errInvalidCommittedSeals},
+		{func(extra *types.IstanbulExtra) { extra.SignerBitmap = []byte{0x03} }, errInvalidCommittedSeals},
+		{func(extra *types.IstanbulExtra) {
+			extra.AggregatedSeal = engine.blsKey.Sign([]byte("other")).Marshal()
+		}, errInvalidCommittedSeals},
+		{func(extra *types.IstanbulExtra) { extra.AggregatedSeal, extra.SignerBitmap = nil, nil }, errEmptyCommittedSeals},
+	}
+	for i, tt := range tests {
+		if err := engine.verifyCommittedSeals(chain, tamper(tt.modify), nil); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Validators without a registered key can't seal
+	snap, err := engine.snapshot(chain, 1, block.ParentHash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	snap = snap.copy()
+	delete(snap.BLSKeys, engine.Address())
+	if err := engine.verifyAggregatedSeal(block.Header(), extra, snap); err != errMissingBLSKey {
+		t.Errorf("error mismatch: have %v, want %v", err, errMissingBLSKey)
+	}
+}
+
+func TestAggregatedSealFallback(t *testing.T) {
+	chain, engine := newBLSBlockChain(1)
+	defer engine.Stop()
+
+	// Without a BLS key for every validator, the seals stay individual ones
+	block := makeBlock(chain, engine, chain.Genesis())
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	extra, _ := types.ExtractIstanbulExtra(block.Header())
+	if len(extra.CommittedSeal) != 1 || extra.AggregatedSeal != nil {
+		t.Fatalf("unexpected seals without BLS keys: %d committed, aggregated %x", len(extra.CommittedSeal), extra.AggregatedSeal)
+	}
+	// Nodes without a BLS key can't aggregate
+	api := &API{chain: chain, istanbul: &backend{}}
+	if _, err := api.BLSKey(); err != errNoBLSKey {
+		t.Errorf("error mismatch: have %v, want %v", err, errNoBLSKey)
+	}
+}
+
+func TestVerifyBLSSeals(t *testing.T) {
+	var (
+		hash    = []byte("proposal")
+		snap    = &Snapshot{BLSKeys: make(map[common.Address][]byte)}
+		signers []common.Address
+		seals   [][]byte
+	)
+	for i := 0; i < 4; i++ {
+		key, _ := bls.GenerateKey()
+		signer := common.Address{byte(i + 1)}
+		snap.BLSKeys[signer] = key.PublicKey().Marshal()
+
+		signers = append(signers, signer)
+		seals = append(seals, key.Sign(hash).Marshal())
+	}
+	if invalid := verifyBLSSeals(hash, seals, signers, snap); len(invalid) != 0 {
+		t.Fatalf("valid seals rejected: %x", invalid)
+	}
+	// Seals of an other signer, over an other hash or malformed are singled out
+	other, _ := bls.GenerateKey()
+	seals[1] = other.Sign(hash).Marshal()
+	seals[2] = make([]byte, bls.SignatureLength)
+	delete(snap.BLSKeys, signers[3])
+
+	invalid := verifyBLSSeals(hash, seals, signers, snap)
+	want := map[common.Address]bool{signers[1]: true, signers[2]: true, signers[3]: true}
+	if len(invalid) != len(want) {
+		t.Fatalf("invalid signers mismatch: have %x, want %d", invalid, len(want))
+	}
+	for _, signer := range invalid {
+		if !want[signer] {
+			t.Errorf("valid signer %x rejected", signer)
+		}
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/bls"
 	"github.com/ethereum/go-ethereum/crypto/sha3"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -67,15 +68,15 @@ var (
 	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
 	errInvalidUncleHash = errors.New("non empty uncle hash")
 	// errInconsistentValidatorSet is returned if the validator set is inconsistent
-	errInconsistentValidatorSet = errors.New("non empty uncle hash")
+	errInconsistentValidatorSet = errors.New("inconsistent validator set")
 	// errInvalidTimestamp is returned if the timestamp of a block is lower than the previous block's timestamp + the minimum block period.
 	errInvalidTimestamp = errors.New("invalid timestamp")
 	// errInvalidVotingChain is returned if an authorization list is attempted to
 	// be modified via out-of-range or non-contiguous headers.
 	errInvalidVotingChain = errors.New("invalid voting chain")
 	// errInvalidVote is returned if a nonce value is something else that the two
-	// allowed constants of 0x00..0 or 0xff..f.
-	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+	// allowed constants of 0x00..0 or 0xff..f, or a validator weight.
+	errInvalidVote = errors.New("vote nonce not 0x00..0, 0xff..f or a weight")
 	// errInvalidCommittedSeals is returned if the committed seal is not signed by any of parent validators.
 	errInvalidCommittedSeals = errors.New("invalid committed seals")
 	// errEmptyCommittedSeals is returned if the field of committed seals is zero.
@@ -92,6 +93,8 @@ var (
 	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
 	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator.
 
+	maxVoteWeight = uint64(1<<32 - 1) // Maximum validator weight that can be voted on through the nonce
+
 	inmemoryAddresses  = 20 // Number of recent addresses from ecrecover
 	recentAddresses, _ = lru.NewARC(inmemoryAddresses)
 )
@@ -125,14 +128,26 @@ func (sb *backend) verifyHeader(chain consensus.ChainReader, header *types.Heade
 	}
 
 	// Ensure that the extra data format is satisfied
-	if _, err := types.ExtractIstanbulExtra(header); err != nil {
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
 		return errInvalidExtraDataFormat
 	}
 
 	// Ensure that the coinbase is valid
-	if header.Nonce != (emptyNonce) && !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+	authorize, _, err := decodeVote(header.Nonce)
+	if err != nil {
 		return errInvalidNonce
 	}
+	// Ensure that a registered BLS key comes with an authorize vote and a valid
+	// proof of possession
+	if len(extra.BLSKey) > 0 {
+		if !authorize || header.Coinbase == (common.Address{}) {
+			return errInvalidBLSKey
+		}
+		if _, err := decodeBLSKey(extra.BLSKey); err != nil {
+			return err
+		}
+	}
 	// Ensure that the mix digest is zero as we don't have fork protection currently
 	if header.MixDigest != types.IstanbulDigest {
 		return errInvalidMixDigest
@@ -177,9 +192,12 @@ func (sb *backend) verifyCascadingFields(chain consensus.ChainReader, header *ty
 	if err != nil {
 		return err
 	}
-	validators := make([]byte, len(snap.validators())*common.AddressLength)
-	for i, validator := range snap.validators() {
-		copy(validators[i*common.AddressLength:], validator[:])
+	if sb.governed() {
+		if err := sb.verifyGovernedValidators(header, snap); err != nil {
+			return err
+		}
+	} else if err := checkValidators(header, snap.validators(), snap.weights()); err != nil {
+		return err
 	}
 	if err := sb.verifySigner(chain, header, parents); err != nil {
 		return err
@@ -263,13 +281,22 @@ func (sb *backend) verifyCommittedSeals(chain consensus.ChainReader, header *typ
 	if err != nil {
 		return err
 	}
+	// Since the BLS fork, the committed seals are aggregated into a single one
+	// once every validator has a BLS key
+	if sb.aggregatesSeals(header.Number, snap) {
+		return sb.verifyAggregatedSeal(header, extra, snap)
+	}
+	if len(extra.AggregatedSeal) > 0 || len(extra.SignerBitmap) > 0 {
+		return errInvalidCommittedSeals
+	}
 	// The length of Committed seals should be larger than 0
 	if len(extra.CommittedSeal) == 0 {
 		return errEmptyCommittedSeals
 	}
 
 	validators := snap.ValSet.Copy()
-	// Check whether the committed seals are generated by parent's validators
+	// Check whether the committed seals are generated by parent's validators and
+	// sum up their voting power
 	validSeal := 0
 	proposalSeal := istanbulCore.PrepareCommittedSeal(header.Hash())
 	// 1. Get committed seals from current header
@@ -282,15 +309,15 @@ func (sb *backend) verifyCommittedSeals(chain consensus.ChainReader, header *typ
 		}
 		// Every validator can have only one seal. If more than one seals are signed by a
 		// validator, the validator cannot be found and errInvalidCommittedSeals is returned.
-		if validators.RemoveValidator(addr) {
-			validSeal += 1
-		} else {
+		_, v := validators.GetByAddress(addr)
+		if v == nil || !validators.RemoveValidator(addr) {
 			return errInvalidCommittedSeals
 		}
+		validSeal += int(v.Weight())
 	}
 
-	// The length of validSeal should be larger than number of faulty node + 1
-	if validSeal <= 2*snap.ValSet.F() {
+	// The voting power of validSeal should reach a two-thirds quorum
+	if validSeal < snap.ValSet.QuorumSize() {
 		return errInvalidCommittedSeals
 	}
 
@@ -336,14 +363,43 @@ func (sb *backend) Prepare(chain consensus.ChainReader, header *types.Header) er
 		return err
 	}
 
-	// get valid candidate list
+	// add validators in snapshot to extraData's validators section, or the ones
+	// of the governance contract at epoch blocks
+	validators, valWeights := snap.validators(), snap.weights()
+	if sb.governed() && number%sb.config.Epoch == 0 {
+		if validators, valWeights, err = sb.contractValidators(chain, parent); err != nil {
+			return err
+		}
+	}
+	extra, err := prepareExtra(header, validators, valWeights)
+	if err != nil {
+		return err
+	}
+	header.Extra = extra
+
+	// set header's timestamp
+	header.Time = new(big.Int).Add(parent.Time, new(big.Int).SetUint64(sb.config.BlockPeriod))
+	if header.Time.Int64() < time.Now().Unix() {
+		header.Time = big.NewInt(time.Now().Unix())
+	}
+	// get valid candidate list, only BLS key registrations are voted on in
+	// governance mode
 	sb.candidatesLock.RLock()
 	var addresses []common.Address
 	var authorizes []bool
+	var weights []uint64
+	var keys [][]byte
 	for address, authorize := range sb.candidates {
-		if snap.checkVote(address, authorize) {
+		weight, key := sb.candidateWeights[address], sb.candidateKeys[address]
+		var pubkey []byte
+		if len(key) > 0 {
+			pubkey = key[:bls.PublicKeyLength]
+		}
+		if snap.checkVote(address, authorize, weight, pubkey) {
 			addresses = append(addresses, address)
 			authorizes = append(authorizes, authorize)
+			weights = append(weights, weight)
+			keys = append(keys, key)
 		}
 	}
 	sb.candidatesLock.RUnlock()
@@ -353,24 +409,17 @@ func (sb *backend) Prepare(chain consensus.ChainReader, header *types.Header) er
 		index := rand.Intn(len(addresses))
 		// add validator voting in coinbase
 		header.Coinbase = addresses[index]
-		if authorizes[index] {
-			copy(header.Nonce[:], nonceAuthVote)
-		} else {
+		switch {
+		case !authorizes[index]:
 			copy(header.Nonce[:], nonceDropVote)
+		case weights[index] != 0:
+			header.Nonce = types.EncodeNonce(weights[index])
+		default:
+			copy(header.Nonce[:], nonceAuthVote)
+		}
+		if len(keys[index]) > 0 {
+			return writeBLSKey(header, keys[index])
 		}
-	}
-
-	// add validators in snapshot to extraData's validators section
-	extra, err := prepareExtra(header, snap.validators())
-	if err != nil {
-		return err
-	}
-	header.Extra = extra
-
-	// set header's timestamp
-	header.Time = new(big.Int).Add(parent.Time, new(big.Int).SetUint64(sb.config.BlockPeriod))
-	if header.Time.Int64() < time.Now().Unix() {
-		header.Time = big.NewInt(time.Now().Unix())
 	}
 	return nil
 }
@@ -382,6 +431,12 @@ func (sb *backend) Prepare(chain consensus.ChainReader, header *types.Header) er
 // consensus rules that happen at finalization (e.g. block rewards).
 func (sb *backend) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction,
 	uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// The validators of the governance contract can only be verified with the state
+	if sb.governed() && header.Number.Uint64()%sb.config.Epoch == 0 {
+		if err := sb.verifyContractValidators(chain, header); err != nil {
+			return nil, err
+		}
+	}
 	// No block rewards in Istanbul, so the state remains as is and uncles are dropped
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = nilUncleHash
@@ -509,6 +564,7 @@ func (sb *backend) Start(chain consensus.ChainReader, currentBlock func() *types
 	}
 
 	sb.coreStarted = true
+	sb.updateOverlay()
 	return nil
 }
 
@@ -523,6 +579,7 @@ func (sb *backend) Stop() error {
 		return err
 	}
 	sb.coreStarted = false
+	sb.updateOverlay()
 	return nil
 }
 
@@ -544,6 +601,7 @@ func (sb *backend) snapshot(chain consensus.ChainReader, number uint64, hash com
 			if s, err := loadSnapshot(sb.config.Epoch, sb.db, hash); err == nil {
 				log.Trace("Loaded voting snapshot form disk", "number", number, "hash", hash)
 				snap = s
+				snap.governed = sb.governed()
 				break
 			}
 		}
@@ -557,7 +615,8 @@ func (sb *backend) snapshot(chain consensus.ChainReader, number uint64, hash com
 			if err != nil {
 				return nil, err
 			}
-			snap = newSnapshot(sb.config.Epoch, 0, genesis.Hash(), validator.NewSet(istanbulExtra.Validators, sb.config.ProposerPolicy))
+			snap = newSnapshot(sb.config.Epoch, 0, genesis.Hash(), validator.NewWeightedSet(istanbulExtra.Validators, istanbulExtra.Weights, sb.config.ProposerPolicy))
+			snap.governed = sb.governed()
 			if err := snap.store(sb.db); err != nil {
 				return nil, err
 			}
@@ -641,8 +700,9 @@ func ecrecover(header *types.Header) (common.Address, error) {
 	return addr, nil
 }
 
-// prepareExtra returns a extra-data of the given header and validators
-func prepareExtra(header *types.Header, vals []common.Address) ([]byte, error) {
+// prepareExtra returns a extra-data of the given header, validators and their
+// weights (nil if unweighted)
+func prepareExtra(header *types.Header, vals []common.Address, weights []uint64) ([]byte, error) {
 	var buf bytes.Buffer
 
 	// compensate the lack bytes if header.Extra is not enough IstanbulExtraVanity bytes.
@@ -655,6 +715,7 @@ func prepareExtra(header *types.Header, vals []common.Address) ([]byte, error) {
 		Validators:    vals,
 		Seal:          []byte{},
 		CommittedSeal: [][]byte{},
+		Weights:       weights,
 	}
 
 	payload, err := rlp.EncodeToBytes(&ist)
@@ -687,6 +748,24 @@ func writeSeal(h *types.Header, seal []byte) error {
 	return nil
 }
 
+// writeBLSKey writes the extra-data field of the given header with the BLS key
+// registration of the account voted on.
+func writeBLSKey(h *types.Header, key []byte) error {
+	istanbulExtra, err := types.ExtractIstanbulExtra(h)
+	if err != nil {
+		return err
+	}
+
+	istanbulExtra.BLSKey = key
+	payload, err := rlp.EncodeToBytes(&istanbulExtra)
+	if err != nil {
+		return err
+	}
+
+	h.Extra = append(h.Extra[:types.IstanbulExtraVanity], payload...)
+	return nil
+}
+
 // writeCommittedSeals writes the extra-data field of a block header with given committed seals.
 func writeCommittedSeals(h *types.Header, committedSeals [][]byte) error {
 	if len(committedSeals) == 0 {
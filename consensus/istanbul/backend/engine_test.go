@@ -192,7 +192,7 @@ func TestSealCommittedOtherHash(t *testing.T) {
 		if !ok {
 			t.Errorf("unexpected event comes: %v", reflect.TypeOf(ev.Data))
 		}
-		engine.Commit(otherBlock, [][]byte{})
+		engine.Commit(otherBlock, [][]byte{}, nil)
 		eventSub.Unsubscribe()
 	}
 	go eventLoop()
@@ -233,8 +233,17 @@ func TestVerifyHeader(t *testing.T) {
 		t.Errorf("error mismatch: have %v, want %v", err, errEmptyCommittedSeals)
 	}
 
-	// short extra data
+	// forged validator weights
 	header := block.Header()
+	extra, _ := types.ExtractIstanbulExtra(header)
+	header.Extra, _ = prepareExtra(header, extra.Validators, []uint64{5})
+	err = engine.VerifyHeader(chain, header, false)
+	if err != errInconsistentValidatorSet {
+		t.Errorf("error mismatch: have %v, want %v", err, errInconsistentValidatorSet)
+	}
+
+	// short extra data
+	header = block.Header()
 	header.Extra = []byte{}
 	err = engine.VerifyHeader(chain, header, false)
 	if err != errInvalidExtraDataFormat {
@@ -445,7 +454,7 @@ func TestPrepareExtra(t *testing.T) {
 		Extra: vanity,
 	}
 
-	payload, err := prepareExtra(h, validators)
+	payload, err := prepareExtra(h, validators, nil)
 	if err != nil {
 		t.Errorf("error mismatch: have %v, want: nil", err)
 	}
@@ -456,7 +465,7 @@ func TestPrepareExtra(t *testing.T) {
 	// append useless information to extra-data
 	h.Extra = append(vanity, make([]byte, 15)...)
 
-	payload, err = prepareExtra(h, validators)
+	payload, err = prepareExtra(h, validators, nil)
 	if !reflect.DeepEqual(payload, expectedResult) {
 		t.Errorf("payload mismatch: have %v, want %v", payload, expectedResult)
 	}
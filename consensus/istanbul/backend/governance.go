@@ -0,0 +1,230 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// validatorContractABI is the interface the governance contract must implement
+// for the validator set to be read from it. getWeights is optional, without it
+// every validator has the default weight.
+const validatorContractABI = `[{"constant":true,"inputs":[],"name":"getValidators","outputs":[{"name":"","type":"address[]"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"getWeights","outputs":[{"name":"","type":"uint256[]"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// validatorCallGas is the gas allowance of the call reading the validator set.
+const validatorCallGas = uint64(50000000)
+
+var (
+	// errNoGovernanceState is returned if the validator set has to be read from
+	// the governance contract, but the chain gives no access to the state.
+	errNoGovernanceState = errors.New("no state access for the governance contract")
+	// errEmptyValidatorSet is returned if the governance contract returns no validators.
+	errEmptyValidatorSet = errors.New("empty validator set from governance contract")
+	// errInvalidContractWeights is returned if the weights of the governance
+	// contract don't match its validators, or are out of range.
+	errInvalidContractWeights = errors.New("invalid validator weights from governance contract")
+
+	parsedValidatorABI, _ = abi.JSON(strings.NewReader(validatorContractABI))
+)
+
+// stateChain is a chain with access to the state of its blocks, such as the
+// core.BlockChain, which the governance contract can be called against.
+type stateChain interface {
+	core.ChainContext
+	Config() *params.ChainConfig
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// governed returns whether the validator set is managed by a governance contract
+// instead of the votes cast in the block headers.
+func (sb *backend) governed() bool {
+	return sb.config.ValidatorContract != (common.Address{})
+}
+
+// contractValidators reads the validator set and its weights from the governance
+// contract with read-only calls against the state of the given block. The
+// validators are returned in ascending order, without duplicates, and the weights
+// in the same order, or nil if all validators have the default weight.
+func (sb *backend) contractValidators(chain consensus.ChainReader, parent *types.Header) ([]common.Address, []uint64, error) {
+	sc, ok := chain.(stateChain)
+	if !ok {
+		return nil, nil, errNoGovernanceState
+	}
+	statedb, err := sc.StateAt(parent.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	var validators []common.Address
+	output, err := sb.callValidatorContract(sc, parent, statedb, "getValidators")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := parsedValidatorABI.Unpack(&validators, "getValidators", output); err != nil {
+		return nil, nil, err
+	}
+	// The weights are optional, a contract without getWeights fails the call
+	var weights []uint64
+	if output, err := sb.callValidatorContract(sc, parent, statedb, "getWeights"); err == nil && len(output) > 0 {
+		var values []*big.Int
+		if err := parsedValidatorABI.Unpack(&values, "getWeights", output); err != nil {
+			return nil, nil, err
+		}
+		if len(values) != len(validators) {
+			return nil, nil, errInvalidContractWeights
+		}
+		weights = make([]uint64, len(values))
+		for i, value := range values {
+			if value.Sign() <= 0 || value.Cmp(new(big.Int).SetUint64(maxVoteWeight)) > 0 {
+				return nil, nil, errInvalidContractWeights
+			}
+			weights[i] = value.Uint64()
+		}
+	}
+	return normalizeValidators(validators, weights)
+}
+
+// callValidatorContract calls a method of the governance contract without
+// arguments against the given state, which the call leaves untouched.
+func (sb *backend) callValidatorContract(chain stateChain, parent *types.Header, statedb *state.StateDB, method string) ([]byte, error) {
+	input, err := parsedValidatorABI.Pack(method)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		contract = sb.config.ValidatorContract
+		msg      = types.NewMessage(common.Address{}, &contract, 0, new(big.Int), validatorCallGas, new(big.Int), input, false)
+		context  = core.NewEVMContext(msg, parent, chain, &common.Address{})
+		evm      = vm.NewEVM(context, statedb, chain.Config(), vm.Config{})
+	)
+	output, _, err := evm.StaticCall(vm.AccountRef(common.Address{}), contract, input, validatorCallGas)
+	return output, err
+}
+
+// normalizeValidators sorts a validator list along with its weights, if any, and
+// removes the duplicates from it, keeping the weight of the first occurrence.
+// The weights are dropped if all of them are the default weight.
+func normalizeValidators(validators []common.Address, weights []uint64) ([]common.Address, []uint64, error) {
+	if len(validators) == 0 {
+		return nil, nil, errEmptyValidatorSet
+	}
+	order := make([]int, len(validators))
+	for i := range order {
+		order[i] = i
+	}
+	// Stable insertion sort, so the first occurrence of a duplicate comes first
+	for i := 1; i < len(order); i++ {
+		for j := i; j > 0 && bytes.Compare(validators[order[j-1]][:], validators[order[j]][:]) > 0; j-- {
+			order[j-1], order[j] = order[j], order[j-1]
+		}
+	}
+	var (
+		unique   []common.Address
+		uweights []uint64
+		weighted = false
+	)
+	for _, idx := range order {
+		if len(unique) > 0 && validators[idx] == unique[len(unique)-1] {
+			continue
+		}
+		unique = append(unique, validators[idx])
+		if weights != nil {
+			uweights = append(uweights, weights[idx])
+			if weights[idx] != 1 {
+				weighted = true
+			}
+		}
+	}
+	if !weighted {
+		uweights = nil
+	}
+	return unique, uweights, nil
+}
+
+// headerValidatorSet creates the validator set recorded in the extra-data of a header.
+func headerValidatorSet(header *types.Header, policy istanbul.ProposerPolicy) (istanbul.ValidatorSet, error) {
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	return validator.NewWeightedSet(extra.Validators, extra.Weights, policy), nil
+}
+
+// verifyGovernedValidators checks that the validators in the extra-data of a
+// header match the parent snapshot's validator set in governance mode. Epoch
+// blocks carry the contract's validator set instead, which needs the state of the
+// parent and is checked by verifyContractValidators when the block is processed.
+// Without the state (e.g. headers of a light client or fast sync), the validators
+// of an epoch block are trusted, as they are sealed by a quorum of the parent's set.
+func (sb *backend) verifyGovernedValidators(header *types.Header, snap *Snapshot) error {
+	if header.Number.Uint64()%sb.config.Epoch == 0 {
+		return nil
+	}
+	return checkValidators(header, snap.validators(), snap.weights())
+}
+
+// verifyContractValidators checks that the validators in the extra-data of an
+// epoch block match the governance contract at the state of its parent. It fails
+// if that state is unavailable, so the block isn't accepted unverified.
+func (sb *backend) verifyContractValidators(chain consensus.ChainReader, header *types.Header) error {
+	number := header.Number.Uint64()
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	validators, weights, err := sb.contractValidators(chain, parent)
+	if err != nil {
+		return err
+	}
+	return checkValidators(header, validators, weights)
+}
+
+// checkValidators checks that the validators and weights in the extra-data of a
+// header are the expected ones.
+func checkValidators(header *types.Header, validators []common.Address, weights []uint64) error {
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return err
+	}
+	if len(extra.Validators) != len(validators) || len(extra.Weights) != len(weights) {
+		return errInconsistentValidatorSet
+	}
+	for i, validator := range extra.Validators {
+		if validator != validators[i] {
+			return errInconsistentValidatorSet
+		}
+	}
+	for i, weight := range extra.Weights {
+		if weight != weights[i] {
+			return errInconsistentValidatorSet
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// validatorContractCode implements getValidators() and getWeights() on top of the
+// storage: slot 0 holds the number of validators, the following slots the
+// validators, and the slots from 0x100 on their weights.
+var validatorContractCode = hexutil.MustDecode("0x6000357c010000000000000000000000000000000000000000000000000000000090046322acb8671460315760016035565b6101005b60206000526000548060205260005b81811015605e578083015481602002604001526001016044565b506020026040016000f3")
+
+// newGovernedBlockChain creates a single validator chain whose validator set is
+// managed by a governance contract. The contract lists the local validator along
+// with the given others, or no validators at all if there are no others. The
+// contract returns the given weights for the same validators, or the default
+// weight if there are none.
+func newGovernedBlockChain(epoch uint64, others []common.Address, weights ...uint64) (*core.BlockChain, *backend) {
+	genesis, nodeKeys := getGenesisAndKeys(1)
+
+	var validators []common.Address
+	if len(others) > 0 {
+		validators = append([]common.Address{crypto.PubkeyToAddress(nodeKeys[0].PublicKey)}, others...)
+	}
+	contract := common.HexToAddress("0x0000000000000000000000000000000000001000")
+	storage := map[common.Hash]common.Hash{
+		common.BigToHash(big.NewInt(0)): common.BigToHash(big.NewInt(int64(len(validators)))),
+	}
+	for i, validator := range validators {
+		storage[common.BigToHash(big.NewInt(int64(i+1)))] = validator.Hash()
+	}
+	if len(weights) == 0 {
+		for range validators {
+			weights = append(weights, 1)
+		}
+	}
+	for i, weight := range weights {
+		storage[common.BigToHash(big.NewInt(int64(0x100+i)))] = common.BigToHash(new(big.Int).SetUint64(weight))
+	}
+	genesis.Alloc[contract] = core.GenesisAccount{Code: validatorContractCode, Storage: storage, Balance: new(big.Int)}
+
+	config := *istanbul.DefaultConfig
+	config.Epoch = epoch
+	config.ValidatorContract = contract
+
+	memDB, _ := ethdb.NewMemDatabase()
+	b, _ := New(&config, nodeKeys[0], memDB).(*backend)
+	genesis.MustCommit(memDB)
+	blockchain, err := core.NewBlockChain(memDB, nil, genesis.Config, b, vm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	b.Start(blockchain, blockchain.CurrentBlock, blockchain.HasBadBlock)
+	return blockchain, b
+}
+
+func TestGovernedValidatorSet(t *testing.T) {
+	others := []common.Address{
+		common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff"),
+		common.HexToAddress("0x0000000000000000000000000000000000000001"),
+	}
+	chain, engine := newGovernedBlockChain(2, others)
+	defer engine.Stop()
+
+	// Votes are ignored in governance mode
+	engine.candidates[others[0]] = true
+
+	block := makeBlock(chain, engine, chain.Genesis())
+	if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+		t.Fatalf("failed to insert block 1: %v", err)
+	}
+	if block.Coinbase() != (common.Address{}) {
+		t.Errorf("vote cast in governance mode: %x", block.Coinbase())
+	}
+	snap, err := engine.snapshot(chain, 1, block.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if have := snap.validators(); !reflect.DeepEqual(have, []common.Address{engine.Address()}) {
+		t.Errorf("validators changed before the epoch: %x", have)
+	}
+	// The epoch block carries the validators of the contract
+	header := makeHeader(block, engine.config)
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare epoch block: %v", err)
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		t.Fatalf("failed to extract extra-data: %v", err)
+	}
+	want, _, _ := normalizeValidators(append([]common.Address{engine.Address()}, others...), nil)
+	if !reflect.DeepEqual(extra.Validators, want) {
+		t.Errorf("epoch validators mismatch: have %x, want %x", extra.Validators, want)
+	}
+	if extra.Weights != nil {
+		t.Errorf("unweighted contract produced weights: %v", extra.Weights)
+	}
+	// Headers deviating from the contract are rejected once the state is available
+	tampered := types.CopyHeader(header)
+	tampered.Extra, _ = prepareExtra(tampered, want[:2], nil)
+	if err := engine.verifyGovernedValidators(tampered, snap); err != nil {
+		t.Errorf("epoch validators checked against the snapshot: %v", err)
+	}
+	if err := engine.verifyContractValidators(chain, tampered); err != errInconsistentValidatorSet {
+		t.Errorf("error mismatch: have %v, want %v", err, errInconsistentValidatorSet)
+	}
+	if err := engine.verifyContractValidators(chain, header); err != nil {
+		t.Errorf("failed to verify epoch validators: %v", err)
+	}
+	// Once the epoch block is applied, the snapshot follows the contract
+	sealed := makeBlock(chain, engine, block)
+	if _, err := chain.InsertChain(types.Blocks{sealed}); err != nil {
+		t.Fatalf("failed to insert epoch block: %v", err)
+	}
+	if snap, err = engine.snapshot(chain, 2, sealed.Hash(), nil); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if have := snap.validators(); !reflect.DeepEqual(have, want) {
+		t.Errorf("snapshot validators mismatch: have %x, want %x", have, want)
+	}
+	if len(snap.Tally) != 0 {
+		t.Errorf("votes tallied in governance mode: %v", snap.Tally)
+	}
+}
+
+func TestGovernedEmptyValidatorSet(t *testing.T) {
+	chain, engine := newGovernedBlockChain(1, nil)
+	defer engine.Stop()
+
+	header := makeHeader(chain.Genesis(), engine.config)
+	if err := engine.Prepare(chain, header); err != errEmptyValidatorSet {
+		t.Errorf("error mismatch: have %v, want %v", err, errEmptyValidatorSet)
+	}
+}
+
+func TestGovernedValidatorWeights(t *testing.T) {
+	others := []common.Address{
+		common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff"),
+		common.HexToAddress("0x0000000000000000000000000000000000000001"),
+	}
+	chain, engine := newGovernedBlockChain(1, others, 1, 3, 2)
+	defer engine.Stop()
+
+	header := makeHeader(chain.Genesis(), engine.config)
+	if err := engine.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare epoch block: %v", err)
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		t.Fatalf("failed to extract extra-data: %v", err)
+	}
+	// The local validator sorts between the others, its weight is the first one
+	want := []common.Address{others[1], engine.Address(), others[0]}
+	if !reflect.DeepEqual(extra.Validators, want) {
+		t.Errorf("epoch validators mismatch: have %x, want %x", extra.Validators, want)
+	}
+	if want := []uint64{2, 1, 3}; !reflect.DeepEqual(extra.Weights, want) {
+		t.Errorf("epoch weights mismatch: have %v, want %v", extra.Weights, want)
+	}
+	if err := engine.verifyContractValidators(chain, header); err != nil {
+		t.Errorf("failed to verify epoch validators: %v", err)
+	}
+	// Headers dropping the weights are rejected
+	tampered := types.CopyHeader(header)
+	tampered.Extra, _ = prepareExtra(tampered, want, nil)
+	if err := engine.verifyContractValidators(chain, tampered); err != errInconsistentValidatorSet {
+		t.Errorf("error mismatch: have %v, want %v", err, errInconsistentValidatorSet)
+	}
+}
+
+func TestGovernedInvalidWeights(t *testing.T) {
+	others := []common.Address{common.HexToAddress("0xffffffffffffffffffffffffffffffffffffffff")}
+
+	chain, engine := newGovernedBlockChain(1, others, 1, 0)
+	defer engine.Stop()
+
+	header := makeHeader(chain.Genesis(), engine.config)
+	if err := engine.Prepare(chain, header); err != errInvalidContractWeights {
+		t.Errorf("error mismatch: have %v, want %v", err, errInvalidContractWeights)
+	}
+}
+
+func TestNormalizeValidators(t *testing.T) {
+	a, b, c := common.Address{1}, common.Address{2}, common.Address{3}
+
+	have, weights, err := normalizeValidators([]common.Address{c, a, b, a, c}, nil)
+	if err != nil {
+		t.Fatalf("failed to normalize validators: %v", err)
+	}
+	if want := []common.Address{a, b, c}; !reflect.DeepEqual(have, want) {
+		t.Errorf("validators mismatch: have %x, want %x", have, want)
+	}
+	if weights != nil {
+		t.Errorf("weights mismatch: have %v, want nil", weights)
+	}
+	// Weights follow their validators, duplicates keep the first one
+	have, weights, err = normalizeValidators([]common.Address{c, a, b, a, c}, []uint64{3, 1, 2, 4, 5})
+	if err != nil {
+		t.Fatalf("failed to normalize validators: %v", err)
+	}
+	if want := []common.Address{a, b, c}; !reflect.DeepEqual(have, want) {
+		t.Errorf("validators mismatch: have %x, want %x", have, want)
+	}
+	if want := []uint64{1, 2, 3}; !reflect.DeepEqual(weights, want) {
+		t.Errorf("weights mismatch: have %v, want %v", weights, want)
+	}
+	// Default weights are dropped
+	if _, weights, _ = normalizeValidators([]common.Address{b, a}, []uint64{1, 1}); weights != nil {
+		t.Errorf("weights mismatch: have %v, want nil", weights)
+	}
+	if _, _, err := normalizeValidators(nil, nil); err != errEmptyValidatorSet {
+		t.Errorf("error mismatch: have %v, want %v", err, errEmptyValidatorSet)
+	}
+}
@@ -50,10 +50,6 @@ func (sb *backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 	defer sb.coreMu.Unlock()
 
 	if msg.Code == istanbulMsg {
-		if !sb.coreStarted {
-			return true, istanbul.ErrStoppedEngine
-		}
-
 		var data []byte
 		if err := msg.Decode(&data); err != nil {
 			return true, errDecodeFailed
@@ -78,6 +74,12 @@ func (sb *backend) HandleMsg(addr common.Address, msg p2p.Msg) (bool, error) {
 		}
 		sb.knownMessages.Add(hash, true)
 
+		// Nodes not taking part in the consensus relay the message to the
+		// validators they are connected to
+		if !sb.coreStarted {
+			sb.relayToValidators(hash, data)
+			return true, nil
+		}
 		go sb.istanbulEventMux.Post(istanbul.MessageEvent{
 			Payload: data,
 		})
@@ -99,5 +101,6 @@ func (sb *backend) NewChainHead() error {
 		return istanbul.ErrStoppedEngine
 	}
 	go sb.istanbulEventMux.Post(istanbul.FinalCommittedEvent{})
+	sb.updateOverlay()
 	return nil
 }
@@ -0,0 +1,189 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// SetPeerManager implements consensus.Overlay.SetPeerManager
+func (sb *backend) SetPeerManager(manager consensus.PeerManager, chain consensus.ChainReader, nodes []*discover.Node) {
+	sb.overlayMu.Lock()
+	defer sb.overlayMu.Unlock()
+
+	sb.peerManager = manager
+	sb.overlayChain = chain
+	sb.enodes = make(map[common.Address]*discover.Node)
+	for _, node := range nodes {
+		pubkey, err := node.ID.Pubkey()
+		if err != nil {
+			continue
+		}
+		sb.enodes[crypto.PubkeyToAddress(*pubkey)] = node
+	}
+}
+
+// headValidators returns the validator set of the current chain head, or nil if
+// the overlay has no chain.
+func (sb *backend) headValidators() (*types.Header, istanbul.ValidatorSet) {
+	if sb.overlayChain == nil {
+		return nil, nil
+	}
+	head := sb.overlayChain.CurrentHeader()
+	snap, err := sb.snapshot(sb.overlayChain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		return nil, nil
+	}
+	return head, snap.ValSet
+}
+
+// updateOverlay keeps direct connections to the known validators of the current
+// chain head, and drops the ones to nodes which stopped being validators. If the
+// local node isn't a validator, all the overlay connections are dropped.
+func (sb *backend) updateOverlay() {
+	sb.overlayMu.Lock()
+	defer sb.overlayMu.Unlock()
+
+	if sb.peerManager == nil {
+		return
+	}
+	wanted := make(map[common.Address]bool)
+	if head, valSet := sb.headValidators(); sb.coreStarted && valSet != nil {
+		if _, v := valSet.GetByAddress(sb.Address()); v != nil {
+			sb.resolveProposer(head)
+			for _, val := range valSet.List() {
+				if _, ok := sb.enodes[val.Address()]; ok && val.Address() != sb.Address() {
+					wanted[val.Address()] = true
+				}
+			}
+		}
+	}
+	for addr := range wanted {
+		if _, ok := sb.dialed[addr]; !ok {
+			sb.logger.Debug("Connecting to validator", "address", addr, "enode", sb.enodes[addr])
+			sb.peerManager.AddPeer(sb.enodes[addr])
+			sb.dialed[addr] = sb.enodes[addr]
+		}
+	}
+	for addr, node := range sb.dialed {
+		if !wanted[addr] {
+			sb.logger.Debug("Disconnecting from former validator", "address", addr, "enode", node)
+			sb.peerManager.RemovePeer(node)
+			delete(sb.dialed, addr)
+		}
+	}
+}
+
+// resolveProposer recovers the node ID of the proposer of a header from its seal
+// and, if the enode of the proposer isn't known, looks up its enode record through
+// the peer manager in the background. The proposer is connected to on a later
+// update of the overlay once its enode is found. The caller has to hold overlayMu.
+func (sb *backend) resolveProposer(header *types.Header) {
+	if header.Number.Sign() == 0 {
+		return
+	}
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return
+	}
+	pubkey, err := crypto.SigToPub(crypto.Keccak256(sigHash(header).Bytes()), extra.Seal)
+	if err != nil {
+		return
+	}
+	addr := crypto.PubkeyToAddress(*pubkey)
+	if _, ok := sb.enodes[addr]; ok || sb.resolving[addr] || addr == sb.Address() {
+		return
+	}
+	sb.resolving[addr] = true
+
+	manager, id := sb.peerManager, discover.PubkeyID(pubkey)
+	go func() {
+		node := manager.Resolve(id)
+
+		sb.overlayMu.Lock()
+		defer sb.overlayMu.Unlock()
+
+		delete(sb.resolving, addr)
+		if node != nil {
+			sb.logger.Debug("Found validator enode", "address", addr, "enode", node)
+			sb.enodes[addr] = node
+		}
+	}()
+}
+
+// sendToPeer sends a message to a peer, unless the peer is known to have it.
+func (sb *backend) sendToPeer(addr common.Address, p consensus.Peer, hash common.Hash, payload []byte) {
+	ms, ok := sb.recentMessages.Get(addr)
+	var m *lru.ARCCache
+	if ok {
+		m, _ = ms.(*lru.ARCCache)
+		if _, k := m.Get(hash); k {
+			// This peer had this event, skip it
+			return
+		}
+	} else {
+		m, _ = lru.NewARC(inmemoryMessages)
+	}
+
+	m.Add(hash, true)
+	sb.recentMessages.Add(addr, m)
+
+	go p.Send(istanbulMsg, payload)
+}
+
+// relayToValidators sends a message to the connected peers which are validators
+// of the current chain head. Nodes not taking part in the consensus relay the
+// messages this way, for them to reach the validators without a direct connection
+// to the sender, without flooding the rest of the network.
+func (sb *backend) relayToValidators(hash common.Hash, payload []byte) {
+	if sb.broadcaster == nil {
+		return
+	}
+	sb.overlayMu.Lock()
+	_, valSet := sb.headValidators()
+	sb.overlayMu.Unlock()
+
+	if valSet == nil {
+		return
+	}
+	targets := make(map[common.Address]bool)
+	for _, val := range valSet.List() {
+		targets[val.Address()] = true
+	}
+	for addr, p := range sb.broadcaster.FindPeers(targets) {
+		sb.sendToPeer(addr, p, hash, payload)
+	}
+}
+
+// relay sends a message to every peer which isn't one of the given validators,
+// for the message to reach the validators we have no direct connection to.
+func (sb *backend) relay(hash common.Hash, payload []byte, validators map[common.Address]bool) {
+	if sb.broadcaster == nil {
+		return
+	}
+	for addr, p := range sb.broadcaster.Peers() {
+		if !validators[addr] {
+			sb.sendToPeer(addr, p, hash, payload)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backend
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// testPeerManager records the connections requested by the overlay, and resolves
+// the enodes of a fixed set of nodes.
+type testPeerManager struct {
+	peers   map[discover.NodeID]bool
+	records map[discover.NodeID]*discover.Node
+}
+
+func (pm *testPeerManager) AddPeer(node *discover.Node)    { pm.peers[node.ID] = true }
+func (pm *testPeerManager) RemovePeer(node *discover.Node) { delete(pm.peers, node.ID) }
+
+func (pm *testPeerManager) Resolve(id discover.NodeID) *discover.Node {
+	return pm.records[id]
+}
+
+// testPeer records the messages sent to it.
+type testPeer struct {
+	sent chan []byte
+}
+
+func (p *testPeer) Send(msgcode uint64, data interface{}) error {
+	p.sent <- data.([]byte)
+	return nil
+}
+
+// testBroadcaster is a fixed set of connected peers.
+type testBroadcaster struct {
+	peers map[common.Address]consensus.Peer
+}
+
+func (b *testBroadcaster) Enqueue(id string, block *types.Block) {}
+
+func (b *testBroadcaster) FindPeers(targets map[common.Address]bool) map[common.Address]consensus.Peer {
+	m := make(map[common.Address]consensus.Peer)
+	for addr, p := range b.peers {
+		if targets[addr] {
+			m[addr] = p
+		}
+	}
+	return m
+}
+
+func (b *testBroadcaster) Peers() map[common.Address]consensus.Peer {
+	return b.peers
+}
+
+// newOverlayBackend creates a started backend belonging to a set of n validators,
+// returning the keys of all of them.
+func newOverlayBackend(n int) (*backend, []*ecdsa.PrivateKey) {
+	genesis, keys := getGenesisAndKeys(n)
+	memDB, _ := ethdb.NewMemDatabase()
+	config := *istanbul.DefaultConfig
+
+	b, _ := New(&config, keys[0], memDB).(*backend)
+	genesis.MustCommit(memDB)
+	chain, err := core.NewBlockChain(memDB, nil, genesis.Config, b, vm.Config{})
+	if err != nil {
+		panic(err)
+	}
+	b.Start(chain, chain.CurrentBlock, chain.HasBadBlock)
+	return b, keys
+}
+
+func testEnode(key *ecdsa.PrivateKey) *discover.Node {
+	return discover.NewNode(discover.PubkeyID(&key.PublicKey), []byte{127, 0, 0, 1}, 30303, 30303)
+}
+
+func expectSent(t *testing.T, name string, p *testPeer, want bool) {
+	select {
+	case <-p.sent:
+		if !want {
+			t.Errorf("%s: unexpected message", name)
+		}
+	case <-time.After(100 * time.Millisecond):
+		if want {
+			t.Errorf("%s: message not sent", name)
+		}
+	}
+}
+
+func TestOverlayConnections(t *testing.T) {
+	b, keys := newOverlayBackend(4)
+	outsider, _ := crypto.GenerateKey()
+
+	// Only the known validators other than ourselves get connected
+	pm := &testPeerManager{peers: make(map[discover.NodeID]bool)}
+	b.SetPeerManager(pm, b.chain, []*discover.Node{testEnode(keys[0]), testEnode(keys[1]), testEnode(keys[2]), testEnode(outsider)})
+	b.updateOverlay()
+
+	for i, want := range []bool{false, true, true, false} {
+		if have := pm.peers[testEnode(keys[i]).ID]; have != want {
+			t.Errorf("validator %d: connection mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	if pm.peers[testEnode(outsider).ID] {
+		t.Errorf("connected to a non-validator")
+	}
+	// Once we stop validating, the overlay is torn down
+	b.Stop()
+	if len(pm.peers) != 0 {
+		t.Errorf("overlay connections left after stopping: %v", pm.peers)
+	}
+}
+
+func TestOverlayResolveProposer(t *testing.T) {
+	b, keys := newOverlayBackend(2)
+	defer b.Stop()
+
+	remote := testEnode(keys[1])
+	pm := &testPeerManager{
+		peers:   make(map[discover.NodeID]bool),
+		records: map[discover.NodeID]*discover.Node{remote.ID: remote},
+	}
+	b.SetPeerManager(pm, b.chain, nil)
+
+	// A header proposed by the other validator reveals its node ID
+	header := makeHeader(b.currentBlock(), b.config)
+	b.Prepare(b.chain, header)
+	seal, err := crypto.Sign(crypto.Keccak256(sigHash(header).Bytes()), keys[1])
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	writeSeal(header, seal)
+
+	b.overlayMu.Lock()
+	b.resolveProposer(header)
+	b.overlayMu.Unlock()
+
+	addr := crypto.PubkeyToAddress(keys[1].PublicKey)
+	for i := 0; i < 100; i++ {
+		b.overlayMu.Lock()
+		node := b.enodes[addr]
+		b.overlayMu.Unlock()
+		if node != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The next update of the overlay connects to the resolved enode
+	b.updateOverlay()
+	if !pm.peers[remote.ID] {
+		t.Errorf("resolved validator not connected")
+	}
+}
+
+func TestGossipRelayFallback(t *testing.T) {
+	b, keys := newOverlayBackend(4)
+	defer b.Stop()
+
+	var (
+		validator = &testPeer{sent: make(chan []byte, 1)}
+		other     = &testPeer{sent: make(chan []byte, 1)}
+		peers     = map[common.Address]consensus.Peer{
+			crypto.PubkeyToAddress(keys[1].PublicKey): validator,
+			common.HexToAddress("0x01"):               other,
+		}
+	)
+	b.SetBroadcaster(&testBroadcaster{peers: peers})
+	valSet := b.Validators(b.currentBlock())
+
+	// Some validators are unreachable, the other peers relay the message
+	b.Gossip(valSet, []byte("partial"))
+	expectSent(t, "validator", validator, true)
+	expectSent(t, "other", other, true)
+
+	// With every validator connected, the message only goes to the validators
+	for _, key := range keys[2:] {
+		peers[crypto.PubkeyToAddress(key.PublicKey)] = &testPeer{sent: make(chan []byte, 1)}
+	}
+	b.Gossip(valSet, []byte("complete"))
+	expectSent(t, "validator", validator, true)
+	expectSent(t, "other", other, false)
+}
+
+func TestStoppedEngineRelay(t *testing.T) {
+	b, keys := newOverlayBackend(3)
+	b.Stop()
+
+	var (
+		sender    = &testPeer{sent: make(chan []byte, 1)}
+		validator = &testPeer{sent: make(chan []byte, 1)}
+		other     = &testPeer{sent: make(chan []byte, 1)}
+	)
+	b.SetPeerManager(&testPeerManager{peers: make(map[discover.NodeID]bool)}, b.chain, nil)
+	b.SetBroadcaster(&testBroadcaster{peers: map[common.Address]consensus.Peer{
+		crypto.PubkeyToAddress(keys[1].PublicKey): sender,
+		crypto.PubkeyToAddress(keys[2].PublicKey): validator,
+		common.HexToAddress("0x01"):               other,
+	}})
+	// Messages are only relayed to the validators
+	if _, err := b.HandleMsg(crypto.PubkeyToAddress(keys[1].PublicKey), makeMsg(istanbulMsg, []byte("data"))); err != nil {
+		t.Fatalf("failed to handle message: %v", err)
+	}
+	expectSent(t, "sender", sender, false)
+	expectSent(t, "validator", validator, true)
+	expectSent(t, "other", other, false)
+
+	// Known messages are not relayed again
+	if _, err := b.HandleMsg(common.HexToAddress("0x01"), makeMsg(istanbulMsg, []byte("data"))); err != nil {
+		t.Fatalf("failed to handle message: %v", err)
+	}
+	expectSent(t, "sender", sender, false)
+	expectSent(t, "validator", validator, false)
+}
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -34,17 +35,21 @@ const (
 // Vote represents a single vote that an authorized validator made to modify the
 // list of authorizations.
 type Vote struct {
-	Validator common.Address `json:"validator"` // Authorized validator that cast this vote
-	Block     uint64         `json:"block"`     // Block number the vote was cast in (expire old votes)
-	Address   common.Address `json:"address"`   // Account being voted on to change its authorization
-	Authorize bool           `json:"authorize"` // Whether to authorize or deauthorize the voted account
+	Validator common.Address `json:"validator"`        // Authorized validator that cast this vote
+	Block     uint64         `json:"block"`            // Block number the vote was cast in (expire old votes)
+	Address   common.Address `json:"address"`          // Account being voted on to change its authorization
+	Authorize bool           `json:"authorize"`        // Whether to authorize or deauthorize the voted account
+	Weight    uint64         `json:"weight,omitempty"` // Voting power to assign to the account (0 = unchanged or default)
+	BLSKey    hexutil.Bytes  `json:"blsKey,omitempty"` // BLS public key to register for the account (empty = unchanged)
 }
 
 // Tally is a simple vote tally to keep the current score of votes. Votes that
 // go against the proposal aren't counted since it's equivalent to not voting.
 type Tally struct {
-	Authorize bool `json:"authorize"` // Whether the vote it about authorizing or kicking someone
-	Votes     int  `json:"votes"`     // Number of votes until now wanting to pass the proposal
+	Authorize bool          `json:"authorize"`        // Whether the vote it about authorizing or kicking someone
+	Weight    uint64        `json:"weight,omitempty"` // Voting power the vote is about to assign
+	BLSKey    hexutil.Bytes `json:"blsKey,omitempty"` // BLS public key the vote is about to register
+	Votes     int           `json:"votes"`            // Number of votes until now wanting to pass the proposal
 }
 
 // Snapshot is the state of the authorization voting at a given point in time.
@@ -56,6 +61,10 @@ type Snapshot struct {
 	Votes  []*Vote                  // List of votes cast in chronological order
 	Tally  map[common.Address]Tally // Current vote tally to avoid recalculating
 	ValSet istanbul.ValidatorSet    // Set of authorized validators at this moment
+
+	BLSKeys map[common.Address][]byte // Registered BLS public keys of the validators
+
+	governed bool // Whether the validator set is taken from the epoch headers instead of votes
 }
 
 // newSnapshot create a new snapshot with the specified startup parameters. This
@@ -63,11 +72,12 @@ type Snapshot struct {
 // the genesis block.
 func newSnapshot(epoch uint64, number uint64, hash common.Hash, valSet istanbul.ValidatorSet) *Snapshot {
 	snap := &Snapshot{
-		Epoch:  epoch,
-		Number: number,
-		Hash:   hash,
-		ValSet: valSet,
-		Tally:  make(map[common.Address]Tally),
+		Epoch:   epoch,
+		Number:  number,
+		Hash:    hash,
+		ValSet:  valSet,
+		Tally:   make(map[common.Address]Tally),
+		BLSKeys: make(map[common.Address][]byte),
 	}
 	return snap
 }
@@ -99,53 +109,71 @@ func (s *Snapshot) store(db ethdb.Database) error {
 // copy creates a deep copy of the snapshot, though not the individual votes.
 func (s *Snapshot) copy() *Snapshot {
 	cpy := &Snapshot{
-		Epoch:  s.Epoch,
-		Number: s.Number,
-		Hash:   s.Hash,
-		ValSet: s.ValSet.Copy(),
-		Votes:  make([]*Vote, len(s.Votes)),
-		Tally:  make(map[common.Address]Tally),
+		Epoch:    s.Epoch,
+		Number:   s.Number,
+		Hash:     s.Hash,
+		ValSet:   s.ValSet.Copy(),
+		Votes:    make([]*Vote, len(s.Votes)),
+		Tally:    make(map[common.Address]Tally),
+		BLSKeys:  make(map[common.Address][]byte),
+		governed: s.governed,
 	}
 
 	for address, tally := range s.Tally {
 		cpy.Tally[address] = tally
 	}
+	for address, key := range s.BLSKeys {
+		cpy.BLSKeys[address] = key
+	}
 	copy(cpy.Votes, s.Votes)
 
 	return cpy
 }
 
-// checkVote return whether it's a valid vote
-func (s *Snapshot) checkVote(address common.Address, authorize bool) bool {
+// checkVote return whether it's a valid vote. An authorize vote on an existing
+// validator is only valid if it changes the validator's weight or BLS key. In
+// governance mode, only the votes registering a new BLS key are valid.
+func (s *Snapshot) checkVote(address common.Address, authorize bool, weight uint64, key []byte) bool {
+	newKey := len(key) > 0 && !bytes.Equal(s.BLSKeys[address], key)
+	if s.governed {
+		return authorize && newKey
+	}
 	_, validator := s.ValSet.GetByAddress(address)
+	if validator != nil && authorize {
+		return (weight != 0 && validator.Weight() != weight) || newKey
+	}
 	return (validator != nil && !authorize) || (validator == nil && authorize)
 }
 
 // cast adds a new vote into the tally.
-func (s *Snapshot) cast(address common.Address, authorize bool) bool {
+func (s *Snapshot) cast(address common.Address, authorize bool, weight uint64, key []byte) bool {
 	// Ensure the vote is meaningful
-	if !s.checkVote(address, authorize) {
+	if !s.checkVote(address, authorize, weight, key) {
 		return false
 	}
 	// Cast the vote into an existing or new tally
 	if old, ok := s.Tally[address]; ok {
+		// Votes for a different weight or key don't count towards the running tally
+		if old.Weight != weight || !bytes.Equal(old.BLSKey, key) {
+			return false
+		}
 		old.Votes++
 		s.Tally[address] = old
 	} else {
-		s.Tally[address] = Tally{Authorize: authorize, Votes: 1}
+		s.Tally[address] = Tally{Authorize: authorize, Weight: weight, BLSKey: key, Votes: 1}
 	}
 	return true
 }
 
 // uncast removes a previously cast vote from the tally.
-func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
+func (s *Snapshot) uncast(address common.Address, authorize bool, weight uint64, key []byte) bool {
 	// If there's no tally, it's a dangling vote, just drop
 	tally, ok := s.Tally[address]
 	if !ok {
 		return false
 	}
 	// Ensure we only revert counted votes
-	if tally.Authorize != authorize {
+	if tally.Authorize != authorize || tally.Weight != weight || !bytes.Equal(tally.BLSKey, key) {
 		return false
 	}
 	// Otherwise revert the vote
@@ -158,6 +186,21 @@ func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
 	return true
 }
 
+// tallyWeight returns the voting power of the validators whose votes on the given
+// account are counted in its tally.
+func (s *Snapshot) tallyWeight(address common.Address) uint64 {
+	weight := uint64(0)
+	for _, vote := range s.Votes {
+		if vote.Address != address {
+			continue
+		}
+		if _, v := s.ValSet.GetByAddress(vote.Validator); v != nil {
+			weight += v.Weight()
+		}
+	}
+	return weight
+}
+
 // apply creates a new authorization snapshot by applying the given headers to
 // the original one.
 func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
@@ -192,12 +235,19 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 		if _, v := snap.ValSet.GetByAddress(validator); v == nil {
 			return nil, errUnauthorized
 		}
+		// In governance mode, the validator set is replaced at every epoch block
+		// by the one the proposer read from the governance contract
+		if snap.governed && number%s.Epoch == 0 {
+			if snap.ValSet, err = headerValidatorSet(header, snap.ValSet.Policy()); err != nil {
+				return nil, err
+			}
+		}
 
 		// Header authorized, discard any previous votes from the validator
 		for i, vote := range snap.Votes {
 			if vote.Validator == validator && vote.Address == header.Coinbase {
 				// Uncast the vote from the cached tally
-				snap.uncast(vote.Address, vote.Authorize)
+				snap.uncast(vote.Address, vote.Authorize, vote.Weight, vote.BLSKey)
 
 				// Uncast the vote from the chronological list
 				snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
@@ -205,35 +255,46 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 			}
 		}
 		// Tally up the new vote from the validator
-		var authorize bool
-		switch {
-		case bytes.Equal(header.Nonce[:], nonceAuthVote):
-			authorize = true
-		case bytes.Equal(header.Nonce[:], nonceDropVote):
-			authorize = false
-		default:
-			return nil, errInvalidVote
+		authorize, weight, err := decodeVote(header.Nonce)
+		if err != nil {
+			return nil, err
 		}
-		if snap.cast(header.Coinbase, authorize) {
+		key, err := headerBLSKey(header)
+		if err != nil {
+			return nil, err
+		}
+		if snap.cast(header.Coinbase, authorize, weight, key) {
 			snap.Votes = append(snap.Votes, &Vote{
 				Validator: validator,
 				Block:     number,
 				Address:   header.Coinbase,
 				Authorize: authorize,
+				Weight:    weight,
+				BLSKey:    key,
 			})
 		}
-		// If the vote passed, update the list of validators
-		if tally := snap.Tally[header.Coinbase]; tally.Votes > snap.ValSet.Size()/2 {
-			if tally.Authorize {
+		// If the vote passed, update the list of validators and their keys
+		if tally := snap.Tally[header.Coinbase]; 2*snap.tallyWeight(header.Coinbase) > snap.ValSet.TotalWeight() {
+			if len(tally.BLSKey) > 0 {
+				snap.BLSKeys[header.Coinbase] = tally.BLSKey
+			}
+			switch {
+			case snap.governed:
+				// Only keys are voted on, the validators come from the contract
+			case tally.Authorize:
 				snap.ValSet.AddValidator(header.Coinbase)
-			} else {
+				if tally.Weight != 0 {
+					snap.ValSet.SetWeight(header.Coinbase, tally.Weight)
+				}
+			default:
 				snap.ValSet.RemoveValidator(header.Coinbase)
+				delete(snap.BLSKeys, header.Coinbase)
 
 				// Discard any previous votes the deauthorized validator cast
 				for i := 0; i < len(snap.Votes); i++ {
 					if snap.Votes[i].Validator == header.Coinbase {
 						// Uncast the vote from the cached tally
-						snap.uncast(snap.Votes[i].Address, snap.Votes[i].Authorize)
+						snap.uncast(snap.Votes[i].Address, snap.Votes[i].Authorize, snap.Votes[i].Weight, snap.Votes[i].BLSKey)
 
 						// Uncast the vote from the chronological list
 						snap.Votes = append(snap.Votes[:i], snap.Votes[i+1:]...)
@@ -258,6 +319,35 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 	return snap, nil
 }
 
+// decodeVote interprets the nonce of a header as a vote. Besides the two magic
+// values to authorize or drop a validator, any nonce up to maxVoteWeight is a
+// vote to authorize a validator with, or change its voting power to, that weight.
+func decodeVote(nonce types.BlockNonce) (authorize bool, weight uint64, err error) {
+	switch {
+	case bytes.Equal(nonce[:], nonceAuthVote):
+		return true, 0, nil
+	case bytes.Equal(nonce[:], nonceDropVote):
+		return false, 0, nil
+	case nonce.Uint64() <= maxVoteWeight:
+		return true, nonce.Uint64(), nil
+	default:
+		return false, 0, errInvalidVote
+	}
+}
+
+// headerBLSKey returns the BLS public key registered by a header for the account
+// voted on, or nil if the header registers none.
+func headerBLSKey(header *types.Header) ([]byte, error) {
+	extra, err := types.ExtractIstanbulExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(extra.BLSKey) == 0 {
+		return nil, nil
+	}
+	return decodeBLSKey(extra.BLSKey)
+}
+
 // validators retrieves the list of authorized validators in ascending order.
 func (s *Snapshot) validators() []common.Address {
 	validators := make([]common.Address, 0, s.ValSet.Size())
@@ -274,6 +364,26 @@ func (s *Snapshot) validators() []common.Address {
 	return validators
 }
 
+// weights retrieves the voting power of the authorized validators in the order of
+// validators(). It returns nil if every validator has the default weight of 1.
+func (s *Snapshot) weights() []uint64 {
+	var (
+		weights  = make([]uint64, 0, s.ValSet.Size())
+		weighted = false
+	)
+	for _, address := range s.validators() {
+		_, v := s.ValSet.GetByAddress(address)
+		weights = append(weights, v.Weight())
+		if v.Weight() != 1 {
+			weighted = true
+		}
+	}
+	if !weighted {
+		return nil
+	}
+	return weights
+}
+
 type snapshotJSON struct {
 	Epoch  uint64                   `json:"epoch"`
 	Number uint64                   `json:"number"`
@@ -283,19 +393,28 @@ type snapshotJSON struct {
 
 	// for validator set
 	Validators []common.Address        `json:"validators"`
+	Weights    []uint64                `json:"weights,omitempty"`
 	Policy     istanbul.ProposerPolicy `json:"policy"`
+
+	BLSKeys map[common.Address]hexutil.Bytes `json:"blsKeys,omitempty"`
 }
 
 func (s *Snapshot) toJSONStruct() *snapshotJSON {
-	return &snapshotJSON{
+	j := &snapshotJSON{
 		Epoch:      s.Epoch,
 		Number:     s.Number,
 		Hash:       s.Hash,
 		Votes:      s.Votes,
 		Tally:      s.Tally,
 		Validators: s.validators(),
+		Weights:    s.weights(),
 		Policy:     s.ValSet.Policy(),
+		BLSKeys:    make(map[common.Address]hexutil.Bytes),
 	}
+	for address, key := range s.BLSKeys {
+		j.BLSKeys[address] = key
+	}
+	return j
 }
 
 // Unmarshal from a json byte array
@@ -310,7 +429,11 @@ func (s *Snapshot) UnmarshalJSON(b []byte) error {
 	s.Hash = j.Hash
 	s.Votes = j.Votes
 	s.Tally = j.Tally
-	s.ValSet = validator.NewSet(j.Validators, j.Policy)
+	s.ValSet = validator.NewWeightedSet(j.Validators, j.Weights, j.Policy)
+	s.BLSKeys = make(map[common.Address][]byte)
+	for address, key := range j.BLSKeys {
+		s.BLSKeys[address] = key
+	}
 	return nil
 }
 
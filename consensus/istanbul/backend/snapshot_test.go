@@ -37,6 +37,7 @@ type testerVote struct {
 	validator string
 	voted     string
 	auth      bool
+	weight    uint64
 }
 
 // testerAccountPool is a pool to maintain currently active tester accounts,
@@ -81,6 +82,7 @@ func TestVoting(t *testing.T) {
 		validators []string
 		votes      []testerVote
 		results    []string
+		weights    map[string]uint64 // Expected non-default weights of the results
 	}{
 		{
 			// Single validator, no votes cast
@@ -312,6 +314,37 @@ func TestVoting(t *testing.T) {
 				{validator: "B", voted: "C", auth: true},
 			},
 			results: []string{"A", "B"},
+		}, {
+			// Single validator, voting to add another with a weight
+			validators: []string{"A"},
+			votes: []testerVote{
+				{validator: "A", voted: "B", weight: 3},
+			},
+			results: []string{"A", "B"},
+			weights: map[string]uint64{"B": 3},
+		}, {
+			// Two validators, changing the weight of one needs both votes for the same weight
+			epoch:      30000,
+			validators: []string{"A", "B"},
+			votes: []testerVote{
+				{validator: "A", voted: "B", weight: 2},
+				{validator: "B", voted: "B", weight: 5}, // Different weight, not counted
+				{validator: "B", voted: "B", weight: 2},
+			},
+			results: []string{"A", "B"},
+			weights: map[string]uint64{"B": 2},
+		}, {
+			// Three validators, a majority by headcount doesn't pass a vote without a majority by weight
+			epoch:      30000,
+			validators: []string{"A", "B", "C"},
+			votes: []testerVote{
+				{validator: "B", voted: "A", weight: 4},
+				{validator: "C", voted: "A", weight: 4},
+				{validator: "B", voted: "D", auth: true},
+				{validator: "C", voted: "D", auth: true},
+			},
+			results: []string{"A", "B", "C"},
+			weights: map[string]uint64{"A": 4},
 		},
 	}
 	// Run through the scenarios and test them
@@ -336,7 +369,7 @@ func TestVoting(t *testing.T) {
 			Mixhash:    types.IstanbulDigest,
 		}
 		b := genesis.ToBlock(nil)
-		extra, _ := prepareExtra(b.Header(), validators)
+		extra, _ := prepareExtra(b.Header(), validators, nil)
 		genesis.ExtraData = extra
 		// Create a pristine blockchain with the genesis injected
 		db, _ := ethdb.NewMemDatabase()
@@ -359,7 +392,7 @@ func TestVoting(t *testing.T) {
 				Difficulty: defaultDifficulty,
 				MixDigest:  types.IstanbulDigest,
 			}
-			extra, _ := prepareExtra(headers[j], validators)
+			extra, _ := prepareExtra(headers[j], validators, nil)
 			headers[j].Extra = extra
 			if j > 0 {
 				headers[j].ParentHash = headers[j-1].Hash()
@@ -367,6 +400,9 @@ func TestVoting(t *testing.T) {
 			if vote.auth {
 				copy(headers[j].Nonce[:], nonceAuthVote)
 			}
+			if vote.weight != 0 {
+				headers[j].Nonce = types.EncodeNonce(vote.weight)
+			}
 			copy(headers[j].Extra, genesis.ExtraData)
 			accounts.sign(headers[j], vote.validator)
 		}
@@ -400,6 +436,15 @@ func TestVoting(t *testing.T) {
 				t.Errorf("test %d, validator %d: validator mismatch: have %x, want %x", i, j, result[j], validators[j])
 			}
 		}
+		for _, validator := range tt.results {
+			want, ok := tt.weights[validator]
+			if !ok {
+				want = 1
+			}
+			if _, v := snap.ValSet.GetByAddress(accounts.address(validator)); v.Weight() != want {
+				t.Errorf("test %d, validator %s: weight mismatch: have %d, want %d", i, validator, v.Weight(), want)
+			}
+		}
 	}
 }
 
@@ -16,18 +16,30 @@
 
 package istanbul
 
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
 type ProposerPolicy uint64
 
 const (
 	RoundRobin ProposerPolicy = iota
 	Sticky
+	WeightedRoundRobin
 )
 
 type Config struct {
-	RequestTimeout uint64         `toml:",omitempty"` // The timeout for each Istanbul round in milliseconds.
-	BlockPeriod    uint64         `toml:",omitempty"` // Default minimum difference between two consecutive block's timestamps in second
-	ProposerPolicy ProposerPolicy `toml:",omitempty"` // The policy for proposer selection
-	Epoch          uint64         `toml:",omitempty"` // The number of blocks after which to checkpoint and reset the pending votes
+	RequestTimeout        uint64         `toml:",omitempty"` // The timeout for each Istanbul round in milliseconds.
+	CommitTimeout         uint64         `toml:",omitempty"` // The timeout for committing an accepted proposal in milliseconds, disabled if zero
+	RoundTimeoutIncrement uint64         `toml:",omitempty"` // The timeout added for every round change in milliseconds, exponential backoff if zero
+	MaxRoundTimeout       uint64         `toml:",omitempty"` // The upper bound of the round timeouts in milliseconds, unbounded if zero
+	BlockPeriod           uint64         `toml:",omitempty"` // Default minimum difference between two consecutive block's timestamps in second
+	ProposerPolicy        ProposerPolicy `toml:",omitempty"` // The policy for proposer selection
+	Epoch                 uint64         `toml:",omitempty"` // The number of blocks after which to checkpoint and reset the pending votes
+	ValidatorContract     common.Address `toml:"-"`          // The governance contract to read the validator set from at every epoch (chain config only), votes are used if empty
+	BLSBlock              *big.Int       `toml:",omitempty"` // The block from which committed seals are aggregated BLS signatures, never if nil
 }
 
 var DefaultConfig = &Config{
@@ -36,3 +48,9 @@ var DefaultConfig = &Config{
 	ProposerPolicy: RoundRobin,
 	Epoch:          30000,
 }
+
+// IsBLS returns whether the committed seals of the given block are aggregated
+// into a single BLS signature.
+func (c *Config) IsBLS(number *big.Int) bool {
+	return c.BLSBlock != nil && number != nil && c.BLSBlock.Cmp(number) <= 0
+}
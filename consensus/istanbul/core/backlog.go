@@ -17,6 +17,9 @@
 package core
 
 import (
+	"bytes"
+	"sort"
+
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
@@ -114,7 +117,16 @@ func (c *core) processBacklog() {
 	c.backlogsMu.Lock()
 	defer c.backlogsMu.Unlock()
 
-	for src, backlog := range c.backlogs {
+	// Walk the validators in a stable order to keep the handling reproducible
+	srcs := make([]istanbul.Validator, 0, len(c.backlogs))
+	for src := range c.backlogs {
+		srcs = append(srcs, src)
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return bytes.Compare(srcs[i].Address().Bytes(), srcs[j].Address().Bytes()) < 0
+	})
+	for _, src := range srcs {
+		backlog := c.backlogs[src]
 		if backlog == nil {
 			continue
 		}
@@ -162,7 +174,7 @@ func (c *core) processBacklog() {
 			}
 			logger.Trace("Post backlog event", "msg", msg)
 
-			go c.sendEvent(backlogEvent{
+			c.postEvent(backlogEvent{
 				src: src,
 				msg: msg,
 			})
@@ -68,11 +68,12 @@ func (c *core) handleCommit(msg *message, src istanbul.Validator) error {
 
 	c.acceptCommit(msg, src)
 
-	// Commit the proposal once we have enough COMMIT messages and we are not in the Committed state.
+	// Commit the proposal once we have enough COMMIT messages with valid committed
+	// seals and we are not in the Committed state.
 	//
 	// If we already have a proposal, we may have chance to speed up the consensus process
 	// by committing the proposal without PREPARE messages.
-	if c.current.Commits.Size() > 2*c.valSet.F() && c.state.Cmp(StateCommitted) < 0 {
+	if c.current.Commits.Weight() >= c.valSet.QuorumSize() && c.state.Cmp(StateCommitted) < 0 && c.verifyCommittedSeals() {
 		// Still need to call LockHash here since state can skip Prepared state and jump directly to the Committed state.
 		c.current.LockHash()
 		c.commit()
@@ -94,6 +95,35 @@ func (c *core) verifyCommit(commit *istanbul.Subject, src istanbul.Validator) er
 	return nil
 }
 
+// verifyCommittedSeals verifies the committed seals of the COMMIT messages at
+// once, when they reach a quorum, so that a single bad seal can't spoil the seals
+// we commit the proposal with. The messages with invalid seals are dropped, and
+// it returns whether the remaining ones still reach a quorum.
+func (c *core) verifyCommittedSeals() bool {
+	proposal := c.current.Proposal()
+	if proposal == nil {
+		return false
+	}
+	var (
+		commits = c.current.Commits.Values()
+		seals   = make([][]byte, len(commits))
+		signers = make([]common.Address, len(commits))
+	)
+	for i, commit := range commits {
+		seals[i], signers[i] = commit.CommittedSeal, commit.Address
+	}
+	invalid, err := c.backend.VerifyCommittedSeals(proposal, seals, signers)
+	if err != nil {
+		c.logger.Warn("Failed to verify committed seals", "err", err)
+		return false
+	}
+	for _, addr := range invalid {
+		c.logger.Warn("Invalid committed seal", "from", addr, "state", c.state)
+		c.current.Commits.Remove(addr)
+	}
+	return c.current.Commits.Weight() >= c.valSet.QuorumSize()
+}
+
 func (c *core) acceptCommit(msg *message, src istanbul.Validator) error {
 	logger := c.logger.New("from", src, "state", c.state)
 
@@ -225,6 +225,65 @@ OUTER:
 	}
 }
 
+func TestHandleCommitInvalidSeal(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	for i, backend := range sys.backends {
+		c := backend.engine.(*core)
+		c.valSet = backend.peers
+		c.current = newTestRoundState(
+			&istanbul.View{
+				Round:    big.NewInt(0),
+				Sequence: big.NewInt(1),
+			},
+			c.valSet,
+		)
+		if i == 0 {
+			// replica 0 is the proposer
+			c.state = StatePrepared
+		}
+	}
+	sys.Run(false)
+
+	v0 := sys.backends[0]
+	r0 := v0.engine.(*core)
+	bad := r0.valSet.GetByIndex(1).Address()
+	v0.invalidSeals = map[common.Address]bool{bad: true}
+
+	for i, v := range sys.backends {
+		validator := r0.valSet.GetByIndex(uint64(i))
+		m, _ := Encode(v.engine.(*core).current.Subject())
+		if err := r0.handleCommit(&message{
+			Code:          msgCommit,
+			Msg:           m,
+			Address:       validator.Address(),
+			Signature:     []byte{},
+			CommittedSeal: validator.Address().Bytes(), // small hack
+		}, validator); err != nil {
+			t.Fatalf("failed to handle commit %d: %v", i, err)
+		}
+		// The quorum reached with the third commit includes the invalid seal
+		if i == 2 {
+			if r0.state == StateCommitted {
+				t.Fatalf("committed with an invalid seal")
+			}
+			if r0.current.Commits.Get(bad) != nil {
+				t.Errorf("commit with an invalid seal kept")
+			}
+		}
+	}
+	if r0.state != StateCommitted {
+		t.Fatalf("state mismatch: have %v, want %v", r0.state, StateCommitted)
+	}
+	for _, seal := range v0.committedMsgs[0].committedSeals {
+		if bytes.Equal(seal[:common.AddressLength], bad.Bytes()) {
+			t.Errorf("invalid seal committed")
+		}
+	}
+	if have := len(v0.committedMsgs[0].committedSeals); have != 3 {
+		t.Errorf("committed seal count mismatch: have %d, want 3", have)
+	}
+}
+
 // round is not checked for now
 func TestVerifyCommit(t *testing.T) {
 	// for log purpose
@@ -24,16 +24,18 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
-	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"gopkg.in/karalabe/cookiejar.v2/collections/prque"
 )
 
-// New creates an Istanbul consensus core
-func New(backend istanbul.Backend, config *istanbul.Config) Engine {
+// New creates an Istanbul consensus core. If db is not nil, the consensus messages
+// are journaled into it so that a restarted validator resumes the current view.
+func New(backend istanbul.Backend, config *istanbul.Config, db ethdb.Database) Engine {
 	c := &core{
 		config:             config,
 		address:            backend.Address(),
@@ -45,11 +47,19 @@ func New(backend istanbul.Backend, config *istanbul.Config) Engine {
 		backlogsMu:         new(sync.Mutex),
 		pendingRequests:    prque.New(),
 		pendingRequestsMu:  new(sync.Mutex),
+		evidenceMu:         new(sync.RWMutex),
+		statusMu:           new(sync.RWMutex),
 		consensusTimestamp: time.Time{},
+		clock:              mclock.System{},
 		roundMeter:         metrics.NewRegisteredMeter("consensus/istanbul/core/round", nil),
 		sequenceMeter:      metrics.NewRegisteredMeter("consensus/istanbul/core/sequence", nil),
 		consensusTimer:     metrics.NewRegisteredTimer("consensus/istanbul/core/consensus", nil),
 	}
+	if db != nil {
+		c.db = db
+		c.wal = newWAL(db)
+		c.loadEvidence()
+	}
 	c.validateFn = c.checkValidatorSignature
 	return c
 }
@@ -66,7 +76,12 @@ type core struct {
 	events                *event.TypeMuxSubscription
 	finalCommittedSub     *event.TypeMuxSubscription
 	timeoutSub            *event.TypeMuxSubscription
-	futurePreprepareTimer *time.Timer
+	futurePreprepareTimer mclock.Timer
+	clock                 mclock.Clock
+
+	sync     bool          // Whether the engine is driven by HandleEvent instead of the event mux
+	queue    []interface{} // Internal events waiting to be handled in sync mode
+	handling bool          // Whether an event is being handled in sync mode
 
 	valSet                istanbul.ValidatorSet
 	waitingForRoundChange bool
@@ -77,13 +92,24 @@ type core struct {
 
 	current   *roundState
 	handlerWg *sync.WaitGroup
+	db        ethdb.Database
+	wal       *wal
 
-	roundChangeSet   *roundChangeSet
-	roundChangeTimer *time.Timer
+	roundChangeSet      *roundChangeSet
+	roundChangeTimer    mclock.Timer
+	roundChangeDeadline mclock.AbsTime
+
+	statusMu *sync.RWMutex // Protects the fields read by Status from outside the handler
 
 	pendingRequests   *prque.Prque
 	pendingRequestsMu *sync.Mutex
 
+	signedSeq     *big.Int               // Sequence the signed messages were last pruned at
+	signedMsgs    map[string]*messageSet // First signed message per validator, code and view
+	evidence      []*istanbul.Evidence
+	evidenceCount uint64 // Number of proofs ever written into the database
+	evidenceMu    *sync.RWMutex
+
 	consensusTimestamp time.Time
 	// the meter to record the round change rate
 	roundMeter metrics.Meter
@@ -102,8 +128,7 @@ func (c *core) finalizeMessage(msg *message) ([]byte, error) {
 	msg.CommittedSeal = []byte{}
 	// Assign the CommittedSeal if it's a COMMIT message and proposal is not nil
 	if msg.Code == msgCommit && c.current.Proposal() != nil {
-		seal := PrepareCommittedSeal(c.current.Proposal().Hash())
-		msg.CommittedSeal, err = c.backend.Sign(seal)
+		msg.CommittedSeal, err = c.backend.SignCommittedSeal(c.current.Proposal())
 		if err != nil {
 			return nil, err
 		}
@@ -131,14 +156,23 @@ func (c *core) finalizeMessage(msg *message) ([]byte, error) {
 func (c *core) broadcast(msg *message) {
 	logger := c.logger.New("state", c.state)
 
-	payload, err := c.finalizeMessage(msg)
-	if err != nil {
-		logger.Error("Failed to finalize message", "msg", msg, "err", err)
-		return
+	// Never sign two different messages of the same kind for a view
+	payload := c.rebroadcast(msg)
+	if payload == nil {
+		var err error
+		if payload, err = c.finalizeMessage(msg); err != nil {
+			logger.Error("Failed to finalize message", "msg", msg, "err", err)
+			return
+		}
+		// Journal the message before it leaves the node
+		if err = c.writeSent(payload); err != nil {
+			logger.Error("Failed to write consensus WAL", "msg", msg, "err", err)
+			return
+		}
 	}
 
 	// Broadcast payload
-	if err = c.backend.Broadcast(c.valSet, payload); err != nil {
+	if err := c.backend.Broadcast(c.valSet, payload); err != nil {
 		logger.Error("Failed to broadcast message", "msg", msg, "err", err)
 		return
 	}
@@ -165,12 +199,13 @@ func (c *core) commit() {
 	proposal := c.current.Proposal()
 	if proposal != nil {
 		committedSeals := make([][]byte, c.current.Commits.Size())
+		signers := make([]common.Address, c.current.Commits.Size())
 		for i, v := range c.current.Commits.Values() {
-			committedSeals[i] = make([]byte, types.IstanbulExtraSeal)
-			copy(committedSeals[i][:], v.CommittedSeal[:])
+			committedSeals[i] = common.CopyBytes(v.CommittedSeal)
+			signers[i] = v.Address
 		}
 
-		if err := c.backend.Commit(proposal, committedSeals); err != nil {
+		if err := c.backend.Commit(proposal, committedSeals, signers); err != nil {
 			c.current.UnlockHash() //Unlock block when insertion fails
 			c.sendNextRoundChange()
 			return
@@ -226,18 +261,27 @@ func (c *core) startNewRound(round *big.Int) {
 			Sequence: new(big.Int).Add(lastProposal.Number(), common.Big1),
 			Round:    new(big.Int),
 		}
+		c.statusMu.Lock()
 		c.valSet = c.backend.Validators(lastProposal)
+		c.statusMu.Unlock()
+	}
+	var oldView *istanbul.View
+	if c.current != nil {
+		oldView = c.currentView()
 	}
 
 	// Update logger
 	logger = logger.New("old_proposer", c.valSet.GetProposer())
+	c.statusMu.Lock()
 	// Clear invalid ROUND CHANGE messages
 	c.roundChangeSet = newRoundChangeSet(c.valSet)
 	// New snapshot for new round
 	c.updateRoundState(newView, c.valSet, roundChange)
 	// Calculate new proposer
-	c.valSet.CalcProposer(lastProposer, newView.Round.Uint64())
+	c.valSet.CalcProposer(lastProposer, newView.Sequence.Uint64(), newView.Round.Uint64())
 	c.waitingForRoundChange = false
+	c.statusMu.Unlock()
+	c.sendEvent(RoundChangeEvent{Old: oldView, New: c.currentView(), Proposer: c.valSet.GetProposer().Address()})
 	c.setState(StateAcceptRequest)
 	if roundChange && c.isProposer() && c.current != nil {
 		// If it is locked, propose the old proposal
@@ -262,17 +306,22 @@ func (c *core) catchUpRound(view *istanbul.View) {
 	if view.Round.Cmp(c.current.Round()) > 0 {
 		c.roundMeter.Mark(new(big.Int).Sub(view.Round, c.current.Round()).Int64())
 	}
-	c.waitingForRoundChange = true
+	oldView := c.currentView()
 
 	// Need to keep block locked for round catching up
+	c.statusMu.Lock()
+	c.waitingForRoundChange = true
 	c.updateRoundState(view, c.valSet, true)
+	c.statusMu.Unlock()
+	c.sendEvent(RoundChangeEvent{Old: oldView, New: c.currentView(), Proposer: c.valSet.GetProposer().Address()})
 	c.roundChangeSet.Clear(view.Round)
 	c.newRoundChangeTimer()
 
 	logger.Trace("Catch up round", "new_round", view.Round, "new_seq", view.Sequence, "new_proposer", c.valSet)
 }
 
-// updateRoundState updates round state by checking if locking block is necessary
+// updateRoundState updates round state by checking if locking block is necessary.
+// The caller has to hold statusMu.
 func (c *core) updateRoundState(view *istanbul.View, validatorSet istanbul.ValidatorSet, roundChange bool) {
 	// Lock only if both roundChange is true and it is locked
 	if roundChange && c.current != nil {
@@ -284,11 +333,22 @@ func (c *core) updateRoundState(view *istanbul.View, validatorSet istanbul.Valid
 	} else {
 		c.current = newRoundState(view, validatorSet, common.Hash{}, nil, nil, c.backend.HasBadProposal)
 	}
+	if c.wal != nil {
+		if err := c.wal.reset(view, c.current.GetLockedHash(), c.current.Preprepare); err != nil {
+			c.logger.Error("Failed to write consensus WAL", "err", err)
+		}
+	}
 }
 
 func (c *core) setState(state State) {
 	if c.state != state {
+		old := c.state
+
+		c.statusMu.Lock()
 		c.state = state
+		c.statusMu.Unlock()
+
+		c.sendEvent(StateEvent{View: c.currentView(), Old: old, New: state})
 	}
 	if state == StateAcceptRequest {
 		c.processPendingRequests()
@@ -315,19 +375,52 @@ func (c *core) stopTimer() {
 
 func (c *core) newRoundChangeTimer() {
 	c.stopTimer()
+	c.startRoundChangeTimer(c.roundTimeout(c.config.RequestTimeout))
+}
 
-	// set timeout based on the round number
-	timeout := time.Duration(c.config.RequestTimeout) * time.Millisecond
-	round := c.current.Round().Uint64()
-	if round > 0 {
-		timeout += time.Duration(math.Pow(2, float64(round))) * time.Second
+// newCommitTimer replaces the round change timer once a proposal is accepted,
+// giving the round the commit timeout to complete if one is configured.
+func (c *core) newCommitTimer() {
+	if c.config.CommitTimeout == 0 {
+		return
+	}
+	if c.roundChangeTimer != nil {
+		c.roundChangeTimer.Stop()
 	}
+	c.startRoundChangeTimer(c.roundTimeout(c.config.CommitTimeout))
+}
+
+func (c *core) startRoundChangeTimer(timeout time.Duration) {
+	c.statusMu.Lock()
+	c.roundChangeDeadline = c.clock.Now() + mclock.AbsTime(timeout)
+	c.statusMu.Unlock()
 
-	c.roundChangeTimer = time.AfterFunc(timeout, func() {
-		c.sendEvent(timeoutEvent{})
+	c.roundChangeTimer = c.clock.AfterFunc(timeout, func() {
+		c.sendInternalEvent(timeoutEvent{})
 	})
 }
 
+// roundTimeout returns the timeout of the current round for the given base
+// timeout in milliseconds. Every round change extends the timeout by the round
+// increment, or doubles it if no increment is configured, up to the maximum.
+func (c *core) roundTimeout(base uint64) time.Duration {
+	timeout := float64(base) * float64(time.Millisecond)
+	if round := c.current.Round().Uint64(); round > 0 {
+		if c.config.RoundTimeoutIncrement > 0 {
+			timeout += float64(round) * float64(c.config.RoundTimeoutIncrement) * float64(time.Millisecond)
+		} else {
+			timeout += math.Pow(2, float64(round)) * float64(time.Second)
+		}
+	}
+	if max := float64(c.config.MaxRoundTimeout) * float64(time.Millisecond); max > 0 && timeout > max {
+		timeout = max
+	}
+	if timeout >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(timeout)
+}
+
 func (c *core) checkValidatorSignature(data []byte, sig []byte) (common.Address, error) {
 	return istanbul.CheckValidatorSignature(c.valSet, data, sig)
 }
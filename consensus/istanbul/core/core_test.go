@@ -17,11 +17,13 @@
 package core
 
 import (
+	"math"
 	"math/big"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"github.com/ethereum/go-ethereum/core/types"
 	elog "github.com/ethereum/go-ethereum/log"
@@ -76,3 +78,35 @@ func TestNewRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestRoundTimeout(t *testing.T) {
+	tests := []struct {
+		config istanbul.Config
+		round  int64
+		base   uint64
+		want   time.Duration
+	}{
+		// Legacy exponential backoff
+		{istanbul.Config{}, 0, 10000, 10 * time.Second},
+		{istanbul.Config{}, 1, 10000, 12 * time.Second},
+		{istanbul.Config{}, 3, 10000, 18 * time.Second},
+		{istanbul.Config{}, 100, 10000, time.Duration(math.MaxInt64)},
+		// Linear increment per round
+		{istanbul.Config{RoundTimeoutIncrement: 500}, 0, 2000, 2 * time.Second},
+		{istanbul.Config{RoundTimeoutIncrement: 500}, 4, 2000, 4 * time.Second},
+		// Capped timeouts
+		{istanbul.Config{MaxRoundTimeout: 30000}, 10, 10000, 30 * time.Second},
+		{istanbul.Config{RoundTimeoutIncrement: 500, MaxRoundTimeout: 3000}, 4, 2000, 3 * time.Second},
+		{istanbul.Config{MaxRoundTimeout: 30000}, 0, 60000, 30 * time.Second},
+	}
+	for i, tt := range tests {
+		config := tt.config
+		c := &core{
+			config:  &config,
+			current: newRoundState(&istanbul.View{Round: big.NewInt(tt.round), Sequence: big.NewInt(1)}, nil, common.Hash{}, nil, nil, nil),
+		}
+		if have := c.roundTimeout(tt.base); have != tt.want {
+			t.Errorf("test %d: timeout mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
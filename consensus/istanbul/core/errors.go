@@ -43,4 +43,7 @@ var (
 	errFailedDecodeCommit = errors.New("failed to decode COMMIT")
 	// errFailedDecodeMessageSet is returned when the message set is malformed.
 	errFailedDecodeMessageSet = errors.New("failed to decode message set")
+	// errInvalidEvidence is returned when an equivocation evidence does not prove
+	// that its offender signed two conflicting messages.
+	errInvalidEvidence = errors.New("invalid evidence")
 )
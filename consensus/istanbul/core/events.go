@@ -17,6 +17,7 @@
 package core
 
 import (
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 )
 
@@ -26,3 +27,17 @@ type backlogEvent struct {
 }
 
 type timeoutEvent struct{}
+
+// StateEvent is posted when the consensus state machine moves to a new state.
+type StateEvent struct {
+	View *istanbul.View `json:"view"`
+	Old  State          `json:"old"`
+	New  State          `json:"new"`
+}
+
+// RoundChangeEvent is posted when the consensus moves to a new sequence or round.
+type RoundChangeEvent struct {
+	Old      *istanbul.View `json:"old"`
+	New      *istanbul.View `json:"new"`
+	Proposer common.Address `json:"proposer"`
+}
@@ -0,0 +1,254 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// maxEvidence is the number of proofs of equivocation kept, older ones are
+	// dropped once it is reached.
+	maxEvidence = 1024
+
+	// evidenceSequences is the number of sequences, starting at the current one,
+	// whose messages are checked for equivocation.
+	evidenceSequences = 2
+
+	// evidenceRounds is the number of rounds past the current one (or past round
+	// zero for future sequences) whose messages are checked for equivocation.
+	evidenceRounds = 10
+)
+
+var (
+	evidenceCountKey  = []byte("istanbul-evidence-count") // Number of proofs ever stored (uint64 big endian)
+	evidenceKeyPrefix = []byte("istanbul-evidence-")      // evidenceKeyPrefix + slot (uint64 big endian) -> evidence
+)
+
+// evidenceKey = evidenceKeyPrefix + slot (uint64 big endian). The proofs are kept
+// in a ring of maxEvidence slots, so each one is written only once.
+func evidenceKey(index uint64) []byte {
+	key := make([]byte, len(evidenceKeyPrefix)+8)
+	copy(key, evidenceKeyPrefix)
+	binary.BigEndian.PutUint64(key[len(evidenceKeyPrefix):], index%maxEvidence)
+	return key
+}
+
+// Evidence implements core.Engine.Evidence
+func (c *core) Evidence() []*istanbul.Evidence {
+	c.evidenceMu.RLock()
+	defer c.evidenceMu.RUnlock()
+
+	evidence := make([]*istanbul.Evidence, len(c.evidence))
+	copy(evidence, c.evidence)
+	return evidence
+}
+
+// checkEquivocation remembers the first PRE-PREPARE, PREPARE and COMMIT message
+// of every validator for each view of the current and next sequences, and reports
+// the validator if it signs a different message of the same kind for the same
+// view. Future messages are checked as they arrive, before they are queued in the
+// backlog. Views too far ahead are ignored, so that a validator can't grow the
+// tracked messages without bound.
+func (c *core) checkEquivocation(msg *message) {
+	if msg.Code == msgRoundChange {
+		return
+	}
+	view, err := messageView(msg)
+	if err != nil || view.Sequence == nil || view.Round == nil {
+		return
+	}
+	// Only keep track of the current and next few sequences and rounds, drop
+	// everything else
+	sequence := c.current.Sequence()
+	if view.Sequence.Cmp(sequence) < 0 || view.Sequence.Cmp(new(big.Int).Add(sequence, big.NewInt(evidenceSequences))) >= 0 {
+		return
+	}
+	round := new(big.Int)
+	if view.Sequence.Cmp(sequence) == 0 {
+		round.Set(c.current.Round())
+	}
+	if view.Round.Cmp(round.Add(round, big.NewInt(evidenceRounds))) > 0 {
+		return
+	}
+	if c.signedMsgs == nil {
+		c.signedMsgs = make(map[string]*messageSet)
+	}
+	if c.signedSeq == nil || c.signedSeq.Cmp(sequence) != 0 {
+		c.signedSeq = new(big.Int).Set(sequence)
+		for key, set := range c.signedMsgs {
+			if set.view.Sequence.Cmp(sequence) < 0 {
+				delete(c.signedMsgs, key)
+			}
+		}
+	}
+	key := fmt.Sprintf("%d:%v", msg.Code, view)
+	set, ok := c.signedMsgs[key]
+	if !ok {
+		set = newMessageSet(c.valSet)
+		set.view = view
+		c.signedMsgs[key] = set
+	}
+	if set.Get(msg.Address) == nil {
+		set.Add(msg)
+		return
+	}
+	prev := set.Conflict(msg)
+	if prev == nil {
+		return
+	}
+	first, err := prev.Payload()
+	if err != nil {
+		return
+	}
+	second, err := msg.Payload()
+	if err != nil {
+		return
+	}
+	c.storeEvidence(&istanbul.Evidence{
+		Offender: msg.Address,
+		Code:     msg.Code,
+		View:     view,
+		First:    first,
+		Second:   second,
+	})
+}
+
+// storeEvidence records a new proof of equivocation, persists it if a database
+// is available and announces it on the event mux.
+func (c *core) storeEvidence(evidence *istanbul.Evidence) {
+	c.evidenceMu.Lock()
+	for _, known := range c.evidence {
+		if known.Offender == evidence.Offender && known.Code == evidence.Code && known.View.Cmp(evidence.View) == 0 {
+			c.evidenceMu.Unlock()
+			return
+		}
+	}
+	c.evidence = append(c.evidence, evidence)
+	if len(c.evidence) > maxEvidence {
+		c.evidence = c.evidence[len(c.evidence)-maxEvidence:]
+	}
+	if c.db != nil {
+		if err := c.writeEvidence(evidence); err != nil {
+			c.logger.Error("Failed to store equivocation evidence", "err", err)
+		}
+	}
+	c.evidenceMu.Unlock()
+
+	c.logger.Warn("Validator signed conflicting messages", "offender", evidence.Offender, "code", evidence.Code, "view", evidence.View)
+	go c.backend.EventMux().Post(istanbul.EvidenceEvent{Evidence: evidence})
+}
+
+// writeEvidence appends a single proof of equivocation to the database,
+// overwriting the oldest one if the ring is full.
+func (c *core) writeEvidence(evidence *istanbul.Evidence) error {
+	blob, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		return err
+	}
+	count := c.evidenceCount + 1
+
+	enc := make([]byte, 8)
+	binary.BigEndian.PutUint64(enc, count)
+
+	batch := c.db.NewBatch()
+	batch.Put(evidenceKey(c.evidenceCount), blob)
+	batch.Put(evidenceCountKey, enc)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	c.evidenceCount = count
+	return nil
+}
+
+// loadEvidence retrieves the evidence collected before the last restart.
+func (c *core) loadEvidence() {
+	enc, err := c.db.Get(evidenceCountKey)
+	if err != nil || len(enc) != 8 {
+		return
+	}
+	count := binary.BigEndian.Uint64(enc)
+
+	first := uint64(0)
+	if count > maxEvidence {
+		first = count - maxEvidence
+	}
+	var evidence []*istanbul.Evidence
+	for i := first; i < count; i++ {
+		blob, err := c.db.Get(evidenceKey(i))
+		if err != nil {
+			c.logger.Error("Failed to load equivocation evidence", "index", i, "err", err)
+			continue
+		}
+		item := new(istanbul.Evidence)
+		if err := rlp.DecodeBytes(blob, item); err != nil {
+			c.logger.Error("Failed to decode equivocation evidence", "index", i, "err", err)
+			continue
+		}
+		evidence = append(evidence, item)
+	}
+	c.evidence, c.evidenceCount = evidence, count
+}
+
+// VerifyEvidence checks that the evidence holds two different messages of the
+// same kind and view, both signed by the offender.
+func VerifyEvidence(evidence *istanbul.Evidence) error {
+	if evidence.View == nil || evidence.View.Round == nil || evidence.View.Sequence == nil {
+		return errInvalidEvidence
+	}
+	switch evidence.Code {
+	case msgPreprepare, msgPrepare, msgCommit:
+	default:
+		return errInvalidEvidence
+	}
+	validateFn := func(data []byte, sig []byte) (common.Address, error) {
+		signer, err := istanbul.GetSignatureAddress(data, sig)
+		if err != nil {
+			return common.Address{}, err
+		}
+		if signer != evidence.Offender {
+			return common.Address{}, errInvalidEvidence
+		}
+		return signer, nil
+	}
+	var msgs [2]*message
+	for i, payload := range [][]byte{evidence.First, evidence.Second} {
+		msg := new(message)
+		if err := msg.FromPayload(payload, validateFn); err != nil {
+			return err
+		}
+		if msg.Address != evidence.Offender || msg.Code != evidence.Code {
+			return errInvalidEvidence
+		}
+		view, err := messageView(msg)
+		if err != nil || view.Cmp(evidence.View) != 0 {
+			return errInvalidEvidence
+		}
+		msgs[i] = msg
+	}
+	if bytes.Equal(msgs[0].Msg, msgs[1].Msg) && bytes.Equal(msgs[0].CommittedSeal, msgs[1].CommittedSeal) {
+		return errInvalidEvidence
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newTestPrepare(view *istanbul.View, digest common.Hash, addr common.Address) *message {
+	subject, _ := Encode(&istanbul.Subject{View: view, Digest: digest})
+	return &message{
+		Code:          msgPrepare,
+		Msg:           subject,
+		Address:       addr,
+		Signature:     []byte{},
+		CommittedSeal: []byte{},
+	}
+}
+
+func signTestMessage(msg *message, key *ecdsa.PrivateKey) []byte {
+	data, _ := msg.PayloadNoSig()
+	msg.Signature, _ = crypto.Sign(crypto.Keccak256(data), key)
+	payload, _ := msg.Payload()
+	return payload
+}
+
+func TestEquivocationDetection(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+	sub := v0.events.Subscribe(istanbul.EvidenceEvent{})
+	defer sub.Unsubscribe()
+
+	offender := v0.peers.GetByIndex(1).Address()
+	first := newTestPrepare(c.currentView(), common.HexToHash("0x01"), offender)
+	second := newTestPrepare(c.currentView(), common.HexToHash("0x02"), offender)
+
+	// Repeating the same message is fine, changing it is not
+	for _, msg := range []*message{first, first, second, second} {
+		c.checkEquivocation(msg)
+	}
+	evidence := c.Evidence()
+	if len(evidence) != 1 {
+		t.Fatalf("evidence mismatch: have %d, want 1", len(evidence))
+	}
+	if evidence[0].Offender != offender || evidence[0].Code != msgPrepare || evidence[0].View.Cmp(c.currentView()) != 0 {
+		t.Errorf("evidence mismatch: have %v", evidence[0])
+	}
+	select {
+	case ev := <-sub.Chan():
+		if ev.Data.(istanbul.EvidenceEvent).Evidence != evidence[0] {
+			t.Errorf("event mismatch: have %v, want %v", ev.Data, evidence[0])
+		}
+	case <-time.After(time.Second):
+		t.Errorf("evidence event not posted")
+	}
+	// Messages of other views are independent
+	other := &istanbul.View{Round: big.NewInt(1), Sequence: c.current.Sequence()}
+	c.checkEquivocation(newTestPrepare(other, common.HexToHash("0x01"), offender))
+	if len(c.Evidence()) != 1 {
+		t.Errorf("evidence mismatch: have %d, want 1", len(c.Evidence()))
+	}
+	// Future messages, which end up in the backlog, must be checked too
+	future := &istanbul.View{Round: big.NewInt(0), Sequence: new(big.Int).Add(c.current.Sequence(), common.Big1)}
+	c.checkEquivocation(newTestPrepare(future, common.HexToHash("0x01"), offender))
+	c.checkEquivocation(newTestPrepare(future, common.HexToHash("0x02"), offender))
+	if len(c.Evidence()) != 2 {
+		t.Errorf("evidence mismatch: have %d, want 2", len(c.Evidence()))
+	}
+	// Evidence must survive a restart
+	restarted := New(v0, istanbul.DefaultConfig, v0.db).(*core)
+	if len(restarted.Evidence()) != 2 {
+		t.Errorf("persisted evidence mismatch: have %d, want 2", len(restarted.Evidence()))
+	}
+}
+
+func TestEquivocationWindow(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+	offender := v0.peers.GetByIndex(1).Address()
+
+	// Messages of views too far ahead are not tracked
+	sequence := c.current.Sequence()
+	views := []*istanbul.View{
+		{Round: big.NewInt(0), Sequence: new(big.Int).Add(sequence, big.NewInt(evidenceSequences))},
+		{Round: big.NewInt(evidenceRounds + 1), Sequence: sequence},
+		{Round: big.NewInt(evidenceRounds + 1), Sequence: new(big.Int).Add(sequence, common.Big1)},
+	}
+	for _, view := range views {
+		c.checkEquivocation(newTestPrepare(view, common.HexToHash("0x01"), offender))
+		c.checkEquivocation(newTestPrepare(view, common.HexToHash("0x02"), offender))
+	}
+	if len(c.signedMsgs) != 0 {
+		t.Errorf("tracked views mismatch: have %d, want 0", len(c.signedMsgs))
+	}
+	if len(c.Evidence()) != 0 {
+		t.Errorf("evidence mismatch: have %d, want 0", len(c.Evidence()))
+	}
+	// The last round of the window is still checked
+	view := &istanbul.View{Round: big.NewInt(evidenceRounds), Sequence: sequence}
+	c.checkEquivocation(newTestPrepare(view, common.HexToHash("0x01"), offender))
+	c.checkEquivocation(newTestPrepare(view, common.HexToHash("0x02"), offender))
+	if len(c.Evidence()) != 1 {
+		t.Errorf("evidence mismatch: have %d, want 1", len(c.Evidence()))
+	}
+}
+
+func TestEvidenceLimit(t *testing.T) {
+	sys := NewTestSystemWithBackend(1, 0)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+	for i := 0; i < maxEvidence+2; i++ {
+		c.storeEvidence(&istanbul.Evidence{
+			Offender: common.HexToAddress("0x01"),
+			Code:     msgPrepare,
+			View:     &istanbul.View{Round: big.NewInt(0), Sequence: big.NewInt(int64(i))},
+		})
+	}
+	evidence := c.Evidence()
+	if len(evidence) != maxEvidence {
+		t.Fatalf("evidence mismatch: have %d, want %d", len(evidence), maxEvidence)
+	}
+	if seq := evidence[0].View.Sequence.Int64(); seq != 2 {
+		t.Errorf("oldest evidence mismatch: have sequence %d, want 2", seq)
+	}
+	// The ring must come back in the same order after a restart
+	restarted := New(v0, istanbul.DefaultConfig, v0.db).(*core).Evidence()
+	if len(restarted) != maxEvidence {
+		t.Fatalf("persisted evidence mismatch: have %d, want %d", len(restarted), maxEvidence)
+	}
+	for i := range restarted {
+		if restarted[i].View.Cmp(evidence[i].View) != 0 {
+			t.Fatalf("persisted evidence %d mismatch: have %v, want %v", i, restarted[i].View, evidence[i].View)
+		}
+	}
+}
+
+func TestVerifyEvidence(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	view := &istanbul.View{Round: big.NewInt(0), Sequence: big.NewInt(1)}
+
+	first := signTestMessage(newTestPrepare(view, common.HexToHash("0x01"), addr), key)
+	second := signTestMessage(newTestPrepare(view, common.HexToHash("0x02"), addr), key)
+
+	testCases := []struct {
+		evidence *istanbul.Evidence
+		err      error
+	}{
+		{
+			// valid evidence
+			&istanbul.Evidence{Offender: addr, Code: msgPrepare, View: view, First: first, Second: second},
+			nil,
+		},
+		{
+			// identical messages
+			&istanbul.Evidence{Offender: addr, Code: msgPrepare, View: view, First: first, Second: first},
+			errInvalidEvidence,
+		},
+		{
+			// wrong offender
+			&istanbul.Evidence{Offender: common.HexToAddress("0x01"), Code: msgPrepare, View: view, First: first, Second: second},
+			errInvalidEvidence,
+		},
+		{
+			// wrong code
+			&istanbul.Evidence{Offender: addr, Code: msgCommit, View: view, First: first, Second: second},
+			errInvalidEvidence,
+		},
+		{
+			// wrong view
+			&istanbul.Evidence{Offender: addr, Code: msgPrepare, View: &istanbul.View{Round: big.NewInt(1), Sequence: big.NewInt(1)}, First: first, Second: second},
+			errInvalidEvidence,
+		},
+	}
+	for i, test := range testCases {
+		if err := VerifyEvidence(test.evidence); err != test.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, test.err)
+		}
+	}
+}
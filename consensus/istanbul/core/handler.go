@@ -18,25 +18,54 @@ package core
 
 import (
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 )
 
 // Start implements core.Engine.Start
 func (c *core) Start() error {
-	// Start a new round from last sequence + 1
+	// Start a new round from last sequence + 1, keeping the journal for replay
+	entry := c.loadWAL()
 	c.startNewRound(common.Big0)
 
 	// Tests will handle events itself, so we have to make subscribeEvents()
 	// be able to call in test.
 	c.subscribeEvents()
+
+	// Resume the current view if we were interrupted in the middle of it
+	c.replayWAL(entry)
 	go c.handleEvents()
 
 	return nil
 }
 
+// StartSync implements core.SyncEngine.StartSync
+func (c *core) StartSync(clock mclock.Clock) error {
+	c.sync, c.clock = true, clock
+
+	c.handling = true
+	entry := c.loadWAL()
+	c.startNewRound(common.Big0)
+	c.replayWAL(entry)
+	c.drain()
+
+	return nil
+}
+
+// HandleEvent implements core.SyncEngine.HandleEvent
+func (c *core) HandleEvent(ev interface{}) {
+	c.sendInternalEvent(ev)
+}
+
 // Stop implements core.Engine.Stop
 func (c *core) Stop() error {
 	c.stopTimer()
+	if c.sync {
+		c.statusMu.Lock()
+		c.current = nil
+		c.statusMu.Unlock()
+		return nil
+	}
 	c.unsubscribeEvents()
 
 	// Make sure the handler goroutine exits
@@ -73,7 +102,9 @@ func (c *core) unsubscribeEvents() {
 func (c *core) handleEvents() {
 	// Clear state
 	defer func() {
+		c.statusMu.Lock()
 		c.current = nil
+		c.statusMu.Unlock()
 		c.handlerWg.Done()
 	}()
 
@@ -86,45 +117,63 @@ func (c *core) handleEvents() {
 				return
 			}
 			// A real event arrived, process interesting content
-			switch ev := event.Data.(type) {
-			case istanbul.RequestEvent:
-				r := &istanbul.Request{
-					Proposal: ev.Proposal,
-				}
-				err := c.handleRequest(r)
-				if err == errFutureMessage {
-					c.storeRequestMsg(r)
-				}
-			case istanbul.MessageEvent:
-				if err := c.handleMsg(ev.Payload); err == nil {
-					c.backend.Gossip(c.valSet, ev.Payload)
-				}
-			case backlogEvent:
-				// No need to check signature for internal messages
-				if err := c.handleCheckedMsg(ev.msg, ev.src); err == nil {
-					p, err := ev.msg.Payload()
-					if err != nil {
-						c.logger.Warn("Get message payload failed", "err", err)
-						continue
-					}
-					c.backend.Gossip(c.valSet, p)
-				}
-			}
-		case _, ok := <-c.timeoutSub.Chan():
+			c.dispatch(event.Data)
+		case event, ok := <-c.timeoutSub.Chan():
 			if !ok {
 				return
 			}
-			c.handleTimeoutMsg()
+			c.dispatch(event.Data)
 		case event, ok := <-c.finalCommittedSub.Chan():
 			if !ok {
 				return
 			}
-			switch event.Data.(type) {
-			case istanbul.FinalCommittedEvent:
-				c.handleFinalCommitted()
+			c.dispatch(event.Data)
+		}
+	}
+}
+
+// dispatch handles a single external or internal event
+func (c *core) dispatch(event interface{}) {
+	switch ev := event.(type) {
+	case istanbul.RequestEvent:
+		r := &istanbul.Request{
+			Proposal: ev.Proposal,
+		}
+		err := c.handleRequest(r)
+		if err == errFutureMessage {
+			c.storeRequestMsg(r)
+		}
+	case istanbul.MessageEvent:
+		if err := c.handleMsg(ev.Payload); err == nil {
+			c.backend.Gossip(c.valSet, ev.Payload)
+		}
+	case backlogEvent:
+		// No need to check signature for internal messages
+		if err := c.handleCheckedMsg(ev.msg, ev.src); err == nil {
+			p, err := ev.msg.Payload()
+			if err != nil {
+				c.logger.Warn("Get message payload failed", "err", err)
+				return
 			}
+			c.backend.Gossip(c.valSet, p)
 		}
+	case timeoutEvent:
+		c.handleTimeoutMsg()
+	case istanbul.FinalCommittedEvent:
+		c.handleFinalCommitted()
+	}
+}
+
+// drain handles the queued internal events in sync mode, including the ones
+// queued while handling them.
+func (c *core) drain() {
+	c.handling = true
+	for len(c.queue) > 0 {
+		ev := c.queue[0]
+		c.queue = c.queue[1:]
+		c.dispatch(ev)
 	}
+	c.handling = false
 }
 
 // sendEvent sends events to mux
@@ -132,6 +181,29 @@ func (c *core) sendEvent(ev interface{}) {
 	c.backend.EventMux().Post(ev)
 }
 
+// sendInternalEvent sends an event for the handler to mux, or queues it for the
+// goroutine driving the engine in sync mode
+func (c *core) sendInternalEvent(ev interface{}) {
+	if c.sync {
+		c.queue = append(c.queue, ev)
+		if !c.handling {
+			c.drain()
+		}
+		return
+	}
+	c.sendEvent(ev)
+}
+
+// postEvent sends an event for the handler without blocking the caller, which
+// may hold locks the handler needs
+func (c *core) postEvent(ev interface{}) {
+	if c.sync {
+		c.sendInternalEvent(ev)
+		return
+	}
+	go c.sendEvent(ev)
+}
+
 func (c *core) handleMsg(payload []byte) error {
 	logger := c.logger.New()
 
@@ -149,16 +221,21 @@ func (c *core) handleMsg(payload []byte) error {
 		return istanbul.ErrUnauthorizedAddress
 	}
 
+	// Catch validators signing conflicting messages for the same view
+	c.checkEquivocation(msg)
+
 	return c.handleCheckedMsg(msg, src)
 }
 
 func (c *core) handleCheckedMsg(msg *message, src istanbul.Validator) error {
 	logger := c.logger.New("address", c.address, "from", src)
 
-	// Store the message if it's a future message
+	// Store the message if it's a future message, journal it if accepted
 	testBacklog := func(err error) error {
 		if err == errFutureMessage {
 			c.storeBacklog(msg, src)
+		} else if err == nil {
+			c.writeAccepted(msg)
 		}
 
 		return err
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
 	"strings"
@@ -63,6 +64,14 @@ func (ms *messageSet) Add(msg *message) error {
 	return ms.addVerifiedMessage(msg)
 }
 
+// Remove drops the message of the given validator from the set.
+func (ms *messageSet) Remove(addr common.Address) {
+	ms.messagesMu.Lock()
+	defer ms.messagesMu.Unlock()
+
+	delete(ms.messages, addr)
+}
+
 func (ms *messageSet) Values() (result []*message) {
 	ms.messagesMu.Lock()
 	defer ms.messagesMu.Unlock()
@@ -80,12 +89,42 @@ func (ms *messageSet) Size() int {
 	return len(ms.messages)
 }
 
+// Weight returns the total voting power of the validators in the message set.
+func (ms *messageSet) Weight() int {
+	ms.messagesMu.Lock()
+	defer ms.messagesMu.Unlock()
+
+	weight := 0
+	for addr := range ms.messages {
+		if _, v := ms.valSet.GetByAddress(addr); v != nil {
+			weight += int(v.Weight())
+		}
+	}
+	return weight
+}
+
 func (ms *messageSet) Get(addr common.Address) *message {
 	ms.messagesMu.Lock()
 	defer ms.messagesMu.Unlock()
 	return ms.messages[addr]
 }
 
+// Conflict returns the message previously added for the sender of msg if its
+// content differs from msg, which means the sender signed two different messages.
+func (ms *messageSet) Conflict(msg *message) *message {
+	ms.messagesMu.Lock()
+	defer ms.messagesMu.Unlock()
+
+	prev := ms.messages[msg.Address]
+	if prev == nil {
+		return nil
+	}
+	if bytes.Equal(prev.Msg, msg.Msg) && bytes.Equal(prev.CommittedSeal, msg.CommittedSeal) {
+		return nil
+	}
+	return prev
+}
+
 // ----------------------------------------------------------------------------
 
 func (ms *messageSet) verify(msg *message) error {
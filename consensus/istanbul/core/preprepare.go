@@ -62,7 +62,7 @@ func (c *core) handlePreprepare(msg *message, src istanbul.Validator) error {
 			// Get validator set for the given proposal
 			valSet := c.backend.ParentValidators(preprepare.Proposal).Copy()
 			previousProposer := c.backend.GetProposer(preprepare.Proposal.Number().Uint64() - 1)
-			valSet.CalcProposer(previousProposer, preprepare.View.Round.Uint64())
+			valSet.CalcProposer(previousProposer, preprepare.View.Sequence.Uint64(), preprepare.View.Round.Uint64())
 			// Broadcast COMMIT if it is an existing block
 			// 1. The proposer needs to be a proposer matches the given (Sequence + Round)
 			// 2. The given block must exist
@@ -86,8 +86,8 @@ func (c *core) handlePreprepare(msg *message, src istanbul.Validator) error {
 		// if it's a future block, we will handle it again after the duration
 		if err == consensus.ErrFutureBlock {
 			c.stopFuturePreprepareTimer()
-			c.futurePreprepareTimer = time.AfterFunc(duration, func() {
-				c.sendEvent(backlogEvent{
+			c.futurePreprepareTimer = c.clock.AfterFunc(duration, func() {
+				c.sendInternalEvent(backlogEvent{
 					src: src,
 					msg: msg,
 				})
@@ -127,4 +127,5 @@ func (c *core) handlePreprepare(msg *message, src istanbul.Validator) error {
 func (c *core) acceptPreprepare(preprepare *istanbul.Preprepare) {
 	c.consensusTimestamp = time.Now()
 	c.current.SetPreprepare(preprepare)
+	c.newCommitTimer()
 }
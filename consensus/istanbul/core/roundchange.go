@@ -82,24 +82,29 @@ func (c *core) handleRoundChange(msg *message, src istanbul.Validator) error {
 	cv := c.currentView()
 	roundView := rc.View
 
-	// Add the ROUND CHANGE message to its message set and return how many
-	// messages we've got with the same round number and sequence number.
+	// Add the ROUND CHANGE message to its message set and return the voting power
+	// we've got with the same round number and sequence number.
 	num, err := c.roundChangeSet.Add(roundView.Round, msg)
 	if err != nil {
 		logger.Warn("Failed to add round change message", "from", src, "msg", msg, "err", err)
 		return err
 	}
+	// reached reports whether this message made the voting power cross the threshold,
+	// which is the weighted equivalent of having exactly threshold messages.
+	reached := func(threshold int) bool {
+		return num >= threshold && num-int(src.Weight()) < threshold
+	}
 
 	// Once we received f+1 ROUND CHANGE messages, those messages form a weak certificate.
 	// If our round number is smaller than the certificate's round number, we would
 	// try to catch up the round number.
-	if c.waitingForRoundChange && num == c.valSet.F()+1 {
+	if c.waitingForRoundChange && reached(c.valSet.F()+1) {
 		if cv.Round.Cmp(roundView.Round) < 0 {
 			c.sendRoundChange(roundView.Round)
 		}
 		return nil
-	} else if num == 2*c.valSet.F()+1 && (c.waitingForRoundChange || cv.Round.Cmp(roundView.Round) < 0) {
-		// We've received 2f+1 ROUND CHANGE messages, start a new round immediately.
+	} else if reached(c.valSet.QuorumSize()) && (c.waitingForRoundChange || cv.Round.Cmp(roundView.Round) < 0) {
+		// We've received a quorum of ROUND CHANGE messages, start a new round immediately.
 		c.startNewRound(roundView.Round)
 		return nil
 	} else if cv.Round.Cmp(roundView.Round) < 0 {
@@ -125,7 +130,8 @@ type roundChangeSet struct {
 	mu           *sync.Mutex
 }
 
-// Add adds the round and message into round change set
+// Add adds the round and message into round change set and returns the voting
+// power of the round change messages for the round
 func (rcs *roundChangeSet) Add(r *big.Int, msg *message) (int, error) {
 	rcs.mu.Lock()
 	defer rcs.mu.Unlock()
@@ -138,7 +144,21 @@ func (rcs *roundChangeSet) Add(r *big.Int, msg *message) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return rcs.roundChanges[round].Size(), nil
+	return rcs.roundChanges[round].Weight(), nil
+}
+
+// Senders returns the validators which sent a round change message, per round
+func (rcs *roundChangeSet) Senders() map[uint64][]common.Address {
+	rcs.mu.Lock()
+	defer rcs.mu.Unlock()
+
+	senders := make(map[uint64][]common.Address)
+	for round, rms := range rcs.roundChanges {
+		for _, msg := range rms.Values() {
+			senders[round] = append(senders[round], msg.Address)
+		}
+	}
+	return senders
 }
 
 // Clear deletes the messages with smaller round
@@ -153,14 +173,14 @@ func (rcs *roundChangeSet) Clear(round *big.Int) {
 	}
 }
 
-// MaxRound returns the max round which the number of messages is equal or larger than num
+// MaxRound returns the max round which the voting power of messages is equal or larger than num
 func (rcs *roundChangeSet) MaxRound(num int) *big.Int {
 	rcs.mu.Lock()
 	defer rcs.mu.Unlock()
 
 	var maxRound *big.Int
 	for k, rms := range rcs.roundChanges {
-		if rms.Size() < num {
+		if rms.Weight() < num {
 			continue
 		}
 		r := big.NewInt(int64(k))
@@ -57,16 +57,20 @@ type roundState struct {
 	hasBadProposal func(hash common.Hash) bool
 }
 
-func (s *roundState) GetPrepareOrCommitSize() int {
+// GetPrepareOrCommitWeight returns the total voting power of the validators which
+// sent either a PREPARE or a COMMIT message, counting each validator only once.
+func (s *roundState) GetPrepareOrCommitWeight() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	result := s.Prepares.Size() + s.Commits.Size()
+	result := s.Prepares.Weight() + s.Commits.Weight()
 
 	// find duplicate one
 	for _, m := range s.Prepares.Values() {
 		if s.Commits.Get(m.Address) != nil {
-			result--
+			if _, v := s.Commits.valSet.GetByAddress(m.Address); v != nil {
+				result -= int(v.Weight())
+			}
 		}
 	}
 	return result
@@ -0,0 +1,98 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Status is a point in time view of the consensus state machine, meant to help
+// operators find out why a network stalls.
+type Status struct {
+	Sequence   *big.Int       `json:"sequence"`
+	Round      *big.Int       `json:"round"`
+	State      State          `json:"state"`
+	Proposer   common.Address `json:"proposer"`
+	IsProposer bool           `json:"isProposer"`
+
+	Proposal   *common.Hash `json:"proposal"`   // Hash of the proposal being voted on, if any
+	LockedHash *common.Hash `json:"lockedHash"` // Hash of the locked proposal, if any
+
+	Prepares      []common.Address            `json:"prepares"`      // Validators which sent a PREPARE
+	PrepareWeight int                         `json:"prepareWeight"` // Voting power of the PREPAREs
+	Commits       []common.Address            `json:"commits"`       // Validators which sent a COMMIT
+	CommitWeight  int                         `json:"commitWeight"`  // Voting power of the COMMITs
+	RoundChanges  map[uint64][]common.Address `json:"roundChanges"`  // Validators which sent a ROUND CHANGE, per round
+
+	Backlogs map[common.Address]int `json:"backlogs"` // Number of future messages queued per validator
+
+	WaitingForRoundChange bool      `json:"waitingForRoundChange"`
+	RoundChangeDeadline   time.Time `json:"roundChangeDeadline"`
+}
+
+// Status implements core.Engine.Status
+func (c *core) Status() *Status {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+
+	if c.current == nil || c.valSet == nil {
+		return nil
+	}
+	status := &Status{
+		Sequence:              new(big.Int).Set(c.current.Sequence()),
+		Round:                 new(big.Int).Set(c.current.Round()),
+		State:                 c.state,
+		Prepares:              make([]common.Address, 0),
+		PrepareWeight:         c.current.Prepares.Weight(),
+		Commits:               make([]common.Address, 0),
+		CommitWeight:          c.current.Commits.Weight(),
+		RoundChanges:          make(map[uint64][]common.Address),
+		Backlogs:              make(map[common.Address]int),
+		RoundChangeDeadline:   time.Now().Add(time.Duration(c.roundChangeDeadline - c.clock.Now())),
+		WaitingForRoundChange: c.waitingForRoundChange,
+	}
+	if proposer := c.valSet.GetProposer(); proposer != nil {
+		status.Proposer = proposer.Address()
+		status.IsProposer = proposer.Address() == c.address
+	}
+	if proposal := c.current.Proposal(); proposal != nil {
+		hash := proposal.Hash()
+		status.Proposal = &hash
+	}
+	if locked := c.current.GetLockedHash(); !common.EmptyHash(locked) {
+		status.LockedHash = &locked
+	}
+	for _, msg := range c.current.Prepares.Values() {
+		status.Prepares = append(status.Prepares, msg.Address)
+	}
+	for _, msg := range c.current.Commits.Values() {
+		status.Commits = append(status.Commits, msg.Address)
+	}
+	if c.roundChangeSet != nil {
+		status.RoundChanges = c.roundChangeSet.Senders()
+	}
+	c.backlogsMu.Lock()
+	for src, backlog := range c.backlogs {
+		status.Backlogs[src.Address()] = backlog.Size()
+	}
+	c.backlogsMu.Unlock()
+
+	return status
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+)
+
+func TestStatus(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+	c.current.SetPreprepare(newTestPreprepare(c.currentView()))
+	c.current.LockHash()
+
+	v1 := v0.peers.GetByIndex(1)
+	c.current.Prepares.Add(newTestPrepare(c.currentView(), newTestProposal().Hash(), v1.Address()))
+
+	future := &istanbul.View{Round: big.NewInt(0), Sequence: big.NewInt(2)}
+	c.storeBacklog(newTestPrepare(future, common.Hash{}, v1.Address()), v1)
+
+	status := c.Status()
+	if status == nil {
+		t.Fatalf("missing status")
+	}
+	if status.Sequence.Cmp(big.NewInt(1)) != 0 || status.Round.Sign() != 0 {
+		t.Errorf("view mismatch: have %v/%v, want 1/0", status.Sequence, status.Round)
+	}
+	if status.State != StateAcceptRequest {
+		t.Errorf("state mismatch: have %v, want %v", status.State, StateAcceptRequest)
+	}
+	if status.Proposal == nil || *status.Proposal != newTestProposal().Hash() {
+		t.Errorf("proposal mismatch: have %v, want %v", status.Proposal, newTestProposal().Hash())
+	}
+	if status.LockedHash == nil || *status.LockedHash != newTestProposal().Hash() {
+		t.Errorf("locked hash mismatch: have %v, want %v", status.LockedHash, newTestProposal().Hash())
+	}
+	if len(status.Prepares) != 1 || status.Prepares[0] != v1.Address() || status.PrepareWeight != 1 {
+		t.Errorf("prepares mismatch: have %v (weight %d)", status.Prepares, status.PrepareWeight)
+	}
+	if len(status.Commits) != 0 || status.CommitWeight != 0 {
+		t.Errorf("commits mismatch: have %v (weight %d)", status.Commits, status.CommitWeight)
+	}
+	if status.Backlogs[v1.Address()] != 1 {
+		t.Errorf("backlog mismatch: have %d, want 1", status.Backlogs[v1.Address()])
+	}
+}
+
+func TestStateEvents(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+	sub := v0.events.Subscribe(StateEvent{}, RoundChangeEvent{})
+	defer sub.Unsubscribe()
+
+	go c.setState(StatePreprepared)
+	select {
+	case ev := <-sub.Chan():
+		state, ok := ev.Data.(StateEvent)
+		if !ok || state.Old != StateAcceptRequest || state.New != StatePreprepared {
+			t.Errorf("state event mismatch: have %v", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("state event not posted")
+	}
+
+	c.roundChangeSet = newRoundChangeSet(c.valSet)
+	go c.catchUpRound(&istanbul.View{Round: big.NewInt(2), Sequence: big.NewInt(1)})
+	select {
+	case ev := <-sub.Chan():
+		change, ok := ev.Data.(RoundChangeEvent)
+		if !ok || change.Old.Round.Sign() != 0 || change.New.Round.Cmp(big.NewInt(2)) != 0 {
+			t.Errorf("round change event mismatch: have %v", ev.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("round change event not posted")
+	}
+}
@@ -41,7 +41,8 @@ type testSystemBackend struct {
 	events *event.TypeMux
 
 	committedMsgs []testCommittedMsgs
-	sentMsgs      [][]byte // store the message when Send is called by core
+	sentMsgs      [][]byte                // store the message when Send is called by core
+	invalidSeals  map[common.Address]bool // signers whose committed seals are rejected
 
 	address common.Address
 	db      ethdb.Database
@@ -92,7 +93,7 @@ func (self *testSystemBackend) Gossip(valSet istanbul.ValidatorSet, message []by
 	return nil
 }
 
-func (self *testSystemBackend) Commit(proposal istanbul.Proposal, seals [][]byte) error {
+func (self *testSystemBackend) Commit(proposal istanbul.Proposal, seals [][]byte, signers []common.Address) error {
 	testLogger.Info("commit message", "address", self.Address())
 	self.committedMsgs = append(self.committedMsgs, testCommittedMsgs{
 		commitProposal: proposal,
@@ -117,6 +118,20 @@ func (self *testSystemBackend) CheckSignature([]byte, common.Address, []byte) er
 	return nil
 }
 
+func (self *testSystemBackend) SignCommittedSeal(proposal istanbul.Proposal) ([]byte, error) {
+	return self.Sign(PrepareCommittedSeal(proposal.Hash()))
+}
+
+func (self *testSystemBackend) VerifyCommittedSeals(proposal istanbul.Proposal, seals [][]byte, signers []common.Address) ([]common.Address, error) {
+	var invalid []common.Address
+	for _, signer := range signers {
+		if self.invalidSeals[signer] {
+			invalid = append(invalid, signer)
+		}
+	}
+	return invalid, nil
+}
+
 func (self *testSystemBackend) CheckValidatorSignature(data []byte, sig []byte) (common.Address, error) {
 	return common.Address{}, nil
 }
@@ -204,7 +219,7 @@ func NewTestSystemWithBackend(n, f uint64) *testSystem {
 		backend.peers = vset
 		backend.address = vset.GetByIndex(i).Address()
 
-		core := New(backend, config).(*core)
+		core := New(backend, config, backend.db).(*core)
 		core.state = StateAcceptRequest
 		core.current = newRoundState(&istanbul.View{
 			Round:    big.NewInt(0),
@@ -21,12 +21,37 @@ import (
 	"io"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
 type Engine interface {
 	Start() error
 	Stop() error
+
+	// Evidence retrieves the proofs of equivocation collected so far.
+	Evidence() []*istanbul.Evidence
+
+	// Status retrieves a snapshot of the consensus state, or nil if the engine
+	// is not running.
+	Status() *Status
+}
+
+// SyncEngine is an Engine which can be driven by its caller one event at a time,
+// instead of consuming events from the backend's event mux on its own goroutine.
+// Every event is handled, together with all the internal events it triggers,
+// before HandleEvent returns, which makes runs reproducible for simulations.
+type SyncEngine interface {
+	Engine
+
+	// StartSync starts the engine in sync mode, scheduling its timers on the
+	// given clock. Timers must fire on the goroutine driving the engine.
+	StartSync(clock mclock.Clock) error
+
+	// HandleEvent handles an istanbul.RequestEvent, istanbul.MessageEvent or
+	// istanbul.FinalCommittedEvent synchronously.
+	HandleEvent(ev interface{})
 }
 
 type State uint64
@@ -52,6 +77,11 @@ func (s State) String() string {
 	}
 }
 
+// MarshalText implements encoding.TextMarshaler, reporting states by name.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 // Cmp compares s and y and returns:
 //   -1 if s is the previous state of y
 //    0 if s and y are the same state
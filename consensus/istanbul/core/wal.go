@@ -0,0 +1,404 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	walHeadKey        = []byte("istanbul-wal-head")   // walHead of the journaled view
+	walLockKey        = []byte("istanbul-wal-lock")   // walLock of the journaled view
+	walSentPrefix     = []byte("istanbul-wal-sent")   // walSentPrefix + index (uint64 big endian) -> payload
+	walAcceptedPrefix = []byte("istanbul-wal-accept") // walAcceptedPrefix + index (uint64 big endian) -> payload
+)
+
+// walHead is the persisted view of the journal along with the number of messages
+// journaled in it. The messages themselves are kept under their own keys, so the
+// journal only ever appends a message and rewrites this small record.
+type walHead struct {
+	View     *istanbul.View
+	Sent     uint64
+	Accepted uint64
+}
+
+// walLock is the persisted lock of the journaled view. It is only rewritten when
+// the lock changes.
+type walLock struct {
+	LockedHash common.Hash
+	Preprepare []byte // RLP encoded locked PRE-PREPARE, empty if not locked
+}
+
+// walEntry is the consensus state of a single view. Everything needed to resume
+// the view after a restart without contradicting what was already signed is kept
+// here.
+type walEntry struct {
+	View       *istanbul.View
+	LockedHash common.Hash
+	Preprepare []byte   // RLP encoded locked PRE-PREPARE, empty if not locked
+	Sent       [][]byte // Payloads signed and broadcast by us in this view
+	Accepted   [][]byte // Payloads accepted from the validators in this view
+}
+
+// wal is a write-ahead log of the consensus messages of the current view. Every
+// message is flushed to the database before it is broadcast, so a restarted
+// validator can rebuild its round state and never sign two different messages
+// of the same kind for the same view.
+type wal struct {
+	db    ethdb.Database
+	entry *walEntry
+	known map[common.Hash]bool // Hashes of the payloads already in the entry
+
+	locked     bool        // Whether the lock in the database is known to match lockedHash
+	lockedHash common.Hash // Lock last written to the database
+}
+
+func newWAL(db ethdb.Database) *wal {
+	return &wal{
+		db:    db,
+		known: make(map[common.Hash]bool),
+	}
+}
+
+// walMessageKey = prefix + index (uint64 big endian)
+func walMessageKey(prefix []byte, index uint64) []byte {
+	key := make([]byte, len(prefix)+8)
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], index)
+	return key
+}
+
+// load retrieves the last persisted entry from the database, if any.
+func (w *wal) load() (*walEntry, error) {
+	blob, err := w.db.Get(walHeadKey)
+	if err != nil || len(blob) == 0 {
+		return nil, nil
+	}
+	head := new(walHead)
+	if err := rlp.DecodeBytes(blob, head); err != nil {
+		return nil, err
+	}
+	entry := &walEntry{View: head.View}
+	if blob, err := w.db.Get(walLockKey); err == nil && len(blob) > 0 {
+		lock := new(walLock)
+		if err := rlp.DecodeBytes(blob, lock); err != nil {
+			return nil, err
+		}
+		entry.LockedHash, entry.Preprepare = lock.LockedHash, lock.Preprepare
+	}
+	for i := uint64(0); i < head.Sent; i++ {
+		payload, err := w.db.Get(walMessageKey(walSentPrefix, i))
+		if err != nil {
+			return nil, err
+		}
+		entry.Sent = append(entry.Sent, payload)
+	}
+	for i := uint64(0); i < head.Accepted; i++ {
+		payload, err := w.db.Get(walMessageKey(walAcceptedPrefix, i))
+		if err != nil {
+			return nil, err
+		}
+		entry.Accepted = append(entry.Accepted, payload)
+	}
+	return entry, nil
+}
+
+// restore makes the given loaded entry the one being appended to, writing its
+// view and lock back into the database in case they were overwritten since.
+func (w *wal) restore(entry *walEntry, lockedHash common.Hash, preprepare *istanbul.Preprepare) error {
+	w.entry = entry
+	w.known = make(map[common.Hash]bool)
+	for _, payload := range entry.Sent {
+		w.known[istanbul.RLPHash(payload)] = true
+	}
+	for _, payload := range entry.Accepted {
+		w.known[istanbul.RLPHash(payload)] = true
+	}
+	w.locked = false
+
+	batch := w.db.NewBatch()
+	if err := w.writeLock(batch, lockedHash, preprepare); err != nil {
+		return err
+	}
+	if err := w.writeHead(batch); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// reset starts a new, empty entry for the given view and writes it into the
+// database along with the lock carried over into the view. The messages of the
+// previous view are dropped.
+func (w *wal) reset(view *istanbul.View, lockedHash common.Hash, preprepare *istanbul.Preprepare) error {
+	prev := w.entry
+	w.entry = &walEntry{
+		View: &istanbul.View{
+			Round:    view.Round,
+			Sequence: view.Sequence,
+		},
+	}
+	w.known = make(map[common.Hash]bool)
+
+	batch := w.db.NewBatch()
+	if err := w.writeLock(batch, lockedHash, preprepare); err != nil {
+		return err
+	}
+	if err := w.writeHead(batch); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	// The head no longer references the old messages, drop them. Leftovers of a
+	// crash in between are overwritten by the messages of later views.
+	if prev != nil {
+		for i := range prev.Sent {
+			w.db.Delete(walMessageKey(walSentPrefix, uint64(i)))
+		}
+		for i := range prev.Accepted {
+			w.db.Delete(walMessageKey(walAcceptedPrefix, uint64(i)))
+		}
+	}
+	return nil
+}
+
+// sent returns the payload we already signed for the given message code and
+// view, or nil if we did not sign one yet.
+func (w *wal) sent(code uint64, view *istanbul.View) []byte {
+	if w.entry == nil {
+		return nil
+	}
+	for _, payload := range w.entry.Sent {
+		msg := new(message)
+		if err := msg.FromPayload(payload, nil); err != nil || msg.Code != code {
+			continue
+		}
+		if v, err := messageView(msg); err == nil && v.Cmp(view) == 0 {
+			return payload
+		}
+	}
+	return nil
+}
+
+// append adds a payload signed by us, or accepted from a validator, to the current
+// entry and writes it into the database along with the current lock. It returns
+// false if the payload is already journaled.
+func (w *wal) append(sent bool, payload []byte, lockedHash common.Hash, preprepare *istanbul.Preprepare) (bool, error) {
+	hash := istanbul.RLPHash(payload)
+	if w.entry == nil || w.known[hash] {
+		return false, nil
+	}
+	w.known[hash] = true
+
+	batch := w.db.NewBatch()
+	if sent {
+		batch.Put(walMessageKey(walSentPrefix, uint64(len(w.entry.Sent))), payload)
+		w.entry.Sent = append(w.entry.Sent, payload)
+	} else {
+		batch.Put(walMessageKey(walAcceptedPrefix, uint64(len(w.entry.Accepted))), payload)
+		w.entry.Accepted = append(w.entry.Accepted, payload)
+	}
+	if err := w.writeLock(batch, lockedHash, preprepare); err != nil {
+		return true, err
+	}
+	if err := w.writeHead(batch); err != nil {
+		return true, err
+	}
+	return true, batch.Write()
+}
+
+// writeHead adds the view of the current entry and its message counts to a batch.
+func (w *wal) writeHead(batch ethdb.Batch) error {
+	blob, err := rlp.EncodeToBytes(&walHead{
+		View:     w.entry.View,
+		Sent:     uint64(len(w.entry.Sent)),
+		Accepted: uint64(len(w.entry.Accepted)),
+	})
+	if err != nil {
+		return err
+	}
+	return batch.Put(walHeadKey, blob)
+}
+
+// writeLock adds the given lock to a batch, unless it is already in the database.
+func (w *wal) writeLock(batch ethdb.Batch, lockedHash common.Hash, preprepare *istanbul.Preprepare) error {
+	if preprepare == nil {
+		lockedHash = common.Hash{}
+	}
+	if w.locked && w.lockedHash == lockedHash {
+		return nil
+	}
+	lock := &walLock{LockedHash: lockedHash}
+	if !common.EmptyHash(lockedHash) {
+		blob, err := rlp.EncodeToBytes(preprepare)
+		if err != nil {
+			return err
+		}
+		lock.Preprepare = blob
+	}
+	blob, err := rlp.EncodeToBytes(lock)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(walLockKey, blob); err != nil {
+		return err
+	}
+	w.locked, w.lockedHash = true, lockedHash
+	return nil
+}
+
+// messageView extracts the view a consensus message belongs to. All message
+// kinds start with the view, so only the leading list element is decoded.
+func messageView(msg *message) (*istanbul.View, error) {
+	var head struct {
+		View *istanbul.View
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+	if err := msg.Decode(&head); err != nil {
+		return nil, err
+	}
+	return head.View, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// writeSent records a message signed by us before it leaves the node.
+func (c *core) writeSent(payload []byte) error {
+	if c.wal == nil {
+		return nil
+	}
+	_, err := c.wal.append(true, payload, c.current.GetLockedHash(), c.current.Preprepare)
+	return err
+}
+
+// writeAccepted records a message which was accepted into the round state.
+func (c *core) writeAccepted(msg *message) {
+	if c.wal == nil {
+		return
+	}
+	payload, err := msg.Payload()
+	if err != nil {
+		return
+	}
+	if _, err := c.wal.append(false, payload, c.current.GetLockedHash(), c.current.Preprepare); err != nil {
+		c.logger.Error("Failed to write consensus WAL", "err", err)
+	}
+}
+
+// loadWAL retrieves the journaled consensus state. It has to be called before
+// the first round is started, which overwrites the journal.
+func (c *core) loadWAL() *walEntry {
+	if c.wal == nil {
+		return nil
+	}
+	entry, err := c.wal.load()
+	if err != nil {
+		c.logger.Error("Failed to load consensus WAL", "err", err)
+		return nil
+	}
+	return entry
+}
+
+// replayWAL restores the consensus state of the current sequence from the
+// journaled entry, re-handling every accepted message and gossiping the
+// messages we signed before the restart.
+func (c *core) replayWAL(entry *walEntry) {
+	if entry == nil || entry.View == nil || entry.View.Sequence.Cmp(c.current.Sequence()) != 0 {
+		return
+	}
+	logger := c.logger.New("seq", entry.View.Sequence, "round", entry.View.Round)
+
+	// Restore the view and the lock
+	var preprepare *istanbul.Preprepare
+	if len(entry.Preprepare) > 0 {
+		preprepare = new(istanbul.Preprepare)
+		if err := rlp.DecodeBytes(entry.Preprepare, preprepare); err != nil {
+			logger.Error("Failed to decode locked proposal from WAL", "err", err)
+			preprepare = nil
+		}
+	}
+	lockedHash := entry.LockedHash
+	if preprepare == nil || preprepare.Proposal.Hash() != lockedHash {
+		lockedHash, preprepare = common.Hash{}, nil
+	}
+	_, lastProposer := c.backend.LastProposal()
+
+	c.statusMu.Lock()
+	c.current = newRoundState(entry.View, c.valSet, lockedHash, preprepare, nil, c.backend.HasBadProposal)
+	c.roundChangeSet = newRoundChangeSet(c.valSet)
+	c.valSet.CalcProposer(lastProposer, entry.View.Sequence.Uint64(), entry.View.Round.Uint64())
+	c.statusMu.Unlock()
+	if err := c.wal.restore(entry, lockedHash, preprepare); err != nil {
+		logger.Error("Failed to write consensus WAL", "err", err)
+	}
+	c.newRoundChangeTimer()
+
+	logger.Info("Replaying consensus WAL", "sent", len(entry.Sent), "accepted", len(entry.Accepted), "locked", lockedHash)
+
+	// Feed the accepted messages back into the state machine
+	for _, payload := range entry.Accepted {
+		msg := new(message)
+		if err := msg.FromPayload(payload, c.validateFn); err != nil {
+			continue
+		}
+		_, src := c.valSet.GetByAddress(msg.Address)
+		if src == nil {
+			continue
+		}
+		c.handleCheckedMsg(msg, src)
+	}
+	// Resend what we signed, peers may have missed it while we were down
+	for _, payload := range entry.Sent {
+		msg := new(message)
+		if err := msg.FromPayload(payload, nil); err != nil {
+			continue
+		}
+		if view, err := messageView(msg); err != nil || view.Cmp(c.currentView()) != 0 {
+			continue
+		}
+		if err := c.backend.Gossip(c.valSet, payload); err != nil {
+			logger.Error("Failed to resend message from WAL", "err", err)
+		}
+	}
+}
+
+// rebroadcast returns the payload to send instead of msg if a message of the
+// same kind was already signed for its view.
+func (c *core) rebroadcast(msg *message) []byte {
+	if c.wal == nil {
+		return nil
+	}
+	view, err := messageView(msg)
+	if err != nil {
+		return nil
+	}
+	prev := c.wal.sent(msg.Code, view)
+	if prev == nil {
+		return nil
+	}
+	old := new(message)
+	if err := old.FromPayload(prev, nil); err == nil && !bytes.Equal(old.Msg, msg.Msg) {
+		c.logger.Warn("Refusing to sign conflicting message", "code", msg.Code, "view", view)
+	}
+	return prev
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+func TestWALConflictingMessage(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	sys.Run(false)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+	c.wal.reset(c.currentView(), common.Hash{}, nil)
+
+	c.current.SetPreprepare(newTestPreprepare(c.currentView()))
+	c.sendPrepare()
+
+	// Switching the proposal must not produce a second, conflicting PREPARE
+	c.current.SetPreprepare(&istanbul.Preprepare{
+		View:     c.currentView(),
+		Proposal: makeBlock(2),
+	})
+	c.sendPrepare()
+
+	if len(v0.sentMsgs) != 2 {
+		t.Fatalf("sent messages mismatch: have %d, want 2", len(v0.sentMsgs))
+	}
+	if !bytes.Equal(v0.sentMsgs[0], v0.sentMsgs[1]) {
+		t.Errorf("conflicting PREPARE signed for the same view")
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	sys := NewTestSystemWithBackend(4, 1)
+	sys.Run(false)
+
+	v0 := sys.backends[0]
+	c := v0.engine.(*core)
+
+	// Lock a proposal at round 1 and vote for it
+	view := &istanbul.View{
+		Round:    big.NewInt(1),
+		Sequence: big.NewInt(1),
+	}
+	c.updateRoundState(view, c.valSet, false)
+	c.current.SetPreprepare(newTestPreprepare(view))
+	c.current.LockHash()
+	c.sendPrepare()
+
+	// Restart the validator on top of the same database
+	restarted := New(v0, istanbul.DefaultConfig, v0.db).(*core)
+	restarted.validateFn = v0.CheckValidatorSignature
+	restarted.logger = testLogger
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("failed to start core: %v", err)
+	}
+	defer restarted.Stop()
+
+	if restarted.current.Round().Cmp(view.Round) != 0 {
+		t.Errorf("round mismatch: have %v, want %v", restarted.current.Round(), view.Round)
+	}
+	if !restarted.current.IsHashLocked() || restarted.current.GetLockedHash() != newTestProposal().Hash() {
+		t.Errorf("lock mismatch: have %v, want %v", restarted.current.GetLockedHash().Hex(), newTestProposal().Hash().Hex())
+	}
+	// A PREPARE for another proposal must be replaced by the journaled one
+	sent := len(v0.sentMsgs)
+	restarted.current.SetPreprepare(&istanbul.Preprepare{
+		View:     view,
+		Proposal: makeBlock(2),
+	})
+	restarted.sendPrepare()
+
+	if len(v0.sentMsgs) != sent+1 {
+		t.Fatalf("sent messages mismatch: have %d, want %d", len(v0.sentMsgs), sent+1)
+	}
+	if !bytes.Equal(v0.sentMsgs[0], v0.sentMsgs[sent]) {
+		t.Errorf("conflicting PREPARE signed after restart")
+	}
+}
+
+func TestWALAppendAndReset(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	w := newWAL(db)
+
+	view := &istanbul.View{Round: big.NewInt(0), Sequence: big.NewInt(1)}
+	if err := w.reset(view, common.Hash{}, nil); err != nil {
+		t.Fatalf("failed to reset journal: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if ok, err := w.append(i == 0, []byte{byte(i)}, common.Hash{}, nil); !ok || err != nil {
+			t.Fatalf("message %d: failed to append: %v, %v", i, ok, err)
+		}
+	}
+	// Known payloads must not be journaled twice
+	if ok, _ := w.append(false, []byte{1}, common.Hash{}, nil); ok {
+		t.Errorf("duplicate payload journaled")
+	}
+	entry, err := newWAL(db).load()
+	if err != nil {
+		t.Fatalf("failed to load journal: %v", err)
+	}
+	if entry.View.Cmp(view) != 0 || len(entry.Sent) != 1 || len(entry.Accepted) != 2 {
+		t.Fatalf("journal mismatch: view %v, sent %d, accepted %d", entry.View, len(entry.Sent), len(entry.Accepted))
+	}
+	if !bytes.Equal(entry.Accepted[1], []byte{2}) {
+		t.Errorf("accepted payload mismatch: have %x, want 02", entry.Accepted[1])
+	}
+	// A new view must be persisted right away and drop the old messages
+	next := &istanbul.View{Round: big.NewInt(1), Sequence: big.NewInt(1)}
+	if err := w.reset(next, common.Hash{}, nil); err != nil {
+		t.Fatalf("failed to reset journal: %v", err)
+	}
+	if entry, _ = newWAL(db).load(); entry.View.Cmp(next) != 0 || len(entry.Sent)+len(entry.Accepted) != 0 {
+		t.Errorf("journal not reset: view %v, sent %d, accepted %d", entry.View, len(entry.Sent), len(entry.Accepted))
+	}
+	if ok, _ := db.Has(walMessageKey(walAcceptedPrefix, 0)); ok {
+		t.Errorf("message of the old view left in the database")
+	}
+}
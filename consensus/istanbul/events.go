@@ -29,3 +29,8 @@ type MessageEvent struct {
 // FinalCommittedEvent is posted when a proposal is committed
 type FinalCommittedEvent struct {
 }
+
+// EvidenceEvent is posted when a validator is caught signing conflicting messages
+type EvidenceEvent struct {
+	Evidence *Evidence
+}
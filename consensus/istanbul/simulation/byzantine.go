@@ -0,0 +1,99 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulation
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Message codes of the consensus protocol, mirroring the core package.
+const (
+	msgPreprepare uint64 = iota
+	msgPrepare
+	msgCommit
+)
+
+// wireMessage mirrors the wire format of the consensus messages, so that byzantine
+// validators can forge them without access to the core internals.
+type wireMessage struct {
+	Code          uint64
+	Msg           []byte
+	Address       common.Address
+	Signature     []byte
+	CommittedSeal []byte
+}
+
+// forge returns a validly signed message conflicting with one the validator sent
+// itself. A forged PRE-PREPARE proposes a different block, forged PREPAREs and
+// COMMITs vote for it. Messages of other validators are returned untouched.
+func (n *node) forge(payload []byte) []byte {
+	hash := istanbul.RLPHash(payload)
+	if forged, ok := n.forged[hash]; ok {
+		return forged
+	}
+	var msg wireMessage
+	if err := rlp.DecodeBytes(payload, &msg); err != nil || msg.Address != n.address {
+		return payload
+	}
+	switch msg.Code {
+	case msgPreprepare:
+		var preprepare istanbul.Preprepare
+		if err := rlp.DecodeBytes(msg.Msg, &preprepare); err != nil {
+			return payload
+		}
+		block := preprepare.Proposal.(*types.Block)
+		header := block.Header()
+		header.Time = new(big.Int).Add(header.Time, common.Big1)
+		alt := types.NewBlockWithHeader(header)
+		n.digests[block.Hash()] = alt.Hash()
+
+		preprepare.Proposal = alt
+		msg.Msg, _ = rlp.EncodeToBytes(&preprepare)
+
+	case msgPrepare, msgCommit:
+		var subject istanbul.Subject
+		if err := rlp.DecodeBytes(msg.Msg, &subject); err != nil {
+			return payload
+		}
+		digest, ok := n.digests[subject.Digest]
+		if !ok {
+			digest = crypto.Keccak256Hash(subject.Digest.Bytes())
+		}
+		subject.Digest = digest
+		msg.Msg, _ = rlp.EncodeToBytes(&subject)
+
+		if msg.Code == msgCommit {
+			msg.CommittedSeal, _ = n.Sign(istanbulCore.PrepareCommittedSeal(digest))
+		}
+	default:
+		return payload
+	}
+	msg.Signature = []byte{}
+	data, _ := rlp.EncodeToBytes(&msg)
+	msg.Signature, _ = n.Sign(data)
+
+	forged, _ := rlp.EncodeToBytes(&msg)
+	n.forged[hash] = forged
+	return forged
+}
@@ -0,0 +1,321 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulation
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	istanbulCore "github.com/ethereum/go-ethereum/consensus/istanbul/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+var (
+	// errInvalidProposal is returned when a proposal is not a block, or carries
+	// the marker of the wrong proposal behaviour.
+	errInvalidProposal = errors.New("invalid proposal")
+	// errUnknownParent is returned when a proposal does not extend the local chain.
+	errUnknownParent = errors.New("unknown parent")
+	// errInsufficientSeals is returned when a block is not sealed by a quorum.
+	errInsufficientSeals = errors.New("insufficient committed seals")
+	// errInvalidSignature is returned when a signature is not made by the
+	// expected signer.
+	errInvalidSignature = errors.New("invalid signature")
+
+	// invalidExtra marks the proposals of validators with the WrongProposal behaviour.
+	invalidExtra = []byte("invalid")
+)
+
+// sealedBlock is a committed block together with the seals proving the quorum.
+type sealedBlock struct {
+	block *types.Block
+	seals [][]byte
+}
+
+// node is a simulated validator. It implements istanbul.Backend on top of an
+// in-memory chain and runs an Istanbul core engine in sync mode.
+type node struct {
+	index     int
+	net       *Network
+	key       *ecdsa.PrivateKey
+	address   common.Address
+	behaviour Behaviour
+
+	engine istanbulCore.SyncEngine
+	db     ethdb.Database
+	mux    *event.TypeMux
+	valSet istanbul.ValidatorSet
+
+	chain    []*sealedBlock
+	known    map[common.Hash]bool // Consensus messages already received
+	gossiped map[common.Hash]bool // Consensus messages already relayed
+
+	forged  map[common.Hash][]byte      // Conflicting messages sent by an equivocating validator
+	digests map[common.Hash]common.Hash // Proposals replaced by an equivocating validator
+}
+
+// start launches the consensus engine and schedules the first proposal.
+func (n *node) start() {
+	n.engine = istanbulCore.New(n, n.net.istanbulConfig(), n.db).(istanbulCore.SyncEngine)
+	n.engine.StartSync(n.net.clock)
+	n.scheduleRequest()
+}
+
+// head returns the last committed block.
+func (n *node) head() *types.Block {
+	return n.chain[len(n.chain)-1].block
+}
+
+// propose assembles the block the validator proposes on top of its chain.
+func (n *node) propose() *types.Block {
+	parent := n.head()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   n.address,
+		Difficulty: big.NewInt(1),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		Time:       new(big.Int).Add(parent.Time(), common.Big1),
+	}
+	if n.behaviour == WrongProposal {
+		header.Extra = invalidExtra
+	}
+	return types.NewBlockWithHeader(header)
+}
+
+// scheduleRequest hands a new proposal to the engine after the block period,
+// like the miner does after every new chain head.
+func (n *node) scheduleRequest() {
+	number := n.head().NumberU64()
+	n.net.clock.AfterFunc(n.net.config.BlockPeriod, func() {
+		if n.engine == nil || n.head().NumberU64() != number {
+			return
+		}
+		n.engine.HandleEvent(istanbul.RequestEvent{Proposal: n.propose()})
+	})
+}
+
+// deliver feeds a consensus message from the network into the engine.
+func (n *node) deliver(payload []byte) {
+	hash := istanbul.RLPHash(payload)
+	if n.known[hash] {
+		return
+	}
+	n.known[hash] = true
+	n.engine.HandleEvent(istanbul.MessageEvent{Payload: payload})
+}
+
+// insert appends a sealed block to the local chain, announces it and moves the
+// engine to the next height.
+func (n *node) insert(sealed *sealedBlock) {
+	n.chain = append(n.chain, sealed)
+	n.net.recordCommit(n, sealed.block)
+	n.net.announce(n, sealed)
+
+	n.net.clock.AfterFunc(0, func() {
+		n.engine.HandleEvent(istanbul.FinalCommittedEvent{})
+	})
+	n.scheduleRequest()
+}
+
+// importBlocks inserts the blocks received from a peer, stopping at the first
+// one which does not extend the local chain.
+func (n *node) importBlocks(from int, blocks []*sealedBlock) {
+	for _, sealed := range blocks {
+		number := sealed.block.NumberU64()
+		switch {
+		case number <= n.head().NumberU64():
+			continue
+		case number > n.head().NumberU64()+1:
+			// We're lagging behind, ask the sender for the missing blocks
+			n.net.requestBlocks(n, from, n.head().NumberU64()+1)
+			return
+		}
+		if sealed.block.ParentHash() != n.head().Hash() || n.verifySeals(sealed.block, sealed.seals) != nil {
+			return
+		}
+		n.insert(sealed)
+	}
+}
+
+// verifySeals checks that the block is sealed by a quorum of validators.
+func (n *node) verifySeals(block *types.Block, seals [][]byte) error {
+	signers := make(map[common.Address]bool)
+	weight := 0
+	for _, seal := range seals {
+		signer, err := istanbul.GetSignatureAddress(istanbulCore.PrepareCommittedSeal(block.Hash()), seal)
+		if err != nil {
+			return err
+		}
+		_, v := n.valSet.GetByAddress(signer)
+		if v == nil || signers[signer] {
+			return errInsufficientSeals
+		}
+		signers[signer] = true
+		weight += int(v.Weight())
+	}
+	if weight < n.valSet.QuorumSize() {
+		return errInsufficientSeals
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+// Address implements istanbul.Backend.Address
+func (n *node) Address() common.Address {
+	return n.address
+}
+
+// Validators implements istanbul.Backend.Validators
+func (n *node) Validators(proposal istanbul.Proposal) istanbul.ValidatorSet {
+	return n.valSet.Copy()
+}
+
+// EventMux implements istanbul.Backend.EventMux
+func (n *node) EventMux() *event.TypeMux {
+	return n.mux
+}
+
+// Broadcast implements istanbul.Backend.Broadcast
+func (n *node) Broadcast(valSet istanbul.ValidatorSet, payload []byte) error {
+	hash := istanbul.RLPHash(payload)
+	n.known[hash] = true
+
+	n.Gossip(valSet, payload)
+	n.net.clock.AfterFunc(0, func() {
+		if n.engine != nil {
+			n.engine.HandleEvent(istanbul.MessageEvent{Payload: payload})
+		}
+	})
+	return nil
+}
+
+// Gossip implements istanbul.Backend.Gossip
+func (n *node) Gossip(valSet istanbul.ValidatorSet, payload []byte) error {
+	hash := istanbul.RLPHash(payload)
+	if n.gossiped[hash] {
+		return nil
+	}
+	n.gossiped[hash] = true
+	n.net.gossip(n, payload)
+	return nil
+}
+
+// Commit implements istanbul.Backend.Commit
+func (n *node) Commit(proposal istanbul.Proposal, seals [][]byte, signers []common.Address) error {
+	block, ok := proposal.(*types.Block)
+	if !ok {
+		return errInvalidProposal
+	}
+	// The block may have been imported from a peer in the meantime
+	if n.HasPropsal(block.Hash(), block.Number()) {
+		return nil
+	}
+	if block.ParentHash() != n.head().Hash() {
+		return errUnknownParent
+	}
+	if err := n.verifySeals(block, seals); err != nil {
+		return err
+	}
+	n.insert(&sealedBlock{block: block, seals: seals})
+	return nil
+}
+
+// Verify implements istanbul.Backend.Verify
+func (n *node) Verify(proposal istanbul.Proposal) (time.Duration, error) {
+	block, ok := proposal.(*types.Block)
+	if !ok || bytes.Equal(block.Extra(), invalidExtra) {
+		return 0, errInvalidProposal
+	}
+	if block.ParentHash() != n.head().Hash() {
+		return 0, errUnknownParent
+	}
+	return 0, nil
+}
+
+// Sign implements istanbul.Backend.Sign
+func (n *node) Sign(data []byte) ([]byte, error) {
+	return crypto.Sign(crypto.Keccak256(data), n.key)
+}
+
+// CheckSignature implements istanbul.Backend.CheckSignature
+func (n *node) CheckSignature(data []byte, address common.Address, sig []byte) error {
+	signer, err := istanbul.GetSignatureAddress(data, sig)
+	if err != nil {
+		return err
+	}
+	if signer != address {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// SignCommittedSeal implements istanbul.Backend.SignCommittedSeal
+func (n *node) SignCommittedSeal(proposal istanbul.Proposal) ([]byte, error) {
+	return n.Sign(istanbulCore.PrepareCommittedSeal(proposal.Hash()))
+}
+
+// VerifyCommittedSeals implements istanbul.Backend.VerifyCommittedSeals
+func (n *node) VerifyCommittedSeals(proposal istanbul.Proposal, seals [][]byte, signers []common.Address) ([]common.Address, error) {
+	var invalid []common.Address
+	for i, seal := range seals {
+		if err := n.CheckSignature(istanbulCore.PrepareCommittedSeal(proposal.Hash()), signers[i], seal); err != nil {
+			invalid = append(invalid, signers[i])
+		}
+	}
+	return invalid, nil
+}
+
+// LastProposal implements istanbul.Backend.LastProposal
+func (n *node) LastProposal() (istanbul.Proposal, common.Address) {
+	head := n.head()
+	return head, head.Coinbase()
+}
+
+// HasPropsal implements istanbul.Backend.HasPropsal
+func (n *node) HasPropsal(hash common.Hash, number *big.Int) bool {
+	if number.Sign() < 0 || number.Cmp(big.NewInt(int64(len(n.chain)))) >= 0 {
+		return false
+	}
+	return n.chain[number.Uint64()].block.Hash() == hash
+}
+
+// GetProposer implements istanbul.Backend.GetProposer
+func (n *node) GetProposer(number uint64) common.Address {
+	if number >= uint64(len(n.chain)) {
+		return common.Address{}
+	}
+	return n.chain[number].block.Coinbase()
+}
+
+// ParentValidators implements istanbul.Backend.ParentValidators
+func (n *node) ParentValidators(proposal istanbul.Proposal) istanbul.ValidatorSet {
+	return n.valSet.Copy()
+}
+
+// HasBadProposal implements istanbul.Backend.HasBadProposal
+func (n *node) HasBadProposal(hash common.Hash) bool {
+	return false
+}
@@ -0,0 +1,338 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package simulation runs a network of in-process Istanbul validators on top of
+// a simulated message bus and a virtual clock.
+//
+// Every validator runs the real consensus core in sync mode, so the whole network
+// is driven from a single goroutine: messages, timers and proposals are all events
+// on the virtual clock. Given the same configuration, a simulation always plays
+// out exactly the same way, which makes it possible to test safety and liveness
+// under latency, message loss, partitions and byzantine validators.
+package simulation
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/consensus/istanbul"
+	"github.com/ethereum/go-ethereum/consensus/istanbul/validator"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Behaviour describes how a simulated validator acts.
+type Behaviour int
+
+const (
+	// Honest validators follow the protocol.
+	Honest Behaviour = iota
+	// Silent validators receive messages but never send anything.
+	Silent
+	// Equivocating validators send conflicting PRE-PREPARE, PREPARE and COMMIT
+	// messages to the two halves of the network.
+	Equivocating
+	// WrongProposal validators propose blocks the honest validators reject.
+	WrongProposal
+)
+
+func (b Behaviour) String() string {
+	switch b {
+	case Honest:
+		return "honest"
+	case Silent:
+		return "silent"
+	case Equivocating:
+		return "equivocating"
+	case WrongProposal:
+		return "wrong proposal"
+	default:
+		return "unknown"
+	}
+}
+
+// Config contains the settings of a simulated network.
+type Config struct {
+	Validators int               // Number of validators in the network
+	Byzantine  map[int]Behaviour // Behaviour of the misbehaving validators, by index
+	Seed       int64             // Seed of the keys and of all random decisions
+
+	MinLatency time.Duration // Minimum delay of a message between two validators
+	MaxLatency time.Duration // Maximum delay of a message between two validators
+	DropRate   float64       // Probability of a message being lost
+
+	BlockPeriod           time.Duration           // Delay between a new chain head and the next proposal
+	RequestTimeout        time.Duration           // Timeout of the first round of a height
+	CommitTimeout         time.Duration           // Timeout for committing an accepted proposal, disabled if zero
+	RoundTimeoutIncrement time.Duration           // Timeout added for every round change, exponential backoff if zero
+	MaxRoundTimeout       time.Duration           // Upper bound of the round timeouts, unbounded if zero
+	ProposerPolicy        istanbul.ProposerPolicy // Proposer selection policy
+}
+
+// Network is a simulated network of Istanbul validators.
+type Network struct {
+	config Config
+	clock  *mclock.Simulated
+	rand   *rand.Rand
+	nodes  []*node
+	groups []int // Partition group of every validator, nil if the network is whole
+
+	commits    map[uint64]common.Hash // Block committed at every height by the honest validators
+	violations []error                // Safety violations detected so far
+}
+
+// NewNetwork creates a simulated network. The validators are not running until
+// Start is called.
+func NewNetwork(config Config) *Network {
+	if config.MaxLatency < config.MinLatency {
+		config.MaxLatency = config.MinLatency
+	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = time.Duration(istanbul.DefaultConfig.RequestTimeout) * time.Millisecond
+	}
+	net := &Network{
+		config:  config,
+		clock:   new(mclock.Simulated),
+		rand:    rand.New(rand.NewSource(config.Seed)),
+		commits: make(map[uint64]common.Hash),
+	}
+	// Derive the validator keys from the seed, so runs are reproducible
+	genesis := &sealedBlock{
+		block: types.NewBlockWithHeader(&types.Header{
+			Number:     new(big.Int),
+			Difficulty: big.NewInt(1),
+			Time:       new(big.Int),
+		}),
+	}
+	addrs := make([]common.Address, config.Validators)
+	for i := 0; i < config.Validators; i++ {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("istanbul-simulation-%d-%d", config.Seed, i))))
+		if err != nil {
+			panic(err)
+		}
+		db, _ := ethdb.NewMemDatabase()
+		n := &node{
+			index:     i,
+			net:       net,
+			key:       key,
+			address:   crypto.PubkeyToAddress(key.PublicKey),
+			behaviour: config.Byzantine[i],
+			db:        db,
+			mux:       new(event.TypeMux),
+			chain:     []*sealedBlock{genesis},
+			known:     make(map[common.Hash]bool),
+			gossiped:  make(map[common.Hash]bool),
+			forged:    make(map[common.Hash][]byte),
+			digests:   make(map[common.Hash]common.Hash),
+		}
+		net.nodes = append(net.nodes, n)
+		addrs[i] = n.address
+	}
+	for _, n := range net.nodes {
+		n.valSet = validator.NewSet(addrs, config.ProposerPolicy)
+	}
+	return net
+}
+
+// istanbulConfig returns the consensus configuration of the validators.
+func (net *Network) istanbulConfig() *istanbul.Config {
+	return &istanbul.Config{
+		RequestTimeout:        uint64(net.config.RequestTimeout / time.Millisecond),
+		CommitTimeout:         uint64(net.config.CommitTimeout / time.Millisecond),
+		RoundTimeoutIncrement: uint64(net.config.RoundTimeoutIncrement / time.Millisecond),
+		MaxRoundTimeout:       uint64(net.config.MaxRoundTimeout / time.Millisecond),
+		BlockPeriod:           uint64(net.config.BlockPeriod / time.Second),
+		ProposerPolicy:        net.config.ProposerPolicy,
+		Epoch:                 istanbul.DefaultConfig.Epoch,
+	}
+}
+
+// Start launches the consensus engine of every validator.
+func (net *Network) Start() {
+	for _, n := range net.nodes {
+		n.start()
+	}
+}
+
+// Stop terminates the consensus engine of every validator.
+func (net *Network) Stop() {
+	for _, n := range net.nodes {
+		if n.engine != nil {
+			n.engine.Stop()
+			n.engine = nil
+		}
+	}
+}
+
+// Run moves the virtual clock forward, processing every event on the way.
+func (net *Network) Run(d time.Duration) {
+	net.clock.Run(d)
+}
+
+// RunUntil moves the virtual clock forward until every honest validator reaches
+// the given height, or until the time limit passes. It reports whether the
+// height was reached.
+func (net *Network) RunUntil(height uint64, limit time.Duration) bool {
+	deadline := net.clock.Now() + mclock.AbsTime(limit)
+	for net.MinHeight() < height && net.clock.Now() < deadline {
+		net.clock.Run(100 * time.Millisecond)
+	}
+	return net.MinHeight() >= height
+}
+
+// Elapsed returns the virtual time passed since the network was created.
+func (net *Network) Elapsed() time.Duration {
+	return time.Duration(net.clock.Now())
+}
+
+// Partition splits the network into the given groups of validators. Messages
+// sent across groups are lost. Validators not listed form a group of their own.
+func (net *Network) Partition(groups ...[]int) {
+	net.groups = make([]int, len(net.nodes))
+	for i := range net.groups {
+		net.groups[i] = -1 - i
+	}
+	for g, group := range groups {
+		for _, i := range group {
+			net.groups[i] = g
+		}
+	}
+}
+
+// Heal removes any partition from the network.
+func (net *Network) Heal() {
+	net.groups = nil
+}
+
+// Height returns the chain height of a validator.
+func (net *Network) Height(i int) uint64 {
+	return net.nodes[i].head().NumberU64()
+}
+
+// MinHeight returns the lowest chain height of the honest validators.
+func (net *Network) MinHeight() uint64 {
+	min := uint64(0)
+	first := true
+	for _, n := range net.nodes {
+		if n.behaviour != Honest {
+			continue
+		}
+		if height := n.head().NumberU64(); first || height < min {
+			min, first = height, false
+		}
+	}
+	return min
+}
+
+// Chain returns the hashes of the blocks committed by a validator.
+func (net *Network) Chain(i int) []common.Hash {
+	hashes := make([]common.Hash, len(net.nodes[i].chain))
+	for j, sealed := range net.nodes[i].chain {
+		hashes[j] = sealed.block.Hash()
+	}
+	return hashes
+}
+
+// Evidence returns the proofs of equivocation collected by a validator.
+func (net *Network) Evidence(i int) []*istanbul.Evidence {
+	return net.nodes[i].engine.Evidence()
+}
+
+// Violations returns the safety violations detected so far, namely honest
+// validators committing different blocks at the same height.
+func (net *Network) Violations() []error {
+	return net.violations
+}
+
+// recordCommit checks a newly committed block against the blocks committed by
+// the other honest validators.
+func (net *Network) recordCommit(n *node, block *types.Block) {
+	if n.behaviour != Honest {
+		return
+	}
+	number, hash := block.NumberU64(), block.Hash()
+	if prev, ok := net.commits[number]; ok && prev != hash {
+		net.violations = append(net.violations, fmt.Errorf("validator %d committed %x at height %d, conflicting with %x", n.index, hash, number, prev))
+		return
+	}
+	net.commits[number] = hash
+}
+
+// send schedules the delivery of a message between two validators, subject to
+// the latency, losses and partitions of the network.
+func (net *Network) send(from, to *node, deliver func()) {
+	if from.behaviour == Silent {
+		return
+	}
+	if net.groups != nil && net.groups[from.index] != net.groups[to.index] {
+		return
+	}
+	if net.config.DropRate > 0 && net.rand.Float64() < net.config.DropRate {
+		return
+	}
+	delay := net.config.MinLatency
+	if spread := net.config.MaxLatency - net.config.MinLatency; spread > 0 {
+		delay += time.Duration(net.rand.Int63n(int64(spread) + 1))
+	}
+	net.clock.AfterFunc(delay, func() {
+		if to.engine != nil {
+			deliver()
+		}
+	})
+}
+
+// gossip sends a consensus message to every other validator.
+func (net *Network) gossip(from *node, payload []byte) {
+	for _, to := range net.nodes {
+		if to == from {
+			continue
+		}
+		to, msg := to, payload
+		if from.behaviour == Equivocating && to.index%2 == 1 {
+			msg = from.forge(payload)
+		}
+		net.send(from, to, func() { to.deliver(msg) })
+	}
+}
+
+// announce sends a newly committed block to every other validator.
+func (net *Network) announce(from *node, sealed *sealedBlock) {
+	for _, to := range net.nodes {
+		if to == from {
+			continue
+		}
+		to := to
+		net.send(from, to, func() { to.importBlocks(from.index, []*sealedBlock{sealed}) })
+	}
+}
+
+// requestBlocks asks a peer for its blocks starting at the given number.
+func (net *Network) requestBlocks(n *node, peer int, number uint64) {
+	p := net.nodes[peer]
+	net.send(n, p, func() {
+		if number >= uint64(len(p.chain)) {
+			return
+		}
+		blocks := append([]*sealedBlock{}, p.chain[number:]...)
+		net.send(p, n, func() { n.importBlocks(peer, blocks) })
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -145,3 +146,23 @@ func (b *Subject) DecodeRLP(s *rlp.Stream) error {
 func (b *Subject) String() string {
 	return fmt.Sprintf("{View: %v, Digest: %v}", b.View, b.Digest.String())
 }
+
+// Evidence is a proof that a validator signed two conflicting consensus messages
+// of the same kind for the same view. Both messages are kept in their signed wire
+// format, so the evidence can be verified without trusting the reporter.
+type Evidence struct {
+	Offender common.Address `json:"offender"`
+	Code     uint64         `json:"code"`
+	View     *View          `json:"view"`
+	First    hexutil.Bytes  `json:"first"`
+	Second   hexutil.Bytes  `json:"second"`
+}
+
+// Hash retrieves the RLP hash of the evidence.
+func (e *Evidence) Hash() common.Hash {
+	return RLPHash(e)
+}
+
+func (e *Evidence) String() string {
+	return fmt.Sprintf("{Offender: %v, Code: %v, View: %v}", e.Offender.String(), e.Code, e.View)
+}
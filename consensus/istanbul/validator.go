@@ -26,6 +26,9 @@ type Validator interface {
 	// Address returns address
 	Address() common.Address
 
+	// Weight returns the voting power of the validator
+	Weight() uint64
+
 	// String representation of Validator
 	String() string
 }
@@ -50,7 +53,7 @@ func (slice Validators) Swap(i, j int) {
 
 type ValidatorSet interface {
 	// Calculate the proposer
-	CalcProposer(lastProposer common.Address, round uint64)
+	CalcProposer(lastProposer common.Address, sequence uint64, round uint64)
 	// Return the validator size
 	Size() int
 	// Return the validator array
@@ -67,14 +70,20 @@ type ValidatorSet interface {
 	AddValidator(address common.Address) bool
 	// Remove validator
 	RemoveValidator(address common.Address) bool
+	// Set the voting power of an existing validator
+	SetWeight(address common.Address, weight uint64) bool
+	// Return the sum of the voting power of all validators
+	TotalWeight() uint64
 	// Copy validator set
 	Copy() ValidatorSet
-	// Get the maximum number of faulty nodes
+	// Get the maximum voting power of faulty nodes
 	F() int
+	// Get the voting power needed for a two-thirds quorum
+	QuorumSize() int
 	// Get proposer policy
 	Policy() ProposerPolicy
 }
 
 // ----------------------------------------------------------------------------
 
-type ProposalSelector func(ValidatorSet, common.Address, uint64) Validator
+type ProposalSelector func(valSet ValidatorSet, lastProposer common.Address, sequence uint64, round uint64) Validator
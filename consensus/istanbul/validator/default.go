@@ -28,12 +28,17 @@ import (
 
 type defaultValidator struct {
 	address common.Address
+	weight  uint64
 }
 
 func (val *defaultValidator) Address() common.Address {
 	return val.address
 }
 
+func (val *defaultValidator) Weight() uint64 {
+	return val.weight
+}
+
 func (val *defaultValidator) String() string {
 	return val.Address().String()
 }
@@ -50,13 +55,23 @@ type defaultSet struct {
 }
 
 func newDefaultSet(addrs []common.Address, policy istanbul.ProposerPolicy) *defaultSet {
+	return newWeightedSet(addrs, nil, policy)
+}
+
+// newWeightedSet creates a validator set where every validator carries the voting
+// power at the same index of weights. Missing or zero weights default to 1.
+func newWeightedSet(addrs []common.Address, weights []uint64, policy istanbul.ProposerPolicy) *defaultSet {
 	valSet := &defaultSet{}
 
 	valSet.policy = policy
 	// init validators
 	valSet.validators = make([]istanbul.Validator, len(addrs))
 	for i, addr := range addrs {
-		valSet.validators[i] = New(addr)
+		weight := uint64(1)
+		if i < len(weights) && weights[i] > 0 {
+			weight = weights[i]
+		}
+		valSet.validators[i] = NewWeighted(addr, weight)
 	}
 	// sort validator
 	sort.Sort(valSet.validators)
@@ -64,9 +79,13 @@ func newDefaultSet(addrs []common.Address, policy istanbul.ProposerPolicy) *defa
 	if valSet.Size() > 0 {
 		valSet.proposer = valSet.GetByIndex(0)
 	}
-	valSet.selector = roundRobinProposer
-	if policy == istanbul.Sticky {
+	switch policy {
+	case istanbul.Sticky:
 		valSet.selector = stickyProposer
+	case istanbul.WeightedRoundRobin:
+		valSet.selector = weightedRoundRobinProposer
+	default:
+		valSet.selector = roundRobinProposer
 	}
 
 	return valSet
@@ -111,10 +130,10 @@ func (valSet *defaultSet) IsProposer(address common.Address) bool {
 	return reflect.DeepEqual(valSet.GetProposer(), val)
 }
 
-func (valSet *defaultSet) CalcProposer(lastProposer common.Address, round uint64) {
+func (valSet *defaultSet) CalcProposer(lastProposer common.Address, sequence uint64, round uint64) {
 	valSet.validatorMu.RLock()
 	defer valSet.validatorMu.RUnlock()
-	valSet.proposer = valSet.selector(valSet, lastProposer, round)
+	valSet.proposer = valSet.selector(valSet, lastProposer, sequence, round)
 }
 
 func calcSeed(valSet istanbul.ValidatorSet, proposer common.Address, round uint64) uint64 {
@@ -129,7 +148,7 @@ func emptyAddress(addr common.Address) bool {
 	return addr == common.Address{}
 }
 
-func roundRobinProposer(valSet istanbul.ValidatorSet, proposer common.Address, round uint64) istanbul.Validator {
+func roundRobinProposer(valSet istanbul.ValidatorSet, proposer common.Address, sequence uint64, round uint64) istanbul.Validator {
 	if valSet.Size() == 0 {
 		return nil
 	}
@@ -143,7 +162,7 @@ func roundRobinProposer(valSet istanbul.ValidatorSet, proposer common.Address, r
 	return valSet.GetByIndex(pick)
 }
 
-func stickyProposer(valSet istanbul.ValidatorSet, proposer common.Address, round uint64) istanbul.Validator {
+func stickyProposer(valSet istanbul.ValidatorSet, proposer common.Address, sequence uint64, round uint64) istanbul.Validator {
 	if valSet.Size() == 0 {
 		return nil
 	}
@@ -157,6 +176,25 @@ func stickyProposer(valSet istanbul.ValidatorSet, proposer common.Address, round
 	return valSet.GetByIndex(pick)
 }
 
+// weightedRoundRobinProposer lays the validators out on a ring where every one of
+// them owns as many consecutive slots as its weight, and walks the ring by block
+// height and round. The last proposer is irrelevant as the height alone determines
+// how far a validator with multiple slots has progressed.
+func weightedRoundRobinProposer(valSet istanbul.ValidatorSet, proposer common.Address, sequence uint64, round uint64) istanbul.Validator {
+	total := valSet.TotalWeight()
+	if total == 0 {
+		return nil
+	}
+	slot := (sequence + round) % total
+	for _, val := range valSet.List() {
+		if slot < val.Weight() {
+			return val
+		}
+		slot -= val.Weight()
+	}
+	return nil
+}
+
 func (valSet *defaultSet) AddValidator(address common.Address) bool {
 	valSet.validatorMu.Lock()
 	defer valSet.validatorMu.Unlock()
@@ -185,17 +223,53 @@ func (valSet *defaultSet) RemoveValidator(address common.Address) bool {
 	return false
 }
 
+func (valSet *defaultSet) SetWeight(address common.Address, weight uint64) bool {
+	valSet.validatorMu.Lock()
+	defer valSet.validatorMu.Unlock()
+
+	if weight == 0 {
+		return false
+	}
+	for i, v := range valSet.validators {
+		if v.Address() == address {
+			valSet.validators[i] = NewWeighted(address, weight)
+			if valSet.proposer != nil && valSet.proposer.Address() == address {
+				valSet.proposer = valSet.validators[i]
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (valSet *defaultSet) TotalWeight() uint64 {
+	valSet.validatorMu.RLock()
+	defer valSet.validatorMu.RUnlock()
+
+	total := uint64(0)
+	for _, v := range valSet.validators {
+		total += v.Weight()
+	}
+	return total
+}
+
 func (valSet *defaultSet) Copy() istanbul.ValidatorSet {
 	valSet.validatorMu.RLock()
 	defer valSet.validatorMu.RUnlock()
 
 	addresses := make([]common.Address, 0, len(valSet.validators))
+	weights := make([]uint64, 0, len(valSet.validators))
 	for _, v := range valSet.validators {
 		addresses = append(addresses, v.Address())
+		weights = append(weights, v.Weight())
 	}
-	return NewSet(addresses, valSet.policy)
+	return NewWeightedSet(addresses, weights, valSet.policy)
 }
 
-func (valSet *defaultSet) F() int { return int(math.Ceil(float64(valSet.Size())/3)) - 1 }
+func (valSet *defaultSet) F() int { return int(math.Ceil(float64(valSet.TotalWeight())/3)) - 1 }
+
+func (valSet *defaultSet) QuorumSize() int {
+	return int(math.Ceil(float64(2*valSet.TotalWeight()) / 3))
+}
 
 func (valSet *defaultSet) Policy() istanbul.ProposerPolicy { return valSet.policy }
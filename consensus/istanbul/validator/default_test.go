@@ -37,6 +37,8 @@ func TestValidatorSet(t *testing.T) {
 	testEmptyValSet(t)
 	testStickyProposer(t)
 	testAddAndRemoveValidator(t)
+	testWeightedValSet(t)
+	testWeightedRoundRobinProposer(t)
 }
 
 func testNewValidatorSet(t *testing.T) {
@@ -111,17 +113,17 @@ func testNormalValSet(t *testing.T) {
 	}
 	// test calculate proposer
 	lastProposer := addr1
-	valSet.CalcProposer(lastProposer, uint64(0))
+	valSet.CalcProposer(lastProposer, 0, uint64(0))
 	if val := valSet.GetProposer(); !reflect.DeepEqual(val, val2) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val2)
 	}
-	valSet.CalcProposer(lastProposer, uint64(3))
+	valSet.CalcProposer(lastProposer, 0, uint64(3))
 	if val := valSet.GetProposer(); !reflect.DeepEqual(val, val1) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val1)
 	}
 	// test empty last proposer
 	lastProposer = common.Address{}
-	valSet.CalcProposer(lastProposer, uint64(3))
+	valSet.CalcProposer(lastProposer, 0, uint64(3))
 	if val := valSet.GetProposer(); !reflect.DeepEqual(val, val2) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val2)
 	}
@@ -149,7 +151,7 @@ func testAddAndRemoveValidator(t *testing.T) {
 	}
 
 	for i, v := range valSet.List() {
-		expected := common.StringToAddress(string(i))
+		expected := common.StringToAddress(string(rune(i)))
 		if v.Address() != expected {
 			t.Errorf("the order of validators is wrong: have %v, want %v", v.Address().Hex(), expected.Hex())
 		}
@@ -190,19 +192,84 @@ func testStickyProposer(t *testing.T) {
 	}
 	// test calculate proposer
 	lastProposer := addr1
-	valSet.CalcProposer(lastProposer, uint64(0))
+	valSet.CalcProposer(lastProposer, 0, uint64(0))
 	if val := valSet.GetProposer(); !reflect.DeepEqual(val, val1) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val1)
 	}
 
-	valSet.CalcProposer(lastProposer, uint64(1))
+	valSet.CalcProposer(lastProposer, 0, uint64(1))
 	if val := valSet.GetProposer(); !reflect.DeepEqual(val, val2) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val2)
 	}
 	// test empty last proposer
 	lastProposer = common.Address{}
-	valSet.CalcProposer(lastProposer, uint64(3))
+	valSet.CalcProposer(lastProposer, 0, uint64(3))
 	if val := valSet.GetProposer(); !reflect.DeepEqual(val, val2) {
 		t.Errorf("proposer mismatch: have %v, want %v", val, val2)
 	}
 }
+
+func testWeightedValSet(t *testing.T) {
+	addr1 := common.HexToAddress(testAddress)
+	addr2 := common.HexToAddress(testAddress2)
+
+	valSet := NewWeightedSet([]common.Address{addr1, addr2}, []uint64{5, 1}, istanbul.RoundRobin)
+	if total := valSet.TotalWeight(); total != 6 {
+		t.Errorf("total weight mismatch: have %v, want 6", total)
+	}
+	// ceil(6/3)-1
+	if f := valSet.F(); f != 1 {
+		t.Errorf("faulty weight mismatch: have %v, want 1", f)
+	}
+	// ceil(2*6/3), more than 2F for weight totals that aren't 3F+1
+	if q := valSet.QuorumSize(); q != 4 {
+		t.Errorf("quorum size mismatch: have %v, want 4", q)
+	}
+	if !valSet.SetWeight(addr2, 4) {
+		t.Error("the weight of an existing validator should be set")
+	}
+	if valSet.SetWeight(common.HexToAddress("0x9535b2e7faaba5288511d89341d94a38063a349b"), 4) {
+		t.Error("the weight of a non-existing validator should not be set")
+	}
+	if valSet.SetWeight(addr2, 0) {
+		t.Error("a zero weight should not be set")
+	}
+	// ceil(9/3)-1
+	if f := valSet.F(); f != 2 {
+		t.Errorf("faulty weight mismatch: have %v, want 2", f)
+	}
+	// ceil(2*9/3)
+	if q := valSet.QuorumSize(); q != 6 {
+		t.Errorf("quorum size mismatch: have %v, want 6", q)
+	}
+	// weights should survive a copy
+	cpy := valSet.Copy()
+	if _, val := cpy.GetByAddress(addr2); val.Weight() != 4 {
+		t.Errorf("copied weight mismatch: have %v, want 4", val.Weight())
+	}
+	// unweighted sets should behave as before
+	if f := NewSet([]common.Address{addr1, addr2}, istanbul.RoundRobin).F(); f != 0 {
+		t.Errorf("faulty weight mismatch: have %v, want 0", f)
+	}
+}
+
+func testWeightedRoundRobinProposer(t *testing.T) {
+	addr1 := common.HexToAddress(testAddress)
+	addr2 := common.HexToAddress(testAddress2)
+
+	valSet := NewWeightedSet([]common.Address{addr1, addr2}, []uint64{2, 1}, istanbul.WeightedRoundRobin)
+
+	// validators own consecutive slots on the ring: [addr1, addr1, addr2]
+	expected := []common.Address{addr1, addr1, addr2, addr1, addr1, addr2}
+	for seq, want := range expected {
+		valSet.CalcProposer(common.Address{}, uint64(seq), 0)
+		if have := valSet.GetProposer().Address(); have != want {
+			t.Errorf("sequence %d: proposer mismatch: have %v, want %v", seq, have.Hex(), want.Hex())
+		}
+	}
+	// round changes move along the ring
+	valSet.CalcProposer(addr1, 0, 2)
+	if have := valSet.GetProposer().Address(); have != addr2 {
+		t.Errorf("proposer mismatch: have %v, want %v", have.Hex(), addr2.Hex())
+	}
+}
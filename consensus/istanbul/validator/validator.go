@@ -22,8 +22,14 @@ import (
 )
 
 func New(addr common.Address) istanbul.Validator {
+	return NewWeighted(addr, 1)
+}
+
+// NewWeighted creates a validator with the given voting power.
+func NewWeighted(addr common.Address, weight uint64) istanbul.Validator {
 	return &defaultValidator{
 		address: addr,
+		weight:  weight,
 	}
 }
 
@@ -31,6 +37,12 @@ func NewSet(addrs []common.Address, policy istanbul.ProposerPolicy) istanbul.Val
 	return newDefaultSet(addrs, policy)
 }
 
+// NewWeightedSet creates a validator set where weights[i] is the voting power of
+// addrs[i]. Validators without a (non-zero) weight get a voting power of 1.
+func NewWeightedSet(addrs []common.Address, weights []uint64, policy istanbul.ProposerPolicy) istanbul.ValidatorSet {
+	return newWeightedSet(addrs, weights, policy)
+}
+
 func ExtractValidators(extraData []byte) []common.Address {
 	// get the validator addresses
 	addrs := make([]common.Address, (len(extraData) / common.AddressLength))
@@ -20,6 +20,7 @@ package consensus
 import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 )
 
 // Constants to match up protocol versions and messages
@@ -52,6 +53,8 @@ type Broadcaster interface {
 	Enqueue(id string, block *types.Block)
 	// FindPeers retrives peers by addresses
 	FindPeers(map[common.Address]bool) map[common.Address]Peer
+	// Peers retrieves all the connected peers by address
+	Peers() map[common.Address]Peer
 }
 
 // Peer defines the interface to communicate with peer
@@ -59,3 +62,14 @@ type Peer interface {
 	// Send sends the message to this peer
 	Send(msgcode uint64, data interface{}) error
 }
+
+// PeerManager defines the interface to maintain connections to specific nodes,
+// as implemented by p2p.Server
+type PeerManager interface {
+	// AddPeer connects to the given node and keeps the connection
+	AddPeer(node *discover.Node)
+	// RemovePeer disconnects from the given node
+	RemovePeer(node *discover.Node)
+	// Resolve looks up the current enode record of the node with the given ID
+	Resolve(id discover.NodeID) *discover.Node
+}
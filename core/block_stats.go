@@ -0,0 +1,119 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// blockStatsLimit is the number of recently imported blocks to keep the import
+// statistics of.
+const blockStatsLimit = 128
+
+var (
+	blockVerifyTimer     = metrics.NewRegisteredTimer("chain/verify", nil)
+	blockSendersTimer    = metrics.NewRegisteredTimer("chain/senders", nil)
+	blockExecutionTimer  = metrics.NewRegisteredTimer("chain/execution", nil)
+	blockValidationTimer = metrics.NewRegisteredTimer("chain/validation", nil)
+	blockCommitTimer     = metrics.NewRegisteredTimer("chain/commit", nil)
+	blockFlushTimer      = metrics.NewRegisteredTimer("chain/flush", nil)
+	blockWriteTimer      = metrics.NewRegisteredTimer("chain/write", nil)
+
+	stateReadTimer = metrics.NewRegisteredTimer("chain/state/reads", nil)
+	stateHashTimer = metrics.NewRegisteredTimer("chain/state/hashes", nil)
+
+	accountReadCounter     = metrics.NewRegisteredCounter("chain/account/reads", nil)
+	accountCacheHitCounter = metrics.NewRegisteredCounter("chain/account/hits", nil)
+	accountWriteCounter    = metrics.NewRegisteredCounter("chain/account/writes", nil)
+	storageReadCounter     = metrics.NewRegisteredCounter("chain/storage/reads", nil)
+	storageCacheHitCounter = metrics.NewRegisteredCounter("chain/storage/hits", nil)
+	storageWriteCounter    = metrics.NewRegisteredCounter("chain/storage/writes", nil)
+)
+
+// BlockStats are the timings of the import phases of a block, along with the state
+// accesses done while processing it. The state timings overlap the phases: reads
+// mostly happen during the execution, hashing during the validation.
+type BlockStats struct {
+	Number  uint64      `json:"number"`
+	Hash    common.Hash `json:"hash"`
+	Txs     int         `json:"txs"`
+	GasUsed uint64      `json:"gasUsed"`
+
+	Verification time.Duration `json:"verification"` // Waiting for the header verification and validating the body
+	Senders      time.Duration `json:"senders"`      // Recovering the senders of the transactions
+	Execution    time.Duration `json:"execution"`    // Executing the transactions and finalizing the block
+	Validation   time.Duration `json:"validation"`   // Validating the resulting state, including the trie hashing
+	Commit       time.Duration `json:"commit"`       // Committing the state tries into the trie database
+	Flush        time.Duration `json:"flush"`        // Flushing and garbage collecting the trie database
+	Write        time.Duration `json:"write"`        // Writing the block and its metadata, including any reorg
+	Total        time.Duration `json:"total"`
+
+	State state.Stats `json:"state"`
+}
+
+// recordBlockStats reports the import statistics of a block through the metrics,
+// keeps them around for the debug APIs and logs them if the block was slow.
+func (bc *BlockChain) recordBlockStats(stats *BlockStats) {
+	blockVerifyTimer.Update(stats.Verification)
+	blockSendersTimer.Update(stats.Senders)
+	blockExecutionTimer.Update(stats.Execution)
+	blockValidationTimer.Update(stats.Validation)
+	blockCommitTimer.Update(stats.Commit)
+	blockFlushTimer.Update(stats.Flush)
+	blockWriteTimer.Update(stats.Write)
+
+	stateReadTimer.Update(stats.State.AccountReadTime + stats.State.StorageReadTime)
+	stateHashTimer.Update(stats.State.HashTime)
+
+	accountReadCounter.Inc(int64(stats.State.AccountReads))
+	accountCacheHitCounter.Inc(int64(stats.State.AccountCacheHits))
+	accountWriteCounter.Inc(int64(stats.State.AccountWrites))
+	storageReadCounter.Inc(int64(stats.State.StorageReads))
+	storageCacheHitCounter.Inc(int64(stats.State.StorageCacheHits))
+	storageWriteCounter.Inc(int64(stats.State.StorageWrites))
+
+	bc.blockStats.Add(stats.Hash, stats)
+
+	if threshold := bc.cacheConfig.SlowBlockThreshold; threshold > 0 && stats.Total >= threshold {
+		log.Warn("Slow block import", "number", stats.Number, "hash", stats.Hash, "txs", stats.Txs, "gas", stats.GasUsed,
+			"elapsed", common.PrettyDuration(stats.Total), "verify", common.PrettyDuration(stats.Verification),
+			"senders", common.PrettyDuration(stats.Senders), "exec", common.PrettyDuration(stats.Execution),
+			"validate", common.PrettyDuration(stats.Validation), "commit", common.PrettyDuration(stats.Commit),
+			"flush", common.PrettyDuration(stats.Flush), "write", common.PrettyDuration(stats.Write),
+			"accreads", stats.State.AccountReads, "acchits", stats.State.AccountCacheHits, "accwrites", stats.State.AccountWrites,
+			"slotreads", stats.State.StorageReads, "slothits", stats.State.StorageCacheHits, "slotwrites", stats.State.StorageWrites,
+			"readtime", common.PrettyDuration(stats.State.AccountReadTime+stats.State.StorageReadTime),
+			"hashtime", common.PrettyDuration(stats.State.HashTime))
+	}
+}
+
+// BlockStats returns the import statistics of the recently processed blocks, in
+// the order of their import.
+func (bc *BlockChain) BlockStats() []*BlockStats {
+	stats := make([]*BlockStats, 0, bc.blockStats.Len())
+	for _, hash := range bc.blockStats.Keys() {
+		if st, exist := bc.blockStats.Peek(hash); exist {
+			stats = append(stats, st.(*BlockStats))
+		}
+	}
+	return stats
+}
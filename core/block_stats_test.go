@@ -0,0 +1,80 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the import statistics of the processed blocks are gathered.
+func TestBlockStats(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	gendb, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 4, func(i int, block *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		block.AddTx(tx)
+	})
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	stats := chain.BlockStats()
+	if len(stats) != len(blocks) {
+		t.Fatalf("block stats count mismatch: have %d, want %d", len(stats), len(blocks))
+	}
+	for i, st := range stats {
+		block := blocks[i]
+		if st.Number != block.NumberU64() || st.Hash != block.Hash() || st.Txs != 1 || st.GasUsed != block.GasUsed() {
+			t.Errorf("block #%d: stats mismatch: have #%d [%x…], %d txs, %d gas", block.NumberU64(), st.Number, st.Hash[:4], st.Txs, st.GasUsed)
+		}
+		if st.Execution == 0 || st.Validation == 0 || st.Commit == 0 {
+			t.Errorf("block #%d: phases not timed: %+v", block.NumberU64(), st)
+		}
+		if phases := st.Verification + st.Senders + st.Execution + st.Validation + st.Commit + st.Flush + st.Write; phases > st.Total {
+			t.Errorf("block #%d: phases exceed total: %v > %v", block.NumberU64(), phases, st.Total)
+		}
+		if st.State.AccountReads == 0 || st.State.AccountWrites == 0 {
+			t.Errorf("block #%d: state accesses not counted: %+v", block.NumberU64(), st.State)
+		}
+	}
+}
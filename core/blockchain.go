@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -69,6 +70,12 @@ type CacheConfig struct {
 	Disabled      bool          // Whether to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+
+	AncientThreshold uint64 // Number of recent blocks kept in the key-value store if backed by an ancient store
+	Snapshot         bool   // Whether to maintain a flat snapshot of the recent states for faster reads
+	TxLookupLimit    uint64 // Number of recent blocks to index the transactions of (0 = all blocks)
+
+	SlowBlockThreshold time.Duration // Import time above which to log the statistics of a block (0 = disabled)
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -111,6 +118,7 @@ type BlockChain struct {
 	currentFastBlock atomic.Value // Current head of the fast-sync chain (may be above the block chain!)
 
 	stateCache   state.Database // State database to reuse between imports (contains state cache)
+	snaps        *snapshot.Tree // Flat snapshot of the recent states (nil if disabled)
 	bodyCache    *lru.Cache     // Cache for the most recent block bodies
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
@@ -127,7 +135,8 @@ type BlockChain struct {
 	validator Validator // block and state validator interface
 	vmConfig  vm.Config
 
-	badBlocks *lru.Cache // Bad block cache
+	badBlocks  *lru.Cache // Bad block cache
+	blockStats *lru.Cache // Import statistics of the recently processed blocks
 }
 
 // NewBlockChain returns a fully initialised block chain using information
@@ -145,6 +154,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 	badBlocks, _ := lru.New(badBlockLimit)
+	blockStats, _ := lru.New(blockStatsLimit)
 
 	bc := &BlockChain{
 		chainConfig:  chainConfig,
@@ -160,6 +170,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		engine:       engine,
 		vmConfig:     vmConfig,
 		badBlocks:    badBlocks,
+		blockStats:   blockStats,
 	}
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
 	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine))
@@ -189,8 +200,29 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			}
 		}
 	}
+	// Open the flat state snapshot, regenerating it if stale
+	if cacheConfig.Snapshot {
+		if ldb, ok := ethdb.KeyValueStore(db).(*ethdb.LDBDatabase); ok {
+			bc.snaps = snapshot.New(ldb, bc.stateCache.TrieDB(), bc.CurrentBlock().Root())
+		} else {
+			log.Warn("State snapshot requires a persistent database, disabling")
+		}
+	}
 	// Take ownership of this particular state
 	go bc.update()
+
+	// Follow the chain head with the transaction index if limited, or if it was
+	// limited before and needs to be completed
+	if cacheConfig.TxLookupLimit > 0 || GetTxIndexTail(db) != nil {
+		bc.wg.Add(1)
+		go bc.maintainTxIndex()
+	}
+
+	// Move the immutable blocks out of the key-value store if supported
+	if _, ok := db.(ethdb.AncientStore); ok {
+		bc.wg.Add(1)
+		go bc.freeze()
+	}
 	return bc, nil
 }
 
@@ -274,6 +306,13 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	bc.hc.SetHead(head, delFn)
 	currentHeader := bc.hc.CurrentHeader()
 
+	// Discard the rewound blocks moved to the ancient store
+	if ancients, ok := bc.db.(ethdb.AncientStore); ok {
+		if err := ancients.TruncateAncients(head + 1); err != nil {
+			log.Crit("Failed to truncate ancient store", "err", err)
+		}
+	}
+
 	// Clear out any stale content from the caches
 	bc.bodyCache.Purge()
 	bc.bodyRLPCache.Purge()
@@ -309,7 +348,14 @@ func (bc *BlockChain) SetHead(head uint64) error {
 	if err := WriteHeadFastBlockHash(bc.db, currentFastBlock.Hash()); err != nil {
 		log.Crit("Failed to reset head fast block", "err", err)
 	}
-	return bc.loadLastState()
+	if err := bc.loadLastState(); err != nil {
+		return err
+	}
+	// Regenerate the state snapshot if rewound past its layers
+	if bc.snaps != nil && bc.snaps.Snapshot(bc.CurrentBlock().Root()) == nil {
+		bc.snaps.Rebuild(bc.CurrentBlock().Root())
+	}
+	return nil
 }
 
 // FastSyncCommitHead sets the current head block to the one defined by the hash
@@ -384,7 +430,7 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
-	return state.New(root, bc.stateCache)
+	return state.NewWithSnapshot(root, bc.stateCache, bc.snaps)
 }
 
 // Reset purges the entire blockchain, restoring it to its genesis state.
@@ -539,6 +585,9 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	if bc.blockCache.Contains(hash) {
 		return true
 	}
+	if isAncient(bc.db, hash, number) {
+		return true
+	}
 	ok, _ := bc.db.Has(blockBodyKey(hash, number))
 	return ok
 }
@@ -642,6 +691,13 @@ func (bc *BlockChain) Stop() {
 
 	bc.wg.Wait()
 
+	// Flatten the state snapshot into the head state, which is persisted below
+	if bc.snaps != nil {
+		if err := bc.snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to flatten state snapshot", "err", err)
+		}
+		bc.snaps.Release()
+	}
 	// Ensure the state of a recent block is also stored to disk before exiting.
 	// We're writing three different states to catch different restart scenarios:
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
@@ -872,9 +928,17 @@ func (bc *BlockChain) WriteBlockWithoutState(block *types.Block, td *big.Int) (e
 
 // WriteBlockWithState writes the block and all associated state to the database.
 func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) (status WriteStatus, err error) {
+	return bc.writeBlockWithState(block, receipts, state, new(BlockStats))
+}
+
+// writeBlockWithState writes the block and all associated state to the database,
+// measuring the time spent on each phase into the block statistics.
+func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, state *state.StateDB, stats *BlockStats) (status WriteStatus, err error) {
 	bc.wg.Add(1)
 	defer bc.wg.Done()
 
+	defer func(start time.Time) { stats.Write = time.Since(start) - stats.Commit - stats.Flush }(time.Now())
+
 	// Calculate the total difficulty of the block
 	ptd := bc.GetTd(block.ParentHash(), block.NumberU64()-1)
 	if ptd == nil {
@@ -897,10 +961,20 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	if err := WriteBlock(batch, block); err != nil {
 		return NonStatTy, err
 	}
+	start := time.Now()
 	root, err := state.Commit(bc.chainConfig.IsEIP158(block.Number()))
 	if err != nil {
 		return NonStatTy, err
 	}
+	// Flatten the old state snapshot layers before their tries get collected
+	if bc.snaps != nil && bc.snaps.Snapshot(root) != nil {
+		if err := bc.snaps.Cap(root, triesInMemory-1); err != nil {
+			log.Warn("Failed to cap state snapshot", "root", root, "err", err)
+		}
+	}
+	stats.Commit = time.Since(start)
+
+	start = time.Now()
 	triedb := bc.stateCache.TrieDB()
 
 	// If we're running an archive node, always flush
@@ -953,6 +1027,8 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 			}
 		}
 	}
+	stats.Flush = time.Since(start)
+
 	if err := WriteBlockReceipts(batch, block.Hash(), block.NumberU64(), receipts); err != nil {
 		return NonStatTy, err
 	}
@@ -980,6 +1056,10 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 		if err := WritePreimages(bc.db, block.NumberU64(), state.Preimages()); err != nil {
 			return NonStatTy, err
 		}
+		// Regenerate the state snapshot if the new head isn't built on it
+		if bc.snaps != nil && bc.snaps.Snapshot(root) == nil {
+			bc.snaps.Rebuild(root)
+		}
 		status = CanonStatTy
 	} else {
 		status = SideStatTy
@@ -1069,6 +1149,12 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		if err == nil {
 			err = bc.Validator().ValidateBody(block)
 		}
+		bstats := &BlockStats{
+			Number:       block.NumberU64(),
+			Hash:         block.Hash(),
+			Txs:          len(block.Transactions()),
+			Verification: time.Since(bstart),
+		}
 		switch {
 		case err == ErrKnownBlock:
 			// Block and state both already known. However if the current block is below
@@ -1139,29 +1225,45 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 		} else {
 			parent = chain[i-1]
 		}
-		state, err := state.New(parent.Root(), bc.stateCache)
+		state, err := state.NewWithSnapshot(parent.Root(), bc.stateCache, bc.snaps)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		// Recover the transaction senders up front, they are cached for the processing
+		start := time.Now()
+		signer := types.MakeSigner(bc.chainConfig, block.Number())
+		for _, tx := range block.Transactions() {
+			types.Sender(signer, tx)
+		}
+		bstats.Senders = time.Since(start)
+
 		// Process block using the parent state as reference point.
+		start = time.Now()
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
 		}
+		bstats.Execution = time.Since(start)
+
 		// Validate the state using the default validator
+		start = time.Now()
 		err = bc.Validator().ValidateState(block, parent, state, receipts, usedGas)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
 		}
+		bstats.Validation = time.Since(start)
 		proctime := time.Since(bstart)
 
 		// Write the block to the chain and get the status.
-		status, err := bc.WriteBlockWithState(block, receipts, state)
+		status, err := bc.writeBlockWithState(block, receipts, state, bstats)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
+		bstats.GasUsed, bstats.Total, bstats.State = usedGas, time.Since(bstart), state.Stats()
+		bc.recordBlockStats(bstats)
+
 		switch status {
 		case CanonStatTy:
 			log.Debug("Inserted new block", "number", block.Number(), "hash", block.Hash(), "uncles", len(block.Uncles()),
@@ -1326,9 +1428,12 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	for i := len(newChain) - 1; i >= 0; i-- {
 		// insert the block in the canonical way, re-writing history
 		bc.insert(newChain[i])
-		// write lookup entries for hash based transaction/receipt searches
-		if err := WriteTxLookupEntries(bc.db, newChain[i]); err != nil {
-			return err
+		// write lookup entries for hash based transaction/receipt searches, unless
+		// the block is older than the indexed ones
+		if tail := GetTxIndexTail(bc.db); tail == nil || newChain[i].NumberU64() >= *tail {
+			if err := WriteTxLookupEntries(bc.db, newChain[i]); err != nil {
+				return err
+			}
 		}
 		addedTxs = append(addedTxs, newChain[i].Transactions()...)
 	}
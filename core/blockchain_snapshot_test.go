@@ -0,0 +1,132 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the states read through the snapshot match the ones in the tries,
+// across chain imports, reorgs and restarts.
+func TestBlockChainSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address  = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address:  {Balance: big.NewInt(1000000000)},
+				contract: {Code: []byte{0x34, 0x80, 0x55}, Balance: big.NewInt(0)}, // CALLVALUE DUP1 SSTORE
+			},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	// Generate a chain storing into the contract, and a longer fork of it
+	gen := func(seed byte) func(i int, block *BlockGen) {
+		return func(i int, block *BlockGen) {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{seed, byte(i)}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+			block.AddTx(tx)
+			tx, _ = types.SignTx(types.NewTransaction(block.TxNonce(address), contract, big.NewInt(int64(seed)+int64(i)), 100000, nil, nil), signer, key)
+			block.AddTx(tx)
+		}
+	}
+	gendb, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 20, gen(1))
+	forks, _ := GenerateChain(gspec.Config, blocks[9], ethash.NewFaker(), gendb, 15, gen(2))
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	gspec.MustCommit(db)
+
+	config := &CacheConfig{Disabled: true, Snapshot: true}
+	chain, err := NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	check := func(chain *BlockChain, block *types.Block) {
+		if chain.snaps.Snapshot(block.Root()) == nil {
+			t.Fatalf("block #%d: snapshot missing", block.NumberU64())
+		}
+		snapdb, _ := chain.StateAt(block.Root())
+		triedb, _ := state.New(block.Root(), state.NewDatabase(db))
+
+		addrs := []common.Address{address, contract}
+		for i := 0; i < 20; i++ {
+			addrs = append(addrs, common.Address{1, byte(i)}, common.Address{2, byte(i)})
+		}
+		for _, addr := range addrs {
+			if have, want := snapdb.GetBalance(addr), triedb.GetBalance(addr); have.Cmp(want) != 0 {
+				t.Errorf("block #%d: balance mismatch for %x: have %v, want %v", block.NumberU64(), addr, have, want)
+			}
+			if have, want := snapdb.Exist(addr), triedb.Exist(addr); have != want {
+				t.Errorf("block #%d: existence mismatch for %x: have %v, want %v", block.NumberU64(), addr, have, want)
+			}
+		}
+		for i := 0; i < 40; i++ {
+			slot := common.BigToHash(big.NewInt(int64(i)))
+			if have, want := snapdb.GetState(contract, slot), triedb.GetState(contract, slot); have != want {
+				t.Errorf("block #%d: slot %d mismatch: have %x, want %x", block.NumberU64(), i, have, want)
+			}
+		}
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	check(chain, blocks[len(blocks)-1])
+	check(chain, blocks[5])
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	check(chain, forks[len(forks)-1])
+	chain.Stop()
+
+	// Reopen the chain, the snapshot must be flattened into the head state
+	chain, err = NewBlockChain(db, config, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	defer chain.Stop()
+
+	check(chain, forks[len(forks)-1])
+	if chain.snaps.Snapshot(forks[len(forks)-2].Root()) != nil {
+		t.Errorf("snapshot layers not flattened on stop")
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// DefaultAncientThreshold is the default number of recent blocks kept in the
+	// key-value store before being moved to the ancient store.
+	DefaultAncientThreshold = 90000
+
+	// freezerBatchLimit is the maximum number of blocks moved to the ancient
+	// store in one go.
+	freezerBatchLimit = 30000
+
+	// freezerChunkSize is the number of blocks moved to the ancient store while
+	// holding the chain lock, before releasing it for the importer.
+	freezerChunkSize = 1000
+)
+
+// freezerRecheckInterval is the frequency of checking whether blocks got old
+// enough to be moved to the ancient store.
+var freezerRecheckInterval = time.Minute
+
+// NewDatabaseWithAncients wraps a chain database with an ancient store located in
+// the given directory, into which the blocks past the ancient threshold are moved.
+// If compress is set, the headers, bodies and receipts of new ancient stores are
+// snappy compressed.
+func NewDatabaseWithAncients(db ethdb.Database, dir string, compress bool) (ethdb.Database, error) {
+	freezer, err := ethdb.NewFreezer(dir, map[string]bool{
+		ancientHashTable:    false,
+		ancientHeaderTable:  compress,
+		ancientBodyTable:    compress,
+		ancientReceiptTable: compress,
+		ancientTdTable:      false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ethdb.NewDatabaseWithFreezer(db, freezer), nil
+}
+
+// freeze periodically moves the canonical blocks past the ancient threshold from
+// the key-value store into the ancient store.
+func (bc *BlockChain) freeze() {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(freezerRecheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := bc.freezeBlocks(); err != nil {
+				log.Error("Failed to move blocks to the ancient store", "err", err)
+			}
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// freezeBlocks moves a batch of canonical blocks past the ancient threshold into
+// the ancient store, deleting them from the key-value store. It returns the number
+// of blocks moved.
+//
+// The blocks are moved in chunks, releasing the chain lock in between so imports
+// aren't stalled for the whole batch. Side chain blocks at the frozen heights
+// aren't moved, and stay in the key-value store.
+func (bc *BlockChain) freezeBlocks() (int, error) {
+	if _, ok := bc.db.(ethdb.AncientStore); !ok {
+		return 0, nil
+	}
+	var (
+		start = time.Now()
+		moved int
+		last  common.Hash
+		head  uint64
+	)
+	for moved < freezerBatchLimit {
+		select {
+		case <-bc.quit:
+			return moved, nil
+		default:
+		}
+		limit := freezerBatchLimit - moved
+		if limit > freezerChunkSize {
+			limit = freezerChunkSize
+		}
+		first, hashes, err := bc.freezeChunk(limit)
+		moved += len(hashes)
+		if err != nil {
+			return moved, err
+		}
+		if len(hashes) == 0 {
+			break
+		}
+		head, last = first+uint64(len(hashes))-1, hashes[len(hashes)-1]
+	}
+	if moved > 0 {
+		log.Info("Moved blocks to the ancient store", "blocks", moved, "number", head, "hash", last, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return moved, nil
+}
+
+// freezeChunk moves at most limit canonical blocks past the ancient threshold into
+// the ancient store, holding the chain lock to prevent the chain from being rewound
+// meanwhile. It returns the number of the first block and the hashes of the blocks
+// moved.
+func (bc *BlockChain) freezeChunk(limit int) (uint64, []common.Hash, error) {
+	ancients := bc.db.(ethdb.AncientStore)
+
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	threshold := bc.cacheConfig.AncientThreshold
+	if threshold == 0 {
+		threshold = DefaultAncientThreshold
+	}
+	head := bc.CurrentBlock().NumberU64()
+	if head <= threshold {
+		return 0, nil, nil
+	}
+	frozen, err := ancients.Ancients()
+	if err != nil {
+		return 0, nil, err
+	}
+	last := head - threshold
+	if frozen > last {
+		return frozen, nil, nil
+	}
+	if last-frozen >= uint64(limit) {
+		last = frozen + uint64(limit) - 1
+	}
+	var hashes []common.Hash
+	for number := frozen; number <= last; number++ {
+		hash := GetCanonicalHash(bc.db, number)
+		if hash == (common.Hash{}) {
+			return frozen, hashes, fmt.Errorf("canonical hash #%d missing", number)
+		}
+		items, err := bc.ancientItems(hash, number)
+		if err != nil {
+			return frozen, hashes, err
+		}
+		if err := ancients.AppendAncient(number, items); err != nil {
+			return frozen, hashes, err
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := ancients.Sync(); err != nil {
+		return frozen, nil, err
+	}
+	// Wipe the moved blocks from the key-value store, keeping the genesis for the
+	// database setup checks, and the hash to number mappings for the lookups
+	for i, hash := range hashes {
+		if number := frozen + uint64(i); number > 0 {
+			bc.db.Delete(headerKey(hash, number))
+			DeleteBody(bc.db, hash, number)
+			DeleteBlockReceipts(bc.db, hash, number)
+			DeleteTd(bc.db, hash, number)
+			DeleteCanonicalHash(bc.db, number)
+		}
+	}
+	return frozen, hashes, nil
+}
+
+// ancientItems collects the data of a canonical block to append to the ancient
+// store. A missing total difficulty is recomputed from the parent's, and missing
+// receipts are stored as an empty list, so that a single damaged block doesn't
+// stop the freezer forever. The header and body can't be recovered locally.
+func (bc *BlockChain) ancientItems(hash common.Hash, number uint64) (map[string][]byte, error) {
+	items := map[string][]byte{
+		ancientHashTable: hash.Bytes(),
+	}
+	for kind, key := range map[string][]byte{
+		ancientHeaderTable: headerKey(hash, number),
+		ancientBodyTable:   blockBodyKey(hash, number),
+	} {
+		data, err := bc.db.Get(key)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("block #%d [%x…] %s missing", number, hash[:4], kind)
+		}
+		items[kind] = data
+	}
+	receipts, _ := bc.db.Get(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash[:]...))
+	if len(receipts) == 0 {
+		log.Warn("Freezing block without receipts", "number", number, "hash", hash)
+		receipts, _ = rlp.EncodeToBytes([]*types.ReceiptForStorage{})
+	}
+	items[ancientReceiptTable] = receipts
+
+	td, _ := bc.db.Get(append(headerKey(hash, number), tdSuffix...))
+	if len(td) == 0 {
+		header := GetHeader(bc.db, hash, number)
+		if header == nil || number == 0 {
+			return nil, fmt.Errorf("block #%d [%x…] %s missing", number, hash[:4], ancientTdTable)
+		}
+		ptd := GetTd(bc.db, header.ParentHash, number-1)
+		if ptd == nil {
+			return nil, fmt.Errorf("block #%d [%x…] %s missing", number-1, header.ParentHash[:4], ancientTdTable)
+		}
+		log.Warn("Repairing missing total difficulty", "number", number, "hash", hash)
+		enc, err := rlp.EncodeToBytes(new(big.Int).Add(ptd, header.Difficulty))
+		if err != nil {
+			return nil, err
+		}
+		td = enc
+	}
+	items[ancientTdTable] = td
+	return items, nil
+}
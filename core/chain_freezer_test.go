@@ -0,0 +1,179 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that the blocks past the ancient threshold are moved into the ancient
+// store, and transparently read from there.
+func TestBlockChainFreezer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ancient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	gendb, _ := ethdb.NewMemDatabase()
+	blocks, receipts := GenerateChain(gspec.Config, gspec.MustCommit(gendb), ethash.NewFaker(), gendb, 20, func(i int, block *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		block.AddTx(tx)
+	})
+	kvdb, _ := ethdb.NewMemDatabase()
+	db, err := NewDatabaseWithAncients(kvdb, dir, true)
+	if err != nil {
+		t.Fatalf("failed to open ancient store: %v", err)
+	}
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, &CacheConfig{Disabled: true, AncientThreshold: 5}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if n, err := chain.freezeBlocks(); n != 16 || err != nil {
+		t.Fatalf("frozen block count mismatch: have %d (%v), want %d", n, err, 16)
+	}
+	if n, err := chain.freezeBlocks(); n != 0 || err != nil {
+		t.Fatalf("frozen block count mismatch: have %d (%v), want %d", n, err, 0)
+	}
+	// The moved blocks are no longer in the key-value store, but still readable
+	chain.blockCache.Purge()
+	for i, block := range blocks {
+		number, hash := block.NumberU64(), block.Hash()
+		if has, _ := kvdb.Has(headerKey(hash, number)); has != (number > 15) {
+			t.Errorf("block #%d: key-value header presence mismatch: have %v, want %v", number, has, number > 15)
+		}
+		if have := chain.GetBlockByNumber(number); have == nil || have.Hash() != hash {
+			t.Errorf("block #%d: canonical block mismatch: have %v, want %x", number, have, hash)
+		}
+		if !chain.HasBlock(hash, number) || !chain.HasHeader(hash, number) {
+			t.Errorf("block #%d: block not found", number)
+		}
+		if td := chain.GetTd(hash, number); td == nil || td.Cmp(chain.GetTd(block.ParentHash(), number-1)) <= 0 {
+			t.Errorf("block #%d: invalid total difficulty %v", number, td)
+		}
+		have, _ := rlp.EncodeToBytes(chain.GetReceiptsByHash(hash))
+		want, _ := rlp.EncodeToBytes(receipts[i])
+		if !bytes.Equal(have, want) {
+			t.Errorf("block #%d: receipts mismatch", number)
+		}
+	}
+	if has, _ := kvdb.Has(headerKey(chain.Genesis().Hash(), 0)); !has {
+		t.Errorf("genesis header deleted from the key-value store")
+	}
+	// Exports span both stores
+	buf := new(bytes.Buffer)
+	if err := chain.ExportN(buf, 0, 20); err != nil {
+		t.Fatalf("failed to export chain: %v", err)
+	}
+	stream := rlp.NewStream(buf, 0)
+	for i := 0; i <= 20; i++ {
+		block := new(types.Block)
+		if err := stream.Decode(block); err != nil {
+			t.Fatalf("failed to decode exported block %d: %v", i, err)
+		}
+		if block.Hash() != GetCanonicalHash(db, uint64(i)) {
+			t.Errorf("exported block %d mismatch", i)
+		}
+	}
+	// Rewinding the chain discards the ancient blocks above the new head
+	if err := chain.SetHead(10); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if frozen, _ := db.(ethdb.AncientStore).Ancients(); frozen != 11 {
+		t.Errorf("ancient count mismatch: have %d, want %d", frozen, 11)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != blocks[9].Hash() {
+		t.Errorf("head mismatch: have #%d, want #%d", head.NumberU64(), blocks[9].NumberU64())
+	}
+	if block := chain.GetBlockByNumber(11); block != nil {
+		t.Errorf("rewound block #11 still present")
+	}
+}
+
+// Tests that blocks missing their total difficulty or receipts in the key-value
+// store are still moved into the ancient store, instead of stalling the freezer.
+func TestBlockChainFreezerRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ancient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gspec := &Genesis{Config: params.TestChainConfig}
+	gendb, _ := ethdb.NewMemDatabase()
+	blocks, _ := GenerateChain(gspec.Config, gspec.MustCommit(gendb), ethash.NewFaker(), gendb, 10, nil)
+
+	kvdb, _ := ethdb.NewMemDatabase()
+	db, err := NewDatabaseWithAncients(kvdb, dir, false)
+	if err != nil {
+		t.Fatalf("failed to open ancient store: %v", err)
+	}
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, &CacheConfig{Disabled: true, AncientThreshold: 2}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	damaged := blocks[4]
+	want := chain.GetTd(damaged.Hash(), damaged.NumberU64())
+	DeleteTd(kvdb, damaged.Hash(), damaged.NumberU64())
+	DeleteBlockReceipts(kvdb, damaged.Hash(), damaged.NumberU64())
+
+	if n, err := chain.freezeBlocks(); n != 9 || err != nil {
+		t.Fatalf("frozen block count mismatch: have %d (%v), want %d", n, err, 9)
+	}
+	if td := GetTd(db, damaged.Hash(), damaged.NumberU64()); td == nil || td.Cmp(want) != 0 {
+		t.Errorf("repaired total difficulty mismatch: have %v, want %v", td, want)
+	}
+	if receipts := GetBlockReceipts(db, damaged.Hash(), damaged.NumberU64()); receipts == nil || len(receipts) != 0 {
+		t.Errorf("repaired receipts mismatch: have %v, want empty", receipts)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// txIndexBatchLimit is the maximum number of blocks indexed or unindexed in
+	// one go.
+	txIndexBatchLimit = 10000
+
+	// txIndexChunkSize is the number of blocks indexed or unindexed while holding
+	// the chain lock, before releasing it for the importer.
+	txIndexChunkSize = 1000
+)
+
+// txIndexRecheckInterval is the frequency of checking whether the range of blocks
+// with indexed transactions needs to follow the chain head.
+var txIndexRecheckInterval = 10 * time.Second
+
+// maintainTxIndex keeps the transactions of the recent blocks within the lookup
+// limit indexed, unindexing the older ones as the chain head moves, or indexing
+// them back if the limit got raised.
+func (bc *BlockChain) maintainTxIndex() {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(txIndexRecheckInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := bc.indexTransactions()
+		if err != nil {
+			log.Error("Failed to maintain transaction index", "err", err)
+		}
+		// Keep going while there are blocks left, waiting for the head otherwise
+		if n > 0 && err == nil {
+			select {
+			case <-bc.quit:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-bc.quit:
+			return
+		}
+	}
+}
+
+// txIndexTail returns the number of the oldest block whose transactions should be
+// indexed for the current chain head.
+func (bc *BlockChain) txIndexTail() uint64 {
+	head, limit := bc.CurrentBlock().NumberU64(), bc.cacheConfig.TxLookupLimit
+	if limit == 0 || head < limit {
+		return 0
+	}
+	return head - limit + 1
+}
+
+// indexTransactions moves the range of blocks with indexed transactions by a batch
+// towards the one required by the lookup limit, either unindexing the blocks past
+// it or indexing the missing ones. It returns the number of blocks processed.
+//
+// The blocks are processed in chunks, releasing the chain lock in between so
+// imports aren't stalled for the whole batch.
+func (bc *BlockChain) indexTransactions() (int, error) {
+	var (
+		start = time.Now()
+		done  int
+		err   error
+	)
+	for done < txIndexBatchLimit {
+		select {
+		case <-bc.quit:
+			return done, nil
+		default:
+		}
+		limit := txIndexBatchLimit - done
+		if limit > txIndexChunkSize {
+			limit = txIndexChunkSize
+		}
+		var n int
+		if n, err = bc.indexTxChunk(uint64(limit)); n == 0 || err != nil {
+			break
+		}
+		done += n
+	}
+	if done > 0 {
+		var tail uint64
+		if stored := GetTxIndexTail(bc.db); stored != nil {
+			tail = *stored
+		}
+		log.Info("Updated transaction index", "blocks", done, "tail", tail, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return done, err
+}
+
+// indexTxChunk moves the range of blocks with indexed transactions by at most
+// limit blocks, holding the chain lock to prevent the chain from being reorganised
+// meanwhile. It returns the number of blocks processed.
+func (bc *BlockChain) indexTxChunk(limit uint64) (int, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	var tail uint64
+	if stored := GetTxIndexTail(bc.db); stored != nil {
+		tail = *stored
+	}
+	want := bc.txIndexTail()
+
+	switch {
+	case tail < want:
+		// Chain head moved on, drop the transaction lookups of the oldest blocks
+		end := want
+		if end-tail > limit {
+			end = tail + limit
+		}
+		for number := tail; number < end; number++ {
+			hash := GetCanonicalHash(bc.db, number)
+			body := GetBody(bc.db, hash, number)
+			if body == nil {
+				return 0, fmt.Errorf("block #%d [%x…] body missing", number, hash[:4])
+			}
+			for _, tx := range body.Transactions {
+				DeleteTxLookupEntry(bc.db, tx.Hash())
+			}
+		}
+		if err := WriteTxIndexTail(bc.db, end); err != nil {
+			return 0, err
+		}
+		return int(end - tail), nil
+
+	case tail > want:
+		// Lookup limit raised or chain rewound, index the missing blocks backwards
+		first := want
+		if tail-first > limit {
+			first = tail - limit
+		}
+		batch := bc.db.NewBatch()
+		for number := tail - 1; number >= first && number < tail; number-- {
+			hash := GetCanonicalHash(bc.db, number)
+			block := GetBlock(bc.db, hash, number)
+			if block == nil {
+				return 0, fmt.Errorf("block #%d [%x…] missing", number, hash[:4])
+			}
+			if err := WriteTxLookupEntries(batch, block); err != nil {
+				return 0, err
+			}
+			if batch.ValueSize() >= ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					return 0, err
+				}
+				batch.Reset()
+			}
+		}
+		if err := WriteTxIndexTail(batch, first); err != nil {
+			return 0, err
+		}
+		if err := batch.Write(); err != nil {
+			return 0, err
+		}
+		return int(tail - first), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the transaction index follows the chain head within the lookup limit,
+// across limit changes and reorgs.
+func TestTxIndexer(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000)}},
+		}
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	gen := func(recipient byte) func(i int, block *BlockGen) {
+		return func(i int, block *BlockGen) {
+			tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{recipient}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+			block.AddTx(tx)
+		}
+	}
+	gendb, _ := ethdb.NewMemDatabase()
+	genesis := gspec.MustCommit(gendb)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 20, gen(0x01))
+	forks, _ := GenerateChain(gspec.Config, blocks[9], ethash.NewFaker(), gendb, 15, gen(0x02))
+
+	db, _ := ethdb.NewMemDatabase()
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, &CacheConfig{Disabled: true}, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	// check verifies that only the transactions of the given blocks from the given
+	// tail on are indexed
+	check := func(blocks []*types.Block, tail uint64) {
+		for _, block := range blocks {
+			for _, tx := range block.Transactions() {
+				hash, _, _ := GetTxLookupEntry(db, tx.Hash())
+				if indexed := hash != (common.Hash{}); indexed != (block.NumberU64() >= tail) {
+					t.Errorf("block #%d: transaction index presence mismatch: have %v, want %v", block.NumberU64(), indexed, block.NumberU64() >= tail)
+				}
+			}
+		}
+	}
+	index := func(want int, tail uint64) {
+		if n, err := chain.indexTransactions(); n != want || err != nil {
+			t.Fatalf("processed block count mismatch: have %d (%v), want %d", n, err, want)
+		}
+		if n, err := chain.indexTransactions(); n != 0 || err != nil {
+			t.Fatalf("processed block count mismatch: have %d (%v), want %d", n, err, 0)
+		}
+		if stored := GetTxIndexTail(db); stored == nil || *stored != tail {
+			t.Fatalf("index tail mismatch: have %v, want %d", stored, tail)
+		}
+	}
+	check(blocks, 0)
+
+	// Limit the index to the recent blocks, then raise and lift the limit
+	chain.cacheConfig.TxLookupLimit = 5
+	index(16, 16)
+	check(blocks, 16)
+
+	chain.cacheConfig.TxLookupLimit = 10
+	index(5, 11)
+	check(blocks, 11)
+
+	chain.cacheConfig.TxLookupLimit = 0
+	index(11, 0)
+	check(blocks, 0)
+
+	// Reorg to a longer fork, the blocks older than the tail must not be indexed
+	chain.cacheConfig.TxLookupLimit = 5
+	index(16, 16)
+
+	if _, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	check(forks, 16)
+	check(blocks[:10], 16)
+	for _, block := range blocks[10:] {
+		if hash, _, _ := GetTxLookupEntry(db, block.Transactions()[0].Hash()); hash != (common.Hash{}) {
+			t.Errorf("block #%d: reorged transaction still indexed", block.NumberU64())
+		}
+	}
+	index(5, 21)
+	check(forks, 21)
+}
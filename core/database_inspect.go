@@ -0,0 +1,195 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Kinds of data reported by the database inspection, in display order.
+const (
+	statHeaders         = "Headers"
+	statTds             = "Total difficulties"
+	statCanonicalHashes = "Canonical hashes"
+	statHashNumbers     = "Block number lookups"
+	statBodies          = "Bodies"
+	statReceipts        = "Receipts"
+	statTxLookups       = "Transaction lookups"
+	statBloomBits       = "Bloombits"
+	statPreimages       = "Preimages"
+	statTrieNodes       = "Trie nodes"
+	statCodes           = "Contract codes"
+	statSnapAccounts    = "Snapshot accounts"
+	statSnapStorage     = "Snapshot storage"
+	statIstanbulSnaps   = "Istanbul snapshots"
+	statCliqueSnaps     = "Clique snapshots"
+	statLightTries      = "Light client tries"
+	statIndexers        = "Chain indexers"
+	statMetadata        = "Metadata"
+	statUnaccounted     = "Unaccounted"
+)
+
+var (
+	// statKinds lists the kinds of data of the key-value store, in display order.
+	statKinds = []string{
+		statHeaders, statTds, statCanonicalHashes, statHashNumbers, statBodies,
+		statReceipts, statTxLookups, statBloomBits, statPreimages, statTrieNodes,
+		statCodes, statSnapAccounts, statSnapStorage, statIstanbulSnaps,
+		statCliqueSnaps, statLightTries, statIndexers, statMetadata, statUnaccounted,
+	}
+
+	// ancientKinds lists the tables of the ancient store, in display order.
+	ancientKinds = []string{ancientHashTable, ancientHeaderTable, ancientBodyTable, ancientReceiptTable, ancientTdTable}
+
+	// databaseMetadataKeys are the singleton keys of the chain database, including
+	// the ones owned by other packages.
+	databaseMetadataKeys = [][]byte{
+		headHeaderKey, headBlockKey, headFastKey, trieSyncKey, txIndexTailKey, []byte("BlockchainVersion"),
+		[]byte("SnapshotRoot"), []byte("SnapshotGenerator"), []byte("PruneStateRoots"),
+		[]byte("istanbul-wal"), []byte("istanbul-evidence"), []byte("_requestCostStats"),
+	}
+)
+
+// DatabaseStat is the number and total size of the entries of a kind of data in
+// the chain database.
+type DatabaseStat struct {
+	Database string             `json:"database"`
+	Kind     string             `json:"kind"`
+	Count    uint64             `json:"count"`
+	Size     common.StorageSize `json:"size"`
+}
+
+// InspectDatabase iterates the key-value store of the chain database, and looks
+// up the ancient store if any, returning the number and size of the entries of
+// every kind of data.
+//
+// Trie nodes and contract codes share the same key space, the entries decoding
+// as an RLP list are accounted as trie nodes.
+func InspectDatabase(db ethdb.Database) ([]DatabaseStat, error) {
+	ldb, ok := ethdb.KeyValueStore(db).(*ethdb.LDBDatabase)
+	if !ok {
+		return nil, errors.New("database inspection requires a persistent database")
+	}
+	var (
+		stats  = make(map[string]*DatabaseStat)
+		count  uint64
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for _, kind := range statKinds {
+		stats[kind] = &DatabaseStat{Database: "Key-Value store", Kind: kind}
+	}
+	it := ldb.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		key, value := it.Key(), it.Value()
+
+		stat := stats[inspectKind(key, value)]
+		stat.Count++
+		stat.Size += common.StorageSize(len(key) + len(value))
+
+		if count++; time.Since(logged) > 8*time.Second {
+			log.Info("Inspecting database", "entries", count, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	result := make([]DatabaseStat, 0, len(statKinds)+len(ancientKinds))
+	for _, kind := range statKinds {
+		result = append(result, *stats[kind])
+	}
+	if ancients, ok := db.(ethdb.AncientReader); ok {
+		frozen, err := ancients.Ancients()
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range ancientKinds {
+			size, err := ancients.AncientSize(kind)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, DatabaseStat{Database: "Ancient store", Kind: kind, Count: frozen, Size: common.StorageSize(size)})
+		}
+	}
+	return result, nil
+}
+
+// inspectKind returns the kind of data of a key-value store entry, as laid out
+// by the database schema.
+func inspectKind(key, value []byte) string {
+	var (
+		numHashLen = 1 + 8 + common.HashLength
+		hashLen    = 1 + common.HashLength
+	)
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == numHashLen:
+		return statHeaders
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == numHashLen+len(tdSuffix) && bytes.HasSuffix(key, tdSuffix):
+		return statTds
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == 1+8+len(numSuffix) && bytes.HasSuffix(key, numSuffix):
+		return statCanonicalHashes
+	case bytes.HasPrefix(key, blockHashPrefix) && len(key) == hashLen:
+		return statHashNumbers
+	case bytes.HasPrefix(key, bodyPrefix) && len(key) == numHashLen:
+		return statBodies
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == numHashLen:
+		return statReceipts
+	case bytes.HasPrefix(key, lookupPrefix) && len(key) == hashLen:
+		return statTxLookups
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == 1+2+8+common.HashLength:
+		return statBloomBits
+	case bytes.HasPrefix(key, []byte(preimagePrefix)) && len(key) == len(preimagePrefix)+common.HashLength:
+		return statPreimages
+	case len(key) == common.HashLength:
+		if kind, _, rest, err := rlp.Split(value); err == nil && kind == rlp.List && len(rest) == 0 {
+			return statTrieNodes
+		}
+		return statCodes
+	case bytes.HasPrefix(key, snapshot.AccountPrefix) && len(key) == len(snapshot.AccountPrefix)+common.HashLength:
+		return statSnapAccounts
+	case bytes.HasPrefix(key, snapshot.StoragePrefix) && len(key) == len(snapshot.StoragePrefix)+2*common.HashLength:
+		return statSnapStorage
+	case bytes.HasPrefix(key, []byte("istanbul-snapshot")):
+		return statIstanbulSnaps
+	case bytes.HasPrefix(key, []byte("clique-")):
+		return statCliqueSnaps
+	case bytes.HasPrefix(key, []byte("cht-")) || bytes.HasPrefix(key, []byte("blt-")) ||
+		bytes.HasPrefix(key, []byte("chtRoot-")) || bytes.HasPrefix(key, []byte("bltRoot-")):
+		return statLightTries
+	case bytes.HasPrefix(key, BloomBitsIndexPrefix) || bytes.HasPrefix(key, []byte("chtIndex-")) || bytes.HasPrefix(key, []byte("bltIndex-")):
+		return statIndexers
+	case bytes.HasPrefix(key, configPrefix):
+		return statMetadata
+	}
+	for _, meta := range databaseMetadataKeys {
+		if bytes.Equal(key, meta) {
+			return statMetadata
+		}
+	}
+	return statUnaccounted
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the database entries are classified as laid out by the schema.
+func TestInspectKind(t *testing.T) {
+	var (
+		hash   = common.HexToHash("0xdeadbeef")
+		number = encodeBlockNumber(1)
+		node   = []byte{0xc2, 0x01, 0x02}
+	)
+	key := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		key, value []byte
+		kind       string
+	}{
+		{key(headerPrefix, number, hash[:]), nil, statHeaders},
+		{key(headerPrefix, number, hash[:], tdSuffix), nil, statTds},
+		{key(headerPrefix, number, numSuffix), nil, statCanonicalHashes},
+		{key(blockHashPrefix, hash[:]), nil, statHashNumbers},
+		{key(bodyPrefix, number, hash[:]), nil, statBodies},
+		{key(blockReceiptsPrefix, number, hash[:]), nil, statReceipts},
+		{key(lookupPrefix, hash[:]), nil, statTxLookups},
+		{key(bloomBitsPrefix, []byte{0, 3}, number, hash[:]), nil, statBloomBits},
+		{key([]byte(preimagePrefix), hash[:]), nil, statPreimages},
+		{hash[:], node, statTrieNodes},
+		{hash[:], []byte{0x60, 0x00}, statCodes},
+		{key(snapshot.AccountPrefix, hash[:]), nil, statSnapAccounts},
+		{key(snapshot.StoragePrefix, hash[:], hash[:]), nil, statSnapStorage},
+		{key([]byte("istanbul-snapshot"), hash[:]), nil, statIstanbulSnaps},
+		{key([]byte("clique-"), hash[:]), nil, statCliqueSnaps},
+		{key([]byte("cht-"), hash[:]), nil, statLightTries},
+		{key(BloomBitsIndexPrefix, []byte("count")), nil, statIndexers},
+		{headHeaderKey, hash[:], statMetadata},
+		{key(configPrefix, hash[:]), nil, statMetadata},
+		{[]byte("unknown"), nil, statUnaccounted},
+	}
+	for i, tt := range tests {
+		if kind := inspectKind(tt.key, tt.value); kind != tt.kind {
+			t.Errorf("test %d: key %x: kind mismatch: have %s, want %s", i, tt.key, kind, tt.kind)
+		}
+	}
+}
+
+// Tests that inspecting a chain database accounts for all of its entries.
+func TestInspectDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000000)}}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 8, func(i int, block *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		block.AddTx(tx)
+	})
+	chain, err := NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	chain.Stop()
+
+	stats, err := InspectDatabase(db)
+	if err != nil {
+		t.Fatalf("failed to inspect database: %v", err)
+	}
+	counts := make(map[string]uint64)
+	for _, stat := range stats {
+		if stat.Count > 0 && stat.Size == 0 {
+			t.Errorf("%s: %d entries without size", stat.Kind, stat.Count)
+		}
+		counts[stat.Kind] = stat.Count
+	}
+	for _, kind := range []string{statHeaders, statTds, statCanonicalHashes, statHashNumbers, statBodies, statReceipts} {
+		if counts[kind] != 9 {
+			t.Errorf("%s: count mismatch: have %d, want %d", kind, counts[kind], 9)
+		}
+	}
+	if counts[statTxLookups] != 8 {
+		t.Errorf("%s: count mismatch: have %d, want %d", statTxLookups, counts[statTxLookups], 8)
+	}
+	if counts[statTrieNodes] == 0 {
+		t.Errorf("%s: no entries found", statTrieNodes)
+	}
+	if counts[statUnaccounted] != 0 {
+		t.Errorf("%s: have %d entries, want none", statUnaccounted, counts[statUnaccounted])
+	}
+	memdb, _ := ethdb.NewMemDatabase()
+	if _, err := InspectDatabase(memdb); err == nil {
+		t.Errorf("inspected in-memory database, want error")
+	}
+}
@@ -368,6 +368,9 @@ func (hc *HeaderChain) HasHeader(hash common.Hash, number uint64) bool {
 	if hc.numberCache.Contains(hash) || hc.headerCache.Contains(hash) {
 		return true
 	}
+	if isAncient(hc.chainDb, hash, number) {
+		return true
+	}
 	ok, _ := hc.chainDb.Has(headerKey(hash, number))
 	return ok
 }
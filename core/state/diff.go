@@ -0,0 +1,191 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccountDiff is the change of an account since a revision of the state, with its
+// values before and after the change. Unchanged values are the same in both.
+type AccountDiff struct {
+	Created    bool // Whether the account didn't exist before
+	Destructed bool // Whether the account self destructed
+	Deleted    bool // Whether the existing account is deleted for being empty (EIP-158)
+
+	PreBalance, PostBalance *big.Int
+	PreNonce, PostNonce     uint64
+	PreCode, PostCode       []byte
+
+	Storage map[common.Hash]StorageDiff // Changes of the modified storage slots
+}
+
+// StorageDiff is the change of a storage slot since a revision of the state.
+type StorageDiff struct {
+	Pre, Post common.Hash
+}
+
+// accountPre tracks which pre values of an account are known while walking the
+// journal. The first change of a value in the journal holds its pre value.
+type accountPre struct {
+	diff *AccountDiff
+
+	balance, nonce, code bool         // Whether the pre value is known
+	reset                bool         // Whether the account got created or overwritten
+	prev                 *stateObject // Account overwritten by the reset, nil if created
+}
+
+// JournalDiff returns the changes of the accounts modified since the given revision
+// of the state, as recorded in the journal. The revision must still be valid, so
+// the diff has to be taken before the journal is cleared by finalising the state.
+//
+// If deleteEmptyObjects is set, the diff accounts for finalising the state the
+// same way: the modified or touched accounts left empty are reported as deleted.
+func (self *StateDB) JournalDiff(revid int, deleteEmptyObjects bool) (map[common.Address]*AccountDiff, error) {
+	idx := sort.Search(len(self.validRevisions), func(i int) bool {
+		return self.validRevisions[i].id >= revid
+	})
+	if idx == len(self.validRevisions) || self.validRevisions[idx].id != revid {
+		return nil, fmt.Errorf("revision id %v unavailable", revid)
+	}
+	// Gather the pre values from the first changes in the journal
+	accounts := make(map[common.Address]*accountPre)
+	lookup := func(addr common.Address) *accountPre {
+		pre := accounts[addr]
+		if pre == nil {
+			pre = &accountPre{diff: &AccountDiff{Storage: make(map[common.Hash]StorageDiff)}}
+			accounts[addr] = pre
+		}
+		return pre
+	}
+	for _, entry := range self.journal[self.validRevisions[idx].journalIndex:] {
+		switch entry := entry.(type) {
+		case createObjectChange:
+			pre := lookup(*entry.account)
+			if !pre.balance && !pre.nonce && !pre.code && len(pre.diff.Storage) == 0 {
+				pre.diff.Created = true
+			}
+			pre.setAccount(new(big.Int), 0, nil)
+			pre.reset = true
+
+		case resetObjectChange:
+			pre := lookup(entry.prev.address)
+			pre.setAccount(entry.prev.Balance(), entry.prev.Nonce(), entry.prev.Code(self.db))
+			if !pre.reset {
+				pre.reset, pre.prev = true, entry.prev
+			}
+
+		case suicideChange:
+			if pre := lookup(*entry.account); !pre.balance {
+				pre.diff.PreBalance, pre.balance = entry.prevbalance, true
+			}
+
+		case balanceChange:
+			if pre := lookup(*entry.account); !pre.balance {
+				pre.diff.PreBalance, pre.balance = entry.prev, true
+			}
+
+		case nonceChange:
+			if pre := lookup(*entry.account); !pre.nonce {
+				pre.diff.PreNonce, pre.nonce = entry.prev, true
+			}
+
+		case codeChange:
+			if pre := lookup(*entry.account); !pre.code {
+				pre.diff.PreCode, pre.code = entry.prevcode, true
+			}
+
+		case touchChange:
+			if deleteEmptyObjects {
+				lookup(*entry.account)
+			}
+
+		case storageChange:
+			pre := lookup(*entry.account)
+			if _, ok := pre.diff.Storage[entry.key]; ok {
+				continue
+			}
+			// The storage of an overwritten account was discarded, the slot held
+			// its value in the account before the reset
+			value := entry.prevalue
+			if pre.reset {
+				value = common.Hash{}
+				if pre.prev != nil {
+					value = pre.prev.GetState(self.db, entry.key)
+				}
+			}
+			pre.diff.Storage[entry.key] = StorageDiff{Pre: value}
+		}
+	}
+	// Fill in the post values from the live objects. The unchanged values of the
+	// destructed accounts are still around to serve as their pre values.
+	diffs := make(map[common.Address]*AccountDiff, len(accounts))
+	for addr, pre := range accounts {
+		var (
+			diff    = pre.diff
+			obj     = self.stateObjects[addr]
+			balance = new(big.Int)
+			nonce   uint64
+			code    []byte
+		)
+		if obj != nil {
+			balance, nonce, code = new(big.Int).Set(obj.Balance()), obj.Nonce(), obj.Code(self.db)
+		}
+		if !pre.balance {
+			diff.PreBalance = balance
+		}
+		if !pre.nonce {
+			diff.PreNonce = nonce
+		}
+		if !pre.code {
+			diff.PreCode = code
+		}
+		if obj != nil && !obj.deleted && !obj.suicided && deleteEmptyObjects && obj.empty() {
+			diff.Deleted = !diff.Created
+			obj = nil
+		}
+		if obj == nil || obj.deleted || obj.suicided {
+			diff.Destructed = obj != nil && obj.suicided
+			diff.PostBalance = new(big.Int)
+		} else {
+			diff.PostBalance, diff.PostNonce, diff.PostCode = balance, nonce, code
+			for key, slot := range diff.Storage {
+				slot.Post = obj.GetState(self.db, key)
+				diff.Storage[key] = slot
+			}
+		}
+		diffs[addr] = diff
+	}
+	return diffs, nil
+}
+
+// setAccount sets the still unknown pre values of the account.
+func (pre *accountPre) setAccount(balance *big.Int, nonce uint64, code []byte) {
+	if !pre.balance {
+		pre.diff.PreBalance, pre.balance = new(big.Int).Set(balance), true
+	}
+	if !pre.nonce {
+		pre.diff.PreNonce, pre.nonce = nonce, true
+	}
+	if !pre.code {
+		pre.diff.PreCode, pre.code = code, true
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that the journal diff reports the pre and post values of the changed
+// accounts, ignoring the reverted changes.
+func TestJournalDiff(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	var (
+		sender    = common.HexToAddress("0x01")
+		contract  = common.HexToAddress("0x02")
+		created   = common.HexToAddress("0x03")
+		destroyed = common.HexToAddress("0x04")
+		reverted  = common.HexToAddress("0x05")
+
+		slot1 = common.HexToHash("0x01")
+		slot2 = common.HexToHash("0x02")
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetBalance(sender, big.NewInt(1000))
+	state.SetNonce(sender, 5)
+	state.SetCode(contract, []byte{0x01})
+	state.SetState(contract, slot1, common.HexToHash("0x11"))
+	state.SetState(contract, slot2, common.HexToHash("0x22"))
+	state.SetBalance(destroyed, big.NewInt(50))
+	state.SetNonce(destroyed, 1)
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, sdb)
+	revision := state.Snapshot()
+
+	state.SubBalance(sender, big.NewInt(300))
+	state.SetNonce(sender, 6)
+	state.SubBalance(sender, big.NewInt(100))
+	state.SetState(contract, slot1, common.HexToHash("0x12"))
+	state.SetState(contract, slot1, common.HexToHash("0x13"))
+	state.AddBalance(created, big.NewInt(300))
+	state.Suicide(destroyed)
+
+	inner := state.Snapshot()
+	state.AddBalance(reverted, big.NewInt(1))
+	state.SetState(contract, slot2, common.HexToHash("0x23"))
+	state.RevertToSnapshot(inner)
+
+	diffs, err := state.JournalDiff(revision, false)
+	if err != nil {
+		t.Fatalf("failed to diff state: %v", err)
+	}
+	if len(diffs) != 4 {
+		t.Fatalf("changed account count mismatch: have %d, want 4", len(diffs))
+	}
+	if diff := diffs[sender]; diff == nil || diff.PreBalance.Int64() != 1000 || diff.PostBalance.Int64() != 600 || diff.PreNonce != 5 || diff.PostNonce != 6 {
+		t.Errorf("sender diff mismatch: %+v", diff)
+	}
+	if diff := diffs[contract]; diff == nil || len(diff.Storage) != 1 || diff.Storage[slot1] != (StorageDiff{common.HexToHash("0x11"), common.HexToHash("0x13")}) || !bytes.Equal(diff.PreCode, diff.PostCode) {
+		t.Errorf("contract diff mismatch: %+v", diff)
+	}
+	if diff := diffs[created]; diff == nil || !diff.Created || diff.PreBalance.Sign() != 0 || diff.PostBalance.Int64() != 300 {
+		t.Errorf("created account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[destroyed]; diff == nil || !diff.Destructed || diff.PreBalance.Int64() != 50 || diff.PostBalance.Sign() != 0 || diff.PreNonce != 1 || diff.PostNonce != 0 {
+		t.Errorf("destructed account diff mismatch: %+v", diff)
+	}
+	if _, err := state.JournalDiff(inner, false); err == nil {
+		t.Errorf("diff since reverted revision succeeded")
+	}
+}
+
+// Tests that the storage of an overwritten account is diffed against its values
+// before the reset.
+func TestJournalDiffReset(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	var (
+		addr = common.HexToAddress("0x01")
+		slot = common.HexToHash("0x01")
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetBalance(addr, big.NewInt(10))
+	state.SetState(addr, slot, common.HexToHash("0x11"))
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, sdb)
+	revision := state.Snapshot()
+
+	state.CreateAccount(addr)
+	state.SetState(addr, slot, common.HexToHash("0x12"))
+
+	diffs, err := state.JournalDiff(revision, false)
+	if err != nil {
+		t.Fatalf("failed to diff state: %v", err)
+	}
+	diff := diffs[addr]
+	if diff == nil || diff.Created || diff.PreBalance.Int64() != 10 || diff.PostBalance.Int64() != 10 {
+		t.Fatalf("account diff mismatch: %+v", diff)
+	}
+	if have, want := diff.Storage[slot], (StorageDiff{common.HexToHash("0x11"), common.HexToHash("0x12")}); have != want {
+		t.Fatalf("storage diff mismatch: have %+v, want %+v", have, want)
+	}
+}
+
+// Tests that the empty accounts deleted by finalising the state are reported as
+// such when requested.
+func TestJournalDiffDeleteEmpty(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	var (
+		empty   = common.HexToAddress("0x01")
+		drained = common.HexToAddress("0x02")
+		created = common.HexToAddress("0x03")
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.CreateAccount(empty)
+	state.SetBalance(drained, big.NewInt(10))
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, sdb)
+	revision := state.Snapshot()
+
+	state.AddBalance(empty, new(big.Int))
+	state.SubBalance(drained, big.NewInt(10))
+	state.AddBalance(created, new(big.Int))
+
+	diffs, err := state.JournalDiff(revision, false)
+	if err != nil {
+		t.Fatalf("failed to diff state: %v", err)
+	}
+	for addr, diff := range diffs {
+		if diff.Deleted {
+			t.Errorf("account %x reported deleted without deleting empty objects", addr)
+		}
+	}
+	diffs, err = state.JournalDiff(revision, true)
+	if err != nil {
+		t.Fatalf("failed to diff state: %v", err)
+	}
+	if diff := diffs[empty]; diff == nil || !diff.Deleted {
+		t.Errorf("touched empty account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[drained]; diff == nil || !diff.Deleted || diff.PreBalance.Int64() != 10 || diff.PostBalance.Sign() != 0 {
+		t.Errorf("drained account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[created]; diff == nil || !diff.Created || diff.Deleted {
+		t.Errorf("created empty account diff mismatch: %+v", diff)
+	}
+}
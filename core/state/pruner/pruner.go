@@ -0,0 +1,294 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package pruner implements the offline pruning of the state stored on disk.
+package pruner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// pruneBatchSize is the number of keys written to or deleted from the database in
+// one batch.
+const pruneBatchSize = 10000
+
+var (
+	// pruneRootsKey tracks the state roots retained by an interrupted pruning, so
+	// that it resumes with the same ones.
+	pruneRootsKey = []byte("PruneStateRoots")
+
+	// pruneMarkPrefix + hash -> empty, marks the trie nodes and codes reachable
+	// from the retained roots.
+	pruneMarkPrefix = []byte("PruneStateMark-")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256(nil)
+
+	// errNoRoots is returned if pruning is requested without any state to retain.
+	errNoRoots = errors.New("no state roots to retain")
+)
+
+// Pruner deletes every state trie node and contract code not reachable from a set
+// of retained state roots. It must be run offline, since any state written while
+// pruning may be deleted.
+//
+// The reachable entries are marked on disk, so the memory use doesn't grow with
+// the size of the state, and all the other entries keyed by a hash are swept from
+// the database. The roots are only recorded once their tries are known to be
+// complete, and if interrupted from there on, the pruning is resumed with the same
+// roots, so no entry reachable from them is ever deleted.
+type Pruner struct {
+	db     *ethdb.LDBDatabase
+	triedb *trie.Database
+	roots  []common.Hash
+	batch  *leveldb.Batch // Pending marks, not yet written to the database
+	marked int            // Number of entries marked
+}
+
+// NewPruner creates a pruner retaining the state of the given roots, or those of
+// an interrupted pruning if there's one.
+func NewPruner(db *ethdb.LDBDatabase, roots []common.Hash) (*Pruner, error) {
+	if blob, _ := db.Get(pruneRootsKey); len(blob) > 0 {
+		var resumed []common.Hash
+		if err := rlp.DecodeBytes(blob, &resumed); err != nil {
+			return nil, err
+		}
+		log.Warn("Resuming interrupted state pruning", "roots", len(resumed))
+		roots = resumed
+	}
+	if len(roots) == 0 {
+		return nil, errNoRoots
+	}
+	return &Pruner{
+		db:     db,
+		triedb: trie.NewDatabase(db),
+		roots:  roots,
+		batch:  new(leveldb.Batch),
+	}, nil
+}
+
+// Roots returns the state roots retained by the pruner.
+func (p *Pruner) Roots() []common.Hash {
+	return p.roots
+}
+
+// Prune marks the entries reachable from the retained roots, and deletes all the
+// other ones.
+func (p *Pruner) Prune() error {
+	// Drop the marks of an interrupted pruning, they may cover partial subtries
+	start := time.Now()
+	if err := p.clearMarks(); err != nil {
+		return err
+	}
+	// Mark the reachable state, failing on any missing node before deleting anything
+	for _, root := range p.roots {
+		if err := p.markTrie(root, true); err != nil {
+			return fmt.Errorf("incomplete state %x: %v", root, err)
+		}
+	}
+	if err := p.flushMarks(); err != nil {
+		return err
+	}
+	log.Info("Marked reachable state", "roots", len(p.roots), "entries", p.marked, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Record the verified roots, any interruption from here on must resume with them
+	blob, err := rlp.EncodeToBytes(p.roots)
+	if err != nil {
+		return err
+	}
+	if err := p.db.Put(pruneRootsKey, blob); err != nil {
+		return err
+	}
+	deleted, err := p.sweep()
+	if err != nil {
+		return err
+	}
+	if err := p.db.Delete(pruneRootsKey); err != nil {
+		return err
+	}
+	if err := p.clearMarks(); err != nil {
+		return err
+	}
+	log.Info("Pruned unreachable state", "deleted", deleted, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	// Reclaim the freed up disk space
+	cstart := time.Now()
+	if err := p.db.LDB().CompactRange(util.Range{}); err != nil {
+		return err
+	}
+	log.Info("Compacted database", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	return nil
+}
+
+// markTrie marks all the nodes of a trie, skipping the subtries already marked.
+// For the account trie, the storage tries and codes of the accounts are marked too.
+//
+// Marking aborts on any missing node, so within a pruning, a subtrie skipped for
+// being marked has always been marked in full.
+func (p *Pruner) markTrie(root common.Hash, accounts bool) error {
+	if root == types.EmptyRootHash {
+		return nil
+	}
+	if marked, err := p.isMarked(root); marked || err != nil {
+		return err
+	}
+	tr, err := trie.New(root, p.triedb)
+	if err != nil {
+		return err
+	}
+	it := tr.NodeIterator(nil)
+	for descend := true; it.Next(descend); {
+		descend = true
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			marked, err := p.isMarked(hash)
+			if err != nil {
+				return err
+			}
+			if marked {
+				descend = false
+				continue
+			}
+			if err := p.mark(hash); err != nil {
+				return err
+			}
+		}
+		if !accounts || !it.Leaf() {
+			continue
+		}
+		var account state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &account); err != nil {
+			return err
+		}
+		if err := p.markTrie(account.Root, false); err != nil {
+			return err
+		}
+		if !bytes.Equal(account.CodeHash, emptyCode) {
+			code := common.BytesToHash(account.CodeHash)
+			if ok, _ := p.db.Has(code.Bytes()); !ok {
+				return fmt.Errorf("code %x missing", code)
+			}
+			if err := p.mark(code); err != nil {
+				return err
+			}
+		}
+	}
+	return it.Error()
+}
+
+// mark queues an entry to be marked as reachable, writing the pending marks once
+// the batch is full.
+func (p *Pruner) mark(hash common.Hash) error {
+	p.batch.Put(append(pruneMarkPrefix, hash[:]...), nil)
+	p.marked++
+
+	if p.batch.Len() >= pruneBatchSize {
+		return p.flushMarks()
+	}
+	return nil
+}
+
+// isMarked reports whether an entry was marked as reachable. Marks still pending
+// in the batch aren't seen, at worst revisiting their subtries.
+func (p *Pruner) isMarked(hash common.Hash) (bool, error) {
+	return p.db.Has(append(pruneMarkPrefix, hash[:]...))
+}
+
+// flushMarks writes the pending marks to the database.
+func (p *Pruner) flushMarks() error {
+	if err := p.db.LDB().Write(p.batch, nil); err != nil {
+		return err
+	}
+	p.batch.Reset()
+	return nil
+}
+
+// clearMarks deletes all the marks from the database.
+func (p *Pruner) clearMarks() error {
+	batch := new(leveldb.Batch)
+	it := p.db.LDB().NewIterator(util.BytesPrefix(pruneMarkPrefix), nil)
+	defer it.Release()
+
+	for it.Next() {
+		batch.Delete(common.CopyBytes(it.Key()))
+		if batch.Len() >= pruneBatchSize {
+			if err := p.db.LDB().Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return p.db.LDB().Write(batch, nil)
+}
+
+// sweep deletes all the unmarked trie nodes and contract codes from the database,
+// returning their number. Both are the only entries keyed by a bare hash.
+func (p *Pruner) sweep() (int, error) {
+	var (
+		deleted int
+		batch   = new(leveldb.Batch)
+		logged  = time.Now()
+	)
+	it := p.db.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		marked, err := p.isMarked(common.BytesToHash(key))
+		if err != nil {
+			return deleted, err
+		}
+		if marked {
+			continue
+		}
+		batch.Delete(common.CopyBytes(key))
+		deleted++
+
+		if batch.Len() >= pruneBatchSize {
+			if err := p.db.LDB().Write(batch, nil); err != nil {
+				return deleted, err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state", "deleted", deleted)
+			logged = time.Now()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return deleted, err
+	}
+	return deleted, p.db.LDB().Write(batch, nil)
+}
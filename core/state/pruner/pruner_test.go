@@ -0,0 +1,184 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// newTestDatabase creates a persistent database in a temporary directory.
+func newTestDatabase(t *testing.T) (*ethdb.LDBDatabase, func()) {
+	dir, err := ioutil.TempDir("", "pruner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// commitState writes a state with the given number of accounts, each holding some
+// storage and code derived from the seed, and returns its root.
+func commitState(t *testing.T, db ethdb.Database, seed byte, accounts int) common.Hash {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	for i := 0; i < accounts; i++ {
+		addr := common.BytesToAddress([]byte{byte(i), seed})
+		statedb.SetBalance(addr, big.NewInt(int64(i)+1))
+		statedb.SetState(addr, common.BytesToHash([]byte{byte(i)}), common.BytesToHash([]byte{seed}))
+		statedb.SetCode(addr, []byte{seed, byte(i)})
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	return root
+}
+
+// checkState verifies that a state committed with commitState is fully readable.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash, seed byte, accounts int) {
+	statedb, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	for i := 0; i < accounts; i++ {
+		addr := common.BytesToAddress([]byte{byte(i), seed})
+		if balance := statedb.GetBalance(addr); balance.Int64() != int64(i)+1 {
+			t.Errorf("account %d: balance mismatch: have %v, want %d", i, balance, i+1)
+		}
+		if value := statedb.GetState(addr, common.BytesToHash([]byte{byte(i)})); value != common.BytesToHash([]byte{seed}) {
+			t.Errorf("account %d: storage mismatch: have %x", i, value)
+		}
+		if code := statedb.GetCode(addr); len(code) != 2 || code[0] != seed {
+			t.Errorf("account %d: code mismatch: have %x", i, code)
+		}
+	}
+	if err := statedb.Error(); err != nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+}
+
+// Tests that pruning deletes the state only reachable from the dropped roots,
+// keeping the retained ones intact.
+func TestPrune(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	stale := commitState(t, db, 1, 50)
+	root := commitState(t, db, 2, 50)
+
+	pruner, err := NewPruner(db, []common.Hash{root})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.Prune(); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	checkState(t, db, root, 2, 50)
+
+	if ok, _ := db.Has(stale.Bytes()); ok {
+		t.Errorf("stale state root not deleted")
+	}
+	if ok, _ := db.Has(pruneRootsKey); ok {
+		t.Errorf("pruning marker not deleted")
+	}
+	it := db.LDB().NewIterator(util.BytesPrefix(pruneMarkPrefix), nil)
+	defer it.Release()
+	if it.Next() {
+		t.Errorf("reachability marks not deleted")
+	}
+}
+
+// Tests that an interrupted pruning resumes with the roots it was started with,
+// rather than the ones given to the new pruner.
+func TestPruneResume(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	first := commitState(t, db, 1, 20)
+	second := commitState(t, db, 2, 20)
+
+	blob, _ := rlp.EncodeToBytes([]common.Hash{first, second})
+	db.Put(pruneRootsKey, blob)
+
+	pruner, err := NewPruner(db, []common.Hash{second})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if roots := pruner.Roots(); len(roots) != 2 {
+		t.Fatalf("resumed root count mismatch: have %d, want %d", len(roots), 2)
+	}
+	if err := pruner.Prune(); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	checkState(t, db, first, 1, 20)
+	checkState(t, db, second, 2, 20)
+
+	if _, err := NewPruner(db, nil); err != errNoRoots {
+		t.Errorf("empty roots error mismatch: have %v, want %v", err, errNoRoots)
+	}
+}
+
+// Tests that pruning refuses to start if a retained state is incomplete, without
+// recording its roots or deleting anything.
+func TestPruneIncomplete(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	stale := commitState(t, db, 1, 20)
+	root := commitState(t, db, 2, 20)
+
+	// Drop a node below the root of the retained state
+	tr, _ := trie.New(root, trie.NewDatabase(db))
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) && hash != root {
+			db.Delete(hash.Bytes())
+			break
+		}
+	}
+	pruner, err := NewPruner(db, []common.Hash{root})
+	if err != nil {
+		t.Fatalf("failed to create pruner: %v", err)
+	}
+	if err := pruner.Prune(); err == nil {
+		t.Fatalf("incomplete state pruned")
+	}
+	if ok, _ := db.Has(pruneRootsKey); ok {
+		t.Errorf("roots of incomplete state recorded")
+	}
+	if ok, _ := db.Has(stale.Bytes()); !ok {
+		t.Errorf("stale state deleted despite the failure")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// diffLayer is an in memory snapshot layer, holding the state changes of a block
+// on top of the layer of its parent.
+type diffLayer struct {
+	root   common.Hash // State root of the block
+	parent snapshot    // Layer the changes are applied on, relinked when flattened
+
+	destructs map[common.Hash]struct{}               // Accounts deleted, along with their storage
+	accounts  map[common.Hash][]byte                 // Accounts updated (nil means deleted)
+	storage   map[common.Hash]map[common.Hash][]byte // Storage slots updated (nil means deleted)
+
+	memory uint64 // Approximate size of the changes held, in bytes
+
+	stale bool // Whether the layer was flattened or discarded
+	lock  sync.RWMutex
+}
+
+// newDiffLayer creates a layer with the given state changes on top of a parent.
+// An account both destructed and updated was recreated, and its storage holds
+// only the updated slots.
+func newDiffLayer(parent snapshot, root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer {
+	dl := &diffLayer{
+		root:      root,
+		parent:    parent,
+		destructs: destructs,
+		accounts:  accounts,
+		storage:   storage,
+	}
+	if dl.destructs == nil {
+		dl.destructs = make(map[common.Hash]struct{})
+	}
+	if dl.accounts == nil {
+		dl.accounts = make(map[common.Hash][]byte)
+	}
+	if dl.storage == nil {
+		dl.storage = make(map[common.Hash]map[common.Hash][]byte)
+	}
+	dl.memory = uint64(len(destructs) * common.HashLength)
+	for _, blob := range accounts {
+		dl.memory += uint64(common.HashLength + len(blob))
+	}
+	for _, slots := range storage {
+		for _, blob := range slots {
+			dl.memory += uint64(common.HashLength + len(blob))
+		}
+	}
+	return dl
+}
+
+// merge folds the changes of the layer built on top into this one, returning the
+// combined layer with the state root of the top one. Both layers are marked
+// stale, and the maps of this one are reused for the combined layer instead of
+// being copied.
+func (dl *diffLayer) merge(top *diffLayer) *diffLayer {
+	top.markStale()
+
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+	for hash := range top.destructs {
+		dl.destructs[hash] = struct{}{}
+		delete(dl.accounts, hash)
+		delete(dl.storage, hash)
+	}
+	for hash, blob := range top.accounts {
+		dl.accounts[hash] = blob
+	}
+	for hash, slots := range top.storage {
+		if dl.storage[hash] == nil {
+			dl.storage[hash] = make(map[common.Hash][]byte)
+		}
+		for slot, blob := range slots {
+			dl.storage[hash][slot] = blob
+		}
+	}
+	return &diffLayer{
+		root:      top.root,
+		parent:    dl.parent,
+		destructs: dl.destructs,
+		accounts:  dl.accounts,
+		storage:   dl.storage,
+		memory:    dl.memory + top.memory,
+	}
+}
+
+// Root implements Snapshot, returning the state root of the layer.
+func (dl *diffLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent implements snapshot, returning the layer below.
+func (dl *diffLayer) Parent() snapshot {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.parent
+}
+
+// markStale implements snapshot.
+func (dl *diffLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// isStale implements snapshot.
+func (dl *diffLayer) isStale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// Account implements Snapshot, looking the account up in the layer, or in the
+// ones below if it wasn't changed.
+func (dl *diffLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, ErrSnapshotStale
+	}
+	if blob, ok := dl.accounts[hash]; ok {
+		dl.lock.RUnlock()
+		return blob, nil
+	}
+	if _, ok := dl.destructs[hash]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Account(hash)
+}
+
+// Storage implements Snapshot, looking the storage slot up in the layer, or in
+// the ones below if it wasn't changed.
+func (dl *diffLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	if dl.stale {
+		dl.lock.RUnlock()
+		return nil, ErrSnapshotStale
+	}
+	if blob, ok := dl.storage[accountHash][storageHash]; ok {
+		dl.lock.RUnlock()
+		return blob, nil
+	}
+	if _, ok := dl.destructs[accountHash]; ok {
+		dl.lock.RUnlock()
+		return nil, nil
+	}
+	parent := dl.parent
+	dl.lock.RUnlock()
+
+	return parent.Storage(accountHash, storageHash)
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// diskLayer is the bottom snapshot layer, holding the flat state of a block in
+// the database.
+type diskLayer struct {
+	db     *ethdb.LDBDatabase // Database holding the flat state entries
+	triedb *trie.Database     // Trie database to generate the entries from
+	root   common.Hash        // State root of the block
+
+	genMarker []byte             // Last account generated (nil if done, empty if none)
+	genAbort  chan chan struct{} // Channel to stop the generator (nil if not running)
+
+	stale bool // Whether the layer was flattened or discarded
+	lock  sync.RWMutex
+}
+
+// Root implements Snapshot, returning the state root of the layer.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent implements snapshot, the disk layer being the bottom one.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// markStale implements snapshot.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// isStale implements snapshot.
+func (dl *diskLayer) isStale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// generating returns whether the entries of the layer are still being generated.
+func (dl *diskLayer) generating() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.genMarker != nil
+}
+
+// Account implements Snapshot, retrieving the account from the database.
+func (dl *diskLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !covered(hash, dl.genMarker) {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.db.Get(accountKey(hash))
+	return blob, nil
+}
+
+// Storage implements Snapshot, retrieving the storage slot from the database.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !covered(accountHash, dl.genMarker) {
+		return nil, ErrNotCoveredYet
+	}
+	blob, _ := dl.db.Get(storageKey(accountHash, storageHash))
+	return blob, nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// account is the consensus representation of accounts, as stored in the leaves of
+// the account trie.
+type account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// startGeneration starts generating the entries past the progress marker of the
+// disk layer in the background.
+func (dl *diskLayer) startGeneration() {
+	dl.genAbort = make(chan chan struct{})
+	go dl.generate()
+}
+
+// stopGeneration stops the background generation, if running, waiting for the
+// generator to persist its progress.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	abort := make(chan struct{})
+	dl.genAbort <- abort
+	<-abort
+
+	dl.genAbort = nil
+}
+
+// generate iterates the state trie of the disk layer from its progress marker,
+// writing the accounts and their storage slots into the database. The progress is
+// only advanced, and the stop requests only handled, between accounts, so that
+// no account is ever served partially generated.
+//
+// The entries past the marker are wiped first, as an interrupted generator may
+// have left some behind.
+func (dl *diskLayer) generate() {
+	dl.lock.RLock()
+	marker := dl.genMarker
+	dl.lock.RUnlock()
+
+	var (
+		start    = time.Now()
+		logged   = time.Now()
+		accounts int
+		batch    = new(leveldb.Batch)
+	)
+	// flush writes the pending entries, advancing the marker to the given account
+	// if it's a complete one
+	flush := func(done []byte) {
+		dl.lock.Lock()
+		defer dl.lock.Unlock()
+
+		if done != nil {
+			batch.Put(snapshotGeneratorKey, done)
+		}
+		if err := dl.db.LDB().Write(batch, nil); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+		if done != nil {
+			dl.genMarker = done
+		}
+	}
+	if err := dl.wipe(marker); err != nil {
+		log.Error("Failed to wipe state snapshot", "err", err)
+		dl.waitAbort()
+		return
+	}
+	accTrie, err := trie.NewSecure(dl.root, dl.triedb, 0)
+	if err != nil {
+		log.Error("Failed to open state trie for snapshot", "root", dl.root, "err", err)
+		dl.waitAbort()
+		return
+	}
+	it := trie.NewIterator(accTrie.NodeIterator(marker))
+	for it.Next() {
+		if len(marker) > 0 && bytes.Equal(it.Key, marker) {
+			continue
+		}
+		hash := common.CopyBytes(it.Key)
+		batch.Put(accountKey(common.BytesToHash(hash)), common.CopyBytes(it.Value))
+
+		var acc account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			log.Error("Invalid account in state trie", "hash", common.BytesToHash(hash), "err", err)
+			dl.waitAbort()
+			return
+		}
+		if acc.Root != types.EmptyRootHash {
+			stTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				log.Error("Failed to open storage trie for snapshot", "root", acc.Root, "err", err)
+				dl.waitAbort()
+				return
+			}
+			stIt := trie.NewIterator(stTrie.NodeIterator(nil))
+			for stIt.Next() {
+				batch.Put(storageKey(common.BytesToHash(hash), common.BytesToHash(stIt.Key)), common.CopyBytes(stIt.Value))
+				if len(batch.Dump()) > ethdb.IdealBatchSize {
+					flush(nil)
+				}
+			}
+			if stIt.Err != nil {
+				log.Error("Failed to iterate storage trie for snapshot", "root", acc.Root, "err", stIt.Err)
+				dl.waitAbort()
+				return
+			}
+		}
+		accounts++
+
+		// Persist the progress once in a while, giving a chance to stop
+		if len(batch.Dump()) > ethdb.IdealBatchSize {
+			flush(hash)
+			select {
+			case abort := <-dl.genAbort:
+				close(abort)
+				return
+			default:
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Generating state snapshot", "at", common.BytesToHash(hash), "accounts", accounts, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if it.Err != nil {
+		log.Error("Failed to iterate state trie for snapshot", "root", dl.root, "err", it.Err)
+		dl.waitAbort()
+		return
+	}
+	// Generation done, drop the marker and wait to be stopped
+	batch.Delete(snapshotGeneratorKey)
+	flush(nil)
+
+	dl.lock.Lock()
+	dl.genMarker = nil
+	dl.lock.Unlock()
+
+	log.Info("Generated state snapshot", "root", dl.root, "accounts", accounts, "elapsed", common.PrettyDuration(time.Since(start)))
+	dl.waitAbort()
+}
+
+// waitAbort blocks until the generator is requested to stop.
+func (dl *diskLayer) waitAbort() {
+	abort := <-dl.genAbort
+	close(abort)
+}
+
+// wipe deletes the snapshot entries of the accounts past the given one.
+func (dl *diskLayer) wipe(marker []byte) error {
+	batch := new(leveldb.Batch)
+	for prefix, size := range map[string]int{
+		string(AccountPrefix): len(AccountPrefix) + common.HashLength,
+		string(StoragePrefix): len(StoragePrefix) + 2*common.HashLength,
+	} {
+		it := dl.db.LDB().NewIterator(&util.Range{Start: append([]byte(prefix), marker...), Limit: []byte{prefix[0] + 1}}, nil)
+		for it.Next() {
+			key := it.Key()
+			if len(key) != size {
+				continue
+			}
+			if len(marker) > 0 && bytes.Equal(key[len(prefix):len(prefix)+common.HashLength], marker) {
+				continue
+			}
+			batch.Delete(key)
+			if batch.Len() >= 10000 {
+				if err := dl.db.LDB().Write(batch, nil); err != nil {
+					it.Release()
+					return err
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return dl.db.LDB().Write(batch, nil)
+}
@@ -0,0 +1,343 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat key-value snapshot of the recent states,
+// serving account and storage reads without walking the state tries.
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// aggregatorMemoryLimit is the size of the changes collected in the bottom diff
+// layer above which they are written into the disk layer.
+const aggregatorMemoryLimit = 4 * 1024 * 1024
+
+var (
+	// AccountPrefix is the database key prefix of the snapshot accounts:
+	// AccountPrefix + account hash -> account trie leaf
+	AccountPrefix = []byte("a")
+
+	// StoragePrefix is the database key prefix of the snapshot storage slots:
+	// StoragePrefix + account hash + slot hash -> storage trie leaf
+	StoragePrefix = []byte("o")
+
+	// snapshotRootKey tracks the state root of the snapshot stored on disk.
+	snapshotRootKey = []byte("SnapshotRoot")
+
+	// snapshotGeneratorKey tracks the last account generated into the snapshot
+	// stored on disk, until the generation is done.
+	snapshotGeneratorKey = []byte("SnapshotGenerator")
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the layer was flattened
+	// or discarded in the meantime. The state should be read from the trie instead.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the requested entry is
+	// not generated into the snapshot yet. The state should be read from the trie
+	// instead.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotMissing is returned if a snapshot layer is requested for a state
+	// root not tracked by the tree.
+	errSnapshotMissing = errors.New("snapshot missing")
+)
+
+// Snapshot represents the flat state of a block.
+type Snapshot interface {
+	// Root returns the state root of the snapshot.
+	Root() common.Hash
+
+	// Account retrieves the RLP encoded account with the given address hash, or
+	// nil if the account doesn't exist.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage retrieves the RLP encoded storage slot with the given hash of the
+	// account with the given address hash, or nil if the slot is empty.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layers, linked to the
+// layer they're built on.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the layer the snapshot is built on, or nil for the disk one.
+	Parent() snapshot
+
+	// markStale flags the layer as flattened or discarded.
+	markStale()
+
+	// isStale returns whether the layer was flattened or discarded.
+	isStale() bool
+}
+
+// Tree is the collection of the snapshots of the recent states: a disk layer at
+// the bottom, holding the flat state of an older block in the database, and in
+// memory diff layers on top, holding the changes of the recent blocks.
+//
+// The diff layers form a tree, tracking the side chains too. Capping the tree
+// merges the oldest diff layers of a chain into a single bottom one, discarding
+// the layers not built on it anymore. The bottom diff layer is flattened into the
+// disk layer once its changes grow past aggregatorMemoryLimit, so that the disk
+// isn't written, nor the generator paused, for every block.
+type Tree struct {
+	db     *ethdb.LDBDatabase       // Persistent database holding the disk layer
+	triedb *trie.Database           // Trie database to generate the disk layer from
+	layers map[common.Hash]snapshot // Snapshot layers, keyed by state root
+	lock   sync.RWMutex
+}
+
+// New opens the snapshot tree of the given state root. If the snapshot stored on
+// disk is of another state, it's discarded and generated anew in the background,
+// during which the reads are served by the tries.
+func New(db *ethdb.LDBDatabase, triedb *trie.Database, root common.Hash) *Tree {
+	snaps := &Tree{
+		db:     db,
+		triedb: triedb,
+		layers: make(map[common.Hash]snapshot),
+	}
+	blob, _ := db.Get(snapshotRootKey)
+	if common.BytesToHash(blob) != root {
+		log.Warn("State snapshot missing or stale, regenerating", "root", root)
+		snaps.Rebuild(root)
+		return snaps
+	}
+	base := &diskLayer{db: db, triedb: triedb, root: root}
+	if ok, _ := db.Has(snapshotGeneratorKey); ok {
+		marker, _ := db.Get(snapshotGeneratorKey)
+		base.genMarker = append([]byte{}, marker...)
+		base.startGeneration()
+	}
+	snaps.layers[root] = base
+	log.Info("Loaded state snapshot", "root", root, "generated", base.genMarker == nil)
+	return snaps
+}
+
+// Snapshot retrieves the snapshot of the given state root, or nil if it's not
+// tracked by the tree.
+func (t *Tree) Snapshot(root common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if snap, ok := t.layers[root]; ok {
+		return snap
+	}
+	return nil
+}
+
+// Update adds a diff layer with the given state changes on top of the snapshot
+// of the parent state root.
+func (t *Tree) Update(root, parent common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if _, ok := t.layers[root]; ok {
+		return nil
+	}
+	base, ok := t.layers[parent]
+	if !ok {
+		return fmt.Errorf("%v: parent %x", errSnapshotMissing, parent)
+	}
+	t.layers[root] = newDiffLayer(base, root, destructs, accounts, storage)
+	return nil
+}
+
+// Cap keeps the given number of diff layers below the snapshot of the given state
+// root, merging the older ones into the bottom diff layer, which is flattened into
+// the disk layer if it grows too large, if the disk layer is still being generated
+// or if no layers are to be kept. The layers not built on the new bottom one are
+// discarded.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("%v: %x", errSnapshotMissing, root)
+	}
+	// Gather the diff layers from the top down to the disk one
+	var chain []*diffLayer
+	for {
+		diff, ok := snap.(*diffLayer)
+		if !ok {
+			break
+		}
+		chain = append(chain, diff)
+		snap = diff.Parent()
+	}
+	if len(chain) <= layers {
+		return nil
+	}
+	// Merge the layers past the limit bottom up. The generator works on the state
+	// trie of the disk layer, so while generating, the disk layer is kept at the
+	// oldest state still held in memory.
+	base := snap.(*diskLayer)
+	bottom := chain[len(chain)-1]
+	for i := len(chain) - 2; i >= layers; i-- {
+		bottom = bottom.merge(chain[i])
+	}
+	var kept snapshot = bottom
+	if layers == 0 || bottom.memory > aggregatorMemoryLimit || base.generating() {
+		base = t.flatten(base, bottom)
+		kept = base
+	}
+	if layers > 0 {
+		chain[layers-1].lock.Lock()
+		chain[layers-1].parent = kept
+		chain[layers-1].lock.Unlock()
+	}
+	// Discard all the layers merged or flattened, and the ones built on them
+	stale := t.layers
+	t.layers = map[common.Hash]snapshot{base.root: base, kept.Root(): kept}
+	for root, snap := range stale {
+		if _, ok := t.layers[root]; ok {
+			continue
+		}
+		valid := true
+		for layer := snap; layer != nil; layer = layer.Parent() {
+			if layer.isStale() {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			t.layers[root] = snap
+			continue
+		}
+		snap.markStale()
+	}
+	return nil
+}
+
+// flatten writes the changes of a diff layer into the disk layer below, returning
+// the new disk layer. While generating, only the entries already generated are
+// written, the generator picking up the others from the new state.
+func (t *Tree) flatten(base *diskLayer, diff *diffLayer) *diskLayer {
+	base.stopGeneration()
+	base.markStale()
+	diff.markStale()
+
+	marker := base.genMarker
+	batch := new(leveldb.Batch)
+	for hash := range diff.destructs {
+		if !covered(hash, marker) {
+			continue
+		}
+		batch.Delete(accountKey(hash))
+		it := t.db.LDB().NewIterator(util.BytesPrefix(append(append([]byte{}, StoragePrefix...), hash[:]...)), nil)
+		for it.Next() {
+			batch.Delete(it.Key())
+		}
+		it.Release()
+	}
+	for hash, blob := range diff.accounts {
+		if !covered(hash, marker) {
+			continue
+		}
+		if len(blob) == 0 {
+			batch.Delete(accountKey(hash))
+		} else {
+			batch.Put(accountKey(hash), blob)
+		}
+	}
+	for hash, slots := range diff.storage {
+		if !covered(hash, marker) {
+			continue
+		}
+		for slot, blob := range slots {
+			if len(blob) == 0 {
+				batch.Delete(storageKey(hash, slot))
+			} else {
+				batch.Put(storageKey(hash, slot), blob)
+			}
+		}
+	}
+	batch.Put(snapshotRootKey, diff.root[:])
+	if err := t.db.LDB().Write(batch, nil); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	disk := &diskLayer{db: t.db, triedb: t.triedb, root: diff.root, genMarker: marker}
+	if marker != nil {
+		disk.startGeneration()
+	}
+	return disk
+}
+
+// Rebuild discards all the snapshot layers, and generates the one of the given
+// state root from the trie in the background.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, snap := range t.layers {
+		if disk, ok := snap.(*diskLayer); ok {
+			disk.stopGeneration()
+		}
+		snap.markStale()
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(snapshotRootKey, root[:])
+	batch.Put(snapshotGeneratorKey, []byte{})
+	if err := t.db.LDB().Write(batch, nil); err != nil {
+		log.Crit("Failed to reset state snapshot", "err", err)
+	}
+	base := &diskLayer{db: t.db, triedb: t.triedb, root: root, genMarker: []byte{}}
+	base.startGeneration()
+
+	t.layers = map[common.Hash]snapshot{root: base}
+}
+
+// Release stops the background generation of the disk layer, if running. The
+// generation resumes from where it left off when the tree is opened again.
+func (t *Tree) Release() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, snap := range t.layers {
+		if disk, ok := snap.(*diskLayer); ok {
+			disk.stopGeneration()
+		}
+	}
+}
+
+// accountKey = AccountPrefix + hash
+func accountKey(hash common.Hash) []byte {
+	return append(append([]byte{}, AccountPrefix...), hash[:]...)
+}
+
+// storageKey = StoragePrefix + account hash + slot hash
+func storageKey(accountHash, storageHash common.Hash) []byte {
+	return append(append(append([]byte{}, StoragePrefix...), accountHash[:]...), storageHash[:]...)
+}
+
+// covered returns whether the entries of the given account are generated into the
+// disk layer, given the generator progress marker.
+func covered(hash common.Hash, marker []byte) bool {
+	return marker == nil || bytes.Compare(hash[:], marker) <= 0
+}
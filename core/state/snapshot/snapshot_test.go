@@ -0,0 +1,391 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testState is a state trie with its accounts and storage slots, keyed by hash.
+type testState struct {
+	root     common.Hash
+	accounts map[common.Hash][]byte
+	storage  map[common.Hash]map[common.Hash][]byte
+}
+
+// newTestState writes a state with the given number of accounts into the trie
+// database, every other account holding a few storage slots.
+func newTestState(t *testing.T, triedb *trie.Database, accounts int) *testState {
+	state := &testState{
+		accounts: make(map[common.Hash][]byte),
+		storage:  make(map[common.Hash]map[common.Hash][]byte),
+	}
+	accTrie, _ := trie.New(common.Hash{}, triedb)
+	for i := 0; i < accounts; i++ {
+		hash := crypto.Keccak256Hash([]byte{byte(i), byte(i >> 8)})
+		acc := account{Nonce: uint64(i), Balance: big.NewInt(int64(i)), Root: types.EmptyRootHash, CodeHash: crypto.Keccak256(nil)}
+		if i%2 == 0 {
+			state.storage[hash] = make(map[common.Hash][]byte)
+			stTrie, _ := trie.New(common.Hash{}, triedb)
+			for j := 1; j <= 3; j++ {
+				slot := crypto.Keccak256Hash([]byte{byte(j)})
+				blob, _ := rlp.EncodeToBytes([]byte{byte(i), byte(j)})
+				stTrie.Update(slot[:], blob)
+				state.storage[hash][slot] = blob
+			}
+			acc.Root, _ = stTrie.Commit(nil)
+		}
+		blob, _ := rlp.EncodeToBytes(&acc)
+		accTrie.Update(hash[:], blob)
+		state.accounts[hash] = blob
+	}
+	root, err := accTrie.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit state trie: %v", err)
+	}
+	if err := triedb.Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state trie: %v", err)
+	}
+	state.root = root
+	return state
+}
+
+// newTestDatabase creates a persistent database in a temporary directory.
+func newTestDatabase(t *testing.T) (*ethdb.LDBDatabase, func()) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitGeneration waits until the disk layer of the tree is fully generated.
+func waitGeneration(t *testing.T, snaps *Tree) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		snaps.lock.RLock()
+		var done bool
+		for _, snap := range snaps.layers {
+			if disk, ok := snap.(*diskLayer); ok {
+				disk.lock.RLock()
+				done = disk.genMarker == nil
+				disk.lock.RUnlock()
+			}
+		}
+		snaps.lock.RUnlock()
+		if done {
+			return
+		}
+	}
+	t.Fatalf("snapshot generation timed out")
+}
+
+// checkSnapshot verifies that the snapshot serves exactly the given state.
+func checkSnapshot(t *testing.T, snap Snapshot, state *testState) {
+	for hash, want := range state.accounts {
+		if blob, err := snap.Account(hash); err != nil || !bytes.Equal(blob, want) {
+			t.Errorf("account %x: have %x, %v; want %x", hash, blob, err, want)
+		}
+		for slot, want := range state.storage[hash] {
+			if blob, err := snap.Storage(hash, slot); err != nil || !bytes.Equal(blob, want) {
+				t.Errorf("account %x slot %x: have %x, %v; want %x", hash, slot, blob, err, want)
+			}
+		}
+	}
+	missing := common.HexToHash("0xdeadbeef")
+	if blob, err := snap.Account(missing); err != nil || blob != nil {
+		t.Errorf("missing account: have %x, %v; want nil", blob, err)
+	}
+}
+
+// Tests that a snapshot is generated from the state trie, wiping the stale entries
+// left in the database.
+func TestGeneration(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	triedb := trie.NewDatabase(db)
+	state := newTestState(t, triedb, 300)
+
+	stale := common.HexToHash("0xdeadbeef")
+	db.Put(accountKey(stale), []byte{0x01})
+	db.Put(storageKey(stale, stale), []byte{0x01})
+
+	snaps := New(db, triedb, state.root)
+	defer snaps.Release()
+
+	waitGeneration(t, snaps)
+	checkSnapshot(t, snaps.Snapshot(state.root), state)
+
+	if ok, _ := db.Has(storageKey(stale, stale)); ok {
+		t.Errorf("stale storage entry not wiped")
+	}
+	// Reopen the tree, which must not regenerate the snapshot
+	snaps.Release()
+	db.Put(accountKey(stale), []byte{0x01})
+
+	snaps = New(db, triedb, state.root)
+	if blob, _ := snaps.Snapshot(state.root).Account(stale); !bytes.Equal(blob, []byte{0x01}) {
+		t.Errorf("snapshot regenerated on reopen")
+	}
+}
+
+// Tests that the diff layers shadow the ones below, and that capping the tree
+// flattens them into the disk layer, discarding the side chains.
+func TestDiffLayers(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	triedb := trie.NewDatabase(db)
+	state := newTestState(t, triedb, 10)
+
+	snaps := New(db, triedb, state.root)
+	defer snaps.Release()
+	waitGeneration(t, snaps)
+
+	var hashes []common.Hash
+	for hash := range state.storage {
+		hashes = append(hashes, hash)
+	}
+	var (
+		updated   = hashes[0]
+		destroyed = hashes[1]
+		created   = common.HexToHash("0x01")
+		slot      = common.HexToHash("0x02")
+	)
+	// Layer 1 updates an account, destructs another and creates a new one
+	root1, root2, side := common.HexToHash("0x11"), common.HexToHash("0x12"), common.HexToHash("0x21")
+	err := snaps.Update(root1, state.root,
+		map[common.Hash]struct{}{destroyed: {}},
+		map[common.Hash][]byte{updated: {0x01}, created: {0x02}},
+		map[common.Hash]map[common.Hash][]byte{updated: {slot: {0x03}}},
+	)
+	if err != nil {
+		t.Fatalf("failed to add layer 1: %v", err)
+	}
+	// Layer 2 recreates the destructed account, a side layer deletes the new one
+	snaps.Update(root2, root1, nil, map[common.Hash][]byte{destroyed: {0x04}}, nil)
+	snaps.Update(side, root1, nil, map[common.Hash][]byte{created: nil}, nil)
+
+	if err := snaps.Update(common.HexToHash("0x99"), common.HexToHash("0x98"), nil, nil, nil); err == nil {
+		t.Errorf("layer on missing parent accepted")
+	}
+	check := func(snap Snapshot, hash common.Hash, want []byte) {
+		if blob, err := snap.Account(hash); err != nil || !bytes.Equal(blob, want) {
+			t.Errorf("root %x account %x: have %x, %v; want %x", snap.Root(), hash, blob, err, want)
+		}
+	}
+	checkStorage := func(snap Snapshot, hash, slot common.Hash, want []byte) {
+		if blob, err := snap.Storage(hash, slot); err != nil || !bytes.Equal(blob, want) {
+			t.Errorf("root %x account %x slot %x: have %x, %v; want %x", snap.Root(), hash, slot, blob, err, want)
+		}
+	}
+	oldSlot := crypto.Keccak256Hash([]byte{1}) // present in every account with storage
+	check(snaps.Snapshot(root2), updated, []byte{0x01})
+	check(snaps.Snapshot(root2), created, []byte{0x02})
+	check(snaps.Snapshot(root2), destroyed, []byte{0x04})
+	check(snaps.Snapshot(root1), destroyed, nil)
+	check(snaps.Snapshot(side), created, nil)
+	checkStorage(snaps.Snapshot(root2), updated, slot, []byte{0x03})
+	checkStorage(snaps.Snapshot(root2), updated, oldSlot, state.storage[updated][oldSlot])
+	checkStorage(snaps.Snapshot(root2), destroyed, oldSlot, nil)
+
+	// Cap to a single layer, layer 1 being small enough to stay in memory
+	disk := snaps.Snapshot(state.root)
+	if err := snaps.Cap(root2, 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if snap := snaps.Snapshot(root1); snap == nil {
+		t.Fatalf("bottom layer missing")
+	} else if _, ok := snap.(*diffLayer); !ok {
+		t.Fatalf("bottom layer type mismatch: have %T, want diff layer", snap)
+	}
+	if blob, _ := db.Get(snapshotRootKey); common.BytesToHash(blob) != state.root {
+		t.Errorf("persisted root mismatch: have %x, want %x", blob, state.root)
+	}
+	// Flatten layer 1, the side layer being built on it must be discarded
+	if err := snaps.Cap(root2, 0); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if _, err := disk.Account(updated); err != ErrSnapshotStale {
+		t.Errorf("flattened disk layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if snaps.Snapshot(side) != nil {
+		t.Errorf("side layer not discarded")
+	}
+	if snap := snaps.Snapshot(root2); snap == nil {
+		t.Fatalf("flattened layer missing")
+	} else if _, ok := snap.(*diskLayer); !ok {
+		t.Fatalf("flattened layer type mismatch: have %T, want disk layer", snap)
+	}
+	check(snaps.Snapshot(root2), updated, []byte{0x01})
+	check(snaps.Snapshot(root2), created, []byte{0x02})
+	check(snaps.Snapshot(root2), destroyed, []byte{0x04})
+	checkStorage(snaps.Snapshot(root2), updated, slot, []byte{0x03})
+	checkStorage(snaps.Snapshot(root2), destroyed, oldSlot, nil)
+
+	if ok, _ := db.Has(storageKey(destroyed, oldSlot)); ok {
+		t.Errorf("storage of destructed account not deleted")
+	}
+	if blob, _ := db.Get(snapshotRootKey); common.BytesToHash(blob) != root2 {
+		t.Errorf("persisted root mismatch: have %x, want %x", blob, root2)
+	}
+}
+
+// Tests that capped layers are merged into the bottom diff layer, which is only
+// flattened into the disk layer once it grows too large.
+func TestMergeLayers(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	triedb := trie.NewDatabase(db)
+	state := newTestState(t, triedb, 10)
+
+	snaps := New(db, triedb, state.root)
+	defer snaps.Release()
+	waitGeneration(t, snaps)
+
+	var (
+		recreated = common.HexToHash("0x01")
+		created   = common.HexToHash("0x02")
+		large     = common.HexToHash("0x03")
+		slot      = common.HexToHash("0x04")
+		roots     = []common.Hash{common.HexToHash("0x11"), common.HexToHash("0x12"), common.HexToHash("0x13"), common.HexToHash("0x14"), common.HexToHash("0x15")}
+	)
+	// Create an account with storage, destruct it and recreate it without
+	snaps.Update(roots[0], state.root, nil, map[common.Hash][]byte{recreated: {0x01}}, map[common.Hash]map[common.Hash][]byte{recreated: {slot: {0x01}}})
+	snaps.Update(roots[1], roots[0], map[common.Hash]struct{}{recreated: {}}, map[common.Hash][]byte{created: {0x02}}, nil)
+	snaps.Update(roots[2], roots[1], nil, map[common.Hash][]byte{recreated: {0x03}}, nil)
+
+	if err := snaps.Cap(roots[2], 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if snaps.Snapshot(roots[0]) != nil {
+		t.Errorf("merged layer not discarded")
+	}
+	if snap, ok := snaps.Snapshot(roots[1]).(*diffLayer); !ok {
+		t.Fatalf("bottom layer type mismatch: have %T, want diff layer", snaps.Snapshot(roots[1]))
+	} else if _, ok := snap.Parent().(*diskLayer); !ok {
+		t.Fatalf("bottom layer parent mismatch: have %T, want disk layer", snap.Parent())
+	}
+	if blob, _ := db.Get(snapshotRootKey); common.BytesToHash(blob) != state.root {
+		t.Errorf("persisted root mismatch: have %x, want %x", blob, state.root)
+	}
+	top := snaps.Snapshot(roots[2])
+	if blob, err := top.Account(recreated); err != nil || !bytes.Equal(blob, []byte{0x03}) {
+		t.Errorf("recreated account mismatch: have %x, %v; want 03", blob, err)
+	}
+	if blob, err := top.Account(created); err != nil || !bytes.Equal(blob, []byte{0x02}) {
+		t.Errorf("created account mismatch: have %x, %v; want 02", blob, err)
+	}
+	if blob, err := top.Storage(recreated, slot); err != nil || blob != nil {
+		t.Errorf("recreated account storage mismatch: have %x, %v; want nil", blob, err)
+	}
+	// Grow the bottom layer past the limit and expect it flattened
+	snaps.Update(roots[3], roots[2], nil, map[common.Hash][]byte{large: make([]byte, aggregatorMemoryLimit)}, nil)
+	snaps.Update(roots[4], roots[3], nil, nil, nil)
+
+	if err := snaps.Cap(roots[4], 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if _, ok := snaps.Snapshot(roots[3]).(*diskLayer); !ok {
+		t.Fatalf("flattened layer type mismatch: have %T, want disk layer", snaps.Snapshot(roots[3]))
+	}
+	if blob, _ := db.Get(snapshotRootKey); common.BytesToHash(blob) != roots[3] {
+		t.Errorf("persisted root mismatch: have %x, want %x", blob, roots[3])
+	}
+	if blob, _ := db.Get(accountKey(recreated)); !bytes.Equal(blob, []byte{0x03}) {
+		t.Errorf("persisted account mismatch: have %x, want 03", blob)
+	}
+	if ok, _ := db.Has(storageKey(recreated, slot)); ok {
+		t.Errorf("storage of destructed account persisted")
+	}
+}
+
+// Tests that layers flattened while generating write only the generated entries,
+// the generator picking up the rest from the new state.
+func TestFlattenWhileGenerating(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	triedb := trie.NewDatabase(db)
+	state := newTestState(t, triedb, 10)
+
+	// Pretend half of the state is generated
+	snaps := New(db, triedb, state.root)
+	waitGeneration(t, snaps)
+	snaps.Release()
+
+	var hashes []common.Hash
+	for hash := range state.accounts {
+		hashes = append(hashes, hash)
+	}
+	first, last := hashes[0], hashes[0]
+	for _, hash := range hashes {
+		if bytes.Compare(hash[:], first[:]) < 0 {
+			first = hash
+		}
+		if bytes.Compare(hash[:], last[:]) > 0 {
+			last = hash
+		}
+	}
+	db.Put(snapshotGeneratorKey, first[:])
+	db.Delete(accountKey(last))
+
+	snaps = New(db, triedb, state.root)
+	defer snaps.Release()
+
+	// Flatten a layer changing both a generated and a pending account, making
+	// sure the new state is built from the trie as well
+	next := newTestState(t, triedb, 12)
+	var (
+		accounts = make(map[common.Hash][]byte)
+		storage  = make(map[common.Hash]map[common.Hash][]byte)
+	)
+	for hash, blob := range next.accounts {
+		if !bytes.Equal(state.accounts[hash], blob) {
+			accounts[hash] = blob
+			if _, ok := state.storage[hash]; !ok && next.storage[hash] != nil {
+				storage[hash] = next.storage[hash]
+			}
+		}
+	}
+	snaps.Update(next.root, state.root, nil, accounts, storage)
+	if err := snaps.Cap(next.root, 0); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	waitGeneration(t, snaps)
+	checkSnapshot(t, snaps.Snapshot(next.root), next)
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -172,10 +173,27 @@ func (c *stateObject) getTrie(db Database) Trie {
 func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 	value, exists := self.cachedStorage[key]
 	if exists {
+		self.db.stats.StorageCacheHits++
 		return value
 	}
-	// Load from DB in case it is missing.
-	enc, err := self.getTrie(db).TryGet(key[:])
+	// Load from the snapshot if available, or from the trie. The storage of
+	// a destructed account is gone, even if still in the snapshot.
+	var (
+		enc   []byte
+		err   error
+		start = time.Now()
+	)
+	self.db.stats.StorageReads++
+	if self.db.snap != nil {
+		if _, destructed := self.db.snapDestructs[self.addrHash]; destructed {
+			return common.Hash{}
+		}
+		enc, err = self.db.snap.Storage(self.addrHash, crypto.Keccak256Hash(key[:]))
+	}
+	if self.db.snap == nil || err != nil {
+		enc, err = self.getTrie(db).TryGet(key[:])
+	}
+	self.db.stats.StorageReadTime += time.Since(start)
 	if err != nil {
 		self.setError(err)
 		return common.Hash{}
@@ -213,18 +231,56 @@ func (self *stateObject) setState(key, value common.Hash) {
 	}
 }
 
-// updateTrie writes cached storage modifications into the object's storage trie.
+// SetStorage replaces the entire account storage with the given one, discarding
+// the existing storage trie.
+func (self *stateObject) SetStorage(db Database, storage map[common.Hash]common.Hash) {
+	tr, err := db.OpenStorageTrie(self.addrHash, common.Hash{})
+	if err != nil {
+		self.setError(err)
+		return
+	}
+	self.trie = tr
+	self.cachedStorage = make(Storage)
+	self.dirtyStorage = make(Storage)
+	if self.db.snap != nil {
+		self.db.snapDestructs[self.addrHash] = struct{}{}
+		delete(self.db.snapStorage, self.addrHash)
+	}
+	for key, value := range storage {
+		self.setState(key, value)
+	}
+	if self.onDirty != nil {
+		self.onDirty(self.Address())
+		self.onDirty = nil
+	}
+}
+
+// updateTrie writes cached storage modifications into the object's storage trie,
+// tracking them for the snapshot too.
 func (self *stateObject) updateTrie(db Database) Trie {
+	var storage map[common.Hash][]byte
+	if self.db.snap != nil && len(self.dirtyStorage) > 0 {
+		if storage = self.db.snapStorage[self.addrHash]; storage == nil {
+			storage = make(map[common.Hash][]byte)
+			self.db.snapStorage[self.addrHash] = storage
+		}
+	}
 	tr := self.getTrie(db)
 	for key, value := range self.dirtyStorage {
 		delete(self.dirtyStorage, key)
+		self.db.stats.StorageWrites++
+
+		var v []byte
 		if (value == common.Hash{}) {
 			self.setError(tr.TryDelete(key[:]))
-			continue
+		} else {
+			// Encoding []byte cannot fail, ok to ignore the error.
+			v, _ = rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+			self.setError(tr.TryUpdate(key[:], v))
+		}
+		if storage != nil {
+			storage[crypto.Keccak256Hash(key[:])] = v
 		}
-		// Encoding []byte cannot fail, ok to ignore the error.
-		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
-		self.setError(tr.TryUpdate(key[:], v))
 	}
 	return tr
 }
@@ -32,7 +32,10 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 // Tests that updating a state trie does not leak any database writes prior to
@@ -421,3 +424,88 @@ func (s *StateSuite) TestTouchDelete(c *check.C) {
 		c.Fatal("expected no dirty state object")
 	}
 }
+
+// Tests that the account and storage proofs verify against the state root.
+func TestProof(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+	state, _ := New(common.Hash{}, sdb)
+
+	addr := common.BytesToAddress([]byte{0x01})
+	for i := byte(0); i < 16; i++ {
+		other := common.BytesToAddress([]byte{0x02, i})
+		state.AddBalance(other, big.NewInt(int64(i)+1))
+		state.SetState(addr, common.BytesToHash([]byte{i}), common.BytesToHash([]byte{i + 1}))
+	}
+	state.AddBalance(addr, big.NewInt(42))
+	root, _ := state.Commit(false)
+	state, _ = New(root, sdb)
+
+	// toProofDb indexes the nodes of a proof by their hash
+	toProofDb := func(proof [][]byte) *ethdb.MemDatabase {
+		proofDb, _ := ethdb.NewMemDatabase()
+		for _, node := range proof {
+			proofDb.Put(crypto.Keccak256(node), node)
+		}
+		return proofDb
+	}
+	proof, err := state.GetProof(addr)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	blob, err, _ := trie.VerifyProof(root, crypto.Keccak256(addr.Bytes()), toProofDb(proof))
+	if err != nil {
+		t.Fatalf("failed to verify account proof: %v", err)
+	}
+	var account Account
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		t.Fatalf("failed to decode proven account: %v", err)
+	}
+	if account.Balance.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("proven balance mismatch: have %v, want %v", account.Balance, 42)
+	}
+	key := common.BytesToHash([]byte{3})
+	if proof, err = state.GetStorageProof(addr, key); err != nil {
+		t.Fatalf("failed to prove storage: %v", err)
+	}
+	if blob, err, _ = trie.VerifyProof(account.Root, crypto.Keccak256(key.Bytes()), toProofDb(proof)); err != nil {
+		t.Fatalf("failed to verify storage proof: %v", err)
+	}
+	_, content, _, _ := rlp.Split(blob)
+	if value := common.BytesToHash(content); value != common.BytesToHash([]byte{4}) {
+		t.Errorf("proven storage mismatch: have %x, want %x", value, []byte{4})
+	}
+	// Non-existent accounts have an empty storage proof
+	if proof, err = state.GetStorageProof(common.Address{0xff}, key); err != nil || len(proof) != 0 {
+		t.Errorf("non-existent account storage proof: have %d nodes (%v), want none", len(proof), err)
+	}
+}
+
+// Tests that replacing the storage of an account discards all its previous slots.
+func TestSetStorage(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+	state, _ := New(common.Hash{}, sdb)
+
+	addr := common.BytesToAddress([]byte{0x01})
+	state.SetState(addr, common.Hash{0x01}, common.Hash{0x01})
+	state.SetState(addr, common.Hash{0x02}, common.Hash{0x02})
+	root, _ := state.Commit(false)
+	state, _ = New(root, sdb)
+
+	state.SetStorage(addr, map[common.Hash]common.Hash{{0x02}: {0x03}, {0x04}: {0x04}})
+	want := map[common.Hash]common.Hash{{0x01}: {}, {0x02}: {0x03}, {0x04}: {0x04}}
+	for key, value := range want {
+		if have := state.GetState(addr, key); have != value {
+			t.Errorf("slot %x: value mismatch: have %x, want %x", key, have, value)
+		}
+	}
+	// The replaced storage is committed as a fresh trie
+	root, _ = state.Commit(false)
+	state, _ = New(root, sdb)
+	for key, value := range want {
+		if have := state.GetState(addr, key); have != value {
+			t.Errorf("committed slot %x: value mismatch: have %x, want %x", key, have, value)
+		}
+	}
+}
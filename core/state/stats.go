@@ -0,0 +1,42 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import "time"
+
+// Stats are the state accesses done through a StateDB and the time spent on them,
+// gathered for profiling the block imports. Reads are the accesses missing the
+// live objects and storage caches, going to the snapshot or the tries.
+type Stats struct {
+	AccountReads     int `json:"accountReads"`     // Accounts loaded from the snapshot or the trie
+	AccountCacheHits int `json:"accountCacheHits"` // Account accesses served by the live objects
+	AccountWrites    int `json:"accountWrites"`    // Accounts updated or deleted in the trie
+	StorageReads     int `json:"storageReads"`     // Storage slots loaded from the snapshot or the tries
+	StorageCacheHits int `json:"storageCacheHits"` // Storage accesses served by the object caches
+	StorageWrites    int `json:"storageWrites"`    // Storage slots updated or deleted in the tries
+
+	AccountReadTime time.Duration `json:"accountReadTime"` // Time spent loading accounts
+	StorageReadTime time.Duration `json:"storageReadTime"` // Time spent loading storage slots
+	HashTime        time.Duration `json:"hashTime"`        // Time spent updating and hashing the tries
+	CommitTime      time.Duration `json:"commitTime"`      // Time spent committing the tries
+}
+
+// Stats returns the state accesses done since the creation or the last reset of
+// the state.
+func (self *StateDB) Stats() Stats {
+	return self.stats
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// Tests that the state accesses are counted as reads or cache hits, and that the
+// trie updates are counted as writes.
+func TestStats(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	sdb := NewDatabase(db)
+
+	var (
+		addr = common.HexToAddress("0x01")
+		slot = common.HexToHash("0x02")
+	)
+	state, _ := New(common.Hash{}, sdb)
+	state.SetNonce(addr, 1)
+	state.SetState(addr, slot, common.HexToHash("0x03"))
+	root, err := state.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if stats := state.Stats(); stats.AccountWrites != 1 || stats.StorageWrites != 1 {
+		t.Fatalf("write count mismatch: have %d accounts, %d slots, want 1, 1", stats.AccountWrites, stats.StorageWrites)
+	}
+	state, _ = New(root, sdb)
+	for i := 0; i < 2; i++ {
+		state.GetNonce(addr)
+		state.GetState(addr, slot)
+	}
+	stats := state.Stats()
+	if stats.AccountReads != 1 || stats.AccountCacheHits != 3 {
+		t.Errorf("account access mismatch: have %d reads, %d hits, want 1, 3", stats.AccountReads, stats.AccountCacheHits)
+	}
+	if stats.StorageReads != 1 || stats.StorageCacheHits != 1 {
+		t.Errorf("storage access mismatch: have %d reads, %d hits, want 1, 1", stats.StorageReads, stats.StorageCacheHits)
+	}
+	if stats.AccountWrites != 0 || stats.StorageWrites != 0 {
+		t.Errorf("writes counted on reads: %d accounts, %d slots", stats.AccountWrites, stats.StorageWrites)
+	}
+	state.Reset(root)
+	if stats := state.Stats(); stats != (Stats{}) {
+		t.Errorf("stats not cleared on reset: %+v", stats)
+	}
+}
@@ -40,23 +40,38 @@ type devNull struct{}
 func (*devNull) Write(p []byte) (n int, err error) { return len(p), nil }
 func (*devNull) Close() error                      { return nil }
 
+// journalEntry is a transaction stored in the journal along with its status in
+// the pool, allowing to restore remote transactions too.
+type journalEntry struct {
+	Tx      *types.Transaction
+	Local   bool   // Whether the transaction was sent from a local account
+	Pending bool   // Whether the transaction was executable when journaled
+	Time    uint64 // Arrival time of the transaction in the pool (Unix seconds)
+}
+
 // txJournal is a rotating log of transactions with the aim of storing locally
 // created transactions to allow non-executed ones to survive node restarts.
+//
+// If full, the journal stores all the transactions of the pool along with their
+// status, otherwise only the local transactions as is.
 type txJournal struct {
 	path   string         // Filesystem path to store the transactions at
+	full   bool           // Whether to store the entries of all transactions
 	writer io.WriteCloser // Output stream to write new transactions into
 }
 
 // newTxJournal creates a new transaction journal to
-func newTxJournal(path string) *txJournal {
+func newTxJournal(path string, full bool) *txJournal {
 	return &txJournal{
 		path: path,
+		full: full,
 	}
 }
 
 // load parses a transaction journal dump from disk, loading its contents into
-// the specified pool.
-func (journal *txJournal) load(add func(*types.Transaction) error) error {
+// the specified pool. Plain transactions are loaded as local ones without known
+// arrival time, allowing to switch between journal modes.
+func (journal *txJournal) load(add func(*journalEntry) error) error {
 	// Skip the parsing if the journal file doens't exist at all
 	if _, err := os.Stat(journal.path); os.IsNotExist(err) {
 		return nil
@@ -79,40 +94,56 @@ func (journal *txJournal) load(add func(*types.Transaction) error) error {
 	var failure error
 	for {
 		// Parse the next transaction and terminate on error
-		tx := new(types.Transaction)
-		if err = stream.Decode(tx); err != nil {
+		blob, err := stream.Raw()
+		if err != nil {
 			if err != io.EOF {
 				failure = err
 			}
 			break
 		}
+		entry := new(journalEntry)
+		if tx := new(types.Transaction); rlp.DecodeBytes(blob, tx) == nil {
+			entry.Tx, entry.Local = tx, true
+		} else if err = rlp.DecodeBytes(blob, entry); err != nil {
+			failure = err
+			break
+		}
 		// Import the transaction and bump the appropriate progress counters
 		total++
-		if err = add(tx); err != nil {
+		if err = add(entry); err != nil {
 			log.Debug("Failed to add journaled transaction", "err", err)
 			dropped++
 			continue
 		}
 	}
-	log.Info("Loaded local transaction journal", "transactions", total, "dropped", dropped)
+	log.Info("Loaded transaction journal", "transactions", total, "dropped", dropped)
 
 	return failure
 }
 
 // insert adds the specified transaction to the local disk journal.
-func (journal *txJournal) insert(tx *types.Transaction) error {
+func (journal *txJournal) insert(entry *journalEntry) error {
 	if journal.writer == nil {
 		return errNoActiveJournal
 	}
-	if err := rlp.Encode(journal.writer, tx); err != nil {
+	if err := journal.encode(journal.writer, entry); err != nil {
 		return err
 	}
 	return nil
 }
 
+// encode writes a transaction into the journal, along with its status if the
+// journal is a full one.
+func (journal *txJournal) encode(w io.Writer, entry *journalEntry) error {
+	if journal.full {
+		return rlp.Encode(w, entry)
+	}
+	return rlp.Encode(w, entry.Tx)
+}
+
 // rotate regenerates the transaction journal based on the current contents of
 // the transaction pool.
-func (journal *txJournal) rotate(all map[common.Address]types.Transactions) error {
+func (journal *txJournal) rotate(all map[common.Address][]*journalEntry) error {
 	// Close the current journal (if any is open)
 	if journal.writer != nil {
 		if err := journal.writer.Close(); err != nil {
@@ -126,14 +157,14 @@ func (journal *txJournal) rotate(all map[common.Address]types.Transactions) erro
 		return err
 	}
 	journaled := 0
-	for _, txs := range all {
-		for _, tx := range txs {
-			if err = rlp.Encode(replacement, tx); err != nil {
+	for _, entries := range all {
+		for _, entry := range entries {
+			if err = journal.encode(replacement, entry); err != nil {
 				replacement.Close()
 				return err
 			}
 		}
-		journaled += len(txs)
+		journaled += len(entries)
 	}
 	replacement.Close()
 
@@ -146,7 +177,7 @@ func (journal *txJournal) rotate(all map[common.Address]types.Transactions) erro
 		return err
 	}
 	journal.writer = sink
-	log.Info("Regenerated local transaction journal", "transactions", journaled, "accounts", len(all))
+	log.Info("Regenerated transaction journal", "transactions", journaled, "accounts", len(all))
 
 	return nil
 }
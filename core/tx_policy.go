@@ -0,0 +1,284 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Types of the transaction admission policies.
+const (
+	TxPolicySenders    = "senders"    // Only the listed accounts may send transactions
+	TxPolicyRecipients = "recipients" // Only the listed accounts may receive calls or value
+	TxPolicyCreation   = "creation"   // Only the listed accounts may create contracts
+	TxPolicySelectors  = "selectors"  // Calls to the listed method selectors are rejected
+	TxPolicyRateLimit  = "ratelimit"  // Accounts may only send a limited number of transactions per period
+)
+
+// rateLimitSweepThreshold is the number of tracked accounts above which the rate
+// limit policy drops the windows of the idle ones.
+const rateLimitSweepThreshold = 4096
+
+var (
+	// ErrSenderNotAllowed is returned if the sender of a transaction isn't in the
+	// sender allow-list of the pool.
+	ErrSenderNotAllowed = errors.New("sender not allowed")
+
+	// ErrRecipientNotAllowed is returned if the recipient of a transaction isn't
+	// in the recipient allow-list of the pool.
+	ErrRecipientNotAllowed = errors.New("recipient not allowed")
+
+	// ErrCreationNotAllowed is returned if a transaction creates a contract while
+	// its sender isn't allowed to.
+	ErrCreationNotAllowed = errors.New("contract creation not allowed")
+
+	// ErrSelectorRejected is returned if a transaction calls a method rejected by
+	// the pool.
+	ErrSelectorRejected = errors.New("method selector rejected")
+
+	// ErrRateLimited is returned if the sender of a transaction exceeded the number
+	// of transactions it may send per period.
+	ErrRateLimited = errors.New("sender rate limit exceeded")
+)
+
+// TxPolicyConfig is the configuration of a transaction admission policy. The
+// Accounts are the allowed senders, recipients or contract creators of the policies
+// of those types; for the selectors policy they restrict the rejected Selectors
+// to the calls of the listed contracts, and they are exempt from the ratelimit
+// policy allowing Limit transactions per account and Period. Contract creations
+// are not subject to the recipients policy.
+type TxPolicyConfig struct {
+	Type      string           `json:"type"`
+	Accounts  []common.Address `json:"accounts,omitempty" toml:",omitempty"`
+	Selectors []hexutil.Bytes  `json:"selectors,omitempty" toml:",omitempty"`
+	Limit     uint64           `json:"limit,omitempty" toml:",omitempty"`
+	Period    time.Duration    `json:"period,omitempty" toml:",omitempty"`
+}
+
+// TxPolicy is an admission rule transactions must pass to enter the pool, on top
+// of the built-in validation rules.
+type TxPolicy interface {
+	// Admit checks whether a transaction of the given sender may enter the pool,
+	// returning the reason of its rejection otherwise.
+	Admit(tx *types.Transaction, from common.Address) error
+}
+
+// TxPolicyRecorder is implemented by the admission policies keeping track of the
+// transactions entering the pool, such as the rate limits.
+type TxPolicyRecorder interface {
+	// Record notes that a transaction of the given sender passed all the policies
+	// and got added to the pool.
+	Record(tx *types.Transaction, from common.Address)
+}
+
+// NewTxPolicy creates a transaction admission policy from its configuration.
+func NewTxPolicy(config TxPolicyConfig) (TxPolicy, error) {
+	accounts := make(map[common.Address]struct{}, len(config.Accounts))
+	for _, account := range config.Accounts {
+		accounts[account] = struct{}{}
+	}
+	switch config.Type {
+	case TxPolicySenders:
+		return &senderPolicy{allowed: accounts}, nil
+
+	case TxPolicyRecipients:
+		return &recipientPolicy{allowed: accounts}, nil
+
+	case TxPolicyCreation:
+		return &creationPolicy{allowed: accounts}, nil
+
+	case TxPolicySelectors:
+		if len(config.Selectors) == 0 {
+			return nil, errors.New("selectors policy without selectors")
+		}
+		selectors := make(map[[4]byte]struct{}, len(config.Selectors))
+		for _, selector := range config.Selectors {
+			if len(selector) != 4 {
+				return nil, fmt.Errorf("invalid method selector %x", []byte(selector))
+			}
+			var key [4]byte
+			copy(key[:], selector)
+			selectors[key] = struct{}{}
+		}
+		return &selectorPolicy{selectors: selectors, contracts: accounts}, nil
+
+	case TxPolicyRateLimit:
+		if config.Limit == 0 || config.Period <= 0 {
+			return nil, errors.New("ratelimit policy requires a positive limit and period")
+		}
+		return &rateLimitPolicy{
+			limit:   config.Limit,
+			period:  config.Period,
+			exempt:  accounts,
+			windows: make(map[common.Address]*rateWindow),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown transaction policy type %q", config.Type)
+}
+
+// NewTxPolicies creates an ordered chain of transaction admission policies from
+// their configurations.
+func NewTxPolicies(configs []TxPolicyConfig) ([]TxPolicy, error) {
+	policies := make([]TxPolicy, 0, len(configs))
+	for i, config := range configs {
+		policy, err := NewTxPolicy(config)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: %v", i, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// senderPolicy admits the transactions of the allowed senders only.
+type senderPolicy struct {
+	allowed map[common.Address]struct{}
+}
+
+// Admit implements TxPolicy.
+func (p *senderPolicy) Admit(tx *types.Transaction, from common.Address) error {
+	if _, ok := p.allowed[from]; !ok {
+		return ErrSenderNotAllowed
+	}
+	return nil
+}
+
+// recipientPolicy admits the transactions to the allowed recipients only, along
+// with the contract creations.
+type recipientPolicy struct {
+	allowed map[common.Address]struct{}
+}
+
+// Admit implements TxPolicy.
+func (p *recipientPolicy) Admit(tx *types.Transaction, from common.Address) error {
+	if to := tx.To(); to != nil {
+		if _, ok := p.allowed[*to]; !ok {
+			return ErrRecipientNotAllowed
+		}
+	}
+	return nil
+}
+
+// creationPolicy admits the contract creations of the allowed senders only.
+type creationPolicy struct {
+	allowed map[common.Address]struct{}
+}
+
+// Admit implements TxPolicy.
+func (p *creationPolicy) Admit(tx *types.Transaction, from common.Address) error {
+	if tx.To() == nil {
+		if _, ok := p.allowed[from]; !ok {
+			return ErrCreationNotAllowed
+		}
+	}
+	return nil
+}
+
+// selectorPolicy rejects the calls to the listed method selectors, of the listed
+// contracts if any.
+type selectorPolicy struct {
+	selectors map[[4]byte]struct{}
+	contracts map[common.Address]struct{}
+}
+
+// Admit implements TxPolicy.
+func (p *selectorPolicy) Admit(tx *types.Transaction, from common.Address) error {
+	to, data := tx.To(), tx.Data()
+	if to == nil || len(data) < 4 {
+		return nil
+	}
+	if len(p.contracts) > 0 {
+		if _, ok := p.contracts[*to]; !ok {
+			return nil
+		}
+	}
+	var selector [4]byte
+	copy(selector[:], data)
+	if _, ok := p.selectors[selector]; ok {
+		return ErrSelectorRejected
+	}
+	return nil
+}
+
+// rateWindow is the number of transactions admitted from an account since the
+// start of its current rate limit period.
+type rateWindow struct {
+	start time.Time
+	count uint64
+}
+
+// rateLimitPolicy admits a limited number of transactions per account and period.
+type rateLimitPolicy struct {
+	limit  uint64
+	period time.Duration
+	exempt map[common.Address]struct{}
+
+	windows map[common.Address]*rateWindow
+	lock    sync.Mutex
+}
+
+// Admit implements TxPolicy, checking the sender has transactions left in its
+// current period. They are only counted once recorded.
+func (p *rateLimitPolicy) Admit(tx *types.Transaction, from common.Address) error {
+	if _, ok := p.exempt[from]; ok {
+		return nil
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.window(from, time.Now()).count >= p.limit {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Record implements TxPolicyRecorder, counting the added transaction in the
+// current period of its sender.
+func (p *rateLimitPolicy) Record(tx *types.Transaction, from common.Address) {
+	if _, ok := p.exempt[from]; ok {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.window(from, time.Now()).count++
+}
+
+// window returns the current rate limit period of an account, starting a new one
+// if the previous expired. The lock must be held.
+func (p *rateLimitPolicy) window(from common.Address, now time.Time) *rateWindow {
+	if len(p.windows) >= rateLimitSweepThreshold {
+		for account, window := range p.windows {
+			if now.Sub(window.start) >= p.period {
+				delete(p.windows, account)
+			}
+		}
+	}
+	window := p.windows[from]
+	if window == nil || now.Sub(window.start) >= p.period {
+		window = &rateWindow{start: now}
+		p.windows[from] = window
+	}
+	return window
+}
@@ -0,0 +1,201 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the admission policies accept and reject the transactions as
+// configured.
+func TestTxPolicies(t *testing.T) {
+	var (
+		alice    = common.HexToAddress("0xa1")
+		bob      = common.HexToAddress("0xb0")
+		contract = common.HexToAddress("0xc0")
+		transfer = hexutil.MustDecode("0xa9059cbb")
+		approve  = hexutil.MustDecode("0x095ea7b3")
+	)
+	call := func(to *common.Address, data []byte) *types.Transaction {
+		if to == nil {
+			return types.NewContractCreation(0, big.NewInt(0), 100000, big.NewInt(1), data)
+		}
+		return types.NewTransaction(0, *to, big.NewInt(0), 100000, big.NewInt(1), data)
+	}
+	tests := []struct {
+		config TxPolicyConfig
+		tx     *types.Transaction
+		from   common.Address
+		err    error
+	}{
+		{TxPolicyConfig{Type: TxPolicySenders, Accounts: []common.Address{alice}}, call(&bob, nil), alice, nil},
+		{TxPolicyConfig{Type: TxPolicySenders, Accounts: []common.Address{alice}}, call(&bob, nil), bob, ErrSenderNotAllowed},
+		{TxPolicyConfig{Type: TxPolicyRecipients, Accounts: []common.Address{contract}}, call(&contract, nil), alice, nil},
+		{TxPolicyConfig{Type: TxPolicyRecipients, Accounts: []common.Address{contract}}, call(&bob, nil), alice, ErrRecipientNotAllowed},
+		{TxPolicyConfig{Type: TxPolicyRecipients, Accounts: []common.Address{contract}}, call(nil, nil), alice, nil},
+		{TxPolicyConfig{Type: TxPolicyCreation, Accounts: []common.Address{alice}}, call(nil, nil), alice, nil},
+		{TxPolicyConfig{Type: TxPolicyCreation, Accounts: []common.Address{alice}}, call(nil, nil), bob, ErrCreationNotAllowed},
+		{TxPolicyConfig{Type: TxPolicyCreation}, call(&bob, nil), bob, nil},
+		{TxPolicyConfig{Type: TxPolicySelectors, Selectors: []hexutil.Bytes{approve}}, call(&contract, transfer), alice, nil},
+		{TxPolicyConfig{Type: TxPolicySelectors, Selectors: []hexutil.Bytes{approve}}, call(&contract, append(approve, 0x01)), alice, ErrSelectorRejected},
+		{TxPolicyConfig{Type: TxPolicySelectors, Selectors: []hexutil.Bytes{approve}, Accounts: []common.Address{bob}}, call(&contract, approve), alice, nil},
+		{TxPolicyConfig{Type: TxPolicySelectors, Selectors: []hexutil.Bytes{approve}, Accounts: []common.Address{contract}}, call(&contract, approve), alice, ErrSelectorRejected},
+		{TxPolicyConfig{Type: TxPolicySelectors, Selectors: []hexutil.Bytes{approve}}, call(nil, approve), alice, nil},
+	}
+	for i, tt := range tests {
+		policy, err := NewTxPolicy(tt.config)
+		if err != nil {
+			t.Fatalf("test %d: failed to create policy: %v", i, err)
+		}
+		if err := policy.Admit(tt.tx, tt.from); err != tt.err {
+			t.Errorf("test %d: admission mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Invalid configurations must be refused
+	for i, config := range []TxPolicyConfig{
+		{Type: "unknown"},
+		{Type: TxPolicySelectors},
+		{Type: TxPolicySelectors, Selectors: []hexutil.Bytes{{0x01}}},
+		{Type: TxPolicyRateLimit, Limit: 1},
+		{Type: TxPolicyRateLimit, Period: time.Second},
+	} {
+		if _, err := NewTxPolicy(config); err == nil {
+			t.Errorf("invalid config %d: policy created", i)
+		}
+	}
+}
+
+// Tests that the rate limit policy admits a limited number of transactions per
+// account and period.
+func TestTxPolicyRateLimit(t *testing.T) {
+	var (
+		alice = common.HexToAddress("0xa1")
+		bob   = common.HexToAddress("0xb0")
+		tx    = types.NewTransaction(0, bob, big.NewInt(0), 100000, big.NewInt(1), nil)
+	)
+	policy, err := NewTxPolicy(TxPolicyConfig{Type: TxPolicyRateLimit, Limit: 2, Period: 100 * time.Millisecond, Accounts: []common.Address{bob}})
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	recorder := policy.(TxPolicyRecorder)
+
+	// Transactions are only counted once recorded
+	for i := 0; i < 5; i++ {
+		if err := policy.Admit(tx, alice); err != nil {
+			t.Fatalf("unrecorded transaction %d: rejected: %v", i, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := policy.Admit(tx, alice); err != nil {
+			t.Fatalf("transaction %d: rejected: %v", i, err)
+		}
+		recorder.Record(tx, alice)
+	}
+	if err := policy.Admit(tx, alice); err != ErrRateLimited {
+		t.Fatalf("transaction over limit: admission mismatch: have %v, want %v", err, ErrRateLimited)
+	}
+	for i := 0; i < 5; i++ {
+		if err := policy.Admit(tx, bob); err != nil {
+			t.Fatalf("exempt transaction %d: rejected: %v", i, err)
+		}
+		recorder.Record(tx, bob)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if err := policy.Admit(tx, alice); err != nil {
+		t.Fatalf("transaction in new period: rejected: %v", err)
+	}
+}
+
+// Tests that the transaction pool applies its admission policies, and that they
+// can be replaced at runtime.
+func TestTransactionPoolPolicies(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	other, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+
+	policies := []TxPolicyConfig{
+		{Type: TxPolicySenders, Accounts: []common.Address{crypto.PubkeyToAddress(other.PublicKey)}},
+	}
+	if err := pool.SetPolicies(policies); err != nil {
+		t.Fatalf("failed to set policies: %v", err)
+	}
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != ErrSenderNotAllowed {
+		t.Fatalf("remote transaction: admission mismatch: have %v, want %v", err, ErrSenderNotAllowed)
+	}
+	if err := pool.AddLocal(transaction(0, 100000, key)); err != ErrSenderNotAllowed {
+		t.Fatalf("local transaction: admission mismatch: have %v, want %v", err, ErrSenderNotAllowed)
+	}
+	if have := pool.Policies(); len(have) != 1 || have[0].Type != TxPolicySenders {
+		t.Fatalf("policies mismatch: have %v, want %v", have, policies)
+	}
+	// Invalid policies must leave the current ones in place
+	if err := pool.SetPolicies([]TxPolicyConfig{{Type: "unknown"}}); err == nil {
+		t.Fatalf("invalid policies set")
+	}
+	if have := pool.Policies(); len(have) != 1 {
+		t.Fatalf("policies changed by invalid update: %v", have)
+	}
+	// Allow the sender, the transaction must be admitted
+	policies[0].Accounts = append(policies[0].Accounts, from)
+	if err := pool.SetPolicies(policies); err != nil {
+		t.Fatalf("failed to set policies: %v", err)
+	}
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("allowed transaction rejected: %v", err)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the transactions rejected by the pool after passing the admission
+// policies don't count against the rate limit of their sender.
+func TestTransactionPoolRateLimit(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	if err := pool.SetPolicies([]TxPolicyConfig{{Type: TxPolicyRateLimit, Limit: 2, Period: time.Hour}}); err != nil {
+		t.Fatalf("failed to set policies: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("first transaction rejected: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100001, big.NewInt(1), key)); err != ErrReplaceUnderpriced {
+		t.Fatalf("replacement: admission mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("second transaction rejected: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(1), key)); err != ErrRateLimited {
+		t.Fatalf("transaction over limit: admission mismatch: have %v, want %v", err, ErrRateLimited)
+	}
+}
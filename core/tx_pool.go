@@ -129,6 +129,8 @@ type TxPoolConfig struct {
 	Journal   string        // Journal of local transactions to survive node restarts
 	Rejournal time.Duration // Time interval to regenerate the local transaction journal
 
+	JournalRemotes bool // Whether to journal the remote transactions too, restoring the whole pool on restart
+
 	PriceLimit uint64 // Minimum gas price to enforce for acceptance into the pool
 	PriceBump  uint64 // Minimum price bump percentage to replace an already existing transaction (nonce)
 
@@ -138,6 +140,8 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Policies []TxPolicyConfig `toml:",omitempty"` // Ordered admission policies transactions must pass to enter the pool
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -199,13 +203,15 @@ type TxPool struct {
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals   *accountSet // Set of local transaction to exempt from eviction rules
+	journal  *txJournal  // Journal of local transaction to back up to disk
+	policies []TxPolicy  // Ordered admission policies of the new transactions
 
 	pending map[common.Address]*txList         // All currently processable transactions
 	queue   map[common.Address]*txList         // Queued but non-processable transactions
 	beats   map[common.Address]time.Time       // Last heartbeat from each known account
 	all     map[common.Hash]*types.Transaction // All transactions to allow lookups
+	arrival map[common.Hash]time.Time          // Arrival time of the transactions, to journal them
 	priced  *txPricedList                      // All transactions sorted by price
 
 	wg sync.WaitGroup // for shutdown sync
@@ -229,21 +235,29 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:       make(map[common.Address]*txList),
 		beats:       make(map[common.Address]time.Time),
 		all:         make(map[common.Hash]*types.Transaction),
+		arrival:     make(map[common.Hash]time.Time),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 	}
 	pool.locals = newAccountSet(pool.signer)
 	pool.priced = newTxPricedList(&pool.all)
+
+	policies, err := NewTxPolicies(config.Policies)
+	if err != nil {
+		log.Error("Invalid transaction pool policies, ignoring", "err", err)
+		pool.config.Policies = nil
+	}
+	pool.policies = policies
 	pool.reset(nil, chain.CurrentBlock().Header())
 
-	// If local transactions and journaling is enabled, load from disk
-	if !config.NoLocals && config.Journal != "" {
-		pool.journal = newTxJournal(config.Journal)
+	// If local or remote transactions and journaling is enabled, load from disk
+	if (!config.NoLocals || config.JournalRemotes) && config.Journal != "" {
+		pool.journal = newTxJournal(config.Journal, config.JournalRemotes)
 
-		if err := pool.journal.load(pool.AddLocal); err != nil {
+		if err := pool.journal.load(pool.addJournaled); err != nil {
 			log.Warn("Failed to load transaction journal", "err", err)
 		}
-		if err := pool.journal.rotate(pool.local()); err != nil {
+		if err := pool.journal.rotate(pool.journaled()); err != nil {
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
@@ -324,14 +338,20 @@ func (pool *TxPool) loop() {
 					}
 				}
 			}
+			// Forget the arrival time of the transactions gone from the pool
+			for hash := range pool.arrival {
+				if pool.all[hash] == nil {
+					delete(pool.arrival, hash)
+				}
+			}
 			pool.mu.Unlock()
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
 			if pool.journal != nil {
 				pool.mu.Lock()
-				if err := pool.journal.rotate(pool.local()); err != nil {
-					log.Warn("Failed to rotate local tx journal", "err", err)
+				if err := pool.journal.rotate(pool.journaled()); err != nil {
+					log.Warn("Failed to rotate tx journal", "err", err)
 				}
 				pool.mu.Unlock()
 			}
@@ -441,6 +461,14 @@ func (pool *TxPool) Stop() {
 	pool.wg.Wait()
 
 	if pool.journal != nil {
+		// Regenerate a full journal to store the final status of the transactions
+		if pool.journal.full {
+			pool.mu.Lock()
+			if err := pool.journal.rotate(pool.journaled()); err != nil {
+				log.Warn("Failed to rotate tx journal", "err", err)
+			}
+			pool.mu.Unlock()
+		}
 		pool.journal.close()
 	}
 	log.Info("Transaction pool stopped")
@@ -473,6 +501,33 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
+// Policies returns the configurations of the admission policies of the pool, in
+// the order they are applied.
+func (pool *TxPool) Policies() []TxPolicyConfig {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return append([]TxPolicyConfig{}, pool.config.Policies...)
+}
+
+// SetPolicies replaces the admission policies of the pool, resetting the state
+// of the previous ones. The transactions already in the pool are not checked
+// against the new policies.
+func (pool *TxPool) SetPolicies(configs []TxPolicyConfig) error {
+	policies, err := NewTxPolicies(configs)
+	if err != nil {
+		return err
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.policies = policies
+	pool.config.Policies = append([]TxPolicyConfig{}, configs...)
+
+	log.Info("Transaction pool policies updated", "policies", len(policies))
+	return nil
+}
+
 // State returns the virtual managed state of the transaction pool.
 func (pool *TxPool) State() *state.ManagedState {
 	pool.mu.RLock()
@@ -535,24 +590,71 @@ func (pool *TxPool) Pending() (map[common.Address]types.Transactions, error) {
 	return pending, nil
 }
 
-// local retrieves all currently known local transactions, groupped by origin
-// account and sorted by nonce. The returned transaction set is a copy and can be
-// freely modified by calling code.
-func (pool *TxPool) local() map[common.Address]types.Transactions {
-	txs := make(map[common.Address]types.Transactions)
-	for addr := range pool.locals.accounts {
-		if pending := pool.pending[addr]; pending != nil {
-			txs[addr] = append(txs[addr], pending.Flatten()...)
+// journaled retrieves all currently known transactions to be journaled, either
+// the local ones only or all of them, groupped by origin account and sorted by
+// nonce within the pending and the queued ones.
+func (pool *TxPool) journaled() map[common.Address][]*journalEntry {
+	entries := make(map[common.Address][]*journalEntry)
+	for _, pending := range []bool{true, false} {
+		lists := pool.queue
+		if pending {
+			lists = pool.pending
 		}
-		if queued := pool.queue[addr]; queued != nil {
-			txs[addr] = append(txs[addr], queued.Flatten()...)
+		for addr, list := range lists {
+			local := pool.locals.contains(addr)
+			if !local && !pool.journal.full {
+				continue
+			}
+			for _, tx := range list.Flatten() {
+				entries[addr] = append(entries[addr], pool.journalEntry(tx, local, pending))
+			}
 		}
 	}
-	return txs
+	return entries
+}
+
+// journalEntry assembles the journal entry of a pooled transaction.
+func (pool *TxPool) journalEntry(tx *types.Transaction, local bool, pending bool) *journalEntry {
+	arrival, ok := pool.arrival[tx.Hash()]
+	if !ok {
+		arrival = time.Now()
+	}
+	return &journalEntry{Tx: tx, Local: local, Pending: pending, Time: uint64(arrival.Unix())}
+}
+
+// addJournaled injects a journaled transaction into the pool, validating it
+// against the current head, and restores its arrival time.
+func (pool *TxPool) addJournaled(entry *journalEntry) error {
+	var err error
+	if entry.Local {
+		err = pool.AddLocal(entry.Tx)
+	} else {
+		err = pool.AddRemote(entry.Tx)
+	}
+	if err != nil || entry.Time == 0 {
+		return err
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	hash := entry.Tx.Hash()
+	if pool.all[hash] == nil {
+		return nil
+	}
+	arrival := time.Unix(int64(entry.Time), 0)
+	pool.arrival[hash] = arrival
+
+	// Carry the eviction lifetime of accounts with queued transactions only over
+	from, _ := types.Sender(pool.signer, entry.Tx) // already validated
+	if pool.beats[from].Before(arrival) {
+		pool.beats[from] = arrival
+	}
+	return nil
 }
 
 // validateTx checks whether a transaction is valid according to the consensus
-// rules and adheres to some heuristic limits of the local node (price and size).
+// rules, adheres to some heuristic limits of the local node (price and size) and
+// passes the admission policies.
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	// Heuristic limit, reject transactions over 32KB to prevent DOS attacks
 	if tx.Size() > 32*1024 {
@@ -593,6 +695,12 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if tx.Gas() < intrGas {
 		return ErrIntrinsicGas
 	}
+	// Ensure the transaction passes the admission policies, in order
+	for _, policy := range pool.policies {
+		if err := policy.Admit(tx, from); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -649,8 +757,10 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			pendingReplaceCounter.Inc(1)
 		}
 		pool.all[tx.Hash()] = tx
+		pool.arrival[tx.Hash()] = time.Now()
 		pool.priced.Put(tx)
 		pool.journalTx(from, tx)
+		pool.recordTx(from, tx)
 
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
@@ -668,12 +778,25 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 	if local {
 		pool.locals.add(from)
 	}
+	pool.arrival[hash] = time.Now()
 	pool.journalTx(from, tx)
+	pool.recordTx(from, tx)
 
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replace, nil
 }
 
+// recordTx notifies the admission policies tracking the added transactions.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) recordTx(from common.Address, tx *types.Transaction) {
+	for _, policy := range pool.policies {
+		if recorder, ok := policy.(TxPolicyRecorder); ok {
+			recorder.Record(tx, from)
+		}
+	}
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -701,14 +824,17 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 }
 
 // journalTx adds the specified transaction to the local disk journal if it is
-// deemed to have been sent from a local account.
+// deemed to have been sent from a local account, or if all transactions are
+// journaled.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
-	// Only journal if it's enabled and the transaction is local
-	if pool.journal == nil || !pool.locals.contains(from) {
+	// Only journal if it's enabled and the transaction is local or remotes are kept
+	local := pool.locals.contains(from)
+	if pool.journal == nil || (!local && !pool.journal.full) {
 		return
 	}
-	if err := pool.journal.insert(tx); err != nil {
-		log.Warn("Failed to journal local transaction", "err", err)
+	pending := pool.pending[from] != nil && pool.pending[from].Overlaps(tx)
+	if err := pool.journal.insert(pool.journalEntry(tx, local, pending)); err != nil {
+		log.Warn("Failed to journal transaction", "err", err)
 	}
 }
 
@@ -1624,6 +1624,101 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that journaling the remote transactions too restores the whole pool
+// across restarts, revalidated against the new head, along with the arrival
+// times of the transactions.
+func TestTransactionJournalingRemotes(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary file for the journal
+	file, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary journal: %v", err)
+	}
+	journal := file.Name()
+	defer os.Remove(journal)
+
+	// Clean up the temporary file, we only need the path for now
+	file.Close()
+	os.Remove(journal)
+
+	// Create the original pool with a local only journal, and add a local transaction
+	db, _ := ethdb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Journal = journal
+
+	local, _ := crypto.GenerateKey()
+	remote, _ := crypto.GenerateKey()
+	statedb.AddBalance(crypto.PubkeyToAddress(local.PublicKey), big.NewInt(1000000000))
+	statedb.AddBalance(crypto.PubkeyToAddress(remote.PublicKey), big.NewInt(1000000000))
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	if err := pool.AddLocal(pricedTransaction(0, 100000, big.NewInt(1), local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	pool.Stop()
+
+	// Switch to the full journal, the local transaction must survive, and remote
+	// pending and queued ones be journaled too
+	config.JournalRemotes = true
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+
+	if pending, _ := pool.Stats(); pending != 1 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 1)
+	}
+	for _, nonce := range []uint64{0, 1, 3} {
+		if err := pool.AddRemote(pricedTransaction(nonce, 100000, big.NewInt(1), remote)); err != nil {
+			t.Fatalf("failed to add remote transaction: %v", err)
+		}
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d pending, %d queued, want %d, %d", pending, queued, 3, 1)
+	}
+	queuedTx := pricedTransaction(3, 100000, big.NewInt(1), remote)
+
+	// Age the queued transaction and regenerate the journal, as done periodically
+	pool.mu.Lock()
+	arrival := time.Now().Add(-time.Hour).Truncate(time.Second)
+	pool.arrival[queuedTx.Hash()] = arrival
+	if err := pool.journal.rotate(pool.journaled()); err != nil {
+		t.Fatalf("failed to rotate journal: %v", err)
+	}
+	pool.mu.Unlock()
+
+	pool.Stop()
+
+	// Restart on a new head including the first remote transaction
+	statedb.SetNonce(crypto.PubkeyToAddress(remote.PublicKey), 1)
+	blockchain = &testBlockChain{statedb, 1000000, new(event.Feed)}
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if pending, queued := pool.Stats(); pending != 2 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d pending, %d queued, want %d, %d", pending, queued, 2, 1)
+	}
+	if !pool.locals.contains(crypto.PubkeyToAddress(local.PublicKey)) {
+		t.Errorf("local account not restored")
+	}
+	if pool.locals.contains(crypto.PubkeyToAddress(remote.PublicKey)) {
+		t.Errorf("remote account restored as local")
+	}
+	pool.mu.Lock()
+	if have := pool.arrival[queuedTx.Hash()]; !have.Equal(arrival) {
+		t.Errorf("arrival time mismatch: have %v, want %v", have, arrival)
+	}
+	if have := pool.beats[crypto.PubkeyToAddress(remote.PublicKey)]; have.Before(arrival) {
+		t.Errorf("heartbeat mismatch: have %v, want at least %v", have, arrival)
+	}
+	pool.mu.Unlock()
+
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
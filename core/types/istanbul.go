@@ -40,15 +40,43 @@ type IstanbulExtra struct {
 	Validators    []common.Address
 	Seal          []byte
 	CommittedSeal [][]byte
+
+	// The following fields are optional and only encoded up to the last non-empty
+	// one, to keep the extra-data of chains not using them unchanged.
+
+	// Weights is the voting power of each validator, in the order of Validators.
+	Weights []uint64
+	// AggregatedSeal is the aggregated BLS signature of the committers, replacing
+	// CommittedSeal once BLS seals are enabled.
+	AggregatedSeal []byte
+	// SignerBitmap marks the parent validators, in ascending order of address,
+	// which contributed to AggregatedSeal.
+	SignerBitmap []byte
+	// BLSKey is the BLS public key followed by its proof of possession, registered
+	// for the account voted on in the header.
+	BLSKey []byte
 }
 
 // EncodeRLP serializes ist into the Ethereum RLP format.
 func (ist *IstanbulExtra) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, []interface{}{
+	fields := []interface{}{
 		ist.Validators,
 		ist.Seal,
 		ist.CommittedSeal,
-	})
+	}
+	optional := []interface{}{
+		ist.Weights,
+		ist.AggregatedSeal,
+		ist.SignerBitmap,
+		ist.BLSKey,
+	}
+	present := 0
+	for i, length := range []int{len(ist.Weights), len(ist.AggregatedSeal), len(ist.SignerBitmap), len(ist.BLSKey)} {
+		if length > 0 {
+			present = i + 1
+		}
+	}
+	return rlp.Encode(w, append(fields, optional[:present]...))
 }
 
 // DecodeRLP implements rlp.Decoder, and load the istanbul fields from a RLP stream.
@@ -57,11 +85,35 @@ func (ist *IstanbulExtra) DecodeRLP(s *rlp.Stream) error {
 		Validators    []common.Address
 		Seal          []byte
 		CommittedSeal [][]byte
+		Optional      []rlp.RawValue `rlp:"tail"`
 	}
 	if err := s.Decode(&istanbulExtra); err != nil {
 		return err
 	}
 	ist.Validators, ist.Seal, ist.CommittedSeal = istanbulExtra.Validators, istanbulExtra.Seal, istanbulExtra.CommittedSeal
+	ist.Weights, ist.AggregatedSeal, ist.SignerBitmap, ist.BLSKey = nil, nil, nil, nil
+
+	optional := []interface{}{&ist.Weights, &ist.AggregatedSeal, &ist.SignerBitmap, &ist.BLSKey}
+	if len(istanbulExtra.Optional) > len(optional) {
+		return ErrInvalidIstanbulHeaderExtra
+	}
+	for i, raw := range istanbulExtra.Optional {
+		if err := rlp.DecodeBytes(raw, optional[i]); err != nil {
+			return err
+		}
+	}
+	if len(ist.Weights) == 0 {
+		ist.Weights = nil
+	}
+	if len(ist.AggregatedSeal) == 0 {
+		ist.AggregatedSeal = nil
+	}
+	if len(ist.SignerBitmap) == 0 {
+		ist.SignerBitmap = nil
+	}
+	if len(ist.BLSKey) == 0 {
+		ist.BLSKey = nil
+	}
 	return nil
 }
 
@@ -95,6 +147,7 @@ func IstanbulFilteredHeader(h *Header, keepSeal bool) *Header {
 		istanbulExtra.Seal = []byte{}
 	}
 	istanbulExtra.CommittedSeal = [][]byte{}
+	istanbulExtra.AggregatedSeal, istanbulExtra.SignerBitmap = nil, nil
 
 	payload, err := rlp.EncodeToBytes(&istanbulExtra)
 	if err != nil {
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func TestHeaderHash(t *testing.T) {
@@ -86,3 +87,61 @@ func TestExtractToIstanbul(t *testing.T) {
 		}
 	}
 }
+
+func TestIstanbulExtraWeights(t *testing.T) {
+	extra := &IstanbulExtra{
+		Validators: []common.Address{
+			common.HexToAddress("0x44add0ec310f115a0e603b2d7db9f067778eaf8a"),
+			common.HexToAddress("0x294fc7e8f22b3bcdcf955dd7ff3ba2ed833f8212"),
+		},
+		Seal:          []byte{},
+		CommittedSeal: [][]byte{},
+		Weights:       []uint64{3, 1},
+	}
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		t.Fatalf("failed to encode extra-data: %v", err)
+	}
+	h := &Header{Extra: append(make([]byte, IstanbulExtraVanity), payload...)}
+	decoded, err := ExtractIstanbulExtra(h)
+	if err != nil {
+		t.Fatalf("failed to extract extra-data: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, extra) {
+		t.Errorf("expected: %v, but got: %v", extra, decoded)
+	}
+	// The weights must be part of the hashed header
+	if filtered := IstanbulFilteredHeader(h, true); !bytes.Equal(filtered.Extra, h.Extra) {
+		t.Errorf("weights dropped from filtered header")
+	}
+}
+
+func TestIstanbulExtraAggregatedSeal(t *testing.T) {
+	extra := &IstanbulExtra{
+		Validators:     []common.Address{common.HexToAddress("0x44add0ec310f115a0e603b2d7db9f067778eaf8a")},
+		Seal:           []byte{},
+		CommittedSeal:  [][]byte{},
+		AggregatedSeal: bytes.Repeat([]byte{0x01}, 64),
+		SignerBitmap:   []byte{0x01},
+	}
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		t.Fatalf("failed to encode extra-data: %v", err)
+	}
+	h := &Header{Extra: append(make([]byte, IstanbulExtraVanity), payload...)}
+	decoded, err := ExtractIstanbulExtra(h)
+	if err != nil {
+		t.Fatalf("failed to extract extra-data: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, extra) {
+		t.Errorf("expected: %v, but got: %v", extra, decoded)
+	}
+	// The aggregated seal is not part of the hashed header, like the committed seals
+	filtered, err := ExtractIstanbulExtra(IstanbulFilteredHeader(h, true))
+	if err != nil {
+		t.Fatalf("failed to extract filtered extra-data: %v", err)
+	}
+	if filtered.AggregatedSeal != nil || filtered.SignerBitmap != nil {
+		t.Errorf("aggregated seal kept in filtered header")
+	}
+}
@@ -114,6 +114,12 @@ type EVM struct {
 // NewEVM retutrns a new EVM . The returned EVM is not thread safe and should
 // only ever be used *once*.
 func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmConfig Config) *EVM {
+	// Route the state changes through the tracer if it's interested in them
+	if vmConfig.Debug {
+		if tracer, ok := vmConfig.Tracer.(StateTracer); ok {
+			statedb = &tracingStateDB{StateDB: statedb, tracer: tracer}
+		}
+	}
 	evm := &EVM{
 		Context:     ctx,
 		StateDB:     statedb,
@@ -132,6 +138,16 @@ func (evm *EVM) Cancel() {
 	atomic.StoreInt32(&evm.abort, 1)
 }
 
+// frameTracer returns the tracer to notify of entering and exiting the current
+// call frame, if it's an inner one and the tracer is interested in them.
+func (evm *EVM) frameTracer() (FrameTracer, bool) {
+	if !evm.vmConfig.Debug || evm.depth == 0 {
+		return nil, false
+	}
+	tracer, ok := evm.vmConfig.Tracer.(FrameTracer)
+	return tracer, ok
+}
+
 // Call executes the contract associated with the addr with the given input as
 // parameters. It also handles any necessary value transfer required and takes
 // the necessary steps to create accounts and reverses the state in case of an
@@ -160,6 +176,11 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 			precompiles = PrecompiledContractsByzantium
 		}
 		if precompiles[addr] == nil && evm.ChainConfig().IsEIP158(evm.BlockNumber) && value.Sign() == 0 {
+			// Calling a non existing account, nothing to do but notify the tracer
+			if tracer, ok := evm.frameTracer(); ok {
+				tracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+				tracer.CaptureExit(nil, 0, nil)
+			}
 			return nil, gas, nil
 		}
 		evm.StateDB.CreateAccount(addr)
@@ -180,6 +201,10 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		defer func() { // Lazy evaluation of the parameters
 			evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
 		}()
+	} else if tracer, ok := evm.frameTracer(); ok {
+		tracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
 	}
 	ret, err = run(evm, contract, input)
 
@@ -226,6 +251,11 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	contract := NewContract(caller, to, value, gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if tracer, ok := evm.frameTracer(); ok {
+		tracer.CaptureEnter(CALLCODE, caller.Address(), addr, input, gas, value)
+
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
 	ret, err = run(evm, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
@@ -259,6 +289,11 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	contract := NewContract(caller, to, nil, gas).AsDelegate()
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if tracer, ok := evm.frameTracer(); ok {
+		tracer.CaptureEnter(DELEGATECALL, caller.Address(), addr, input, gas, nil)
+
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
 	ret, err = run(evm, contract, input)
 	if err != nil {
 		evm.StateDB.RevertToSnapshot(snapshot)
@@ -299,6 +334,11 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	contract := NewContract(caller, to, new(big.Int), gas)
 	contract.SetCallCode(&addr, evm.StateDB.GetCodeHash(addr), evm.StateDB.GetCode(addr))
 
+	if tracer, ok := evm.frameTracer(); ok {
+		tracer.CaptureEnter(STATICCALL, caller.Address(), addr, input, gas, new(big.Int))
+
+		defer func() { tracer.CaptureExit(ret, gas-contract.Gas, err) }()
+	}
 	// When an error was returned by the EVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in Homestead this also counts for code storage gas errors.
@@ -353,6 +393,10 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	if evm.vmConfig.Debug && evm.depth == 0 {
 		evm.vmConfig.Tracer.CaptureStart(caller.Address(), contractAddr, true, code, gas, value)
 	}
+	tracer, traced := evm.frameTracer()
+	if traced {
+		tracer.CaptureEnter(CREATE, caller.Address(), contractAddr, code, gas, value)
+	}
 	start := time.Now()
 
 	ret, err = run(evm, contract, nil)
@@ -388,6 +432,9 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	if evm.vmConfig.Debug && evm.depth == 0 {
 		evm.vmConfig.Tracer.CaptureEnd(ret, gas-contract.Gas, time.Since(start), err)
 	}
+	if traced {
+		tracer.CaptureExit(ret, gas-contract.Gas, err)
+	}
 	return ret, contractAddr, contract.Gas, err
 }
 
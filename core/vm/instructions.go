@@ -815,7 +815,13 @@ func opStop(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Sta
 
 func opSuicide(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Stack) ([]byte, error) {
 	balance := evm.StateDB.GetBalance(contract.Address())
-	evm.StateDB.AddBalance(common.BigToAddress(stack.pop()), balance)
+	beneficiary := common.BigToAddress(stack.pop())
+
+	if tracer, ok := evm.frameTracer(); ok {
+		tracer.CaptureEnter(SELFDESTRUCT, contract.Address(), beneficiary, nil, 0, new(big.Int).Set(balance))
+		tracer.CaptureExit(nil, 0, nil)
+	}
+	evm.StateDB.AddBalance(beneficiary, balance)
 
 	evm.StateDB.Suicide(contract.Address())
 	return nil, nil
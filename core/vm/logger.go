@@ -98,6 +98,30 @@ type Tracer interface {
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
 }
 
+// FrameTracer is an optional extension of Tracer, notified whenever an inner call
+// frame (CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE or SELFDESTRUCT) is
+// entered and exited. The outermost frame is reported by CaptureStart and CaptureEnd.
+//
+// The value is nil for DELEGATECALL frames, which don't transfer any. The gas used
+// of a frame includes the gas consumed by its failure.
+type FrameTracer interface {
+	CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error
+	CaptureExit(output []byte, gasUsed uint64, err error) error
+}
+
+// StateTracer is an optional extension of Tracer, notified of the changes made to
+// the state by the EVM, including the ones made by the transaction processing out
+// of the execution (nonce and gas purchase, refunds and fees). Only actual changes
+// are reported. Changes undone by reverting a failed frame are not reported again,
+// tracers need to drop them themselves on the frame exits.
+type StateTracer interface {
+	CaptureBalanceChange(addr common.Address, prev, new *big.Int) error
+	CaptureNonceChange(addr common.Address, prev, new uint64) error
+	CaptureStorageChange(addr common.Address, key, prev, new common.Hash) error
+	CaptureRefundChange(prev, new uint64) error
+	CaptureLog(log *types.Log) error
+}
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
@@ -17,13 +17,17 @@
 package runtime
 
 import (
+	"fmt"
 	"math/big"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/ethdb"
 )
@@ -117,6 +121,95 @@ func TestCall(t *testing.T) {
 	}
 }
 
+// hookTracer records the frame and state change events of an execution.
+type hookTracer struct {
+	events []string
+}
+
+func (t *hookTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+func (t *hookTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *hookTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+func (t *hookTracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) error {
+	return nil
+}
+func (t *hookTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) error {
+	t.events = append(t.events, fmt.Sprintf("enter %v %x->%x %v", typ, from[19:], to[19:], value))
+	return nil
+}
+func (t *hookTracer) CaptureExit(output []byte, gasUsed uint64, err error) error {
+	t.events = append(t.events, fmt.Sprintf("exit %v", err))
+	return nil
+}
+func (t *hookTracer) CaptureBalanceChange(addr common.Address, prev, new *big.Int) error {
+	t.events = append(t.events, fmt.Sprintf("balance %x %v->%v", addr[19:], prev, new))
+	return nil
+}
+func (t *hookTracer) CaptureNonceChange(addr common.Address, prev, new uint64) error {
+	t.events = append(t.events, fmt.Sprintf("nonce %x %v->%v", addr[19:], prev, new))
+	return nil
+}
+func (t *hookTracer) CaptureStorageChange(addr common.Address, key, prev, new common.Hash) error {
+	t.events = append(t.events, fmt.Sprintf("storage %x %x %x->%x", addr[19:], key[31:], prev[31:], new[31:]))
+	return nil
+}
+func (t *hookTracer) CaptureRefundChange(prev, new uint64) error {
+	t.events = append(t.events, fmt.Sprintf("refund %v->%v", prev, new))
+	return nil
+}
+func (t *hookTracer) CaptureLog(log *types.Log) error {
+	t.events = append(t.events, fmt.Sprintf("log %x", log.Address[19:]))
+	return nil
+}
+
+// Tests that the frame and state tracer hooks are called for inner calls and the
+// state changes made during them.
+func TestTracerHooks(t *testing.T) {
+	db, _ := ethdb.NewMemDatabase()
+	state, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// Contract 0x0a calls 0x0b, which stores, logs and self destructs to 0xff
+	caller, callee := common.HexToAddress("0x0a"), common.HexToAddress("0x0b")
+	state.SetCode(caller, []byte{
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0x0b,
+		byte(vm.GAS),
+		byte(vm.CALL),
+		byte(vm.STOP),
+	})
+	state.SetCode(callee, []byte{
+		byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.SSTORE),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.LOG0),
+		byte(vm.PUSH1), 0xff, byte(vm.SELFDESTRUCT),
+	})
+	state.AddBalance(callee, big.NewInt(10))
+
+	tracer := new(hookTracer)
+	cfg := &Config{State: state, GasLimit: 100000, EVMConfig: vm.Config{Debug: true, Tracer: tracer}}
+	if _, _, err := Call(caller, nil, cfg); err != nil {
+		t.Fatal("didn't expect error", err)
+	}
+	want := []string{
+		"enter CALL 0a->0b 0",
+		"storage 0b 00 00->01",
+		"log 0b",
+		"refund 0->24000",
+		"enter SELFDESTRUCT 0b->ff 10",
+		"exit <nil>",
+		"balance ff 0->10",
+		"balance 0b 10->0",
+		"exit <nil>",
+	}
+	if !reflect.DeepEqual(tracer.events, want) {
+		t.Errorf("event mismatch:\nhave %q\nwant %q", tracer.events, want)
+	}
+}
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
@@ -0,0 +1,93 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// tracingStateDB wraps the state database of an EVM, notifying a state tracer of
+// the changes made through it.
+type tracingStateDB struct {
+	StateDB
+	tracer StateTracer
+}
+
+// SubBalance subtracts amount from the account and reports the balance change.
+func (db *tracingStateDB) SubBalance(addr common.Address, amount *big.Int) {
+	prev := new(big.Int).Set(db.StateDB.GetBalance(addr))
+	db.StateDB.SubBalance(addr, amount)
+	db.captureBalance(addr, prev)
+}
+
+// AddBalance adds amount to the account and reports the balance change.
+func (db *tracingStateDB) AddBalance(addr common.Address, amount *big.Int) {
+	prev := new(big.Int).Set(db.StateDB.GetBalance(addr))
+	db.StateDB.AddBalance(addr, amount)
+	db.captureBalance(addr, prev)
+}
+
+// captureBalance reports the change of the balance of an account, if any.
+func (db *tracingStateDB) captureBalance(addr common.Address, prev *big.Int) {
+	if balance := db.StateDB.GetBalance(addr); balance.Cmp(prev) != 0 {
+		db.tracer.CaptureBalanceChange(addr, prev, new(big.Int).Set(balance))
+	}
+}
+
+// SetNonce sets the nonce of the account and reports the nonce change.
+func (db *tracingStateDB) SetNonce(addr common.Address, nonce uint64) {
+	prev := db.StateDB.GetNonce(addr)
+	db.StateDB.SetNonce(addr, nonce)
+	if prev != nonce {
+		db.tracer.CaptureNonceChange(addr, prev, nonce)
+	}
+}
+
+// SetState sets a storage slot of the account and reports the storage change.
+func (db *tracingStateDB) SetState(addr common.Address, key common.Hash, value common.Hash) {
+	prev := db.StateDB.GetState(addr, key)
+	db.StateDB.SetState(addr, key, value)
+	if prev != value {
+		db.tracer.CaptureStorageChange(addr, key, prev, value)
+	}
+}
+
+// AddRefund adds gas to the refund counter and reports the refund change.
+func (db *tracingStateDB) AddRefund(gas uint64) {
+	prev := db.StateDB.GetRefund()
+	db.StateDB.AddRefund(gas)
+	if gas != 0 {
+		db.tracer.CaptureRefundChange(prev, db.StateDB.GetRefund())
+	}
+}
+
+// AddLog adds a log to the state and reports it.
+func (db *tracingStateDB) AddLog(log *types.Log) {
+	db.StateDB.AddLog(log)
+	db.tracer.CaptureLog(log)
+}
+
+// Suicide marks the account as self destructed and reports the balance it loses.
+func (db *tracingStateDB) Suicide(addr common.Address) bool {
+	prev := new(big.Int).Set(db.StateDB.GetBalance(addr))
+	ok := db.StateDB.Suicide(addr)
+	db.captureBalance(addr, prev)
+	return ok
+}
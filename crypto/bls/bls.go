@@ -0,0 +1,395 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package bls implements BLS signatures over the bn256 curve.
+//
+// Signatures live in G1 and public keys in G2, so signatures stay small and can
+// be aggregated by point addition. Signatures over the same message verify against
+// the aggregate of the signers' public keys with a single pairing check.
+//
+// Aggregating public keys is only safe if every key has a proof of possession of
+// its secret key, which must be checked with VerifyProof before a key is trusted.
+package bls
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/bn256"
+)
+
+const (
+	// PublicKeyLength is the length of a marshalled public key.
+	PublicKeyLength = 128
+	// SignatureLength is the length of a marshalled signature.
+	SignatureLength = 64
+)
+
+var (
+	// fieldModulus is the prime of the field the curve is defined over.
+	fieldModulus, _ = new(big.Int).SetString("21888242871839275222246405745257275088696311157297823662689037894645226208583", 10)
+	// groupOrder is the number of elements in both G1 and G2.
+	groupOrder, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+	// sqrtExponent is (p+1)/4, as p = 3 mod 4 square roots are a single exponentiation.
+	sqrtExponent = new(big.Int).Rsh(new(big.Int).Add(fieldModulus, big.NewInt(1)), 2)
+	// legendreExponent is (p-1)/2, the exponent of Euler's criterion.
+	legendreExponent = new(big.Int).Rsh(new(big.Int).Sub(fieldModulus, big.NewInt(1)), 1)
+
+	// Constants of the Shallue-van de Woestijne map for y^2 = x^3 + 3 with Z = 1,
+	// as defined in RFC 9380 section 6.6.1.
+	svdwC1 = big.NewInt(4)
+	svdwC2 = fromHex("183227397098d014dc2822db40c0ac2ecbc0b548b438e5469e10460b6c3e7ea3")
+	svdwC3 = fromHex("16789af3a83522eb353c98fc6b36d713d5d8d1cc5dffffffa")
+	svdwC4 = fromHex("10216f7ba065e00de81ac1e7808072c9dd2b2385cd7b438469602eb24829a9bd")
+
+	// g2 is the generator of G2.
+	g2 = new(bn256.G2).ScalarBaseMult(big.NewInt(1))
+
+	// Domain separation tags of the messages and of the proofs of possession.
+	signatureDomain = []byte("BLS_SIG_BN254G1_XMD:SHA-256_SVDW_RO_NUL_")
+	proofDomain     = []byte("BLS_POP_BN254G1_XMD:SHA-256_SVDW_RO_POP_")
+
+	errInvalidSecretKey = errors.New("bls: invalid secret key")
+	errInvalidLength    = errors.New("bls: invalid length")
+	errInfinity         = errors.New("bls: point at infinity")
+	errNotInGroup       = errors.New("bls: point not in the prime order subgroup")
+)
+
+// SecretKey is a BLS secret key.
+type SecretKey struct {
+	s *big.Int
+}
+
+// PublicKey is a BLS public key.
+type PublicKey struct {
+	p *bn256.G2
+}
+
+// Signature is a BLS signature, or the aggregate of several.
+type Signature struct {
+	p *bn256.G1
+}
+
+// GenerateKey creates a random secret key.
+func GenerateKey() (*SecretKey, error) {
+	for {
+		s, err := rand.Int(rand.Reader, groupOrder)
+		if err != nil {
+			return nil, err
+		}
+		if s.Sign() != 0 {
+			return &SecretKey{s: s}, nil
+		}
+	}
+}
+
+// LoadKey loads a secret key from the given file, hex-encoded as saved by SaveKey.
+func LoadKey(file string) (*SecretKey, error) {
+	buf := make([]byte, 64)
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	if _, err := io.ReadFull(fd, buf); err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return SecretKeyFromBytes(key)
+}
+
+// SaveKey saves a secret key to the given file with restrictive permissions. The
+// key data is saved hex-encoded.
+func SaveKey(file string, key *SecretKey) error {
+	return ioutil.WriteFile(file, []byte(hex.EncodeToString(key.Bytes())), 0600)
+}
+
+// DeriveSecretKey deterministically derives a secret key from a seed, such as
+// the private key of an account.
+func DeriveSecretKey(seed []byte) *SecretKey {
+	for i := uint32(0); ; i++ {
+		var counter [4]byte
+		binary.BigEndian.PutUint32(counter[:], i)
+
+		s := new(big.Int).SetBytes(crypto.Keccak256([]byte("BLS_KEYGEN"), seed, counter[:]))
+		s.Mod(s, groupOrder)
+		if s.Sign() != 0 {
+			return &SecretKey{s: s}
+		}
+	}
+}
+
+// SecretKeyFromBytes creates a secret key from its big endian representation.
+func SecretKeyFromBytes(b []byte) (*SecretKey, error) {
+	s := new(big.Int).SetBytes(b)
+	if s.Sign() == 0 || s.Cmp(groupOrder) >= 0 {
+		return nil, errInvalidSecretKey
+	}
+	return &SecretKey{s: s}, nil
+}
+
+// Bytes returns the 32 byte big endian representation of the secret key.
+func (sk *SecretKey) Bytes() []byte {
+	b := make([]byte, 32)
+	s := sk.s.Bytes()
+	copy(b[32-len(s):], s)
+	return b
+}
+
+// PublicKey returns the public key of the secret key.
+func (sk *SecretKey) PublicKey() *PublicKey {
+	return &PublicKey{p: new(bn256.G2).ScalarBaseMult(sk.s)}
+}
+
+// Sign signs a message.
+func (sk *SecretKey) Sign(msg []byte) *Signature {
+	return &Signature{p: new(bn256.G1).ScalarMult(hashToG1(signatureDomain, msg), sk.s)}
+}
+
+// Prove creates the proof of possession of the secret key, a signature over the
+// public key in a domain of its own.
+func (sk *SecretKey) Prove() *Signature {
+	return &Signature{p: new(bn256.G1).ScalarMult(hashToG1(proofDomain, sk.PublicKey().Marshal()), sk.s)}
+}
+
+// PublicKeyFromBytes unmarshals a public key. Unlike G1, the twist curve G2 lives
+// on has points outside of the prime order subgroup, which are rejected.
+func PublicKeyFromBytes(b []byte) (*PublicKey, error) {
+	if len(b) != PublicKeyLength {
+		return nil, errInvalidLength
+	}
+	p := new(bn256.G2)
+	if _, err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	if isZero(p.Marshal()) {
+		return nil, errInfinity
+	}
+	// The bn256 implementations check the subgroup when unmarshalling, but the
+	// security of the aggregation relies on it, so don't depend on that
+	if !isZero(new(bn256.G2).ScalarMult(p, groupOrder).Marshal()) {
+		return nil, errNotInGroup
+	}
+	return &PublicKey{p: p}, nil
+}
+
+// Marshal returns the 128 byte representation of the public key.
+func (pk *PublicKey) Marshal() []byte {
+	return pk.p.Marshal()
+}
+
+// Verify checks that a signature, or an aggregate signature, was made over the
+// message with the secret key of the public key, or aggregate public key.
+func (pk *PublicKey) Verify(msg []byte, sig *Signature) bool {
+	return pairingCheck(sig, hashToG1(signatureDomain, msg), pk)
+}
+
+// VerifyProof checks the proof of possession of the secret key of the public key.
+func (pk *PublicKey) VerifyProof(proof *Signature) bool {
+	return pairingCheck(proof, hashToG1(proofDomain, pk.Marshal()), pk)
+}
+
+// SignatureFromBytes unmarshals a signature.
+func SignatureFromBytes(b []byte) (*Signature, error) {
+	if len(b) != SignatureLength {
+		return nil, errInvalidLength
+	}
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	if isZero(b) {
+		return nil, errInfinity
+	}
+	return &Signature{p: p}, nil
+}
+
+// Marshal returns the 64 byte representation of the signature.
+func (sig *Signature) Marshal() []byte {
+	return sig.p.Marshal()
+}
+
+// AggregateSignatures combines signatures into a single one. It returns nil if
+// there are no signatures.
+func AggregateSignatures(sigs []*Signature) *Signature {
+	if len(sigs) == 0 {
+		return nil
+	}
+	p := new(bn256.G1).ScalarBaseMult(new(big.Int))
+	for _, sig := range sigs {
+		p.Add(p, sig.p)
+	}
+	return &Signature{p: p}
+}
+
+// AggregatePublicKeys combines public keys into the key verifying the aggregate
+// of their signatures. It returns nil if there are no keys.
+func AggregatePublicKeys(keys []*PublicKey) *PublicKey {
+	if len(keys) == 0 {
+		return nil
+	}
+	p := new(bn256.G2).ScalarBaseMult(new(big.Int))
+	for _, key := range keys {
+		p.Add(p, key.p)
+	}
+	return &PublicKey{p: p}
+}
+
+// pairingCheck checks that e(sig, g2) == e(h, pk).
+func pairingCheck(sig *Signature, h *bn256.G1, pk *PublicKey) bool {
+	return bn256.PairingCheck([]*bn256.G1{sig.p, new(bn256.G1).Neg(h)}, []*bn256.G2{g2, pk.p})
+}
+
+// hashToG1 maps a message to a point of G1 with the hash_to_curve method of
+// RFC 9380 for BN254, with expand_message_xmd over SHA-256 and the Shallue-van
+// de Woestijne map (suite BN254G1_XMD:SHA-256_SVDW_RO_). As G1 has a cofactor of
+// 1, no cofactor clearing is needed. The computation isn't constant time, which
+// is fine as the messages signed are public.
+func hashToG1(domain, msg []byte) *bn256.G1 {
+	u := hashToField(domain, msg)
+	p := mapToG1(u[0])
+	return p.Add(p, mapToG1(u[1]))
+}
+
+// hashToField hashes a message to two elements of the base field, as defined in
+// RFC 9380 section 5.2.
+func hashToField(domain, msg []byte) [2]*big.Int {
+	// L = ceil((ceil(log2(p)) + k) / 8) = 48 bytes per element, with k = 128
+	const length = 48
+
+	uniform := expandMessageXMD(domain, msg, 2*length)
+	return [2]*big.Int{
+		new(big.Int).Mod(new(big.Int).SetBytes(uniform[:length]), fieldModulus),
+		new(big.Int).Mod(new(big.Int).SetBytes(uniform[length:]), fieldModulus),
+	}
+}
+
+// expandMessageXMD expands a message into a uniform byte string of the given
+// length with SHA-256, as defined in RFC 9380 section 5.3.1.
+func expandMessageXMD(domain, msg []byte, length int) []byte {
+	dst := append(append([]byte{}, domain...), byte(len(domain)))
+	ell := (length + sha256.Size - 1) / sha256.Size
+
+	h := sha256.New()
+	h.Write(make([]byte, sha256.BlockSize))
+	h.Write(msg)
+	h.Write([]byte{byte(length >> 8), byte(length), 0})
+	h.Write(dst)
+	b0 := h.Sum(nil)
+
+	var (
+		uniform []byte
+		bi      = make([]byte, sha256.Size)
+	)
+	for i := 1; i <= ell; i++ {
+		for j := range bi {
+			bi[j] ^= b0[j]
+		}
+		h.Reset()
+		h.Write(bi)
+		h.Write([]byte{byte(i)})
+		h.Write(dst)
+		bi = h.Sum(nil)
+		uniform = append(uniform, bi...)
+	}
+	return uniform[:length]
+}
+
+// mapToG1 maps a field element to a point of G1 with the Shallue-van de Woestijne
+// method, as defined in RFC 9380 section 6.6.1.
+func mapToG1(u *big.Int) *bn256.G1 {
+	mul := func(a, b *big.Int) *big.Int { return new(big.Int).Mod(new(big.Int).Mul(a, b), fieldModulus) }
+
+	tv1 := mul(mul(u, u), svdwC1)
+	tv2 := new(big.Int).Add(big.NewInt(1), tv1)
+	tv1.Sub(big.NewInt(1), tv1)
+	tv3 := new(big.Int).ModInverse(mul(tv1, tv2), fieldModulus)
+	if tv3 == nil {
+		tv3 = new(big.Int) // inv0(0) = 0
+	}
+	tv4 := mul(mul(mul(u, tv1), tv3), svdwC3)
+
+	x1 := new(big.Int).Sub(svdwC2, tv4)
+	x1.Mod(x1, fieldModulus)
+	x2 := new(big.Int).Add(svdwC2, tv4)
+	x2.Mod(x2, fieldModulus)
+	x3 := mul(mul(tv2, tv2), tv3)
+	x3 = mul(mul(x3, x3), svdwC4)
+	x3.Add(x3, big.NewInt(1))
+	x3.Mod(x3, fieldModulus)
+
+	var x *big.Int
+	switch {
+	case isSquare(curveRHS(x1)):
+		x = x1
+	case isSquare(curveRHS(x2)):
+		x = x2
+	default:
+		x = x3
+	}
+	y := new(big.Int).Exp(curveRHS(x), sqrtExponent, fieldModulus)
+	if u.Bit(0) != y.Bit(0) {
+		y.Sub(fieldModulus, y)
+	}
+	buf := make([]byte, 64)
+	xb, yb := x.Bytes(), y.Bytes()
+	copy(buf[32-len(xb):32], xb)
+	copy(buf[64-len(yb):], yb)
+
+	p := new(bn256.G1)
+	if _, err := p.Unmarshal(buf); err != nil {
+		panic("bls: mapped point not on the curve")
+	}
+	return p
+}
+
+// curveRHS returns x^3 + 3.
+func curveRHS(x *big.Int) *big.Int {
+	rhs := new(big.Int).Exp(x, big.NewInt(3), fieldModulus)
+	rhs.Add(rhs, big.NewInt(3))
+	return rhs.Mod(rhs, fieldModulus)
+}
+
+// isSquare reports whether a field element is a square, zero included.
+func isSquare(a *big.Int) bool {
+	return new(big.Int).Exp(a, legendreExponent, fieldModulus).Cmp(big.NewInt(1)) <= 0
+}
+
+func fromHex(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 16)
+	return n
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
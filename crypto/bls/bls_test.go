@@ -0,0 +1,154 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package bls
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func testKeys(n int) []*SecretKey {
+	keys := make([]*SecretKey, n)
+	for i := range keys {
+		keys[i] = DeriveSecretKey([]byte(fmt.Sprintf("key %d", i)))
+	}
+	return keys
+}
+
+func TestSignVerify(t *testing.T) {
+	key := testKeys(1)[0]
+	msg := []byte("message")
+
+	sig := key.Sign(msg)
+	if !key.PublicKey().Verify(msg, sig) {
+		t.Fatalf("failed to verify signature")
+	}
+	if key.PublicKey().Verify([]byte("other message"), sig) {
+		t.Errorf("signature verified over a different message")
+	}
+	if testKeys(2)[1].PublicKey().Verify(msg, sig) {
+		t.Errorf("signature verified with a different key")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	keys := testKeys(4)
+	msg := []byte("message")
+
+	var (
+		sigs []*Signature
+		pubs []*PublicKey
+	)
+	for _, key := range keys {
+		sigs = append(sigs, key.Sign(msg))
+		pubs = append(pubs, key.PublicKey())
+	}
+	sig := AggregateSignatures(sigs)
+	if !AggregatePublicKeys(pubs).Verify(msg, sig) {
+		t.Fatalf("failed to verify aggregate signature")
+	}
+	if AggregatePublicKeys(pubs[:3]).Verify(msg, sig) {
+		t.Errorf("aggregate signature verified with a missing signer")
+	}
+	if !AggregatePublicKeys(pubs[:3]).Verify(msg, AggregateSignatures(sigs[:3])) {
+		t.Errorf("failed to verify partial aggregate signature")
+	}
+}
+
+func TestProofOfPossession(t *testing.T) {
+	keys := testKeys(2)
+
+	proof := keys[0].Prove()
+	if !keys[0].PublicKey().VerifyProof(proof) {
+		t.Fatalf("failed to verify proof of possession")
+	}
+	if keys[1].PublicKey().VerifyProof(proof) {
+		t.Errorf("proof of possession verified for a different key")
+	}
+	// A proof is not a valid signature over the public key
+	if keys[0].PublicKey().Verify(keys[0].PublicKey().Marshal(), proof) {
+		t.Errorf("proof of possession verified as a signature")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	key := testKeys(1)[0]
+	sig := key.Sign([]byte("message"))
+
+	pub, err := PublicKeyFromBytes(key.PublicKey().Marshal())
+	if err != nil {
+		t.Fatalf("failed to unmarshal public key: %v", err)
+	}
+	if !bytes.Equal(pub.Marshal(), key.PublicKey().Marshal()) {
+		t.Errorf("public key mismatch after round trip")
+	}
+	dec, err := SignatureFromBytes(sig.Marshal())
+	if err != nil {
+		t.Fatalf("failed to unmarshal signature: %v", err)
+	}
+	if !pub.Verify([]byte("message"), dec) {
+		t.Errorf("failed to verify unmarshalled signature")
+	}
+	sk, err := SecretKeyFromBytes(key.Bytes())
+	if err != nil {
+		t.Fatalf("failed to unmarshal secret key: %v", err)
+	}
+	if !bytes.Equal(sk.PublicKey().Marshal(), key.PublicKey().Marshal()) {
+		t.Errorf("secret key mismatch after round trip")
+	}
+	if _, err := SignatureFromBytes(make([]byte, SignatureLength)); err != errInfinity {
+		t.Errorf("error mismatch: have %v, want %v", err, errInfinity)
+	}
+	if _, err := PublicKeyFromBytes(make([]byte, PublicKeyLength-1)); err != errInvalidLength {
+		t.Errorf("error mismatch: have %v, want %v", err, errInvalidLength)
+	}
+}
+
+func TestHashToG1(t *testing.T) {
+	// Test vectors of the BN254G1_XMD:SHA-256_SVDW_RO_ suite
+	domain := []byte("QUUX-V01-CS02-with-BN254G1_XMD:SHA-256_SVDW_RO_")
+	tests := []struct {
+		msg  string
+		x, y string
+	}{
+		{"", "0a976ab906170db1f9638d376514dbf8c42aef256a54bbd48521f20749e59e86", "02925ead66b9e68bfc309b014398640ab55f6619ab59bc1fab2210ad4c4d53d5"},
+		{"abc", "23f717bee89b1003957139f193e6be7da1df5f1374b26a4643b0378b5baf53d1", "04142f826b71ee574452dbc47e05bc3e1a647478403a7ba38b7b93948f4e151d"},
+	}
+	for _, tt := range tests {
+		want := common.FromHex(tt.x + tt.y)
+		if have := hashToG1(domain, []byte(tt.msg)).Marshal(); !bytes.Equal(have, want) {
+			t.Errorf("%q: point mismatch: have %x, want %x", tt.msg, have, want)
+		}
+	}
+}
+
+func TestPublicKeySubgroup(t *testing.T) {
+	// Points on the twist curve, but outside of G2: one of large order, and one
+	// of a small order dividing the cofactor
+	points := []string{
+		"0d6fe64bc9e9c616612e7696a6cecc1b78e510617311d8a3c2ce6f447ed4d57b078bfae2414c343c1027c4d1c386bbc4cd613e30d8f16adf91b7584a2265b1f51ef79b362c6a421cd8514cb99be02d2d8a6111baf70fc18734a3ca43a305bec429f1cb6944a657b2a541ee0c47d879d3783e03c7471de35b0760b564fd772542",
+		"2b5a481b60b2b27b6b095371d9b9b31dbdca928bb151d7df8fbc5ed49bc9a2e021b0457f7af38b0a185d2eb18e76fa275c6b22ca4e3fbe5c6a8efea52a1b36670e1bcc562358b1523478afca72eb62ef88c9a82a6c2b41d30c3758110c81271d01d79a1fca59637d6be971739235d7cf6a53f34341f0745b7b9972b7bd212fca",
+	}
+	for i, point := range points {
+		if _, err := PublicKeyFromBytes(common.FromHex(point)); err == nil {
+			t.Errorf("point %d: accepted outside of the subgroup", i)
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"math/big"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -198,10 +199,29 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return uint64(api.e.miner.HashRate())
 }
 
+// PublicTxPoolAPI provides RPC methods to inspect the admission policies of the
+// transaction pool. They are changed through the admin API.
+type PublicTxPoolAPI struct {
+	e *Ethereum
+}
+
+// NewPublicTxPoolAPI creates a new RPC service which inspects the transaction pool
+// of this node.
+func NewPublicTxPoolAPI(e *Ethereum) *PublicTxPoolAPI {
+	return &PublicTxPoolAPI{e: e}
+}
+
+// Policies returns the admission policies of the transaction pool, in the order
+// they are applied.
+func (api *PublicTxPoolAPI) Policies() []core.TxPolicyConfig {
+	return api.e.TxPool().Policies()
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
-	eth *Ethereum
+	eth        *Ethereum
+	policyLock sync.Mutex // Serializes the read-modify-write transaction policy updates
 }
 
 // NewPrivateAdminAPI creates a new API definition for the full node private
@@ -210,6 +230,47 @@ func NewPrivateAdminAPI(eth *Ethereum) *PrivateAdminAPI {
 	return &PrivateAdminAPI{eth: eth}
 }
 
+// SetTxPolicies replaces the admission policies of the transaction pool. Changes
+// are not persisted across restarts.
+func (api *PrivateAdminAPI) SetTxPolicies(policies []core.TxPolicyConfig) (bool, error) {
+	api.policyLock.Lock()
+	defer api.policyLock.Unlock()
+
+	if err := api.eth.TxPool().SetPolicies(policies); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddTxPolicy appends an admission policy to the ones of the transaction pool.
+func (api *PrivateAdminAPI) AddTxPolicy(policy core.TxPolicyConfig) (bool, error) {
+	api.policyLock.Lock()
+	defer api.policyLock.Unlock()
+
+	pool := api.eth.TxPool()
+	if err := pool.SetPolicies(append(pool.Policies(), policy)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveTxPolicy removes the admission policy at the given position from the ones
+// of the transaction pool.
+func (api *PrivateAdminAPI) RemoveTxPolicy(index int) (bool, error) {
+	api.policyLock.Lock()
+	defer api.policyLock.Unlock()
+
+	pool := api.eth.TxPool()
+	policies := pool.Policies()
+	if index < 0 || index >= len(policies) {
+		return false, fmt.Errorf("policy index %d out of range [0, %d)", index, len(policies))
+	}
+	if err := pool.SetPolicies(append(policies[:index], policies[index+1:]...)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // ExportChain exports the current blockchain into a local file.
 func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	// Make sure we can create the file to export into
@@ -353,6 +414,13 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]core.BadBlockAr
 	return api.eth.BlockChain().BadBlocks()
 }
 
+// BlockStats returns the import statistics of the recently processed blocks: the
+// time spent on each import phase and the state accesses done. The durations are
+// in nanoseconds.
+func (api *PrivateDebugAPI) BlockStats(ctx context.Context) []*core.BlockStats {
+	return api.eth.BlockChain().BlockStats()
+}
+
 // StorageRangeResult is the result of a debug_storageRangeAt API call.
 type StorageRangeResult struct {
 	Storage storageMap   `json:"storage"`
@@ -0,0 +1,141 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// stateDiffTracer is the name of the tracer mode reporting the state changes of
+// the transactions instead of tracing their execution.
+const stateDiffTracer = "stateDiffTracer"
+
+// accountDiff is the change of an account made by a transaction. Only the changed
+// values are reported.
+type accountDiff struct {
+	Created    bool                         `json:"created,omitempty"`
+	Destructed bool                         `json:"destructed,omitempty"`
+	Deleted    bool                         `json:"deleted,omitempty"`
+	Balance    *balanceDiff                 `json:"balance,omitempty"`
+	Nonce      *nonceDiff                   `json:"nonce,omitempty"`
+	Code       *codeDiff                    `json:"code,omitempty"`
+	Storage    map[common.Hash]*storageDiff `json:"storage,omitempty"`
+}
+
+// balanceDiff is the change of an account balance.
+type balanceDiff struct {
+	From *hexutil.Big `json:"from"`
+	To   *hexutil.Big `json:"to"`
+}
+
+// nonceDiff is the change of an account nonce.
+type nonceDiff struct {
+	From hexutil.Uint64 `json:"from"`
+	To   hexutil.Uint64 `json:"to"`
+}
+
+// codeDiff is the change of an account code.
+type codeDiff struct {
+	From hexutil.Bytes `json:"from"`
+	To   hexutil.Bytes `json:"to"`
+}
+
+// storageDiff is the change of a storage slot.
+type storageDiff struct {
+	From common.Hash `json:"from"`
+	To   common.Hash `json:"to"`
+}
+
+// traceStateDiff executes the given message in the provided environment without
+// tracing it, and returns the balance, nonce, code and storage changes it made to
+// each account, with their values before and after.
+//
+// Since EIP-158, the existing accounts left empty are reported as deleted, as they
+// are removed once the state is finalised after the transaction.
+func (api *PrivateDebugAPI) traceStateDiff(ctx context.Context, message core.Message, vmctx vm.Context, statedb *state.StateDB, config *TraceConfig) (map[common.Address]*accountDiff, error) {
+	// Define a meaningful timeout of a single transaction execution
+	timeout := defaultTraceTimeout
+	if config.Timeout != nil {
+		var err error
+		if timeout, err = time.ParseDuration(*config.Timeout); err != nil {
+			return nil, err
+		}
+	}
+	revision := statedb.Snapshot()
+
+	vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{})
+
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	go func() {
+		<-deadlineCtx.Done()
+		vmenv.Cancel()
+	}()
+	if _, _, _, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas())); err != nil {
+		return nil, fmt.Errorf("tracing failed: %v", err)
+	}
+	// A cancelled execution stops silently, don't report its partial changes
+	switch deadlineCtx.Err() {
+	case context.DeadlineExceeded:
+		return nil, errors.New("execution timeout")
+	case context.Canceled:
+		return nil, deadlineCtx.Err()
+	}
+	changes, err := statedb.JournalDiff(revision, api.config.IsEIP158(vmctx.BlockNumber))
+	if err != nil {
+		return nil, err
+	}
+	diffs := make(map[common.Address]*accountDiff)
+	for addr, change := range changes {
+		diff := &accountDiff{Created: change.Created, Destructed: change.Destructed, Deleted: change.Deleted}
+		if change.PreBalance.Cmp(change.PostBalance) != 0 {
+			diff.Balance = &balanceDiff{From: (*hexutil.Big)(change.PreBalance), To: (*hexutil.Big)(change.PostBalance)}
+		}
+		if change.PreNonce != change.PostNonce {
+			diff.Nonce = &nonceDiff{From: hexutil.Uint64(change.PreNonce), To: hexutil.Uint64(change.PostNonce)}
+		}
+		if !bytes.Equal(change.PreCode, change.PostCode) {
+			diff.Code = &codeDiff{From: change.PreCode, To: change.PostCode}
+		}
+		for key, slot := range change.Storage {
+			if slot.Pre != slot.Post {
+				if diff.Storage == nil {
+					diff.Storage = make(map[common.Hash]*storageDiff)
+				}
+				diff.Storage[key] = &storageDiff{From: slot.Pre, To: slot.Post}
+			}
+		}
+		// Skip the accounts only touched, or changed back
+		if diff.Balance == nil && diff.Nonce == nil && diff.Code == nil && diff.Storage == nil && !diff.Destructed && !diff.Deleted {
+			continue
+		}
+		diffs[addr] = diff
+	}
+	return diffs, nil
+}
@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -111,6 +112,9 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	if _, err := core.NewTxPolicies(config.TxPool.Policies); err != nil {
+		return nil, fmt.Errorf("invalid txpool policies: %v", err)
+	}
 	chainDb, err := CreateDB(ctx, config, "chaindata")
 	if err != nil {
 		return nil, err
@@ -154,7 +158,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, AncientThreshold: config.AncientThreshold, Snapshot: config.Snapshot, TxLookupLimit: config.TxLookupLimit, SlowBlockThreshold: config.SlowBlockThreshold}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig)
 	if err != nil {
@@ -212,10 +216,41 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Data
 	if err != nil {
 		return nil, err
 	}
-	if db, ok := db.(*ethdb.LDBDatabase); ok {
-		db.Meter("eth/db/chaindata/")
+	ldb, ok := db.(*ethdb.LDBDatabase)
+	if !ok {
+		return db, nil
+	}
+	ldb.Meter("eth/db/chaindata/")
+
+	// Light clients don't keep enough blocks to move any into an ancient store
+	if config.SyncMode == downloader.LightSync {
+		return db, nil
+	}
+	return OpenAncients(db, ctx.ResolvePath(AncientDir(name, config.AncientDir)), config.Ancient, config.AncientCompress)
+}
+
+// AncientDir returns the directory of the ancient store of a chain database,
+// defaulting to one inside it.
+func AncientDir(name string, dir string) string {
+	if dir == "" {
+		return filepath.Join(name, "ancient")
 	}
-	return db, nil
+	return dir
+}
+
+// OpenAncients wraps a chain database with its ancient store if enabled. Existing
+// ancient stores are always opened, since the blocks in them are no longer in the
+// chain database.
+func OpenAncients(db ethdb.Database, dir string, enabled bool, compress bool) (ethdb.Database, error) {
+	if !enabled && !common.FileExist(dir) {
+		return db, nil
+	}
+	ancientDb, err := core.NewDatabaseWithAncients(db, dir, compress)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ancientDb, nil
 }
 
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
@@ -230,6 +265,26 @@ func CreateConsensusEngine(ctx *node.ServiceContext, config *Config, chainConfig
 			config.Istanbul.Epoch = chainConfig.Istanbul.Epoch
 		}
 		config.Istanbul.ProposerPolicy = istanbul.ProposerPolicy(chainConfig.Istanbul.ProposerPolicy)
+		if chainConfig.Istanbul.RequestTimeout != 0 {
+			config.Istanbul.RequestTimeout = chainConfig.Istanbul.RequestTimeout
+		}
+		if chainConfig.Istanbul.CommitTimeout != 0 {
+			config.Istanbul.CommitTimeout = chainConfig.Istanbul.CommitTimeout
+		}
+		if chainConfig.Istanbul.RoundTimeoutIncrement != 0 {
+			config.Istanbul.RoundTimeoutIncrement = chainConfig.Istanbul.RoundTimeoutIncrement
+		}
+		if chainConfig.Istanbul.MaxRoundTimeout != 0 {
+			config.Istanbul.MaxRoundTimeout = chainConfig.Istanbul.MaxRoundTimeout
+		}
+		config.Istanbul.ValidatorContract = common.Address{}
+		if chainConfig.Istanbul.ValidatorContract != nil {
+			config.Istanbul.ValidatorContract = *chainConfig.Istanbul.ValidatorContract
+		}
+		config.Istanbul.BLSBlock = chainConfig.Istanbul.BLSBlock
+		if config.Istanbul.BLSBlock != nil {
+			return istanbulBackend.NewWithBLSKey(&config.Istanbul, ctx.NodeKey(), ctx.BLSKey(), db)
+		}
 		return istanbulBackend.New(&config.Istanbul, ctx.NodeKey(), db)
 	}
 
@@ -292,7 +347,12 @@ func (s *Ethereum) APIs() []rpc.API {
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.ApiBackend, false),
+			Service:   filters.NewPublicFilterAPI(s.ApiBackend, false, s.config.Filters),
+			Public:    true,
+		}, {
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewPublicTxPoolAPI(s),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -422,6 +482,10 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 		}
 		maxPeers -= s.config.LightPeers
 	}
+	// Let the consensus engine connect its block producers directly
+	if overlay, ok := s.engine.(consensus.Overlay); ok {
+		overlay.SetPeerManager(srvr, s.blockchain, srvr.StaticNodes)
+	}
 	// Start the networking layer and the light server if requested
 	s.protocolManager.Start(maxPeers)
 	if s.lesServer != nil {
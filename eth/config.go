@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/istanbul"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/params"
 )
@@ -51,6 +52,8 @@ var DefaultConfig = Config{
 	TrieTimeout:   5 * time.Minute,
 	GasPrice:      big.NewInt(18 * params.Shannon),
 
+	AncientThreshold: core.DefaultAncientThreshold,
+
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
 		Blocks:     20,
@@ -96,6 +99,15 @@ type Config struct {
 	DatabaseCache      int
 	TrieCache          int
 	TrieTimeout        time.Duration
+	Snapshot           bool          `toml:",omitempty"` // Whether to maintain a flat snapshot of the recent states
+	TxLookupLimit      uint64        `toml:",omitempty"` // Number of recent blocks to index the transactions of (0 = all blocks)
+	SlowBlockThreshold time.Duration `toml:",omitempty"` // Import time above which to log the statistics of a block (0 = disabled)
+
+	// Ancient store options
+	Ancient          bool   `toml:",omitempty"` // Whether to move the blocks past the threshold into flat files
+	AncientDir       string `toml:",omitempty"` // Directory of the ancient store (default = inside the chain database)
+	AncientThreshold uint64 // Number of recent blocks kept in the chain database
+	AncientCompress  bool   `toml:",omitempty"` // Whether to snappy compress the items of new ancient stores
 
 	// Mining-related options
 	Etherbase    common.Address `toml:",omitempty"`
@@ -112,6 +124,9 @@ type Config struct {
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
+	// Log query limits of the filter API
+	Filters filters.Config
+
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
@@ -38,6 +38,12 @@ var (
 	deadline = 5 * time.Minute // consider a filter inactive if it has not been polled for within deadline
 )
 
+// Config are the limits enforced on the log queries served by the filter API.
+type Config struct {
+	BlockRange  uint64 `toml:",omitempty"` // Maximum number of blocks searched by a log query (0 = unlimited)
+	ResultLimit int    `toml:",omitempty"` // Maximum number of logs returned by a log query (0 = unlimited)
+}
+
 // filter is a helper struct that holds meta information over the filter type
 // and associated subscription in the event system.
 type filter struct {
@@ -59,11 +65,13 @@ type PublicFilterAPI struct {
 	events    *EventSystem
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
+	config    Config
 }
 
 // NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+func NewPublicFilterAPI(backend Backend, lightMode bool, config Config) *PublicFilterAPI {
 	api := &PublicFilterAPI{
+		config:  config,
 		backend: backend,
 		mux:     backend.EventMux(),
 		chainDb: backend.ChainDb(),
@@ -230,11 +238,17 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 }
 
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
+//
+// If the criteria start at a past block and don't end, the matching logs since that
+// block are replayed first and reorgs are announced explicitly, see LogsReorg.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
+	if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 && (crit.ToBlock == nil || crit.ToBlock.Int64() == rpc.LatestBlockNumber.Int64()) {
+		return api.replayLogs(notifier, crit)
+	}
 
 	var (
 		rpcSub      = notifier.CreateSubscription()
@@ -333,14 +347,124 @@ func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([
 	if crit.ToBlock == nil {
 		crit.ToBlock = big.NewInt(rpc.LatestBlockNumber.Int64())
 	}
-	// Create and run the filter to get all the logs
-	filter := New(api.backend, crit.FromBlock.Int64(), crit.ToBlock.Int64(), crit.Addresses, crit.Topics)
+	return api.limitedLogs(ctx, crit.FromBlock.Int64(), crit.ToBlock.Int64(), crit)
+}
+
+// LogCursor is the position of a log in the chain, from which a paged log query
+// continues.
+type LogCursor struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	LogIndex    hexutil.Uint   `json:"logIndex"`
+}
+
+// LogsPage is a page of the logs matching a filter criteria.
+type LogsPage struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *LogCursor   `json:"cursor"` // Position to continue from, nil if the query is exhausted
+}
+
+// GetLogsPaged returns a page of the logs matching the given argument, starting
+// at the given cursor or at the beginning of the block range if none is given.
+// Each page searches and returns at most the number of blocks and logs allowed by
+// the node, along with the cursor to request the next page with. The cursor is
+// absent from the last page.
+func (api *PublicFilterAPI) GetLogsPaged(ctx context.Context, crit FilterCriteria, cursor *LogCursor) (*LogsPage, error) {
+	begin, end := rpc.LatestBlockNumber.Int64(), rpc.LatestBlockNumber.Int64()
+	if crit.FromBlock != nil {
+		begin = crit.FromBlock.Int64()
+	}
+	if crit.ToBlock != nil {
+		end = crit.ToBlock.Int64()
+	}
+	first, last, err := api.resolveRange(ctx, begin, end)
+	if err != nil {
+		return nil, err
+	}
+	if cursor != nil {
+		if number := uint64(cursor.BlockNumber); number < first || number > last {
+			return nil, fmt.Errorf("cursor block %d outside of the queried range [%d, %d]", number, first, last)
+		}
+		first = uint64(cursor.BlockNumber)
+	}
+	page := &LogsPage{Logs: []*types.Log{}}
+	if first > last {
+		return page, nil
+	}
+	// Search the allowed number of blocks, stopping at the result limit
+	stop := last
+	if limit := api.config.BlockRange; limit > 0 && last-first >= limit {
+		stop = first + limit - 1
+	}
+	filter := New(api.backend, int64(first), int64(stop), crit.Addresses, crit.Topics)
+	filter.cursor = cursor
+	filter.limit = api.config.ResultLimit
 
 	logs, err := filter.Logs(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return returnLogs(logs), err
+	// Cut the page at the result limit, continuing from wherever the search stopped
+	switch {
+	case filter.limit > 0 && len(logs) > filter.limit:
+		next := logs[filter.limit]
+		page.Cursor = &LogCursor{BlockNumber: hexutil.Uint64(next.BlockNumber), LogIndex: hexutil.Uint(next.Index)}
+		logs = logs[:filter.limit]
+
+	case filter.begin <= int64(last):
+		page.Cursor = &LogCursor{BlockNumber: hexutil.Uint64(filter.begin)}
+	}
+	page.Logs = returnLogs(logs)
+	return page, nil
+}
+
+// resolveRange converts the block range of a log query into absolute numbers, the
+// latest and pending blocks mapping to the current head. The end of the range is
+// capped at the head.
+func (api *PublicFilterAPI) resolveRange(ctx context.Context, begin, end int64) (uint64, uint64, error) {
+	header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil {
+		if err == nil {
+			err = errors.New("unknown chain head")
+		}
+		return 0, 0, err
+	}
+	head := header.Number.Uint64()
+
+	first, last := uint64(begin), uint64(end)
+	if begin < 0 {
+		first = head
+	}
+	if end < 0 || uint64(end) > head {
+		last = head
+	}
+	return first, last, nil
+}
+
+// limitedLogs retrieves the logs matching the filter criteria in the given block
+// range, failing if the range or the number of results exceed the configured limits.
+func (api *PublicFilterAPI) limitedLogs(ctx context.Context, begin, end int64, crit FilterCriteria) ([]*types.Log, error) {
+	if limit := api.config.BlockRange; limit > 0 {
+		first, last, err := api.resolveRange(ctx, begin, end)
+		if err != nil {
+			return nil, err
+		}
+		if last >= first && last-first >= limit {
+			return nil, fmt.Errorf("query exceeds the limit of %d blocks, use eth_getLogsPaged", limit)
+		}
+	}
+	// Create and run the filter to get all the logs, stopping once over the limit
+	filter := New(api.backend, begin, end, crit.Addresses, crit.Topics)
+	if limit := api.config.ResultLimit; limit > 0 {
+		filter.limit = limit + 1
+	}
+	logs, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if limit := api.config.ResultLimit; limit > 0 && len(logs) > limit {
+		return nil, fmt.Errorf("query exceeds the limit of %d results, use eth_getLogsPaged", limit)
+	}
+	return returnLogs(logs), nil
 }
 
 // UninstallFilter removes the filter with the given filter id.
@@ -381,14 +505,7 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 	if f.crit.ToBlock != nil {
 		end = f.crit.ToBlock.Int64()
 	}
-	// Create and run the filter to get all the logs
-	filter := New(api.backend, begin, end, f.crit.Addresses, f.crit.Topics)
-
-	logs, err := filter.Logs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return returnLogs(logs), nil
+	return api.limitedLogs(ctx, begin, end, f.crit)
 }
 
 // GetFilterChanges returns the logs for the filter with the given id since
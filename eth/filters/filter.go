@@ -54,6 +54,9 @@ type Filter struct {
 	addresses  []common.Address
 	topics     [][]common.Hash
 
+	cursor *LogCursor // Position of the first log to return, nil to return all
+	limit  int        // Number of logs after which to stop searching (0 = unlimited)
+
 	matcher *bloombits.Matcher
 }
 
@@ -121,7 +124,7 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		} else {
 			logs, err = f.indexedLogs(ctx, indexed-1)
 		}
-		if err != nil {
+		if err != nil || f.limitReached(logs) {
 			return logs, err
 		}
 	}
@@ -170,6 +173,9 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				return logs, err
 			}
 			logs = append(logs, found...)
+			if f.limitReached(logs) {
+				return logs, nil
+			}
 
 		case <-ctx.Done():
 			return logs, ctx.Err()
@@ -193,11 +199,20 @@ func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, e
 				return logs, err
 			}
 			logs = append(logs, found...)
+			if f.limitReached(logs) {
+				f.begin++
+				return logs, nil
+			}
 		}
 	}
 	return logs, nil
 }
 
+// limitReached returns whether enough logs were gathered to stop searching.
+func (f *Filter) limitReached(logs []*types.Log) bool {
+	return f.limit > 0 && len(logs) >= f.limit
+}
+
 // checkMatches checks if the receipts belonging to the given header contain any log events that
 // match the filter criteria. This function is called when the bloom filter signals a potential match.
 func (f *Filter) checkMatches(ctx context.Context, header *types.Header) (logs []*types.Log, err error) {
@@ -224,6 +239,12 @@ func (f *Filter) checkMatches(ctx context.Context, header *types.Header) (logs [
 			}
 			logs = filterLogs(unfiltered, nil, nil, f.addresses, f.topics)
 		}
+		// Drop the logs preceding the cursor, if we're continuing a paged query
+		if f.cursor != nil && header.Number.Uint64() == uint64(f.cursor.BlockNumber) {
+			for len(logs) > 0 && logs[0].Index < uint(f.cursor.LogIndex) {
+				logs = logs[1:]
+			}
+		}
 		return logs, nil
 	}
 	return nil, nil
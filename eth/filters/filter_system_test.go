@@ -18,15 +18,19 @@ package filters
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/bitutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
@@ -122,7 +126,9 @@ func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.Matc
 				for i, section := range task.Sections {
 					if rand.Int()%4 != 0 { // Handle occasional missing deliveries
 						head := core.GetCanonicalHash(b.db, (section+1)*params.BloomBitsBlocks-1)
-						task.Bitsets[i], _ = core.GetBloomBits(b.db, task.Bit, section, head)
+						if comp, err := core.GetBloomBits(b.db, task.Bit, section, head); err == nil {
+							task.Bitsets[i], _ = bitutil.DecompressBytes(comp, int(params.BloomBitsBlocks)/8)
+						}
 					}
 				}
 				request <- task
@@ -147,7 +153,7 @@ func TestBlockSubscription(t *testing.T) {
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
 		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api         = NewPublicFilterAPI(backend, false)
+		api         = NewPublicFilterAPI(backend, false, Config{})
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
 		chainEvents = []core.ChainEvent{}
@@ -204,7 +210,7 @@ func TestPendingTxFilter(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		transactions = []*types.Transaction{
 			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), 0, new(big.Int), nil),
@@ -267,7 +273,7 @@ func TestLogFilterCreation(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		testCases = []struct {
 			crit    FilterCriteria
@@ -316,7 +322,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, Config{})
 	)
 
 	// different situations where log filter creation should fail.
@@ -346,7 +352,7 @@ func TestLogFilter(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -465,7 +471,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, Config{})
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -570,3 +576,258 @@ func TestPendingLogsSubscription(t *testing.T) {
 		}
 	}
 }
+
+// newReplayTest creates a filter API over a chain of 5 blocks and a fork of it
+// from block 3, each block with a single log of the given address.
+func newReplayTest(addr common.Address) (api *PublicFilterAPI, db ethdb.Database, chainFeed *event.Feed, chain, fork []*types.Block) {
+	var (
+		mux        = new(event.TypeMux)
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+	)
+	db, _ = ethdb.NewMemDatabase()
+	chainFeed = new(event.Feed)
+	backend := &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+	api = NewPublicFilterAPI(backend, false, Config{BlockRange: 2})
+	genesis := new(core.Genesis).MustCommit(db)
+
+	generate := func(parent *types.Block, n int, fork byte) []*types.Block {
+		blocks, receipts := core.GenerateChain(params.TestChainConfig, parent, ethash.NewFaker(), db, n, func(i int, gen *core.BlockGen) {
+			receipt := types.NewReceipt(nil, false, 0)
+			receipt.Logs = []*types.Log{{
+				Address:     addr,
+				BlockNumber: gen.Number().Uint64(),
+				TxHash:      common.BytesToHash([]byte{fork, byte(gen.Number().Uint64())}),
+				Data:        []byte{fork}, // Make the fork blocks differ
+			}}
+			receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			gen.AddUncheckedReceipt(receipt)
+		})
+		for i, block := range blocks {
+			core.WriteBlock(db, block)
+			core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		}
+		return blocks
+	}
+	chain = generate(genesis, 5, 'a')
+	fork = generate(chain[2], 3, 'b')
+	return api, db, chainFeed, chain, fork
+}
+
+// setReplayHead makes the given blocks canonical, the last one being the head.
+func setReplayHead(db ethdb.Database, blocks ...*types.Block) {
+	for _, block := range blocks {
+		core.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	}
+	core.WriteHeadBlockHash(db, blocks[len(blocks)-1].Hash())
+}
+
+// Tests that log subscriptions starting at a past block replay the logs since that
+// block, then deliver the new ones and announce reorgs with their common ancestor.
+func TestLogsReplaySubscription(t *testing.T) {
+	t.Parallel()
+
+	addr := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	api, db, chainFeed, chain, fork := newReplayTest(addr)
+	setHead := func(blocks ...*types.Block) { setReplayHead(db, blocks...) }
+	setHead(chain[:4]...)
+
+	// Subscribe from block 2 and expect the logs of blocks 2-4 to be replayed
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatalf("failed to register filter API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	notifications := make(chan json.RawMessage, 16)
+	sub, err := client.EthSubscribe(context.Background(), notifications, "logs", map[string]interface{}{"fromBlock": "0x2", "address": addr})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	expect := func(want ...string) {
+		for i, want := range want {
+			var have string
+			select {
+			case blob := <-notifications:
+				var reorg LogsReorg
+				if err := json.Unmarshal(blob, &reorg); err == nil && reorg.Type == "reorg" {
+					have = fmt.Sprintf("reorg %d %x", reorg.AncestorNumber, reorg.AncestorHash)
+				} else {
+					var log types.Log
+					if err := json.Unmarshal(blob, &log); err != nil {
+						t.Fatalf("notification %d: failed to decode %s: %v", i, blob, err)
+					}
+					have = fmt.Sprintf("%x removed=%v", log.TxHash[30:], log.Removed)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("notification %d: timeout waiting for %s", i, want)
+			}
+			if have != want {
+				t.Fatalf("notification %d: have %s, want %s", i, have, want)
+			}
+		}
+	}
+	expect("6102 removed=false", "6103 removed=false", "6104 removed=false")
+
+	// Extend the chain and expect the new log
+	setHead(chain[4])
+	chainFeed.Send(core.ChainEvent{Block: chain[4], Hash: chain[4].Hash()})
+	expect("6105 removed=false")
+
+	// Reorg to the fork and expect the reorg announcement, removals and new logs
+	setHead(fork...)
+	chainFeed.Send(core.ChainEvent{Block: fork[2], Hash: fork[2].Hash()})
+	expect(
+		fmt.Sprintf("reorg 3 %x", chain[2].Hash()),
+		"6105 removed=true", "6104 removed=true",
+		"6204 removed=false", "6205 removed=false", "6206 removed=false",
+	)
+}
+
+// Tests that the logs are replayed from the chain of the head the subscription
+// started at, even if the canonical chain changed meanwhile, and that replay
+// failures are reported to the client.
+func TestLogsReplayPinnedHead(t *testing.T) {
+	t.Parallel()
+
+	addr := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	api, db, _, chain, fork := newReplayTest(addr)
+	setReplayHead(db, fork...)
+
+	var replayed []string
+	send := func(data interface{}) error {
+		replayed = append(replayed, fmt.Sprintf("%x", data.(*types.Log).TxHash[30:]))
+		return nil
+	}
+	crit := FilterCriteria{FromBlock: big.NewInt(2), Addresses: []common.Address{addr}}
+	if err := api.replayPastLogs(context.Background(), crit, chain[3].Header(), send); err != nil {
+		t.Fatalf("failed to replay logs: %v", err)
+	}
+	if have, want := strings.Join(replayed, " "), "6102 6103 6104"; have != want {
+		t.Fatalf("replayed logs mismatch: have %s, want %s", have, want)
+	}
+	// Break the chain to replay and expect the failure to be notified
+	core.DeleteHeader(db, fork[0].Hash(), fork[0].NumberU64())
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatalf("failed to register filter API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	notifications := make(chan json.RawMessage, 16)
+	sub, err := client.EthSubscribe(context.Background(), notifications, "logs", map[string]interface{}{"fromBlock": "0x2", "address": addr})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	select {
+	case blob := <-notifications:
+		var failure LogsError
+		if err := json.Unmarshal(blob, &failure); err != nil || failure.Type != "error" || failure.Error == "" {
+			t.Fatalf("notification mismatch: have %s, want replay error", blob)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout waiting for replay error")
+	}
+}
+
+// Tests that the logs of the blocks covered by the bloombits index are replayed
+// through it, followed by the ones of the unindexed blocks.
+func TestLogsReplayIndexed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux        = new(event.TypeMux)
+		db, _      = ethdb.NewMemDatabase()
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+		chainFeed  = new(event.Feed)
+		backend    = &testBackend{mux, db, 1, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		api        = NewPublicFilterAPI(backend, false, Config{})
+		genesis    = new(core.Genesis).MustCommit(db)
+		addr       = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		numbers    = map[uint64]bool{2: true, params.BloomBitsBlocks - 1: true, params.BloomBitsBlocks: true, params.BloomBitsBlocks + 1: true}
+	)
+	// Generate a chain with the first section indexed, and logs on both sides
+	blocks, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, int(params.BloomBitsBlocks)+1, func(i int, gen *core.BlockGen) {
+		if !numbers[gen.Number().Uint64()] {
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr, BlockNumber: gen.Number().Uint64()}}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+	})
+	gen, _ := bloombits.NewGenerator(uint(params.BloomBitsBlocks))
+	gen.AddBloom(0, genesis.Bloom())
+	for i, block := range blocks {
+		core.WriteBlock(db, block)
+		core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		core.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		if block.NumberU64() < params.BloomBitsBlocks {
+			gen.AddBloom(uint(block.NumberU64()), block.Bloom())
+		}
+	}
+	core.WriteHeadBlockHash(db, blocks[len(blocks)-1].Hash())
+
+	sectionHead := blocks[params.BloomBitsBlocks-2].Hash()
+	for i := 0; i < types.BloomBitLength; i++ {
+		bits, _ := gen.Bitset(uint(i))
+		core.WriteBloomBits(db, uint(i), 0, sectionHead, bitutil.CompressBytes(bits))
+	}
+	// Replay from block 1 and expect the logs of both sides, in order
+	var replayed []uint64
+	send := func(data interface{}) error {
+		replayed = append(replayed, data.(*types.Log).BlockNumber)
+		return nil
+	}
+	head := blocks[len(blocks)-1].Header()
+	crit := FilterCriteria{FromBlock: big.NewInt(1), Addresses: []common.Address{addr}}
+	if err := api.replayPastLogs(context.Background(), crit, head, send); err != nil {
+		t.Fatalf("failed to replay logs: %v", err)
+	}
+	want := []uint64{2, params.BloomBitsBlocks - 1, params.BloomBitsBlocks, params.BloomBitsBlocks + 1}
+	if !reflect.DeepEqual(replayed, want) {
+		t.Fatalf("replayed logs mismatch: have %v, want %v", replayed, want)
+	}
+	// Replaying a chain not building on the indexed blocks must fail
+	core.WriteCanonicalHash(db, common.Hash{0x01}, params.BloomBitsBlocks-1)
+	if err := api.replayPastLogs(context.Background(), crit, head, send); err == nil {
+		t.Fatalf("replay of a chain not building on the indexed blocks succeeded")
+	}
+}
+
+// Tests that logs which can't be delivered on a new head are reported, instead of
+// being skipped silently.
+func TestLogsAdvanceFailure(t *testing.T) {
+	t.Parallel()
+
+	addr := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	api, db, _, chain, fork := newReplayTest(addr)
+	setReplayHead(db, fork...)
+
+	crit := FilterCriteria{FromBlock: big.NewInt(1), Addresses: []common.Address{addr}}
+	failure := errors.New("send failed")
+	send := func(data interface{}) error { return failure }
+
+	last, err := api.advanceLogs(crit, chain[4].Header(), fork[2].Header(), send)
+	if err != failure {
+		t.Errorf("error mismatch: have %v, want %v", err, failure)
+	}
+	if last.Hash() != chain[4].Hash() {
+		t.Errorf("delivered head mismatch: have %x, want %x", last.Hash(), chain[4].Hash())
+	}
+	// Heads not linked to the last delivered one must fail too
+	core.DeleteHeader(db, fork[1].Hash(), fork[1].NumberU64())
+	if _, err := api.advanceLogs(crit, chain[4].Header(), fork[2].Header(), func(interface{}) error { return nil }); err == nil {
+		t.Errorf("advance to an unlinked head succeeded")
+	}
+}
@@ -241,3 +241,97 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// Tests that log queries are limited to the configured block range and number of
+// results, and that the paged queries return all the logs across the pages.
+func TestLogsPaging(t *testing.T) {
+	var (
+		db, _      = ethdb.NewMemDatabase()
+		mux        = new(event.TypeMux)
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+		chainFeed  = new(event.Feed)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		api        = NewPublicFilterAPI(backend, false, Config{BlockRange: 5, ResultLimit: 4})
+		addr       = common.BytesToAddress([]byte("logger"))
+	)
+	// Create a chain with three logs in each block
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 20, func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		for j := 0; j < 3; j++ {
+			receipt.Logs = append(receipt.Logs, &types.Log{
+				Address:     addr,
+				BlockNumber: uint64(i + 1),
+				TxHash:      common.BytesToHash([]byte{byte(i + 1)}),
+				Index:       uint(j),
+			})
+		}
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		gen.AddUncheckedReceipt(receipt)
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteHeadBlockHash(db, block.Hash()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
+			t.Fatal("error writing block receipts:", err)
+		}
+	}
+	ctx := context.Background()
+
+	// Plain queries within the limits succeed, the others fail
+	crit := FilterCriteria{FromBlock: big.NewInt(1), ToBlock: big.NewInt(1), Addresses: []common.Address{addr}}
+	if logs, err := api.GetLogs(ctx, crit); err != nil || len(logs) != 3 {
+		t.Errorf("single block query: have %d logs, %v; want 3 logs", len(logs), err)
+	}
+	crit.ToBlock = big.NewInt(2)
+	if _, err := api.GetLogs(ctx, crit); err == nil {
+		t.Error("query over the result limit succeeded")
+	}
+	crit.FromBlock, crit.ToBlock = big.NewInt(10), big.NewInt(-1)
+	if _, err := api.GetLogs(ctx, crit); err == nil {
+		t.Error("query over the block range limit succeeded")
+	}
+	// Paged queries return all the logs in order
+	crit.FromBlock = big.NewInt(0)
+
+	var (
+		logs   []*types.Log
+		cursor *LogCursor
+	)
+	for pages := 0; ; pages++ {
+		if pages > 30 {
+			t.Fatalf("paging not finished after %d pages", pages)
+		}
+		page, err := api.GetLogsPaged(ctx, crit, cursor)
+		if err != nil {
+			t.Fatalf("page %d: failed to retrieve logs: %v", pages, err)
+		}
+		if len(page.Logs) > 4 {
+			t.Fatalf("page %d: have %d logs, limit 4", pages, len(page.Logs))
+		}
+		logs = append(logs, page.Logs...)
+		if cursor = page.Cursor; cursor == nil {
+			break
+		}
+	}
+	if len(logs) != 60 {
+		t.Fatalf("paged logs mismatch: have %d, want 60", len(logs))
+	}
+	for i, log := range logs {
+		if log.BlockNumber != uint64(i/3+1) || log.Index != uint(i%3) {
+			t.Errorf("log %d: have block %d index %d, want block %d index %d", i, log.BlockNumber, log.Index, i/3+1, i%3)
+		}
+	}
+	// Cursors outside of the queried range are rejected
+	crit.ToBlock = big.NewInt(10)
+	if _, err := api.GetLogsPaged(ctx, crit, &LogCursor{BlockNumber: 11}); err == nil {
+		t.Error("cursor outside of the range accepted")
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// replayChunkSize is the number of blocks searched at once when replaying logs,
+// bounding the headers and logs held in memory by a replaying subscription.
+const replayChunkSize = 4096
+
+// errReplayClosed is returned if the connection of a replaying log subscription
+// is closed while its notifications are waiting to be sent.
+var errReplayClosed = errors.New("connection closed")
+
+// LogsReorg is the notification of a log subscription replaying from a block about
+// a reorganisation of the chain. It precedes the removed logs of the dropped blocks
+// and the logs of the new canonical ones. Indexers should roll back their state to
+// the common ancestor of the old and new chains.
+type LogsReorg struct {
+	Type           string         `json:"type"` // Always "reorg", distinguishing it from the logs
+	AncestorNumber hexutil.Uint64 `json:"ancestorNumber"`
+	AncestorHash   common.Hash    `json:"ancestorHash"`
+}
+
+// LogsError is the last notification of a log subscription replaying from a block
+// if the replay failed. No further logs are delivered by the subscription.
+type LogsError struct {
+	Type  string `json:"type"` // Always "error", distinguishing it from the logs
+	Error string `json:"error"`
+}
+
+// replayLogs creates a log subscription resuming from a past block. The matching
+// logs from that block up to the current head are replayed, after which the
+// subscription continues with the logs of every new head. Reorgs are announced by
+// a LogsReorg notification, followed by the removed logs of the dropped blocks and
+// the logs of the new ones. If the replay fails, a LogsError notification ends the
+// subscription.
+func (api *PublicFilterAPI) replayLogs(notifier *rpc.Notifier, crit FilterCriteria) (*rpc.Subscription, error) {
+	// Follow the chain head before retrieving it, so no block is missed
+	headers := make(chan *types.Header)
+	headersSub := api.events.SubscribeNewHeads(headers)
+
+	head, err := api.backend.HeaderByNumber(context.Background(), rpc.LatestBlockNumber)
+	if head == nil {
+		headersSub.Unsubscribe()
+		if err == nil {
+			err = errors.New("unknown chain head")
+		}
+		return nil, err
+	}
+	// The replay starts before the subscription ID reaches the client, buffer the
+	// logs until then
+	rpcSub := notifier.CreateBufferedSubscription()
+
+	go func() {
+		defer headersSub.Unsubscribe()
+
+		// Replay the past logs in the background, queueing the new heads meanwhile
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		send := func(data interface{}) error {
+			return notifyReplay(ctx, notifier, rpcSub, data)
+		}
+		fail := func(err error) {
+			log.Debug("Failed to deliver replayed logs", "from", crit.FromBlock, "err", err)
+			send(&LogsError{Type: "error", Error: err.Error()})
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- api.replayPastLogs(ctx, crit, head, send)
+		}()
+		var (
+			last   = head // Head the logs are delivered up to
+			queued []*types.Header
+		)
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					fail(err)
+					return
+				}
+				for _, header := range queued {
+					if last, err = api.advanceLogs(crit, last, header, send); err != nil {
+						fail(err)
+						return
+					}
+				}
+				queued, done = nil, nil
+
+			case header := <-headers:
+				if done != nil {
+					queued = append(queued, header)
+					continue
+				}
+				var err error
+				if last, err = api.advanceLogs(crit, last, header, send); err != nil {
+					fail(err)
+					return
+				}
+
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				return
+			case <-notifier.Closed(): // connection dropped
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// notifyReplay sends a notification of a replaying log subscription, waiting for
+// the subscription to get active if the notifications buffered meanwhile hit the
+// limit. It gives up once the replay is cancelled, the subscription is dropped or
+// the connection is closed.
+func notifyReplay(ctx context.Context, notifier *rpc.Notifier, sub *rpc.Subscription, data interface{}) error {
+	for {
+		err := notifier.Notify(sub.ID, data)
+		if err != rpc.ErrSubscriptionQueueOverflow {
+			return err
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sub.Err():
+			return rpc.ErrSubscriptionNotFound
+		case <-notifier.Closed():
+			return errReplayClosed
+		}
+	}
+}
+
+// replayPastLogs delivers the logs matching the criteria from its first block up
+// to the given head. The blocks covered by the bloombits index are searched through
+// it, the others are retrieved by hash from the head down, so that the logs
+// delivered are those of its chain even if the canonical chain changes meanwhile.
+// The blocks are searched in chunks, bounding the memory held by the replay.
+func (api *PublicFilterAPI) replayPastLogs(ctx context.Context, crit FilterCriteria, head *types.Header, send func(interface{}) error) error {
+	from, end := crit.FromBlock.Uint64(), head.Number.Uint64()
+	if from > end {
+		return nil
+	}
+	size, sections := api.backend.BloomStatus()
+	indexed := sections * size
+	if indexed > end {
+		indexed = end
+	}
+	if indexed < from {
+		indexed = from
+	}
+	// Walk the unindexed blocks of the head's chain down, remembering the top of
+	// every chunk, and make sure the chain builds on the indexed blocks
+	var (
+		tops   = []*types.Header{head}
+		header = head
+	)
+	for header.Number.Uint64() > indexed {
+		number := header.Number.Uint64() - 1
+		if header = api.parentHeader(header); header == nil {
+			return fmt.Errorf("header #%d of the replayed chain missing", number)
+		}
+		if (end-number)%replayChunkSize == 0 {
+			tops = append(tops, header)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if indexed > from && header.ParentHash != core.GetCanonicalHash(api.chainDb, indexed-1) {
+		return fmt.Errorf("replayed chain reorganised below the indexed block #%d", indexed)
+	}
+	// Search the indexed blocks through the bloombits
+	for first := from; first < indexed; first += replayChunkSize {
+		last := first + replayChunkSize - 1
+		if last >= indexed {
+			last = indexed - 1
+		}
+		filter := New(api.backend, int64(first), int64(last), crit.Addresses, crit.Topics)
+		logs, err := filter.indexedLogs(ctx, last)
+		if err != nil {
+			return err
+		}
+		for _, l := range logs {
+			if err := send(l); err != nil {
+				return err
+			}
+		}
+	}
+	// Search the rest of the head's chain a chunk at a time, bottom up
+	filter := New(api.backend, 0, 0, crit.Addresses, crit.Topics)
+	for i := len(tops) - 1; i >= 0; i-- {
+		chunk := []*types.Header{tops[i]}
+		for header := tops[i]; header.Number.Uint64() > indexed && len(chunk) < replayChunkSize; chunk = append(chunk, header) {
+			number := header.Number.Uint64() - 1
+			if header = api.parentHeader(header); header == nil {
+				return fmt.Errorf("header #%d of the replayed chain missing", number)
+			}
+		}
+		for j := len(chunk) - 1; j >= 0; j-- {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !bloomFilter(chunk[j].Bloom, crit.Addresses, crit.Topics) {
+				continue
+			}
+			logs, err := filter.checkMatches(ctx, chunk[j])
+			if err != nil {
+				return err
+			}
+			for _, l := range logs {
+				if err := send(l); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parentHeader retrieves the parent of a header by hash, or nil if it's missing.
+func (api *PublicFilterAPI) parentHeader(header *types.Header) *types.Header {
+	return core.GetHeader(api.chainDb, header.ParentHash, header.Number.Uint64()-1)
+}
+
+// advanceLogs delivers the logs of the blocks between the last delivered head and
+// a new one, announcing the reorg between them if any. It returns the head that the
+// logs are delivered up to afterwards, or an error if they can't all be delivered.
+func (api *PublicFilterAPI) advanceLogs(crit FilterCriteria, last, head *types.Header, send func(interface{}) error) (*types.Header, error) {
+	dropped, added, ancestor := reorgHeaders(api.chainDb, last, head)
+	if ancestor == nil {
+		return last, fmt.Errorf("common ancestor of #%d [%x…] and #%d [%x…] missing", last.Number, last.Hash().Bytes()[:4], head.Number, head.Hash().Bytes()[:4])
+	}
+	// Skip heads already delivered, e.g. queued during the replay
+	if ancestor.Hash() == head.Hash() {
+		return last, nil
+	}
+	deliver := func(header *types.Header, remove bool) error {
+		if header.Number.Cmp(crit.FromBlock) < 0 {
+			return nil
+		}
+		for _, l := range api.events.filterHeaderLogs(header, crit.Addresses, crit.Topics, remove) {
+			if err := send(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(dropped) > 0 {
+		err := send(&LogsReorg{
+			Type:           "reorg",
+			AncestorNumber: hexutil.Uint64(ancestor.Number.Uint64()),
+			AncestorHash:   ancestor.Hash(),
+		})
+		if err != nil {
+			return last, err
+		}
+		for _, header := range dropped {
+			if err := deliver(header, true); err != nil {
+				return last, err
+			}
+		}
+	}
+	for i := len(added) - 1; i >= 0; i-- {
+		if err := deliver(added[i], false); err != nil {
+			return last, err
+		}
+	}
+	return head, nil
+}
+
+// reorgHeaders returns the headers dropped from and added to the chain when moving
+// its head from oldh to newh, both ordered from the head down, along with their
+// common ancestor. The ancestor is nil if the chains can't be traced back to it.
+func reorgHeaders(db ethdb.Database, oldh, newh *types.Header) (dropped, added []*types.Header, ancestor *types.Header) {
+	for oldh.Hash() != newh.Hash() {
+		if oldh.Number.Uint64() >= newh.Number.Uint64() {
+			dropped = append(dropped, oldh)
+			if oldh = core.GetHeader(db, oldh.ParentHash, oldh.Number.Uint64()-1); oldh == nil {
+				return nil, nil, nil
+			}
+		}
+		if oldh.Number.Uint64() < newh.Number.Uint64() {
+			added = append(added, newh)
+			if newh = core.GetHeader(db, newh.ParentHash, newh.Number.Uint64()-1); newh == nil {
+				return nil, nil, nil
+			}
+		}
+	}
+	return dropped, added, oldh
+}
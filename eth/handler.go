@@ -798,16 +798,23 @@ func (self *ProtocolManager) NodeInfo() *NodeInfo {
 }
 
 func (self *ProtocolManager) FindPeers(targets map[common.Address]bool) map[common.Address]consensus.Peer {
+	m := make(map[common.Address]consensus.Peer)
+	for addr, p := range self.Peers() {
+		if targets[addr] {
+			m[addr] = p
+		}
+	}
+	return m
+}
+
+func (self *ProtocolManager) Peers() map[common.Address]consensus.Peer {
 	m := make(map[common.Address]consensus.Peer)
 	for _, p := range self.peers.Peers() {
 		pubKey, err := p.ID().Pubkey()
 		if err != nil {
 			continue
 		}
-		addr := crypto.PubkeyToAddress(*pubKey)
-		if targets[addr] {
-			m[addr] = p
-		}
+		m[crypto.PubkeyToAddress(*pubKey)] = p
 	}
 	return m
 }
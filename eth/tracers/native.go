@@ -0,0 +1,89 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// NativeTracer is a transaction tracer implemented in Go, running orders of
+// magnitude faster than the JavaScript tracers interpreted by duktape.
+type NativeTracer interface {
+	vm.Tracer
+
+	// GetResult returns the json encoded result of the trace, or the error that
+	// occurred during tracing.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates execution of the tracer at the first opportune moment.
+	Stop(err error)
+}
+
+var (
+	natives     = make(map[string]func() NativeTracer) // Constructors of the native tracers by name
+	nativesLock sync.RWMutex
+)
+
+// init registers the native tracers included in go-ethereum.
+func init() {
+	RegisterNative("callTracer", newCallTracer)
+	RegisterNative("prestateTracer", newPrestateTracer)
+}
+
+// RegisterNative makes a native tracer available under the given name, replacing
+// any previous one. Native tracers take precedence over the JavaScript tracers of
+// the same name when looked up by the tracing APIs.
+func RegisterNative(name string, ctor func() NativeTracer) {
+	nativesLock.Lock()
+	defer nativesLock.Unlock()
+
+	natives[name] = ctor
+}
+
+// NewNative creates a native tracer by name, returning false if no such tracer
+// is registered.
+func NewNative(name string) (NativeTracer, bool) {
+	nativesLock.RLock()
+	ctor, ok := natives[name]
+	nativesLock.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+	return ctor(), true
+}
+
+// interrupter implements the stopping of native tracers.
+type interrupter struct {
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (i *interrupter) Stop(err error) {
+	i.reason = err
+	atomic.StoreUint32(&i.interrupt, 1)
+}
+
+// interrupted returns whether the tracer got stopped.
+func (i *interrupter) interrupted() bool {
+	return atomic.LoadUint32(&i.interrupt) > 0
+}
@@ -18,6 +18,7 @@ package tracers
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"path/filepath"
@@ -192,3 +193,161 @@ func TestCallTracer(t *testing.T) {
 		})
 	}
 }
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the native call tracer against them.
+func TestNativeCallTracer(t *testing.T) {
+	forEachCallTracerTest(t, func(t *testing.T, test *callTracerTest) {
+		tracer, ok := NewNative("callTracer")
+		if !ok {
+			t.Fatalf("native call tracer missing")
+		}
+		res, err := runCallTracerTest(test, tracer)
+		if err != nil {
+			t.Fatalf("failed to retrieve trace result: %v", err)
+		}
+		ret := new(callTrace)
+		if err := json.Unmarshal(res, ret); err != nil {
+			t.Fatalf("failed to unmarshal trace result: %v", err)
+		}
+		if !reflect.DeepEqual(ret, test.Result) {
+			t.Fatalf("trace mismatch: have %+v, want %+v", ret, test.Result)
+		}
+	})
+}
+
+// Tests that the native tracers produce the same results as the JavaScript ones
+// on all the datasets in the tracer test harness.
+func TestNativeTracersMatchJavaScript(t *testing.T) {
+	for _, name := range []string{"callTracer", "prestateTracer"} {
+		name := name // capture range variable
+		t.Run(name, func(t *testing.T) {
+			forEachCallTracerTest(t, func(t *testing.T, test *callTracerTest) {
+				js, err := New(name)
+				if err != nil {
+					t.Fatalf("failed to create %s: %v", name, err)
+				}
+				native, ok := NewNative(name)
+				if !ok {
+					t.Fatalf("native %s missing", name)
+				}
+				var results [2]interface{}
+				for i, tracer := range []resultTracer{js, native} {
+					res, err := runCallTracerTest(test, tracer)
+					if err != nil {
+						t.Fatalf("%s run %d failed: %v", name, i, err)
+					}
+					if err := json.Unmarshal(res, &results[i]); err != nil {
+						t.Fatalf("%s run %d: failed to unmarshal trace result: %v", name, i, err)
+					}
+					// Execution times differ between the runs
+					if call, ok := results[i].(map[string]interface{}); ok {
+						delete(call, "time")
+					}
+				}
+				if !reflect.DeepEqual(results[0], results[1]) {
+					t.Fatalf("%s trace mismatch: have %+v, want %+v", name, results[1], results[0])
+				}
+			})
+		})
+	}
+}
+
+// resultTracer is the interface shared by the JavaScript and native tracers.
+type resultTracer interface {
+	vm.Tracer
+	GetResult() (json.RawMessage, error)
+}
+
+// forEachCallTracerTest loads the call tracer datasets in the tracer test harness
+// and runs the given function against each of them.
+func forEachCallTracerTest(t *testing.T, fn func(t *testing.T, test *callTracerTest)) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+			t.Parallel()
+
+			// Call tracer test found, read if from disk
+			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+			if err != nil {
+				t.Fatalf("failed to read testcase: %v", err)
+			}
+			test := new(callTracerTest)
+			if err := json.Unmarshal(blob, test); err != nil {
+				t.Fatalf("failed to parse testcase: %v", err)
+			}
+			fn(t, test)
+		})
+	}
+}
+
+// runCallTracerTest executes the transaction of a call tracer dataset on top of
+// its prestate with the given tracer, returning the trace result.
+func runCallTracerTest(test *callTracerTest, tracer resultTracer) (json.RawMessage, error) {
+	// Configure a blockchain with the given prestate
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		return nil, fmt.Errorf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+		GasPrice:    tx.GasPrice(),
+	}
+	db, _ := ethdb.NewMemDatabase()
+	statedb := tests.MakePreState(db, test.Genesis.Alloc)
+
+	// Create the EVM environment and run the transaction
+	evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		return nil, fmt.Errorf("failed to execute transaction: %v", err)
+	}
+	return tracer.GetResult()
+}
+
+// Tests that custom native tracers can be registered and take precedence over
+// the JavaScript tracers of the same name.
+func TestRegisterNative(t *testing.T) {
+	if _, ok := NewNative("noopTracer"); ok {
+		t.Fatalf("unregistered native tracer found")
+	}
+	RegisterNative("noopTracer", newCallTracer)
+	defer func() {
+		nativesLock.Lock()
+		delete(natives, "noopTracer")
+		nativesLock.Unlock()
+	}()
+
+	tracer, ok := NewNative("noopTracer")
+	if !ok {
+		t.Fatalf("registered native tracer missing")
+	}
+	if _, ok := tracer.(*callTracer); !ok {
+		t.Fatalf("native tracer type mismatch: have %T, want %T", tracer, new(callTracer))
+	}
+	if other, _ := NewNative("noopTracer"); other == tracer {
+		t.Fatalf("native tracer instance reused")
+	}
+}
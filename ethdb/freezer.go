@@ -0,0 +1,226 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// errUnknownTable is returned if the user attempts to access an unknown
+	// freezer table.
+	errUnknownTable = errors.New("unknown table")
+
+	// errMissingItem is returned if an append operation doesn't provide an item
+	// for every freezer table.
+	errMissingItem = errors.New("missing item")
+)
+
+// Freezer is an ancient store made of append-only flat file tables, one for each
+// kind of immutable chain data. All the tables hold the same number of items.
+type Freezer struct {
+	frozen uint64 // Number of items in every table (atomic, first for alignment)
+
+	tables map[string]*freezerTable
+	lock   sync.Mutex // Mutex serializing the write operations
+}
+
+// NewFreezer opens the ancient store in the given directory, with a table for
+// each of the given kinds, mapped to whether its items are compressed. Tables
+// left with different lengths by a crash are truncated to the shortest one.
+func NewFreezer(datadir string, tables map[string]bool) (*Freezer, error) {
+	freezer := &Freezer{
+		tables: make(map[string]*freezerTable),
+	}
+	for name, compress := range tables {
+		table, err := newTable(datadir, name, compress)
+		if err != nil {
+			freezer.Close()
+			return nil, err
+		}
+		freezer.tables[name] = table
+	}
+	frozen := uint64(0)
+	for i, table := range freezer.values() {
+		if items := table.Items(); i == 0 || items < frozen {
+			frozen = items
+		}
+	}
+	if err := freezer.truncate(frozen); err != nil {
+		freezer.Close()
+		return nil, err
+	}
+	log.Info("Opened ancient database", "database", datadir, "items", frozen)
+	return freezer, nil
+}
+
+// values returns the tables of the freezer.
+func (f *Freezer) values() []*freezerTable {
+	tables := make([]*freezerTable, 0, len(f.tables))
+	for _, table := range f.tables {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// HasAncient implements AncientReader, returning whether an ancient item of the
+// given kind exists.
+func (f *Freezer) HasAncient(kind string, number uint64) (bool, error) {
+	if _, ok := f.tables[kind]; !ok {
+		return false, errUnknownTable
+	}
+	return number < atomic.LoadUint64(&f.frozen), nil
+}
+
+// Ancient implements AncientReader, retrieving an ancient item of the given kind.
+func (f *Freezer) Ancient(kind string, number uint64) ([]byte, error) {
+	table, ok := f.tables[kind]
+	if !ok {
+		return nil, errUnknownTable
+	}
+	return table.Retrieve(number)
+}
+
+// Ancients implements AncientReader, returning the number of items in the store.
+func (f *Freezer) Ancients() (uint64, error) {
+	return atomic.LoadUint64(&f.frozen), nil
+}
+
+// AncientSize implements AncientReader, returning the size of the table of the
+// given kind on disk.
+func (f *Freezer) AncientSize(kind string) (uint64, error) {
+	table, ok := f.tables[kind]
+	if !ok {
+		return 0, errUnknownTable
+	}
+	return table.Size()
+}
+
+// AppendAncient implements AncientWriter, injecting the items of every table at
+// the given number. If any of them fails, the tables are reverted to the previous
+// length.
+func (f *Freezer) AppendAncient(number uint64, items map[string][]byte) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if number != atomic.LoadUint64(&f.frozen) {
+		return errOutOrderInsertion
+	}
+	if len(items) != len(f.tables) {
+		return errMissingItem
+	}
+	defer func() {
+		if err != nil {
+			if terr := f.truncate(number); terr != nil {
+				log.Error("Failed to revert ancient append", "number", number, "err", terr)
+			}
+		}
+	}()
+	for kind, item := range items {
+		table, ok := f.tables[kind]
+		if !ok {
+			return fmt.Errorf("%v: %s", errUnknownTable, kind)
+		}
+		if err := table.Append(number, item); err != nil {
+			return err
+		}
+	}
+	atomic.AddUint64(&f.frozen, 1)
+	return nil
+}
+
+// TruncateAncients implements AncientWriter, discarding every ancient item
+// numbered items or above.
+func (f *Freezer) TruncateAncients(items uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if atomic.LoadUint64(&f.frozen) <= items {
+		return nil
+	}
+	return f.truncate(items)
+}
+
+// truncate shortens every table to the given number of items.
+func (f *Freezer) truncate(items uint64) error {
+	for _, table := range f.tables {
+		if err := table.truncate(items); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.frozen, items)
+	return nil
+}
+
+// Sync implements AncientWriter, flushing all the tables to disk.
+func (f *Freezer) Sync() error {
+	for _, table := range f.tables {
+		if err := table.Sync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all the tables of the freezer.
+func (f *Freezer) Close() error {
+	var errs []error
+	for _, table := range f.tables {
+		if err := table.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// freezerdb is a database holding the recent chain data in a key-value store,
+// and the immutable one in an ancient store.
+type freezerdb struct {
+	Database
+	*Freezer
+}
+
+// NewDatabaseWithFreezer creates a database backed by the given key-value store
+// for the recent chain data, and the given ancient store for the immutable one.
+func NewDatabaseWithFreezer(db Database, freezer *Freezer) Database {
+	return &freezerdb{Database: db, Freezer: freezer}
+}
+
+// Close closes both the key-value store and the ancient store.
+func (db *freezerdb) Close() {
+	if err := db.Freezer.Close(); err != nil {
+		log.Error("Failed to close ancient database", "err", err)
+	}
+	db.Database.Close()
+}
+
+// KeyValueStore returns the key-value store of a database, unwrapping the ones
+// backed by an ancient store.
+func KeyValueStore(db Database) Database {
+	if fdb, ok := db.(*freezerdb); ok {
+		return fdb.Database
+	}
+	return db
+}
@@ -0,0 +1,434 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/golang/snappy"
+)
+
+var (
+	// errClosed is returned if an operation attempts to use a closed freezer table.
+	errClosed = errors.New("closed")
+
+	// errOutOfBounds is returned if the item requested is not contained within
+	// the freezer table.
+	errOutOfBounds = errors.New("out of bounds")
+
+	// errOutOrderInsertion is returned if the user attempts to append an item
+	// which isn't the next one in the freezer table.
+	errOutOrderInsertion = errors.New("the append operation is out-order")
+)
+
+// freezerTableSize defines the maximum size of a freezer data file.
+const freezerTableSize = 2 * 1000 * 1000 * 1000
+
+// indexEntrySize is the size of an index entry: a 2 byte data file number and a
+// 4 byte offset within that file.
+const indexEntrySize = 6
+
+// indexEntry points to the end of an item within the data files of a table.
+type indexEntry struct {
+	filenum uint16 // data file number
+	offset  uint32 // end of the item within the data file
+}
+
+// unmarshalBinary deserializes an index entry.
+func (e *indexEntry) unmarshalBinary(b []byte) {
+	e.filenum = binary.BigEndian.Uint16(b[:2])
+	e.offset = binary.BigEndian.Uint32(b[2:6])
+}
+
+// marshallBinary serializes an index entry.
+func (e *indexEntry) marshallBinary() []byte {
+	b := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint16(b[:2], e.filenum)
+	binary.BigEndian.PutUint32(b[2:6], e.offset)
+	return b
+}
+
+// freezerTable is an append-only flat file store of a single kind of chain data,
+// indexed by item number. Its content is split among data files of bounded size,
+// with an index file holding the end position of every item. The first index
+// entry is a sentinel marking the start of the first item.
+type freezerTable struct {
+	items uint64 // Number of items stored in the table (atomic, first for alignment)
+
+	name        string // Name of the table, prefix of its files
+	path        string // Directory containing the files of the table
+	compress    bool   // Whether the items are snappy compressed
+	maxFileSize uint32 // Maximum size of a data file before starting a new one
+
+	index     *os.File            // File holding the index entries
+	files     map[uint16]*os.File // Open data files, keyed by number
+	head      *os.File            // Data file being appended to
+	headId    uint16              // Number of the head data file
+	headBytes uint32              // Number of bytes written to the head data file
+
+	lock   sync.RWMutex // Mutex protecting the files from concurrent access
+	logger log.Logger
+}
+
+// newTable opens a freezer table, creating it if needed and repairing any
+// inconsistency between the index and the data files left by a crash.
+func newTable(path string, name string, compress bool) (*freezerTable, error) {
+	return newCustomTable(path, name, compress, freezerTableSize)
+}
+
+// newCustomTable opens a freezer table with a custom maximum data file size.
+func newCustomTable(path string, name string, compress bool, maxFileSize uint32) (*freezerTable, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	// Keep using the format of an existing table, the items can't be recoded
+	for _, ext := range []string{"ridx", "cidx"} {
+		if _, err := os.Stat(filepath.Join(path, fmt.Sprintf("%s.%s", name, ext))); err == nil {
+			if existing := ext == "cidx"; existing != compress {
+				log.Warn("Ignoring freezer table compression setting", "table", name, "compressed", existing)
+				compress = existing
+			}
+			break
+		}
+	}
+	idxName := fmt.Sprintf("%s.ridx", name)
+	if compress {
+		idxName = fmt.Sprintf("%s.cidx", name)
+	}
+	index, err := os.OpenFile(filepath.Join(path, idxName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	tab := &freezerTable{
+		name:        name,
+		path:        path,
+		compress:    compress,
+		maxFileSize: maxFileSize,
+		index:       index,
+		files:       make(map[uint16]*os.File),
+		logger:      log.New("table", name),
+	}
+	if err := tab.repair(); err != nil {
+		tab.Close()
+		return nil, err
+	}
+	return tab, nil
+}
+
+// fileName returns the name of a data file of the table.
+func (t *freezerTable) fileName(num uint16) string {
+	if t.compress {
+		return filepath.Join(t.path, fmt.Sprintf("%s.%04d.cdat", t.name, num))
+	}
+	return filepath.Join(t.path, fmt.Sprintf("%s.%04d.rdat", t.name, num))
+}
+
+// openFile opens a data file of the table, caching the handle.
+func (t *freezerTable) openFile(num uint16, flag int) (*os.File, error) {
+	if f, ok := t.files[num]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(t.fileName(num), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	t.files[num] = f
+	return f, nil
+}
+
+// releaseFilesAfter closes and deletes the data files numbered above num.
+func (t *freezerTable) releaseFilesAfter(num uint16) {
+	for fnum, f := range t.files {
+		if fnum > num {
+			delete(t.files, fnum)
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+}
+
+// readEntry reads the index entry at the given position.
+func (t *freezerTable) readEntry(pos uint64) (indexEntry, error) {
+	var (
+		entry indexEntry
+		buf   = make([]byte, indexEntrySize)
+	)
+	if _, err := t.index.ReadAt(buf, int64(pos*indexEntrySize)); err != nil {
+		return entry, err
+	}
+	entry.unmarshalBinary(buf)
+	return entry, nil
+}
+
+// repair cross checks the index and the head data file, truncating them to the
+// last item fully contained in both.
+func (t *freezerTable) repair() error {
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	// Create the sentinel of a new index, and drop any partially written entry
+	if stat.Size() == 0 {
+		if _, err := t.index.Write((&indexEntry{}).marshallBinary()); err != nil {
+			return err
+		}
+		stat, err = t.index.Stat()
+		if err != nil {
+			return err
+		}
+	}
+	size := stat.Size() / indexEntrySize * indexEntrySize
+	if size != stat.Size() {
+		if err := t.index.Truncate(size); err != nil {
+			return err
+		}
+	}
+	// Shrink the index until its last entry fits in the data files
+	for {
+		last, err := t.readEntry(uint64(size/indexEntrySize - 1))
+		if err != nil {
+			return err
+		}
+		head, err := t.openFile(last.filenum, os.O_RDWR|os.O_CREATE)
+		if err != nil {
+			return err
+		}
+		stat, err := head.Stat()
+		if err != nil {
+			return err
+		}
+		if stat.Size() < int64(last.offset) {
+			if size == indexEntrySize {
+				return fmt.Errorf("freezer table %s: missing data file %d", t.name, last.filenum)
+			}
+			t.logger.Warn("Truncating dangling index entry", "items", size/indexEntrySize-1)
+			size -= indexEntrySize
+			if err := t.index.Truncate(size); err != nil {
+				return err
+			}
+			continue
+		}
+		if stat.Size() > int64(last.offset) {
+			t.logger.Warn("Truncating dangling data", "file", last.filenum, "size", stat.Size(), "indexed", last.offset)
+			if err := head.Truncate(int64(last.offset)); err != nil {
+				return err
+			}
+		}
+		t.releaseFilesAfter(last.filenum)
+		t.head, t.headId, t.headBytes = head, last.filenum, last.offset
+		break
+	}
+	for num := uint16(0); num < t.headId; num++ {
+		if _, err := t.openFile(num, os.O_RDWR); err != nil {
+			return err
+		}
+	}
+	if _, err := t.index.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := t.head.Seek(int64(t.headBytes), io.SeekStart); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&t.items, uint64(size/indexEntrySize-1))
+	return nil
+}
+
+// Items returns the number of items stored in the table.
+func (t *freezerTable) Items() uint64 {
+	return atomic.LoadUint64(&t.items)
+}
+
+// Size returns the total size of the index and data files of the table.
+func (t *freezerTable) Size() (uint64, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return 0, errClosed
+	}
+	files := []*os.File{t.index}
+	for _, f := range t.files {
+		files = append(files, f)
+	}
+	var size uint64
+	for _, f := range files {
+		stat, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		size += uint64(stat.Size())
+	}
+	return size, nil
+}
+
+// Append injects a binary blob at the end of the table. The item number must be
+// the next one in the table.
+func (t *freezerTable) Append(item uint64, blob []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if item != atomic.LoadUint64(&t.items) {
+		return errOutOrderInsertion
+	}
+	if t.compress {
+		blob = snappy.Encode(nil, blob)
+	}
+	// Start a new data file if the item doesn't fit in the head one
+	if t.headBytes > 0 && uint64(t.headBytes)+uint64(len(blob)) > uint64(t.maxFileSize) {
+		head, err := t.openFile(t.headId+1, os.O_RDWR|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		t.head, t.headId, t.headBytes = head, t.headId+1, 0
+	}
+	if _, err := t.head.Write(blob); err != nil {
+		return err
+	}
+	t.headBytes += uint32(len(blob))
+
+	entry := indexEntry{filenum: t.headId, offset: t.headBytes}
+	if _, err := t.index.Write(entry.marshallBinary()); err != nil {
+		return err
+	}
+	atomic.AddUint64(&t.items, 1)
+	return nil
+}
+
+// Retrieve looks up the data at the given item number.
+func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil {
+		return nil, errClosed
+	}
+	if item >= atomic.LoadUint64(&t.items) {
+		return nil, errOutOfBounds
+	}
+	start, err := t.readEntry(item)
+	if err != nil {
+		return nil, err
+	}
+	end, err := t.readEntry(item + 1)
+	if err != nil {
+		return nil, err
+	}
+	// Items starting a new data file are marked by the end of the previous one
+	if start.filenum != end.filenum {
+		start.offset = 0
+	}
+	f, ok := t.files[end.filenum]
+	if !ok {
+		return nil, fmt.Errorf("missing data file %d", end.filenum)
+	}
+	blob := make([]byte, end.offset-start.offset)
+	if _, err := f.ReadAt(blob, int64(start.offset)); err != nil {
+		return nil, err
+	}
+	if t.compress {
+		return snappy.Decode(nil, blob)
+	}
+	return blob, nil
+}
+
+// truncate discards every item numbered items or above.
+func (t *freezerTable) truncate(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if atomic.LoadUint64(&t.items) <= items {
+		return nil
+	}
+	t.logger.Warn("Truncating freezer table", "items", t.items, "limit", items)
+
+	last, err := t.readEntry(items)
+	if err != nil {
+		return err
+	}
+	if err := t.index.Truncate(int64(items+1) * indexEntrySize); err != nil {
+		return err
+	}
+	if _, err := t.index.Seek(int64(items+1)*indexEntrySize, io.SeekStart); err != nil {
+		return err
+	}
+	if last.filenum != t.headId {
+		t.releaseFilesAfter(last.filenum)
+		t.head, t.headId = t.files[last.filenum], last.filenum
+	}
+	if err := t.head.Truncate(int64(last.offset)); err != nil {
+		return err
+	}
+	if _, err := t.head.Seek(int64(last.offset), io.SeekStart); err != nil {
+		return err
+	}
+	t.headBytes = last.offset
+	atomic.StoreUint64(&t.items, items)
+	return nil
+}
+
+// Sync pushes any pending data from memory out to disk.
+func (t *freezerTable) Sync() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	if err := t.index.Sync(); err != nil {
+		return err
+	}
+	return t.head.Sync()
+}
+
+// Close closes all the files of the table.
+func (t *freezerTable) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var errs []error
+	if t.index != nil {
+		if err := t.index.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.index = nil
+	}
+	for num, f := range t.files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(t.files, num)
+	}
+	t.head = nil
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// freezerItem returns a test item of varying length.
+func freezerItem(i uint64) []byte {
+	return bytes.Repeat([]byte{byte(i)}, int(i%7)+10)
+}
+
+// Tests that items can be appended to and retrieved from a table spanning many
+// data files, both compressed and raw.
+func TestFreezerTableAppendRetrieve(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "freezer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		table, err := newCustomTable(dir, "test", compress, 50)
+		if err != nil {
+			t.Fatalf("compress %v: failed to open table: %v", compress, err)
+		}
+		for i := uint64(0); i < 100; i++ {
+			if err := table.Append(i, freezerItem(i)); err != nil {
+				t.Fatalf("compress %v: failed to append item %d: %v", compress, i, err)
+			}
+		}
+		if err := table.Append(200, freezerItem(200)); err != errOutOrderInsertion {
+			t.Errorf("compress %v: out of order append error mismatch: have %v, want %v", compress, err, errOutOrderInsertion)
+		}
+		// Reopen the table and check the items
+		table.Close()
+		if table, err = newCustomTable(dir, "test", compress, 50); err != nil {
+			t.Fatalf("compress %v: failed to reopen table: %v", compress, err)
+		}
+		if items := table.Items(); items != 100 {
+			t.Fatalf("compress %v: item count mismatch: have %d, want %d", compress, items, 100)
+		}
+		for i := uint64(0); i < 100; i++ {
+			blob, err := table.Retrieve(i)
+			if err != nil {
+				t.Fatalf("compress %v: failed to retrieve item %d: %v", compress, i, err)
+			}
+			if !bytes.Equal(blob, freezerItem(i)) {
+				t.Errorf("compress %v: item %d mismatch: have %x, want %x", compress, i, blob, freezerItem(i))
+			}
+		}
+		if _, err := table.Retrieve(100); err != errOutOfBounds {
+			t.Errorf("compress %v: out of bounds error mismatch: have %v, want %v", compress, err, errOutOfBounds)
+		}
+		table.Close()
+	}
+}
+
+// Tests that truncating a table discards the data files past the new end, and
+// that appending resumes from there.
+func TestFreezerTableTruncate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newCustomTable(dir, "test", false, 50)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	defer table.Close()
+
+	for i := uint64(0); i < 30; i++ {
+		table.Append(i, freezerItem(i))
+	}
+	if err := table.truncate(5); err != nil {
+		t.Fatalf("failed to truncate table: %v", err)
+	}
+	if items := table.Items(); items != 5 {
+		t.Fatalf("item count mismatch: have %d, want %d", items, 5)
+	}
+	if _, err := os.Stat(table.fileName(table.headId + 1)); !os.IsNotExist(err) {
+		t.Errorf("data file past the head not deleted: %v", err)
+	}
+	for i := uint64(5); i < 10; i++ {
+		if err := table.Append(i, freezerItem(i+1)); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	for i := uint64(0); i < 10; i++ {
+		want := freezerItem(i)
+		if i >= 5 {
+			want = freezerItem(i + 1)
+		}
+		if blob, _ := table.Retrieve(i); !bytes.Equal(blob, want) {
+			t.Errorf("item %d mismatch: have %x, want %x", i, blob, want)
+		}
+	}
+}
+
+// Tests that a table left inconsistent by a crash is repaired on opening.
+func TestFreezerTableRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	table, err := newCustomTable(dir, "test", false, 1000)
+	if err != nil {
+		t.Fatalf("failed to open table: %v", err)
+	}
+	for i := uint64(0); i < 10; i++ {
+		table.Append(i, freezerItem(i))
+	}
+	table.Close()
+
+	// Cut the last item short, and leave a partial index entry behind
+	data := filepath.Join(dir, "test.0000.rdat")
+	stat, _ := os.Stat(data)
+	os.Truncate(data, stat.Size()-3)
+
+	index, _ := os.OpenFile(filepath.Join(dir, "test.ridx"), os.O_APPEND|os.O_WRONLY, 0644)
+	index.Write([]byte{0x00, 0x01})
+	index.Close()
+
+	if table, err = newCustomTable(dir, "test", false, 1000); err != nil {
+		t.Fatalf("failed to reopen table: %v", err)
+	}
+	defer table.Close()
+
+	if items := table.Items(); items != 9 {
+		t.Fatalf("item count mismatch: have %d, want %d", items, 9)
+	}
+	if err := table.Append(9, freezerItem(9)); err != nil {
+		t.Fatalf("failed to append after repair: %v", err)
+	}
+	if blob, _ := table.Retrieve(9); !bytes.Equal(blob, freezerItem(9)) {
+		t.Errorf("item mismatch: have %x, want %x", blob, freezerItem(9))
+	}
+}
+
+// Tests that the tables of a freezer left with different lengths are truncated to
+// the shortest one.
+func TestFreezerRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tables := map[string]bool{"a": false, "b": true}
+	freezer, err := NewFreezer(dir, tables)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	for i := uint64(0); i < 5; i++ {
+		if err := freezer.AppendAncient(i, map[string][]byte{"a": freezerItem(i), "b": freezerItem(i)}); err != nil {
+			t.Fatalf("failed to append item %d: %v", i, err)
+		}
+	}
+	if err := freezer.AppendAncient(5, map[string][]byte{"a": freezerItem(5)}); err != errMissingItem {
+		t.Errorf("partial append error mismatch: have %v, want %v", err, errMissingItem)
+	}
+	// Simulate a crash in the middle of an append
+	freezer.tables["a"].Append(5, freezerItem(5))
+	freezer.Close()
+
+	if freezer, err = NewFreezer(dir, tables); err != nil {
+		t.Fatalf("failed to reopen freezer: %v", err)
+	}
+	defer freezer.Close()
+
+	if frozen, _ := freezer.Ancients(); frozen != 5 {
+		t.Fatalf("item count mismatch: have %d, want %d", frozen, 5)
+	}
+	for _, kind := range []string{"a", "b"} {
+		if items := freezer.tables[kind].Items(); items != 5 {
+			t.Errorf("table %s: item count mismatch: have %d, want %d", kind, items, 5)
+		}
+		if blob, _ := freezer.Ancient(kind, 4); !bytes.Equal(blob, freezerItem(4)) {
+			t.Errorf("table %s: item mismatch: have %x, want %x", kind, blob, freezerItem(4))
+		}
+	}
+	if _, err := freezer.Ancient("c", 0); err != errUnknownTable {
+		t.Errorf("unknown table error mismatch: have %v, want %v", err, errUnknownTable)
+	}
+}
@@ -44,3 +44,39 @@ type Batch interface {
 	// Reset resets the batch for reuse
 	Reset()
 }
+
+// AncientReader wraps the read operations of an append-only store of immutable
+// chain data, indexed by block number.
+type AncientReader interface {
+	// HasAncient returns whether an ancient item of the given kind exists.
+	HasAncient(kind string, number uint64) (bool, error)
+
+	// Ancient retrieves an ancient item of the given kind.
+	Ancient(kind string, number uint64) ([]byte, error)
+
+	// Ancients returns the number of items in the ancient store.
+	Ancients() (uint64, error)
+
+	// AncientSize returns the size of the ancient items of the given kind on disk.
+	AncientSize(kind string) (uint64, error)
+}
+
+// AncientWriter wraps the write operations of an append-only store of immutable
+// chain data.
+type AncientWriter interface {
+	// AppendAncient injects the items of every kind at the given number, which
+	// must be the next one in the ancient store.
+	AppendAncient(number uint64, items map[string][]byte) error
+
+	// TruncateAncients discards every ancient item numbered items or above.
+	TruncateAncients(items uint64) error
+
+	// Sync flushes the ancient items to disk.
+	Sync() error
+}
+
+// AncientStore is implemented by the databases backed by an ancient store.
+type AncientStore interface {
+	AncientReader
+	AncientWriter
+}
@@ -124,6 +124,21 @@ web3._extend({
 			call: 'admin_removePeer',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'setTxPolicies',
+			call: 'admin_setTxPolicies',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'addTxPolicy',
+			call: 'admin_addTxPolicy',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'removeTxPolicy',
+			call: 'admin_removeTxPolicy',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'exportChain',
 			call: 'admin_exportChain',
@@ -217,6 +232,10 @@ web3._extend({
 			name: 'chaindbCompact',
 			call: 'debug_chaindbCompact',
 		}),
+		new web3._extend.Method({
+			name: 'chaindbInspect',
+			call: 'debug_chaindbInspect',
+		}),
 		new web3._extend.Method({
 			name: 'metrics',
 			call: 'debug_metrics',
@@ -369,6 +388,11 @@ web3._extend({
 			call: 'debug_getBadBlocks',
 			params: 0,
 		}),
+		new web3._extend.Method({
+			name: 'blockStats',
+			call: 'debug_blockStats',
+			params: 0,
+		}),
 		new web3._extend.Method({
 			name: 'storageRangeAt',
 			call: 'debug_storageRangeAt',
@@ -424,6 +448,18 @@ web3._extend({
 			call: 'eth_getRawTransactionByHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getLogsPaged',
+			call: 'eth_getLogsPaged',
+			params: 2,
+			inputFormatter: [null, null]
+		}),
+		new web3._extend.Method({
+			name: 'getProof',
+			call: 'eth_getProof',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, null, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 		new web3._extend.Method({
 			name: 'getRawTransactionFromBlock',
 			call: function(args) {
@@ -616,6 +652,10 @@ web3._extend({
 			name: 'content',
 			getter: 'txpool_content'
 		}),
+		new web3._extend.Property({
+			name: 'policies',
+			getter: 'txpool_policies'
+		}),
 		new web3._extend.Property({
 			name: 'inspect',
 			getter: 'txpool_inspect'
@@ -669,6 +709,12 @@ web3._extend({
 			name: 'discard',
 			call: 'istanbul_discard',
 			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getEvidence',
+			call: 'istanbul_getEvidence',
+			params: 1,
+			inputFormatter: [null]
 		})
 	],
 	properties:
@@ -677,6 +723,10 @@ web3._extend({
 			name: 'candidates',
 			getter: 'istanbul_candidates'
 		}),
+		new web3._extend.Property({
+			name: 'status',
+			getter: 'istanbul_status'
+		}),
 	]
 });
 `
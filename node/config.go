@@ -30,6 +30,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/bls"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/discover"
@@ -37,6 +38,7 @@ import (
 
 const (
 	datadirPrivateKey      = "nodekey"            // Path within the datadir to the node's private key
+	datadirBLSKey          = "blskey"             // Path within the datadir to the node's BLS secret key
 	datadirDefaultKeyStore = "keystore"           // Path within the datadir to the keystore
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
@@ -330,6 +332,39 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
+// BLSKey retrieves the BLS secret key the node signs consensus messages with, or
+// generates a new one, kept separately from the node key.
+func (c *Config) BLSKey() *bls.SecretKey {
+	// Generate ephemeral key if no datadir is being used.
+	if c.DataDir == "" {
+		key, err := bls.GenerateKey()
+		if err != nil {
+			log.Crit(fmt.Sprintf("Failed to generate ephemeral BLS key: %v", err))
+		}
+		return key
+	}
+
+	keyfile := c.resolvePath(datadirBLSKey)
+	if key, err := bls.LoadKey(keyfile); err == nil {
+		return key
+	}
+	// No persistent key found, generate and store a new one.
+	key, err := bls.GenerateKey()
+	if err != nil {
+		log.Crit(fmt.Sprintf("Failed to generate BLS key: %v", err))
+	}
+	instanceDir := filepath.Join(c.DataDir, c.name())
+	if err := os.MkdirAll(instanceDir, 0700); err != nil {
+		log.Error(fmt.Sprintf("Failed to persist BLS key: %v", err))
+		return key
+	}
+	keyfile = filepath.Join(instanceDir, datadirBLSKey)
+	if err := bls.SaveKey(keyfile, key); err != nil {
+		log.Error(fmt.Sprintf("Failed to persist BLS key: %v", err))
+	}
+	return key
+}
+
 // StaticNodes returns a list of node enode URLs configured as static nodes.
 func (c *Config) StaticNodes() []*discover.Node {
 	return c.parsePersistentNodes(c.resolvePath(datadirStaticNodes))
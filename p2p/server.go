@@ -300,6 +300,19 @@ func (srv *Server) RemovePeer(node *discover.Node) {
 	}
 }
 
+// Resolve searches for a specific node with the given ID through the discovery
+// table, returning nil if the node can't be found or discovery is disabled.
+func (srv *Server) Resolve(id discover.NodeID) *discover.Node {
+	srv.lock.Lock()
+	ntab := srv.ntab
+	srv.lock.Unlock()
+
+	if ntab == nil {
+		return nil
+	}
+	return ntab.Resolve(id)
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -166,6 +166,15 @@ func (c *CliqueConfig) String() string {
 type IstanbulConfig struct {
 	Epoch          uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
 	ProposerPolicy uint64 `json:"policy"` // The policy for proposer selection
+
+	RequestTimeout        uint64 `json:"requestTimeout,omitempty"`        // Round timeout in milliseconds, overrides the local setting
+	CommitTimeout         uint64 `json:"commitTimeout,omitempty"`         // Commit timeout in milliseconds, overrides the local setting
+	RoundTimeoutIncrement uint64 `json:"roundTimeoutIncrement,omitempty"` // Per round timeout increment in milliseconds, overrides the local setting
+	MaxRoundTimeout       uint64 `json:"maxRoundTimeout,omitempty"`       // Maximum round timeout in milliseconds, overrides the local setting
+
+	ValidatorContract *common.Address `json:"validatorContract,omitempty"` // Governance contract to read the validator set from at every epoch (nil = header votes)
+
+	BLSBlock *big.Int `json:"blsBlock,omitempty"` // Switch to aggregated BLS committed seals (nil = no fork, 0 = already switched)
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -173,6 +182,11 @@ func (c *IstanbulConfig) String() string {
 	return "istanbul"
 }
 
+// IsBLS returns whether num is either equal to the BLS committed seals fork block or greater.
+func (c *IstanbulConfig) IsBLS(num *big.Int) bool {
+	return isForked(c.BLSBlock, num)
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -293,6 +307,9 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.ConstantinopleBlock, newcfg.ConstantinopleBlock, head) {
 		return newCompatError("Constantinople fork block", c.ConstantinopleBlock, newcfg.ConstantinopleBlock)
 	}
+	if c.Istanbul != nil && newcfg.Istanbul != nil && isForkIncompatible(c.Istanbul.BLSBlock, newcfg.Istanbul.BLSBlock, head) {
+		return newCompatError("Istanbul BLS fork block", c.Istanbul.BLSBlock, newcfg.Istanbul.BLSBlock)
+	}
 	return nil
 }
 
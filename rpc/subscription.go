@@ -29,6 +29,10 @@ var (
 	ErrSubscriptionNotFound = errors.New("subscription not found")
 )
 
+// maxInactiveNotifications is the number of notifications buffered for a subscription
+// created by CreateBufferedSubscription until it gets active.
+const maxInactiveNotifications = 4096
+
 // ID defines a pseudo random number that is used to identify RPC subscriptions.
 type ID string
 
@@ -37,7 +41,9 @@ type ID string
 type Subscription struct {
 	ID        ID
 	namespace string
-	err       chan error // closed on unsubscribe
+	err       chan error    // closed on unsubscribe
+	buffered  bool          // whether notifications are buffered until the subscription is active
+	buffer    []interface{} // notifications sent before the subscription got active
 }
 
 // Err returns a channel that is closed when the client send an unsubscribe request.
@@ -52,7 +58,7 @@ type notifierKey struct{}
 // Server callbacks use the notifier to send notifications.
 type Notifier struct {
 	codec    ServerCodec
-	subMu    sync.RWMutex // guards active and inactive maps
+	subMu    sync.Mutex // guards active and inactive maps
 	active   map[ID]*Subscription
 	inactive map[ID]*Subscription
 }
@@ -78,7 +84,19 @@ func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
 // are dropped until the subscription is marked as active. This is done
 // by the RPC server after the subscription ID is send to the client.
 func (n *Notifier) CreateSubscription() *Subscription {
-	s := &Subscription{ID: NewID(), err: make(chan error)}
+	return n.createSubscription(false)
+}
+
+// CreateBufferedSubscription is like CreateSubscription, but the notifications
+// sent before the subscription is active are buffered and delivered once it is.
+// When the buffer is full, further notifications are refused with
+// ErrSubscriptionQueueOverflow until the subscription gets active.
+func (n *Notifier) CreateBufferedSubscription() *Subscription {
+	return n.createSubscription(true)
+}
+
+func (n *Notifier) createSubscription(buffered bool) *Subscription {
+	s := &Subscription{ID: NewID(), err: make(chan error), buffered: buffered}
 	n.subMu.Lock()
 	n.inactive[s.ID] = s
 	n.subMu.Unlock()
@@ -88,16 +106,28 @@ func (n *Notifier) CreateSubscription() *Subscription {
 // Notify sends a notification to the client with the given data as payload.
 // If an error occurs the RPC connection is closed and the error is returned.
 func (n *Notifier) Notify(id ID, data interface{}) error {
-	n.subMu.RLock()
-	defer n.subMu.RUnlock()
-
-	sub, active := n.active[id]
-	if active {
-		notification := n.codec.CreateNotification(string(id), sub.namespace, data)
-		if err := n.codec.Write(notification); err != nil {
-			n.codec.Close()
-			return err
+	n.subMu.Lock()
+	defer n.subMu.Unlock()
+
+	if sub, active := n.active[id]; active {
+		return n.send(sub, data)
+	}
+	if sub, inactive := n.inactive[id]; inactive && sub.buffered {
+		if len(sub.buffer) >= maxInactiveNotifications {
+			return ErrSubscriptionQueueOverflow
 		}
+		sub.buffer = append(sub.buffer, data)
+	}
+	return nil
+}
+
+// send writes a notification of an active subscription to the client, closing
+// the connection on failure.
+func (n *Notifier) send(sub *Subscription, data interface{}) error {
+	notification := n.codec.CreateNotification(string(sub.ID), sub.namespace, data)
+	if err := n.codec.Write(notification); err != nil {
+		n.codec.Close()
+		return err
 	}
 	return nil
 }
@@ -121,7 +151,7 @@ func (n *Notifier) unsubscribe(id ID) error {
 }
 
 // activate enables a subscription. Until a subscription is enabled all
-// notifications are dropped. This method is called by the RPC server after
+// notifications are dropped, or buffered if requested. This method is called by the RPC server after
 // the subscription ID was sent to client. This prevents notifications being
 // send to the client before the subscription ID is send to the client.
 func (n *Notifier) activate(id ID, namespace string) {
@@ -131,5 +161,14 @@ func (n *Notifier) activate(id ID, namespace string) {
 		sub.namespace = namespace
 		n.active[id] = sub
 		delete(n.inactive, id)
+
+		// Deliver the notifications sent while inactive
+		buffer := sub.buffer
+		sub.buffer = nil
+		for _, data := range buffer {
+			if n.send(sub, data) != nil {
+				return
+			}
+		}
 	}
 }
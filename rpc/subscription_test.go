@@ -328,3 +328,29 @@ func TestSubscriptionMultipleNamespaces(t *testing.T) {
 		}
 	}
 }
+
+// Tests that only the buffered subscriptions keep the notifications sent while
+// inactive, up to a limit.
+func TestInactiveNotificationBuffer(t *testing.T) {
+	notifier := newNotifier(nil)
+
+	plain := notifier.CreateSubscription()
+	if err := notifier.Notify(plain.ID, 0); err != nil {
+		t.Fatalf("notification of inactive subscription failed: %v", err)
+	}
+	if len(plain.buffer) != 0 {
+		t.Errorf("unbuffered subscription kept %d notifications", len(plain.buffer))
+	}
+	buffered := notifier.CreateBufferedSubscription()
+	for i := 0; i < maxInactiveNotifications; i++ {
+		if err := notifier.Notify(buffered.ID, i); err != nil {
+			t.Fatalf("notification %d failed: %v", i, err)
+		}
+	}
+	if err := notifier.Notify(buffered.ID, maxInactiveNotifications); err != ErrSubscriptionQueueOverflow {
+		t.Errorf("error mismatch: have %v, want %v", err, ErrSubscriptionQueueOverflow)
+	}
+	if len(buffered.buffer) != maxInactiveNotifications {
+		t.Errorf("buffered notification count mismatch: have %d, want %d", len(buffered.buffer), maxInactiveNotifications)
+	}
+}